@@ -0,0 +1,445 @@
+// Player accounts. Playing needs no account, but a player who signs in has their
+// finished games counted against a stable user id instead of a seat number.
+// Passwords are stored as scrypt hashes; signing in returns an account token signed
+// with the server's key, which the player sends to be recognised again. Accounts are
+// kept through an AccountRepository: a JSON file here, or the database (sqlite.cts).
+//
+// Each account decides who may see three things about it, each public (the default),
+// friends (the accounts it lists as friends, and itself) or private (itself only):
+//
+//   profile    its stats page and its place on the leaderboard
+//   history    the record of its past games: games played, wins, losses, accuracy, think
+//              time and shot quality, on its stats page, the leaderboard and its export
+//   liveGames  the games it is playing, in the lobby list and to spectators
+//
+// Friends are one-way: listing someone lets them see what is shared with friends, and
+// nothing more.
+//   TANKS_ACCOUNTS_FILE   JSON file accounts and stats are kept in with file storage; unset
+//                         keeps them in memory
+//   TANKS_ACCOUNT_SECRET  key that signs account tokens; unset picks a random one at startup,
+//                         so every token lapses when the server restarts
+
+import * as fs from 'fs';
+import * as crypto from 'crypto';
+import { ErrorCode, GameError } from './errors.cjs';
+import { DEFAULT_RATING, PLACEMENT_MATCHES, inPlacement, rateGame } from './rating.cjs';
+
+const TOKEN_TTL_MS = 30 * 24 * 60 * 60 * 1000;
+const USERNAME_PATTERN = /^[A-Za-z0-9_-]{3,20}$/;
+const PASSWORD_LENGTH = { min: 8, max: 200 };
+const SCRYPT_KEY_BYTES = 32;
+const MAX_LEADERBOARD_PAGE_SIZE = 100;
+const MAX_FRIENDS = 200;
+const VISIBILITIES: Visibility[] = ['public', 'friends', 'private'];
+const PRIVACY_AREAS: PrivacyArea[] = ['profile', 'history', 'liveGames'];
+const DEFAULT_PRIVACY: Privacy = { profile: 'public', history: 'public', liveGames: 'public', friends: [] };
+const EMPTY_STATS: UserStats = {
+  gamesPlayed: 0, wins: 0, losses: 0, shots: 0, hits: 0, ratedGames: 0, timedMoves: 0, thinkMs: 0, gradedShots: 0, shotQuality: 0
+};
+
+interface UserStats {
+  gamesPlayed: number;
+  wins: number;
+  losses: number;
+  shots: number;  // Cells bombed or struck, special shots included
+  hits: number;
+  ratedGames: number;  // Games against another signed-in player, which move the rating
+  timedMoves: number;  // Bombs, special shots and tank moves
+  thinkMs: number;     // Time taken over them
+  gradedShots: number; // Bombs graded in games with move analysis
+  shotQuality: number; // Sum of their grades, 0-100 each
+}
+
+type Visibility = 'public' | 'friends' | 'private';
+type PrivacyArea = 'profile' | 'history' | 'liveGames';
+
+interface Privacy extends Record<PrivacyArea, Visibility> {
+  friends: string[];  // User ids
+}
+
+interface UserAccount {
+  id: string;
+  name: string;
+  passwordHash: string;  // salt:hash, both hex
+  createdAt: string;
+  rating: number;  // Elo, see rating.cts
+  stats: UserStats;
+  privacy: Privacy;
+}
+
+// What other players and the API may see of an account
+interface PublicUser {
+  id: string;
+  name: string;
+}
+
+// Privacy as its owner sees it, friends by name
+interface PrivacySettings extends Record<PrivacyArea, Visibility> {
+  friends: PublicUser[];
+}
+
+// The game record is null where the player keeps their history from the viewer
+interface LeaderboardEntry extends PublicUser {
+  rank: number;
+  rating: number;
+  ratedGames: number | null;
+  wins: number | null;
+  losses: number | null;
+}
+
+interface LeaderboardPage {
+  entries: LeaderboardEntry[];
+  nextCursor: string | null;
+  total: number;
+}
+
+// Where accounts are kept. Accounts reads them all once and saves each one it changes.
+interface AccountRepository {
+  loadAll(): UserAccount[];
+  save(user: UserAccount): void;
+}
+
+// All accounts in one JSON file, rewritten via a temporary file on every change so a
+// crash never truncates it; without a file they live only in memory
+class FileAccountRepository implements AccountRepository {
+  private file: string | undefined;
+  private users: Map<string, UserAccount> = new Map();
+
+  constructor(file?: string) {
+    this.file = file || undefined;
+  }
+
+  loadAll(): UserAccount[] {
+    if (!this.file || !fs.existsSync(this.file)) return [];
+    try {
+      const data = JSON.parse(fs.readFileSync(this.file, 'utf-8'));
+      (Array.isArray(data?.users) ? data.users : []).forEach((user: UserAccount) => this.users.set(user.id, {
+        ...user,
+        // Accounts written before ratings, move stats or privacy settings existed
+        rating: user.rating ?? DEFAULT_RATING,
+        stats: { timedMoves: 0, thinkMs: 0, gradedShots: 0, shotQuality: 0, ...user.stats, ratedGames: user.stats?.ratedGames ?? 0 },
+        privacy: { ...DEFAULT_PRIVACY, ...user.privacy }
+      }));
+    } catch (error) {
+      console.error(`Failed to read accounts from ${this.file}:`, error);
+    }
+    return [...this.users.values()];
+  }
+
+  save(user: UserAccount): void {
+    this.users.set(user.id, user);
+    if (!this.file) return;
+    try {
+      fs.writeFileSync(`${this.file}.tmp`, JSON.stringify({ users: [...this.users.values()] }, null, 2));
+      fs.renameSync(`${this.file}.tmp`, this.file);
+    } catch (error) {
+      console.error(`Failed to write accounts to ${this.file}:`, error);
+    }
+  }
+}
+
+// Highest rating first, then by name
+function byRank(a: UserAccount, b: UserAccount): number {
+  return b.rating - a.rating || a.name.localeCompare(b.name);
+}
+
+class Accounts {
+  private users: Map<string, UserAccount> = new Map();
+  private ranking: UserAccount[] = [];  // Placed players in leaderboard order, kept sorted as ratings change
+  private repository: AccountRepository;
+  private secret: Buffer;
+
+  constructor(repository: AccountRepository = new FileAccountRepository(), secret?: string) {
+    this.repository = repository;
+    this.secret = secret ? Buffer.from(secret) : crypto.randomBytes(32);
+    repository.loadAll().forEach(user => this.users.set(user.id, user));
+    this.ranking = [...this.users.values()].filter(user => !inPlacement(user.stats.ratedGames)).sort(byRank);
+  }
+
+  register(name: unknown, password: unknown): { user: PublicUser; token: string } {
+    const fields: { field: string; reason: string }[] = [];
+    if (typeof name !== 'string' || !USERNAME_PATTERN.test(name)) {
+      fields.push({ field: 'name', reason: 'must be 3-20 letters, digits, - or _' });
+    }
+    if (typeof password !== 'string' || password.length < PASSWORD_LENGTH.min || password.length > PASSWORD_LENGTH.max) {
+      fields.push({ field: 'password', reason: `must be ${PASSWORD_LENGTH.min}-${PASSWORD_LENGTH.max} characters` });
+    }
+    if (fields.length > 0) {
+      throw new GameError(ErrorCode.VALIDATION_FAILED, 'Invalid account details', undefined, fields);
+    }
+    if (this.findByName(name as string)) {
+      throw new GameError(ErrorCode.NAME_TAKEN, 'That name is already registered', { name });
+    }
+
+    const salt = crypto.randomBytes(16);
+    const user: UserAccount = {
+      id: crypto.randomUUID(),
+      name: name as string,
+      passwordHash: `${salt.toString('hex')}:${crypto.scryptSync(password as string, salt, SCRYPT_KEY_BYTES).toString('hex')}`,
+      createdAt: new Date().toISOString(),
+      rating: DEFAULT_RATING,
+      stats: { ...EMPTY_STATS },
+      privacy: { ...DEFAULT_PRIVACY }
+    };
+    this.users.set(user.id, user);
+    this.repository.save(user);
+    console.log(`Registered account ${user.name}`);
+    return { user: this.publicUser(user), token: this.issueToken(user) };
+  }
+
+  signIn(name: unknown, password: unknown): { user: PublicUser; token: string } {
+    const user = typeof name === 'string' ? this.findByName(name) : undefined;
+    if (!user || typeof password !== 'string' || !this.checkPassword(user, password)) {
+      throw new GameError(ErrorCode.UNAUTHORIZED, 'Wrong name or password');
+    }
+    return { user: this.publicUser(user), token: this.issueToken(user) };
+  }
+
+  // Who an account token belongs to, or null if it is forged, expired or for a deleted account
+  verify(token: unknown): PublicUser | null {
+    if (typeof token !== 'string') return null;
+    const [userId, expires, signature] = token.split('.');
+    if (!userId || !expires || !signature) return null;
+
+    const expected = Buffer.from(this.sign(`${userId}.${expires}`));
+    const given = Buffer.from(signature);
+    if (given.length !== expected.length || !crypto.timingSafeEqual(given, expected)) return null;
+    if (Number(expires) < Date.now()) return null;
+
+    const user = this.users.get(userId);
+    return user ? this.publicUser(user) : null;
+  }
+
+  // Count one finished game for a signed-in player
+  recordGame(userId: string, result: { won: boolean } & Pick<UserStats, 'shots' | 'hits' | 'timedMoves' | 'thinkMs' | 'gradedShots' | 'shotQuality'>): void {
+    const user = this.users.get(userId);
+    if (!user) return;
+    user.stats.gamesPlayed++;
+    user.stats[result.won ? 'wins' : 'losses']++;
+    user.stats.shots += result.shots;
+    user.stats.hits += result.hits;
+    user.stats.timedMoves += result.timedMoves;
+    user.stats.thinkMs += result.thinkMs;
+    user.stats.gradedShots += result.gradedShots;
+    user.stats.shotQuality += result.shotQuality;
+    this.repository.save(user);
+  }
+
+  // Move both ratings after a game between two signed-in players; returns the new ratings
+  // and, for each side, whether the game was one of its placement matches (see rating.cts)
+  recordRatedGame(winnerId: string, loserId: string): { winner: number; loser: number; placement: { winner: boolean; loser: boolean } } | null {
+    const winner = this.users.get(winnerId);
+    const loser = this.users.get(loserId);
+    if (!winner || !loser || winner === loser) return null;
+
+    const rated = rateGame(
+      { rating: winner.rating, ratedGames: winner.stats.ratedGames },
+      { rating: loser.rating, ratedGames: loser.stats.ratedGames }
+    );
+    const placement = { winner: inPlacement(winner.stats.ratedGames), loser: inPlacement(loser.stats.ratedGames) };
+    winner.rating = rated.winner;
+    loser.rating = rated.loser;
+    winner.stats.ratedGames++;
+    loser.stats.ratedGames++;
+    [winner, loser].forEach(user => {
+      if (!inPlacement(user.stats.ratedGames)) this.rerank(user);
+      this.repository.save(user);
+    });
+    return { ...rated, placement };
+  }
+
+  // Put every account back to no games and the starting rating, ahead of counting its
+  // games again (see stats.cts)
+  resetStats(): number {
+    this.users.forEach(user => {
+      user.rating = DEFAULT_RATING;
+      user.stats = { ...EMPTY_STATS };
+      this.repository.save(user);
+    });
+    this.ranking = [];
+    return this.users.size;
+  }
+
+  ratingOf(userId: string): number {
+    return this.users.get(userId)?.rating ?? DEFAULT_RATING;
+  }
+
+  // Placement matches the account has still to play before it is on the leaderboard
+  placementMatchesLeft(userId: string): number {
+    return Math.max(PLACEMENT_MATCHES - (this.users.get(userId)?.stats.ratedGames ?? 0), 0);
+  }
+
+  // An account's stats page as the viewer (an account id, or null for a guest) may see it:
+  // refused if they may not see the profile, and without the game record if they may not
+  // see its history. The rating of an account with placement matches left is provisional.
+  getStats(userId: string, viewerId: string | null = null): PublicUser & { rating: number; placementMatchesLeft: number } & Partial<UserStats & {
+    accuracy: number | null; averageThinkMs: number | null; averageShotQuality: number | null
+  }> {
+    const user = this.users.get(userId);
+    if (!user) {
+      throw new GameError(ErrorCode.NOT_FOUND, 'No such user', { userId });
+    }
+    if (!this.allows(user, 'profile', viewerId)) {
+      throw new GameError(ErrorCode.FORBIDDEN, 'This player keeps their profile private', { userId });
+    }
+    const { stats } = user;
+    return {
+      ...this.publicUser(user), rating: user.rating, placementMatchesLeft: this.placementMatchesLeft(user.id),
+      ...(this.allows(user, 'history', viewerId) && {
+        ...stats,
+        accuracy: stats.shots > 0 ? stats.hits / stats.shots : null,
+        averageThinkMs: stats.timedMoves > 0 ? Math.round(stats.thinkMs / stats.timedMoves) : null,
+        averageShotQuality: stats.gradedShots > 0 ? Math.round(stats.shotQuality / stats.gradedShots) : null
+      })
+    };
+  }
+
+  getPrivacy(userId: string): PrivacySettings {
+    const user = this.users.get(userId);
+    if (!user) {
+      throw new GameError(ErrorCode.NOT_FOUND, 'No such user', { userId });
+    }
+    const { friends, ...areas } = user.privacy;
+    return {
+      ...areas,
+      // Friends whose accounts are gone drop out
+      friends: friends.flatMap(friendId => {
+        const friend = this.users.get(friendId);
+        return friend ? [this.publicUser(friend)] : [];
+      })
+    };
+  }
+
+  // Change some of the settings; the rest stay as they were. Friends are given by name and
+  // replace the whole list.
+  setPrivacy(userId: string, changes: Partial<Record<keyof Privacy, unknown>>): PrivacySettings {
+    const user = this.users.get(userId);
+    if (!user) {
+      throw new GameError(ErrorCode.NOT_FOUND, 'No such user', { userId });
+    }
+    const fields: { field: string; reason: string }[] = [];
+    const next: Privacy = { ...user.privacy };
+    PRIVACY_AREAS.forEach(area => {
+      const value = changes[area];
+      if (value === undefined) return;
+      if (!VISIBILITIES.includes(value as Visibility)) {
+        fields.push({ field: area, reason: `must be one of ${VISIBILITIES.join(', ')}` });
+      } else {
+        next[area] = value as Visibility;
+      }
+    });
+    if (changes.friends !== undefined) {
+      const names = changes.friends;
+      if (!Array.isArray(names) || names.length > MAX_FRIENDS || !names.every(name => typeof name === 'string')) {
+        fields.push({ field: 'friends', reason: `must be a list of at most ${MAX_FRIENDS} account names` });
+      } else {
+        const friends = names.map(name => this.findByName(name));
+        const unknown = names.filter((name, index) => !friends[index]);
+        if (unknown.length > 0) {
+          fields.push({ field: 'friends', reason: `no account named ${unknown.join(', ')}` });
+        } else {
+          next.friends = [...new Set(friends.map(friend => friend!.id))].filter(friendId => friendId !== user.id);
+        }
+      }
+    }
+    if (fields.length > 0) {
+      throw new GameError(ErrorCode.VALIDATION_FAILED, 'Invalid privacy settings', undefined, fields);
+    }
+
+    user.privacy = next;
+    this.repository.save(user);
+    return this.getPrivacy(userId);
+  }
+
+  // Whether the viewer (an account id, or null for a guest) may see that part of the
+  // account; an account that no longer exists hides nothing
+  canSee(userId: string, area: PrivacyArea, viewerId: string | null): boolean {
+    const user = this.users.get(userId);
+    return !user || this.allows(user, area, viewerId);
+  }
+
+  // Players who have played their placement matches, highest rating first; pages continue
+  // after the user id given as the cursor, like the games list. Players who keep their
+  // profile from the viewer are left out, but everyone keeps their rank among all placed
+  // players.
+  leaderboard(query: { cursor?: string; limit?: number } = {}, viewerId: string | null = null): LeaderboardPage {
+    let start = 0;
+    if (query.cursor) {
+      const cursorIndex = this.ranking.findIndex(user => user.id === query.cursor);
+      start = cursorIndex === -1 ? this.ranking.length : cursorIndex + 1;
+    }
+    const limit = Math.min(Math.max(Math.floor(query.limit || MAX_LEADERBOARD_PAGE_SIZE), 1), MAX_LEADERBOARD_PAGE_SIZE);
+    const listed = (user: UserAccount) => this.allows(user, 'profile', viewerId);
+    const entries: LeaderboardEntry[] = [];
+    let index = start;
+    for (; index < this.ranking.length && entries.length < limit; index++) {
+      const user = this.ranking[index];
+      if (!listed(user)) continue;
+      const history = this.allows(user, 'history', viewerId);
+      entries.push({
+        rank: index + 1,
+        ...this.publicUser(user),
+        rating: user.rating,
+        ratedGames: history ? user.stats.ratedGames : null,
+        wins: history ? user.stats.wins : null,
+        losses: history ? user.stats.losses : null
+      });
+    }
+    return {
+      entries,
+      nextCursor: this.ranking.slice(index).some(listed) ? entries[entries.length - 1].id : null,
+      total: this.ranking.filter(listed).length
+    };
+  }
+
+  // Move one player to their place in the ranking after their rating changed
+  private rerank(user: UserAccount): void {
+    const current = this.ranking.indexOf(user);
+    if (current !== -1) this.ranking.splice(current, 1);
+    let low = 0;
+    let high = this.ranking.length;
+    while (low < high) {
+      const middle = (low + high) >> 1;
+      if (byRank(this.ranking[middle], user) <= 0) low = middle + 1;
+      else high = middle;
+    }
+    this.ranking.splice(low, 0, user);
+  }
+
+  private allows(user: UserAccount, area: PrivacyArea, viewerId: string | null): boolean {
+    const visibility = user.privacy[area];
+    if (visibility === 'public' || viewerId === user.id) return true;
+    return visibility === 'friends' && viewerId !== null && user.privacy.friends.includes(viewerId);
+  }
+
+  private findByName(name: string): UserAccount | undefined {
+    const wanted = name.toLowerCase();
+    return [...this.users.values()].find(user => user.name.toLowerCase() === wanted);
+  }
+
+  private checkPassword(user: UserAccount, password: string): boolean {
+    const [salt, hash] = user.passwordHash.split(':');
+    const expected = Buffer.from(hash, 'hex');
+    const given = crypto.scryptSync(password, Buffer.from(salt, 'hex'), expected.length);
+    return crypto.timingSafeEqual(given, expected);
+  }
+
+  // userId.expiry.signature, so a token can be checked without keeping a session table
+  private issueToken(user: UserAccount): string {
+    const payload = `${user.id}.${Date.now() + TOKEN_TTL_MS}`;
+    return `${payload}.${this.sign(payload)}`;
+  }
+
+  private sign(payload: string): string {
+    return crypto.createHmac('sha256', this.secret).update(payload).digest('base64url');
+  }
+
+  private publicUser(user: UserAccount): PublicUser {
+    return { id: user.id, name: user.name };
+  }
+}
+
+export { Accounts, FileAccountRepository };
+export type {
+  AccountRepository, UserAccount, UserStats, PublicUser, LeaderboardEntry, LeaderboardPage, Visibility, PrivacyArea, Privacy, PrivacySettings
+};
@@ -0,0 +1,257 @@
+// Computer opponents for solo play. An AI seat is a ServerSeat (see seat.cts), so it is
+// bound by exactly the rules, turn order and fog of war a human player is.
+//
+//   easy    random       bombs any cell it has not bombed yet
+//   medium  hunt         bombs tanks it can see, probes around its hits, otherwise guesses
+//   hard    density      bombs tanks it can see, otherwise the cell whose blast uncovers the
+//                        most likely tank positions
+//
+// Strategies draw their random choices from the RandomInt they are handed, so simulate.cts
+// can replay them from a seed; live games use crypto.randomInt.
+//
+// On top of its strategy, an easier opponent sometimes makes a mistake: in place of its
+// pick it bombs another cell, drawn from the better part of the cells ranked as the density
+// strategy ranks them, so a miss looks like a plausible human choice rather than noise.
+// It never passes up a tank in plain sight. Operators tune this with TANKS_AI_MISTAKES
+// (inline JSON), e.g.
+//   { "easy": { "rate": 0.4, "spread": 0.6 }, "medium": { "rate": 0.1 } }
+
+import * as crypto from 'crypto';
+import type { GameManager } from './server.cjs';
+import { ServerSeat } from './seat.cjs';
+import { Rules, CellState, type Orientation, type Position } from './game.cjs';
+
+type AiDifficulty = 'easy' | 'medium' | 'hard';
+
+const AI_DIFFICULTIES: AiDifficulty[] = ['easy', 'medium', 'hard'];
+const THINK_TIME_MS = 700; // Pause before acting so humans can follow the game
+
+interface MistakeModel {
+  rate: number;    // Chance, 0-1, that a shot is a mistake
+  spread: number;  // Share, 0-1, of the ranked open cells a mistake is drawn from, best first
+}
+
+const DEFAULT_MISTAKES: Record<AiDifficulty, MistakeModel> = {
+  easy: { rate: 0.3, spread: 0.5 },
+  medium: { rate: 0.15, spread: 0.2 },
+  hard: { rate: 0, spread: 0 }
+};
+
+// A whole number from 0 up to, but not including, `max`
+type RandomInt = (max: number) => number;
+
+// What a strategy sees when picking a target: the enemy board through the fog
+interface TargetView {
+  enemyBoard: number[][];
+  explosionRadius: number;
+  random: RandomInt;
+}
+
+interface AiStrategy {
+  name: string;
+  spreadTanks: boolean; // Keep own tanks apart so one blast never uncovers two
+  chooseTarget(view: TargetView): Position;
+}
+
+function pick<T>(items: T[], random: RandomInt): T {
+  return items[random(items.length)];
+}
+
+function cellsWhere(board: number[][], test: (cell: number) => boolean): Position[] {
+  const cells: Position[] = [];
+  board.forEach((row, y) => row.forEach((cell, x) => {
+    if (test(cell)) cells.push({ x, y });
+  }));
+  return cells;
+}
+
+function isOpen(cell: number): boolean {
+  return cell !== CellState.HIT && cell !== CellState.MISS;
+}
+
+function neighbours(board: number[][], { x, y }: Position, radius: number): Position[] {
+  const result: Position[] = [];
+  for (let dy = -radius; dy <= radius; dy++) {
+    for (let dx = -radius; dx <= radius; dx++) {
+      if ((dx || dy) && board[y + dy]?.[x + dx] !== undefined) result.push({ x: x + dx, y: y + dy });
+    }
+  }
+  return result;
+}
+
+const randomStrategy: AiStrategy = {
+  name: 'random',
+  spreadTanks: false,
+  chooseTarget: view => pick(cellsWhere(view.enemyBoard, isOpen), view.random)
+};
+
+const huntStrategy: AiStrategy = {
+  name: 'hunt',
+  spreadTanks: true,
+  chooseTarget: ({ enemyBoard, random }) => {
+    const visible = cellsWhere(enemyBoard, cell => cell === CellState.TANK);
+    if (visible.length > 0) return pick(visible, random);
+
+    // Target mode: players tend to cluster tanks, so probe unknown cells next to hits
+    const probes = cellsWhere(enemyBoard, cell => cell === CellState.HIT)
+      .flatMap(hit => neighbours(enemyBoard, hit, 1))
+      .filter(({ x, y }) => enemyBoard[y][x] === CellState.EMPTY);
+    if (probes.length > 0) return pick(probes, random);
+
+    // Hunt mode: guess among cells the fog still hides
+    const unknown = cellsWhere(enemyBoard, cell => cell === CellState.EMPTY);
+    return pick(unknown.length > 0 ? unknown : cellsWhere(enemyBoard, isOpen), random);
+  }
+};
+
+// How good a shot each cell is, as the density strategy judges it; -1 where a bomb
+// cannot go. Drills (drills.cts) grade players' shots against these scores.
+function scoreTargets({ enemyBoard, explosionRadius }: Omit<TargetView, 'random'>): number[][] {
+  // A tank in sight beats any guess
+  if (cellsWhere(enemyBoard, cell => cell === CellState.TANK).length > 0) {
+    return enemyBoard.map(row => row.map(cell => cell === CellState.TANK ? 1 : isOpen(cell) ? 0 : -1));
+  }
+
+  // Every hidden cell may hold a tank; those beside earlier hits are likelier to
+  const density = enemyBoard.map(row => row.map(cell => (cell === CellState.EMPTY ? 1 : 0)));
+  cellsWhere(enemyBoard, cell => cell === CellState.HIT).forEach(hit => {
+    neighbours(enemyBoard, hit, 1).forEach(({ x, y }) => {
+      if (density[y][x] > 0) density[y][x] += 0.5;
+    });
+  });
+
+  // Score each open cell by the density its blast uncovers, counting its own cell double
+  return enemyBoard.map((row, y) => row.map((cell, x) => isOpen(cell)
+    ? 2 * density[y][x] + neighbours(enemyBoard, { x, y }, explosionRadius).reduce((sum, n) => sum + density[n.y][n.x], 0)
+    : -1));
+}
+
+// Grade a shot at (x, y) from 0 to 100: 100 for one of the best cells, less the
+// further below them
+function gradeShot(scores: number[][], x: number, y: number): number {
+  const bestScore = Math.max(...scores.flat());
+  return bestScore > 0 ? Math.round((100 * Math.max(scores[y][x], 0)) / bestScore) : 100;
+}
+
+// The cells with the highest score
+function bestTargets(scores: number[][]): Position[] {
+  const bestScore = Math.max(...scores.flat());
+  return cellsWhere(scores, score => score === bestScore && score >= 0);
+}
+
+const densityStrategy: AiStrategy = {
+  name: 'density',
+  spreadTanks: true,
+  chooseTarget: ({ random, ...view }) => pick(bestTargets(scoreTargets(view)), random)
+};
+
+const AI_STRATEGIES: Record<AiDifficulty, AiStrategy> = {
+  easy: randomStrategy,
+  medium: huntStrategy,
+  hard: densityStrategy
+};
+
+// Defaults with any overrides from the environment; bad values keep the default
+function loadMistakeModels(env: NodeJS.ProcessEnv = process.env): Record<AiDifficulty, MistakeModel> {
+  const models = Object.fromEntries(AI_DIFFICULTIES.map(d => [d, { ...DEFAULT_MISTAKES[d] }])) as Record<AiDifficulty, MistakeModel>;
+  if (!env.TANKS_AI_MISTAKES) return models;
+
+  let overrides: Record<string, any> = {};
+  try {
+    overrides = JSON.parse(env.TANKS_AI_MISTAKES);
+  } catch (error) {
+    console.error('Failed to read TANKS_AI_MISTAKES, using defaults:', error);
+  }
+  const fraction = (value: unknown, fallback: number) =>
+    typeof value === 'number' && value >= 0 && value <= 1 ? value : fallback;
+  Object.entries(overrides).forEach(([difficulty, value]) => {
+    if (!AI_DIFFICULTIES.includes(difficulty as AiDifficulty)) {
+      console.log(`Ignoring mistakes for unknown AI difficulty: ${difficulty}`);
+      return;
+    }
+    const model = models[difficulty as AiDifficulty];
+    model.rate = fraction(value?.rate, model.rate);
+    model.spread = fraction(value?.spread, model.spread);
+  });
+  return models;
+}
+
+// The strategy's pick, or now and then a plausible mistake in its place
+function withMistake(target: Position, view: TargetView, model: MistakeModel): Position {
+  if (model.rate <= 0 || model.spread <= 0) return target;
+  if (view.enemyBoard[target.y][target.x] === CellState.TANK) return target;
+  if (view.random(1_000_000) >= model.rate * 1_000_000) return target;
+
+  const scores = scoreTargets(view);
+  const ranked = cellsWhere(scores, score => score >= 0)
+    .filter(({ x, y }) => (x !== target.x || y !== target.y) && view.enemyBoard[y][x] !== CellState.TANK)
+    .sort((a, b) => scores[b.y][b.x] - scores[a.y][a.x]);
+  if (ranked.length === 0) return target;
+  return ranked[view.random(Math.max(Math.ceil(ranked.length * model.spread), 1))];
+}
+
+interface Placement {
+  x: number;
+  y: number;
+  orientation: Orientation;
+}
+
+// Choose a position and orientation for each tank, given their lengths in placement order
+function generatePlacements(boardSize: number, lengths: number[], spread: boolean, random: RandomInt = crypto.randomInt): Placement[] {
+  const board = Array.from({ length: boardSize }, () => new Array(boardSize).fill(CellState.EMPTY));
+  const placements: Placement[] = [];
+  let attempts = 0;
+
+  while (placements.length < lengths.length) {
+    const length = lengths[placements.length];
+    const orientation: Orientation = random(2) === 0 ? 'horizontal' : 'vertical';
+    const x = random(orientation === 'horizontal' ? boardSize - length + 1 : boardSize);
+    const y = random(orientation === 'vertical' ? boardSize - length + 1 : boardSize);
+    const cells = Rules.tankCells(x, y, length, orientation);
+    attempts++;
+    if (cells.some(c => board[c.y][c.x] !== CellState.EMPTY)) continue;
+
+    // Fall back to any free cells if the board is too crowded to keep tanks apart
+    const crowded = cells.some(c => neighbours(board, c, 1).some(n => board[n.y][n.x] === CellState.TANK));
+    if (spread && crowded && attempts < 50 * lengths.length) continue;
+
+    cells.forEach(c => { board[c.y][c.x] = CellState.TANK; });
+    placements.push({ x, y, orientation });
+  }
+
+  return placements;
+}
+
+let aiMistakes: Record<AiDifficulty, MistakeModel> | null = null;  // Read from the environment on first use
+
+// One computer-controlled seat; ServerSeat plays it, the strategy picks its shots
+class AiPlayer extends ServerSeat {
+  readonly difficulty: AiDifficulty;
+  private strategy: AiStrategy;
+  private mistakes: MistakeModel;
+
+  constructor(gameManager: GameManager, difficulty: AiDifficulty, mistakes?: MistakeModel) {
+    super(gameManager, `AI (${AI_STRATEGIES[difficulty].name})`, THINK_TIME_MS);
+    this.difficulty = difficulty;
+    this.strategy = AI_STRATEGIES[difficulty];
+    aiMistakes ??= loadMistakeModels();
+    this.mistakes = mistakes ?? aiMistakes[difficulty];
+  }
+
+  protected placeTanks(state: any): void {
+    const lengths = Array.from({ length: state.config.tanksPerPlayer }, (_, i) => state.config.tankLengths?.[i] ?? 1);
+    this.placeFleet(generatePlacements(state.config.boardSize, lengths, this.strategy.spreadTanks));
+  }
+
+  protected takeTurn(state: any): void {
+    const view: TargetView = {
+      enemyBoard: state.enemyBoard,
+      explosionRadius: state.config.explosionRadius,
+      random: crypto.randomInt
+    };
+    this.bomb(withMistake(this.strategy.chooseTarget(view), view, this.mistakes));
+  }
+}
+
+export { AiPlayer, AI_DIFFICULTIES, AI_STRATEGIES, DEFAULT_MISTAKES, generatePlacements, scoreTargets, gradeShot, bestTargets, withMistake, loadMistakeModels };
+export type { AiDifficulty, AiStrategy, RandomInt, MistakeModel };
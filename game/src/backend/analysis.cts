@@ -0,0 +1,179 @@
+// Game analysis built only on public information: what each side has shot at,
+// what it hit, and how many tanks each side still has. Never looks at hidden boards.
+
+import type { MoveLogEntry } from './game.cjs';
+
+interface SideStats {
+  shots: number;           // Bombs fired so far
+  hits: number;            // Bombs that destroyed a tank
+  tanksRemaining: number;  // This side's own surviving tanks
+  cellsRemaining: number;  // Unhit cells of those tanks; the opponent must hit them all
+  unshotCells: number;     // Enemy cells this side has not bombed yet
+}
+
+// How one side played: how long it took over its moves and, in games with move
+// analysis, how its bombs graded
+interface MoveStats {
+  timedMoves: number;
+  thinkMs: number;                    // Over all timed moves
+  averageThinkMs: number | null;
+  medianThinkMs: number | null;
+  gradedShots: number;
+  shotQuality: number;                // Sum of the grades, 0-100 each
+  averageShotQuality: number | null;
+}
+
+// How a side's cold shots came out against chance. A cold shot is a bomb at a cell with
+// nothing it had found beside it: not next to one of its hits, and outside any square a
+// scan of its found a tank in. Blind, such a shot finds a tank about as often as the
+// tank cells left on the board are a share of the cells not yet shot at. Someone seeing
+// the hidden board hits with cold shots as often as with any other.
+interface ColdShooting {
+  shots: number;
+  hits: number;
+  expectedHits: number;
+  pValue: number;  // Chance of at least this many hits by shooting blind
+}
+
+const PRIOR_WEIGHT = 4; // Shots' worth of weight given to the random-shooting hit rate
+
+// Standard normal CDF (Abramowitz-Stegun 7.1.26 approximation of erf)
+function normalCdf(z: number): number {
+  const t = 1 / (1 + 0.3275911 * Math.abs(z) / Math.SQRT2);
+  const erf = 1 - (((((1.061405429 * t - 1.453152027) * t) + 1.421413741) * t - 0.284496736) * t + 0.254829592) * t * Math.exp(-z * z / 2);
+  return z >= 0 ? (1 + erf) / 2 : (1 - erf) / 2;
+}
+
+// Expected shots (and their variance) this side still needs to hit `targets` tank cells.
+// The hit rate blends the side's observed accuracy with the chance a random shot hits.
+function shotsToFinish(side: SideStats, targets: number): { mean: number; variance: number } {
+  if (targets <= 0) return { mean: 0, variance: 0 };
+
+  const randomRate = side.unshotCells > 0 ? Math.min(targets / side.unshotCells, 1) : 1;
+  const rate = Math.min(Math.max((side.hits + PRIOR_WEIGHT * randomRate) / (side.shots + PRIOR_WEIGHT), 0.01), 1);
+
+  // Negative binomial: shots needed for `targets` successes at this rate
+  return { mean: targets / rate, variance: targets * (1 - rate) / (rate * rate) };
+}
+
+// Probability that each side wins, as [first, second]. `toMove` is the side whose turn it is;
+// moving next is worth half a turn.
+function estimateWinProbability(first: SideStats, second: SideStats, toMove: 0 | 1): [number, number] {
+  if (second.tanksRemaining === 0) return [1, 0];
+  if (first.tanksRemaining === 0) return [0, 1];
+
+  const firstNeeds = shotsToFinish(first, second.cellsRemaining);
+  const secondNeeds = shotsToFinish(second, first.cellsRemaining);
+
+  const tempo = toMove === 0 ? 0.5 : -0.5;
+  const spread = Math.sqrt(firstNeeds.variance + secondNeeds.variance + 1);
+  const p = normalCdf((secondNeeds.mean - firstNeeds.mean + tempo) / spread);
+
+  const rounded = Math.round(p * 1000) / 1000;
+  return [rounded, Math.round((1 - rounded) * 1000) / 1000];
+}
+
+// The shots that are sure to win it for `attacker`, whatever the defender does: one for
+// each cell left of the defender's fleet, once all of them have been `found` (uncovered on
+// the attacker's view, which the defender is shown too), and only if the defender cannot
+// hit every cell left of the attacker's fleet with the shots it gets in between. Null
+// while the win is not forced, and always when the defender `canEscape`: a tank that may
+// still move off its cells, or a special shot that strikes many cells at once.
+function forcedFinish(attacker: SideStats, defender: SideStats, found: number, attackerToMove: boolean, canEscape: boolean): number | null {
+  if (canEscape || defender.tanksRemaining === 0 || found < defender.cellsRemaining) return null;
+  const shots = defender.cellsRemaining;
+  const defenderShots = attackerToMove ? shots - 1 : shots;
+  return attacker.cellsRemaining > defenderShots ? shots : null;
+}
+
+const SPARK_LEVELS = '_.:-=+*#%@'; // Plain ASCII so it survives any terminal or log viewer
+
+// One character per value in [0, 1], e.g. a win-probability series across a game
+function sparkline(values: number[]): string {
+  return values
+    .map(value => SPARK_LEVELS[Math.round(Math.min(Math.max(value, 0), 1) * (SPARK_LEVELS.length - 1))])
+    .join('');
+}
+
+function moveStats(moveLog: MoveLogEntry[], playerId: number): MoveStats {
+  const entries = moveLog.filter(entry => entry.playerId === playerId);
+  const timed = entries.flatMap(entry => entry.thinkMs !== undefined ? [entry.thinkMs] : []);
+  const graded = entries.flatMap(entry => entry.quality !== undefined ? [entry.quality] : []);
+  const sum = (values: number[]) => values.reduce((total, value) => total + value, 0);
+  const sorted = [...timed].sort((a, b) => a - b);
+  return {
+    timedMoves: timed.length,
+    thinkMs: sum(timed),
+    averageThinkMs: timed.length > 0 ? Math.round(sum(timed) / timed.length) : null,
+    medianThinkMs: sorted.length > 0 ? sorted[Math.floor(sorted.length / 2)] : null,
+    gradedShots: graded.length,
+    shotQuality: sum(graded),
+    averageShotQuality: graded.length > 0 ? Math.round(sum(graded) / graded.length) : null
+  };
+}
+
+// Tank cells a special shot's hits destroyed are not logged, so they are counted as still
+// standing, and its cells as shot at: both make a blind hit look likelier, never rarer
+function coldShooting(moveLog: MoveLogEntry[], playerId: number, boardSize: number, fleetCells: number): ColdShooting {
+  const shot: Set<string> = new Set();
+  const warm: Set<string> = new Set();
+  const chances: number[] = [];
+  let standing = fleetCells;
+  let hits = 0;
+
+  const onBoard = (x: number, y: number) => x >= 0 && y >= 0 && x < boardSize && y < boardSize;
+  const around = (x: number, y: number, radius: number) => {
+    const cells: string[] = [];
+    for (let dy = -radius; dy <= radius; dy++) {
+      for (let dx = -radius; dx <= radius; dx++) {
+        if (onBoard(x + dx, y + dy)) cells.push(`${x + dx},${y + dy}`);
+      }
+    }
+    return cells;
+  };
+
+  moveLog.filter(entry => entry.playerId === playerId).forEach(entry => {
+    const { x, y } = entry as { x: number; y: number };
+    if (entry.action === 'bomb') {
+      const hit = entry.outcome === 'hit' || entry.outcome === 'victory';
+      if (!warm.has(`${x},${y}`)) {
+        chances.push(Math.min(standing / Math.max(boardSize * boardSize - shot.size, 1), 1));
+        if (hit) hits++;
+      }
+      shot.add(`${x},${y}`);
+      if (hit) {
+        standing--;
+        [[1, 0], [-1, 0], [0, 1], [0, -1]].forEach(([dx, dy]) => onBoard(x + dx, y + dy) && warm.add(`${x + dx},${y + dy}`));
+      }
+    } else if (entry.action === 'ability') {
+      // A strike's line, or the 3x3 square around its target, and the cells beside those
+      const line = (offset: number) => Array.from({ length: boardSize }, (_, i) => entry.direction === 'row' ? `${i},${y + offset}` : `${x + offset},${i}`);
+      const area = entry.ability === 'airstrike' ? line(0) : around(x, y, 1);
+      if (entry.ability !== 'scan') area.forEach(cell => shot.add(cell));
+      if (entry.ability === 'scan' ? entry.found : entry.outcome !== 'miss') {
+        const beside = entry.ability === 'airstrike' ? [...line(-1), ...line(0), ...line(1)] : around(x, y, 2);
+        beside.forEach(cell => warm.add(cell));
+      }
+    }
+  });
+
+  // Poisson binomial: the chance of each number of hits over shots of these chances
+  let counts = [1];
+  chances.forEach(chance => {
+    const next = new Array(counts.length + 1).fill(0);
+    counts.forEach((probability, k) => {
+      next[k] += probability * (1 - chance);
+      next[k + 1] += probability * chance;
+    });
+    counts = next;
+  });
+  return {
+    shots: chances.length,
+    hits,
+    expectedHits: Math.round(chances.reduce((total, chance) => total + chance, 0) * 100) / 100,
+    pValue: Math.min(counts.slice(hits).reduce((total, probability) => total + probability, 0), 1)
+  };
+}
+
+export { estimateWinProbability, forcedFinish, sparkline, moveStats, coldShooting };
+export type { SideStats, MoveStats, ColdShooting };
@@ -0,0 +1,891 @@
+// REST/JSON access to the same game actions the WebSocket protocol offers.
+// Joining returns a session token that later requests send as "Authorization: Bearer <token>".
+// Requests are translated into protocol messages and run through GameManager.handleMessage,
+// so validation, idempotency and error codes are exactly those of the WebSocket path.
+//
+//   GET    /api/games                      open games (same query options as getGamesList)
+//                                           (the lobby, stats and leaderboards take an account's token
+//                                           as the Bearer token, to see what players share with friends)
+//   POST   /api/games                      create a game and join it   { playerName, gameId?, config? }
+//                                           or play the computer        { playerName, difficulty, config? }
+//                                           or a bot (see bot.cts)      { playerName, bot, config? }
+//   POST   /api/games/{id}/join            join an existing game       { playerName }
+//                                           (creating, joining and resuming also take an account's
+//                                           token as the Bearer token, to play signed in)
+//   POST   /api/games/{id}/resume          take back a seat            { resumeToken }
+//   POST   /api/games/{id}/spectate        watch without playing; the session may only read the
+//                                           state, poll events and leave
+//   GET    /api/games/{id}/state           your view of the game (honours If-None-Match); spectators
+//                                           get both boards showing hits and misses only
+//   GET    /api/games/{id}/events          messages pushed to you since the last poll
+//   GET    /api/games/{id}/summary         post-game recap with the win-probability series, think time and
+//                                           shot quality per player, and signed result
+//   GET    /api/games/{id}/summary.csv     the finished game's move log as a spreadsheet
+//   GET    /api/games/{id}/summary.svg     the finished game's boards as an image, labelled and with a legend
+//   GET    /api/games/{id}/moves           every placement, move, bomb and special shot so far
+//   GET    /api/games/{id}/actions         everything you may do right now, each as the protocol message
+//                                           that does it (a bomb is { type: 'bomb', x, y })
+//   GET    /api/games/{id}/cells           when and by whom each cell of your boards changed, and with
+//                                           ?seq=N your boards as they stood after move log entry N
+//   GET    /api/games/{id}/rules           the rules the game is played under: board, tanks, special
+//                                           shots, timers and enabled features
+//   GET    /api/rules                      the same for a new game on this server
+//   GET    /api/games/{id}/lifecycle       whether the game is active, finished or archived, and when it ended
+//   GET    /api/maintenance                upcoming maintenance, or null
+//   POST   /api/games/{id}/settings        propose settings            { config }
+//   POST   /api/games/{id}/settings/accept accept the pending proposal
+//   POST   /api/games/{id}/place           { x, y } or { layout }
+//   POST   /api/games/{id}/place/remove    take a placed tank back off the board  { x, y }
+//   POST   /api/games/{id}/place/confirm   lock in your tanks; the battle starts once both players have
+//   POST   /api/games/{id}/move            { fromX, fromY, toX, toY, expectedMove }
+//   POST   /api/games/{id}/bomb            { x, y, expectedMove }
+//   POST   /api/games/{id}/ability         special shot instead of a bomb  { ability, x, y, direction?, expectedMove }
+//                                           (airstrike along direction 'row' or 'column', cluster, scan)
+//   POST   /api/games/{id}/premoves        queue a bomb the server plays for you if a shot of yours comes
+//                                           out as given  { if: { x, y, outcome: 'hit' | 'miss' }, x, y }
+//   DELETE /api/games/{id}/premoves        drop every premove you have queued
+//   POST   /api/games/{id}/concede         give up a loss that is already forced, in games that offer it
+//                                           (the state's concedeOffer says when)
+//   POST   /api/games/{id}/chat/report     report one of your opponent's chat messages to the moderators
+//                                           { messageId, reason? } (messageId as the chat message gave it)
+//   POST   /api/games/{id}/report          report your opponent, during the game or after it
+//                                           { category, comment? } (cheating, abuse, stalling,
+//                                           unsportsmanlike or other); without a session, send the
+//                                           seat's { resumeToken } as well, e.g. once you have left
+//   POST   /api/games/{id}/save            save the game so it can be resumed later
+//   DELETE /api/games/{id}/session         leave the game
+//   POST   /api/users                      register an account         { name, password }
+//   POST   /api/users/signin               sign in                     { name, password }
+//   GET    /api/users/{id}/stats           games played, wins, losses, accuracy, rating, think time and shot quality;
+//                                           the rating is provisional while placementMatchesLeft is above 0
+//   GET    /api/users/me/inbox             every game waiting on your move, soonest deadline first
+//                                           (send the account token as the Bearer token)
+//   GET    /api/users/me/privacy           who may see your profile, history and live games, and your friends
+//   PUT    /api/users/me/privacy           change them  { profile?, history?, liveGames?, friends? }
+//                                           (each 'public', 'friends' or 'private'; friends by name)
+//   GET    /api/leaderboard                rated players past their placement matches, highest first (?cursor, limit)
+//   GET    /api/leaderboard.csv            every rated player, as a spreadsheet
+//   GET    /api/results/key                public key that signs game results (see results.cts)
+//   POST   /api/freeforall                 hot-seat match for 3-6 players at one client  { players, config? }
+//   GET    /api/freeforall/{id}            the match as the player to move sees it (?seat for another seat)
+//   POST   /api/freeforall/{id}/bomb       the player to move bombs an opponent  { target, x, y }
+//
+// A free-for-all (see freeforall.cts) is played entirely by whoever holds its id, so
+// it needs no session.
+//
+// A finished game that has been archived (see archive.cts) is loaded back in when one of
+// its players asks for its summary, moves or cells, or resumes their seat to see them.
+//
+// x and y count from 0 at the top-left, x along the columns. Placing, bombing, special
+// shots and premoves, and a premove's condition, also take { cell } instead, named in the
+// game's coordinate system (see coords.cts).
+//
+// Summaries and the leaderboard write their figures out in the Accept-Language locale as
+// well, and the CSV exports use it for numbers, dates, separators and column names (see
+// i18n.cts).
+//
+// A client built for one version of the rules (RULES_VERSION in game.cts) may name it in an
+// X-Tanks-Rules-Version header when it creates, joins, resumes or watches a game. Unless
+// the server plays the same rules, no session is made and the request fails with
+// INCOMPATIBLE_RULES, as a WebSocket hello would (see protocol.cts).
+//
+// Registering and signing in return an account token (see accounts.cts); games played
+// with it count towards that account's stats. A profile its owner keeps private is refused,
+// a history kept private leaves the game record out of the stats and the leaderboard, and
+// games kept private are missing from the lobby and cannot be watched.
+//
+// Staff send their staff token (see roles.cts) as the Bearer token instead. Each
+// endpoint names the lowest role that may use it:
+//
+//   GET    /api/games/{id}/snapshot          admin      the game as it would be saved, hidden boards included
+//   PUT    /api/games/{id}/snapshot          admin      store a snapshot for its players to resume
+//   POST   /api/games/{id}/void              moderator  end the game without a result   { reason? }
+//   POST   /api/games/{id}/players/{n}/mute  moderator  mute or unmute player n's chat  { muted?, reason? }
+//   GET    /api/moderation                   moderator  flags raised for review, newest first (?status, kind, userId, assignedTo, limit)
+//   GET    /api/moderation/{seq}             moderator  a flag with its evidence: each of its games, and what staff did
+//                                                       about the flag or to those games
+//   POST   /api/moderation/{seq}/assign      moderator  take an open flag on, or hand it to another moderator or to
+//                                                       nobody  { assignee?: name | null, reason? } (yourself if left out)
+//   POST   /api/moderation/{seq}/resolve     moderator  close a flag  { status: 'dismissed' | 'actioned', reason? }
+//   GET    /api/audit                        admin      staff actions, newest first (?actor, action, gameId, since, limit)
+//   POST   /api/maintenance                  admin      announce maintenance, stopping new games  { inSeconds, message?, pauseClocks? }
+//   DELETE /api/maintenance                  admin      call it off
+//   GET    /api/jobs                         admin      background jobs with their schedules and last runs
+//   POST   /api/jobs/{name}/run              admin      run a job now
+//   GET    /api/chaos                        admin      fault injection settings and faults injected so far
+//   PUT    /api/chaos                        admin      change them  { storageErrors?, eventDelayMs?, dropRate? }
+//   DELETE /api/chaos                        admin      turn every fault off
+//
+// The fault injection endpoints only work on a server started with TANKS_CHAOS=1 (see chaos.cts).
+//
+// Every staff action that succeeds is written to the audit log with who took it.
+
+import * as http from 'http';
+import * as crypto from 'crypto';
+import { WebSocket } from 'ws';
+import { ErrorCode, GameError, toGameError } from './errors.cjs';
+import { negotiateLocale, negotiateFormat, translate, formatNumber, formatPercent, formatDate, toCsv } from './i18n.cjs';
+import { formatCell } from './coords.cjs';
+import { StaffDirectory, PERMISSIONS, type Permission, type StaffMember } from './roles.cjs';
+import { AuditLog } from './audit.cjs';
+import { ModerationQueue } from './moderation.cjs';
+import { Accounts, type LeaderboardEntry } from './accounts.cjs';
+import { Scheduler } from './scheduler.cjs';
+import { FaultInjector } from './chaos.cjs';
+import type { GameManager } from './server.cjs';
+import type { MoveLogEntry } from './game.cjs';
+
+const MAX_BODY_BYTES = 64 * 1024;
+const MAX_PENDING_EVENTS = 200;
+const SESSION_TIMEOUT = 2 * 60 * 60 * 1000; // Sessions not seen for this long leave their game
+
+// Of the games counted on a leaderboard entry; null before any, or where they are kept private
+function winRate(entry: LeaderboardEntry): number | null {
+  if (entry.wins === null || entry.losses === null) return null;
+  const games = entry.wins + entry.losses;
+  return games > 0 ? entry.wins / games : null;
+}
+
+// Stands in for a WebSocket so GameManager can address HTTP players the same way.
+// Pushed messages are queued until the player polls for events, or handed straight to
+// the listener while one is streaming them (see grpc.cts).
+class HttpSession {
+  readonly token: string = crypto.randomUUID();
+  readyState: number = WebSocket.OPEN;
+  protocol: string = '';
+  lastSeen: number = Date.now();
+  listener: ((message: any | null) => void) | null = null;  // Called with null when the session closes
+  private events: any[] = [];
+  private capture: any[] | null = null;
+
+  send(data: string | Buffer): void {
+    const message = JSON.parse(data.toString());
+    if (this.capture) {
+      // Sent while handling this session's own request; returned in that response
+      this.capture.push(message);
+      return;
+    }
+    if (this.listener) {
+      this.listener(message);
+      return;
+    }
+    this.events.push(message);
+    if (this.events.length > MAX_PENDING_EVENTS) this.events.shift();
+  }
+
+  close(): void {
+    this.readyState = WebSocket.CLOSED;
+    this.listener?.(null);
+    this.listener = null;
+  }
+
+  // Collect everything sent to this session while the callback runs
+  collect(callback: () => void): any[] {
+    const captured: any[] = [];
+    this.capture = captured;
+    try {
+      callback();
+    } finally {
+      this.capture = null;
+    }
+    return captured;
+  }
+
+  drainEvents(): any[] {
+    const events = this.events;
+    this.events = [];
+    return events;
+  }
+}
+
+// Routes under /api/games/{id}/ that act for an authenticated player of that game,
+// or for a spectator of it where `spectators` is set
+interface Route {
+  method: string;
+  pattern: RegExp;
+  spectators?: true;
+  handler: (session: HttpSession, gameId: string, body: any, req: http.IncomingMessage, res: http.ServerResponse) => void;
+}
+
+class HttpApi {
+  private gameManager: GameManager;
+  private sessions: Map<string, HttpSession> = new Map();
+  private routes: Route[];
+  private staff: StaffDirectory;
+  private audit: AuditLog;
+  private accounts: Accounts;
+  private scheduler: Scheduler;
+  private chaos: FaultInjector;
+  private moderation: ModerationQueue;
+
+  constructor(
+    gameManager: GameManager,
+    staff: StaffDirectory = new StaffDirectory(),
+    audit: AuditLog = new AuditLog(),
+    accounts: Accounts = new Accounts(),
+    scheduler: Scheduler = new Scheduler(),
+    chaos: FaultInjector = new FaultInjector(false),
+    moderation: ModerationQueue = new ModerationQueue()
+  ) {
+    this.gameManager = gameManager;
+    this.staff = staff;
+    this.audit = audit;
+    this.accounts = accounts;
+    this.scheduler = scheduler;
+    this.chaos = chaos;
+    this.moderation = moderation;
+
+    this.routes = [
+      { method: 'GET', pattern: /^\/api\/games\/([^/]+)\/state$/, spectators: true, handler: (s, id, body, req, res) => this.getState(s, req, res) },
+      { method: 'GET', pattern: /^\/api\/games\/([^/]+)\/events$/, spectators: true, handler: (s, id, body, req, res) => this.reply(res, 200, { events: s.drainEvents() }) },
+      { method: 'GET', pattern: /^\/api\/games\/([^/]+)\/moves$/, handler: (s, id, body, req, res) => this.action(s, res, { type: 'getMoveLog' }, 'moveLog') },
+      { method: 'GET', pattern: /^\/api\/games\/([^/]+)\/actions$/, handler: (s, id, body, req, res) => this.action(s, res, { type: 'getLegalActions' }, 'legalActions') },
+      {
+        method: 'GET', pattern: /^\/api\/games\/([^/]+)\/cells$/, handler: (s, id, body, req, res) => {
+          const seq = new URL(req.url || '/', 'http://localhost').searchParams.get('seq');
+          this.action(s, res, { type: 'getCellHistory', ...(seq !== null && { seq: Number(seq) }) }, 'cellHistory');
+        }
+      },
+      { method: 'GET', pattern: /^\/api\/games\/([^/]+)\/summary$/, handler: (s, id, body, req, res) => this.action(s, res, { type: 'getGameSummary' }, 'gameSummary') },
+      { method: 'GET', pattern: /^\/api\/games\/([^/]+)\/summary\.csv$/, handler: (s, id, body, req, res) => this.summaryCsv(s, id, req, res) },
+      { method: 'GET', pattern: /^\/api\/games\/([^/]+)\/summary\.svg$/, handler: (s, id, body, req, res) => this.summarySvg(s, id, res) },
+      { method: 'POST', pattern: /^\/api\/games\/([^/]+)\/settings$/, handler: (s, id, body, req, res) => this.action(s, res, { type: 'proposeSettings', config: body.config }, 'proposeSettingsResult') },
+      { method: 'POST', pattern: /^\/api\/games\/([^/]+)\/settings\/accept$/, handler: (s, id, body, req, res) => this.action(s, res, { type: 'acceptSettings' }, 'acceptSettingsResult') },
+      {
+        method: 'POST', pattern: /^\/api\/games\/([^/]+)\/place$/, handler: (s, id, body, req, res) => body.layout !== undefined
+          ? this.action(s, res, { ...body, type: 'placeLayout', moveId: this.moveId(body, req) }, 'placeLayoutResult')
+          : this.action(s, res, { ...body, type: 'placeTank', moveId: this.moveId(body, req) }, 'placeTankResult')
+      },
+      { method: 'POST', pattern: /^\/api\/games\/([^/]+)\/place\/remove$/, handler: (s, id, body, req, res) => this.action(s, res, { ...body, type: 'removeTank', moveId: this.moveId(body, req) }, 'removeTankResult') },
+      { method: 'POST', pattern: /^\/api\/games\/([^/]+)\/place\/confirm$/, handler: (s, id, body, req, res) => this.action(s, res, { type: 'confirmPlacement', moveId: this.moveId(body, req) }, 'confirmPlacementResult') },
+      { method: 'POST', pattern: /^\/api\/games\/([^/]+)\/move$/, handler: (s, id, body, req, res) => this.action(s, res, { ...body, type: 'moveTank', moveId: this.moveId(body, req) }, 'moveTankResult') },
+      { method: 'POST', pattern: /^\/api\/games\/([^/]+)\/bomb$/, handler: (s, id, body, req, res) => this.action(s, res, { ...body, type: 'bomb', moveId: this.moveId(body, req) }, 'bombResult') },
+      { method: 'POST', pattern: /^\/api\/games\/([^/]+)\/ability$/, handler: (s, id, body, req, res) => this.action(s, res, { ...body, type: 'useAbility', moveId: this.moveId(body, req) }, 'useAbilityResult') },
+      { method: 'POST', pattern: /^\/api\/games\/([^/]+)\/premoves$/, handler: (s, id, body, req, res) => this.action(s, res, { ...body, type: 'queuePremove' }, 'queuePremoveResult') },
+      { method: 'DELETE', pattern: /^\/api\/games\/([^/]+)\/premoves$/, handler: (s, id, body, req, res) => this.action(s, res, { type: 'cancelPremoves' }, 'cancelPremovesResult') },
+      { method: 'POST', pattern: /^\/api\/games\/([^/]+)\/concede$/, handler: (s, id, body, req, res) => this.action(s, res, { type: 'concede', moveId: this.moveId(body, req) }, 'concedeResult') },
+      { method: 'POST', pattern: /^\/api\/games\/([^/]+)\/report$/, handler: (s, id, body, req, res) => this.action(s, res, { ...body, type: 'reportPlayer' }, 'playerReported') },
+      { method: 'POST', pattern: /^\/api\/games\/([^/]+)\/chat\/report$/, handler: (s, id, body, req, res) => this.action(s, res, { ...body, type: 'reportChat' }, 'chatReported') },
+      { method: 'POST', pattern: /^\/api\/games\/([^/]+)\/save$/, handler: (s, id, body, req, res) => this.action(s, res, { type: 'saveGame' }, 'gameSaved') },
+      { method: 'DELETE', pattern: /^\/api\/games\/([^/]+)\/session$/, spectators: true, handler: (s, id, body, req, res) => this.leave(s, res) }
+    ];
+  }
+
+  handle(req: http.IncomingMessage, res: http.ServerResponse): void {
+    this.readBody(req).then(body => {
+      const url = new URL(req.url || '/', 'http://localhost');
+      const method = req.method || 'GET';
+
+      if (url.pathname === '/api/games' && method === 'GET') {
+        this.listGames(req, url, res);
+        return;
+      }
+      if (url.pathname === '/api/games' && method === 'POST') {
+        this.join(req, res, body.gameId, body);
+        return;
+      }
+      const joinMatch = url.pathname.match(/^\/api\/games\/([^/]+)\/join$/);
+      if (joinMatch && method === 'POST') {
+        // Joining through REST never creates a room implicitly
+        const gameId = decodeURIComponent(joinMatch[1]);
+        if (!this.gameManager.hasGame(gameId.toUpperCase())) {
+          throw new GameError(ErrorCode.GAME_NOT_FOUND, 'Game not found', { gameId: gameId.toUpperCase() });
+        }
+        this.join(req, res, gameId, { playerName: body.playerName });
+        return;
+      }
+
+      if (url.pathname === '/api/users' && method === 'POST') {
+        this.reply(res, 201, { success: true, ...this.accounts.register(body.name, body.password) });
+        return;
+      }
+      if (url.pathname === '/api/users/signin' && method === 'POST') {
+        this.reply(res, 200, { success: true, ...this.accounts.signIn(body.name, body.password) });
+        return;
+      }
+      if (url.pathname === '/api/users/me/inbox' && method === 'GET') {
+        const user = this.accounts.verify(this.bearerToken(req));
+        if (!user) {
+          throw new GameError(ErrorCode.UNAUTHORIZED, 'A valid account token is required');
+        }
+        this.reply(res, 200, { games: this.gameManager.getInbox(user.id) });
+        return;
+      }
+      if (url.pathname === '/api/users/me/privacy' && (method === 'GET' || method === 'PUT')) {
+        const user = this.accounts.verify(this.bearerToken(req));
+        if (!user) {
+          throw new GameError(ErrorCode.UNAUTHORIZED, 'A valid account token is required');
+        }
+        if (method === 'GET') {
+          this.reply(res, 200, { privacy: this.accounts.getPrivacy(user.id) });
+          return;
+        }
+        const privacy = this.accounts.setPrivacy(user.id, {
+          profile: body.profile, history: body.history, liveGames: body.liveGames, friends: body.friends
+        });
+        this.gameManager.enforcePrivacy(user.id);
+        this.reply(res, 200, { success: true, privacy });
+        return;
+      }
+      const statsMatch = url.pathname.match(/^\/api\/users\/([^/]+)\/stats$/);
+      if (statsMatch && method === 'GET') {
+        this.reply(res, 200, this.accounts.getStats(decodeURIComponent(statsMatch[1]), this.viewerOf(req)));
+        return;
+      }
+
+      if (url.pathname === '/api/rules' && method === 'GET') {
+        this.reply(res, 200, this.gameManager.getRules());
+        return;
+      }
+      const lifecycleMatch = url.pathname.match(/^\/api\/games\/([^/]+)\/lifecycle$/);
+      if (lifecycleMatch && method === 'GET') {
+        this.reply(res, 200, this.gameManager.getLifecycle(decodeURIComponent(lifecycleMatch[1])));
+        return;
+      }
+      const rulesMatch = url.pathname.match(/^\/api\/games\/([^/]+)\/rules$/);
+      if (rulesMatch && method === 'GET') {
+        // Settings are public, as in the games list, so no session is needed
+        this.reply(res, 200, this.gameManager.getRules(decodeURIComponent(rulesMatch[1])));
+        return;
+      }
+
+      if (url.pathname === '/api/freeforall' && method === 'POST') {
+        this.reply(res, 201, { success: true, ...this.gameManager.startFreeForAll(body.players, body.config) });
+        return;
+      }
+      const freeForAllMatch = url.pathname.match(/^\/api\/freeforall\/([^/]+)(\/bomb)?$/);
+      if (freeForAllMatch && !freeForAllMatch[2] && method === 'GET') {
+        const seat = url.searchParams.get('seat');
+        this.reply(res, 200, this.gameManager.getFreeForAll(decodeURIComponent(freeForAllMatch[1]), seat === null ? undefined : Number(seat)));
+        return;
+      }
+      if (freeForAllMatch && freeForAllMatch[2] && method === 'POST') {
+        this.reply(res, 200, { success: true, ...this.gameManager.freeForAllBomb(decodeURIComponent(freeForAllMatch[1]), body) });
+        return;
+      }
+
+      if (url.pathname === '/api/results/key' && method === 'GET') {
+        this.reply(res, 200, this.gameManager.getResultKey());
+        return;
+      }
+      if (url.pathname === '/api/leaderboard' && method === 'GET') {
+        const params = url.searchParams;
+        const format = negotiateFormat(req.headers['accept-language']);
+        const page = this.accounts.leaderboard({
+          cursor: params.get('cursor') ?? undefined,
+          limit: params.has('limit') ? Number(params.get('limit')) : undefined
+        }, this.viewerOf(req));
+        this.reply(res, 200, {
+          ...page,
+          entries: page.entries.map(entry => {
+            const rate = winRate(entry);
+            return { ...entry, formatted: { rating: formatNumber(entry.rating, format), winRate: rate === null ? null : formatPercent(rate, format) } };
+          })
+        });
+        return;
+      }
+      if (url.pathname === '/api/leaderboard.csv' && method === 'GET') {
+        this.leaderboardCsv(req, res);
+        return;
+      }
+
+      const spectateMatch = url.pathname.match(/^\/api\/games\/([^/]+)\/spectate$/);
+      if (spectateMatch && method === 'POST') {
+        this.openSession(req, res, { type: 'spectate', gameId: decodeURIComponent(spectateMatch[1]) }, 201, 'spectating');
+        return;
+      }
+      const resumeMatch = url.pathname.match(/^\/api\/games\/([^/]+)\/resume$/);
+      if (resumeMatch && method === 'POST') {
+        this.resume(req, res, decodeURIComponent(resumeMatch[1]), body);
+        return;
+      }
+      const reportMatch = url.pathname.match(/^\/api\/games\/([^/]+)\/report$/);
+      if (reportMatch && method === 'POST' && body.resumeToken !== undefined) {
+        const gameId = decodeURIComponent(reportMatch[1]).toUpperCase();
+        this.gameManager.reportPlayerByToken(gameId, body.resumeToken, body.category, body.comment);
+        this.reply(res, 200, { success: true, gameId });
+        return;
+      }
+      const snapshotMatch = url.pathname.match(/^\/api\/games\/([^/]+)\/snapshot$/);
+      if (snapshotMatch && (method === 'GET' || method === 'PUT')) {
+        const gameId = decodeURIComponent(snapshotMatch[1]);
+        if (method === 'GET') {
+          const member = this.requireStaff(req, 'readSnapshot');
+          const snapshot = this.gameManager.getSnapshot(gameId);
+          this.recordAudit(member, 'readSnapshot', gameId);
+          this.reply(res, 200, snapshot);
+        } else {
+          const member = this.requireStaff(req, 'writeSnapshot');
+          this.gameManager.putSnapshot(gameId, body);
+          this.recordAudit(member, 'writeSnapshot', gameId);
+          this.reply(res, 201, { success: true, gameId: gameId.toUpperCase() });
+        }
+        return;
+      }
+      const voidMatch = url.pathname.match(/^\/api\/games\/([^/]+)\/void$/);
+      if (voidMatch && method === 'POST') {
+        const member = this.requireStaff(req, 'voidGame');
+        const gameId = decodeURIComponent(voidMatch[1]).toUpperCase();
+        const reason = this.reason(body);
+        this.gameManager.voidGame(gameId, reason);
+        this.recordAudit(member, 'voidGame', gameId, undefined, reason);
+        this.reply(res, 200, { success: true, gameId });
+        return;
+      }
+      const muteMatch = url.pathname.match(/^\/api\/games\/([^/]+)\/players\/(\d+)\/mute$/);
+      if (muteMatch && method === 'POST') {
+        const member = this.requireStaff(req, 'muteChat');
+        const gameId = decodeURIComponent(muteMatch[1]).toUpperCase();
+        const playerId = Number(muteMatch[2]);
+        const muted = body.muted !== false;
+        this.gameManager.setChatMuted(gameId, playerId, muted);
+        this.recordAudit(member, 'muteChat', gameId, playerId, `${muted ? 'muted' : 'unmuted'}${body.reason ? `: ${this.reason(body)}` : ''}`);
+        this.reply(res, 200, { success: true, gameId, playerId, muted });
+        return;
+      }
+      if (url.pathname === '/api/moderation' && method === 'GET') {
+        this.requireStaff(req, 'reviewFlags');
+        const params = url.searchParams;
+        const flags = this.moderation.query({
+          status: params.get('status') ?? undefined,
+          kind: params.get('kind') ?? undefined,
+          userId: params.get('userId') ?? undefined,
+          assignedTo: params.get('assignedTo') ?? undefined,
+          limit: params.has('limit') ? Number(params.get('limit')) : undefined
+        });
+        this.reply(res, 200, { flags });
+        return;
+      }
+      const flagMatch = url.pathname.match(/^\/api\/moderation\/(\d+)$/);
+      if (flagMatch && method === 'GET') {
+        this.requireStaff(req, 'reviewFlags');
+        const flag = this.moderation.get(Number(flagMatch[1]));
+        this.reply(res, 200, {
+          flag,
+          games: flag.gameIds.map(gameId => this.gameManager.getEvidence(gameId)),
+          audit: this.audit.related(flag.seq, flag.gameIds)
+        });
+        return;
+      }
+      const assignMatch = url.pathname.match(/^\/api\/moderation\/(\d+)\/assign$/);
+      if (assignMatch && method === 'POST') {
+        const member = this.requireStaff(req, 'reviewFlags');
+        const assignee = body.assignee === undefined ? member.name : body.assignee;
+        const staffMember = typeof assignee === 'string' ? this.staff.byName(assignee) : null;
+        if (assignee !== null && (!staffMember || !StaffDirectory.can(staffMember.role, 'reviewFlags'))) {
+          throw new GameError(ErrorCode.VALIDATION_FAILED, 'Invalid assignee', undefined, [
+            { field: 'assignee', reason: 'must name a moderator, or be null to unassign' }
+          ]);
+        }
+        const note = this.reason(body);
+        const flag = this.moderation.assign(Number(assignMatch[1]), assignee);
+        this.recordAudit(member, 'reviewFlags', undefined, undefined, `assigned to ${assignee ?? 'nobody'}${note ? `: ${note}` : ''}`, flag.seq);
+        this.reply(res, 200, { flag });
+        return;
+      }
+      const resolveMatch = url.pathname.match(/^\/api\/moderation\/(\d+)\/resolve$/);
+      if (resolveMatch && method === 'POST') {
+        const member = this.requireStaff(req, 'reviewFlags');
+        const note = this.reason(body);
+        const flag = this.moderation.resolve(Number(resolveMatch[1]), body.status, member.name, note);
+        this.recordAudit(member, 'reviewFlags', undefined, undefined, `${flag.status}${note ? `: ${note}` : ''}`, flag.seq);
+        this.reply(res, 200, { flag });
+        return;
+      }
+      if (url.pathname === '/api/audit' && method === 'GET') {
+        this.requireStaff(req, 'readAudit');
+        const params = url.searchParams;
+        const entries = this.audit.query({
+          actor: params.get('actor') ?? undefined,
+          action: params.get('action') ?? undefined,
+          gameId: params.get('gameId') ?? undefined,
+          since: params.get('since') ?? undefined,
+          limit: params.has('limit') ? Number(params.get('limit')) : undefined
+        });
+        this.reply(res, 200, { entries });
+        return;
+      }
+
+      if (url.pathname === '/api/jobs' && method === 'GET') {
+        this.requireStaff(req, 'runJobs');
+        this.reply(res, 200, { jobs: this.scheduler.status() });
+        return;
+      }
+      const jobMatch = url.pathname.match(/^\/api\/jobs\/([^/]+)\/run$/);
+      if (jobMatch && method === 'POST') {
+        const member = this.requireStaff(req, 'runJobs');
+        const name = decodeURIComponent(jobMatch[1]);
+        const job = this.scheduler.run(name);
+        this.recordAudit(member, 'runJobs', undefined, undefined, name);
+        this.reply(res, 200, { job });
+        return;
+      }
+
+      if (url.pathname === '/api/chaos') {
+        if (method === 'GET') {
+          this.requireStaff(req, 'injectFaults');
+          this.reply(res, 200, { chaos: this.chaos.status() });
+          return;
+        }
+        if (method === 'PUT') {
+          const member = this.requireStaff(req, 'injectFaults');
+          const chaos = this.chaos.configure({ storageErrors: body.storageErrors, eventDelayMs: body.eventDelayMs, dropRate: body.dropRate });
+          this.recordAudit(member, 'injectFaults', undefined, undefined, JSON.stringify(chaos.settings));
+          this.reply(res, 200, { chaos });
+          return;
+        }
+        if (method === 'DELETE') {
+          const member = this.requireStaff(req, 'injectFaults');
+          const chaos = this.chaos.reset();
+          this.recordAudit(member, 'injectFaults', undefined, undefined, 'all faults off');
+          this.reply(res, 200, { chaos });
+          return;
+        }
+      }
+
+      if (url.pathname === '/api/maintenance') {
+        if (method === 'GET') {
+          this.reply(res, 200, { maintenance: this.gameManager.getMaintenance() });
+          return;
+        }
+        if (method === 'POST') {
+          const member = this.requireStaff(req, 'scheduleMaintenance');
+          const message = typeof body.message === 'string' ? body.message.trim().slice(0, 200) : undefined;
+          const maintenance = this.gameManager.scheduleMaintenance(body.inSeconds, message, body.pauseClocks === true);
+          this.recordAudit(member, 'scheduleMaintenance', undefined, undefined, `in ${body.inSeconds}s${message ? `: ${message}` : ''}`);
+          this.reply(res, 200, { maintenance });
+          return;
+        }
+        if (method === 'DELETE') {
+          const member = this.requireStaff(req, 'scheduleMaintenance');
+          const cancelled = this.gameManager.cancelMaintenance();
+          if (cancelled) this.recordAudit(member, 'scheduleMaintenance', undefined, undefined, 'cancelled');
+          this.reply(res, 200, { success: true, cancelled });
+          return;
+        }
+      }
+
+      const route = this.routes.find(r => r.method === method && r.pattern.test(url.pathname));
+      if (!route) {
+        throw new GameError(ErrorCode.NOT_FOUND, 'Unknown API endpoint', { method, path: url.pathname });
+      }
+
+      const gameId = decodeURIComponent(url.pathname.match(route.pattern)![1]).toUpperCase();
+      const session = this.authenticate(req, gameId, route.spectators === true);
+      route.handler(session, gameId, body, req, res);
+    }).catch(error => {
+      const gameError = toGameError(error);
+      if (gameError.code === ErrorCode.SERVER_ERROR) console.error('API error:', error);
+      const envelope = gameError.toEnvelope(negotiateLocale(req.headers['accept-language']));
+      this.reply(res, envelope.status, { success: false, error: envelope });
+    });
+  }
+
+  private listGames(req: http.IncomingMessage, url: URL, res: http.ServerResponse): void {
+    const params = url.searchParams;
+    const query: Record<string, any> = { type: 'getGamesList' };
+    ['cursor', 'phase', 'sort', 'order'].forEach(key => {
+      if (params.has(key)) query[key] = params.get(key);
+    });
+    if (params.has('limit')) query.limit = Number(params.get('limit'));
+    if (params.has('canJoin')) query.canJoin = params.get('canJoin') === 'true';
+
+    // Lobby reads need no player, so a throwaway session carries the request, signed in
+    // as the viewer if one is given
+    const session = new HttpSession();
+    const token = this.bearerToken(req);
+    if (token) {
+      const signedIn = this.dispatch(session, { type: 'signIn', token }, 'signedIn');
+      if (!signedIn.success) {
+        throw new GameError(signedIn.error.code, signedIn.error.message);
+      }
+    }
+    const reply = this.dispatch(session, query, 'gamesList');
+    this.reply(res, reply.success === false ? reply.error.status : 200, reply);
+  }
+
+  private join(req: http.IncomingMessage, res: http.ServerResponse, gameId: string | undefined, body: any): void {
+    const message = body.bot !== undefined
+      ? { type: 'playBot', playerName: body.playerName, bot: body.bot, config: body.config }
+      : body.difficulty !== undefined
+        ? { type: 'playAi', playerName: body.playerName, difficulty: body.difficulty, config: body.config }
+        : { type: 'join', gameId, playerName: body.playerName, config: body.config };
+    this.openSession(req, res, message, 201);
+  }
+
+  private resume(req: http.IncomingMessage, res: http.ServerResponse, gameId: string, body: any): void {
+    this.openSession(req, res, { type: 'resumeGame', gameId, resumeToken: body.resumeToken }, 200);
+  }
+
+  // Seat a new session with a join-style message and hand back its token
+  private openSession(
+    req: http.IncomingMessage,
+    res: http.ServerResponse,
+    message: Record<string, any>,
+    status: number,
+    replyType: string = 'joined'
+  ): void {
+    const { session, reply } = this.startSession(message, replyType, this.bearerToken(req), req.headers['accept-language'], this.rulesVersion(req));
+    if (!reply.success) {
+      this.reply(res, reply.error.status, reply);
+      return;
+    }
+    this.reply(res, status, { ...reply, token: session.token });
+  }
+
+  // A whole number is passed on as one, anything else as given for the hello to refuse
+  private rulesVersion(req: http.IncomingMessage): unknown {
+    const header = req.headers['x-tanks-rules-version'];
+    if (header === undefined) return undefined;
+    return typeof header === 'string' && /^\s*-?\d+\s*$/.test(header) ? Number(header) : header;
+  }
+
+  // Run a join-style message for a new session, signed in first if an account token is
+  // given; the session is kept only if the reply succeeds. A client that names its rules
+  // version is checked first, by the same hello a WebSocket client sends. Shared with the
+  // gRPC server, so its sessions are these sessions.
+  startSession(
+    message: Record<string, any>,
+    replyType: string,
+    accountToken?: string,
+    acceptLanguage?: string,
+    rulesVersion?: unknown
+  ): { session: HttpSession; reply: any } {
+    const session = new HttpSession();
+    this.setLocale(session, acceptLanguage);
+
+    if (rulesVersion !== undefined) {
+      const welcome = this.dispatch(session, { type: 'hello', rulesVersion }, 'welcome');
+      if (!welcome.success) return { session, reply: welcome };
+    }
+
+    if (accountToken) {
+      const signedIn = this.dispatch(session, { type: 'signIn', token: accountToken }, 'signedIn');
+      if (!signedIn.success) return { session, reply: signedIn };
+    }
+
+    const reply = this.dispatch(session, message, replyType);
+    if (reply.success) this.sessions.set(session.token, session);
+    return { session, reply };
+  }
+
+  private recordAudit(member: StaffMember, action: Permission, gameId?: string, playerId?: number, reason?: string, flag?: number): void {
+    this.audit.record({ actor: member.name, role: member.role, action, target: { gameId: gameId?.toUpperCase(), playerId, flag }, reason });
+  }
+
+  // Staff may say why they acted; kept short so the log stays readable
+  private reason(body: any): string | undefined {
+    return typeof body.reason === 'string' && body.reason.trim() ? body.reason.trim().slice(0, 200) : undefined;
+  }
+
+  private requireStaff(req: http.IncomingMessage, permission: Permission): StaffMember {
+    if (!this.staff.hasStaff()) {
+      throw new GameError(ErrorCode.FEATURE_DISABLED, 'Staff actions are disabled; set TANKS_ADMIN_TOKEN or TANKS_STAFF_TOKENS to enable them');
+    }
+    const token = this.bearerToken(req) ?? '';
+    const member = this.staff.lookup(token);
+    if (!member) {
+      throw new GameError(ErrorCode.UNAUTHORIZED, 'A valid staff token is required');
+    }
+    if (!StaffDirectory.can(member.role, permission)) {
+      throw new GameError(ErrorCode.FORBIDDEN, 'Your role does not allow this action', { role: member.role, required: PERMISSIONS[permission] });
+    }
+    return member;
+  }
+
+  private getState(session: HttpSession, req: http.IncomingMessage, res: http.ServerResponse): void {
+    const ifNoneMatch = req.headers['if-none-match']?.replace(/"/g, '');
+    const reply = this.dispatch(session, { type: 'getGameState', ifNoneMatch }, 'gameState', 'spectatorState', 'gameStateNotModified');
+    if (reply.type === 'gameStateNotModified') {
+      res.writeHead(304, { 'ETag': `"${reply.stateHash}"` });
+      res.end();
+      return;
+    }
+    this.reply(res, 200, reply, { 'ETag': `"${reply.stateHash}"` });
+  }
+
+  private action(session: HttpSession, res: http.ServerResponse, message: Record<string, any>, replyType: string): void {
+    const reply = this.dispatch(session, message, replyType);
+    this.reply(res, reply.success === false ? reply.error.status : 200, reply);
+  }
+
+  private leave(session: HttpSession, res: http.ServerResponse): void {
+    const reply = this.dispatch(session, { type: 'leaveGame' }, 'leftGame');
+    this.endSession(session);
+    this.reply(res, 200, reply);
+  }
+
+  // Run a protocol message for the session and pick out the direct reply
+  dispatch(session: HttpSession, message: Record<string, any>, ...replyTypes: string[]): any {
+    session.lastSeen = Date.now();
+    const sent = session.collect(() => this.gameManager.handleMessage(session as unknown as WebSocket, message as any));
+    const reply = sent.find(m => replyTypes.includes(m.type)) ?? sent.find(m => m.type === 'error');
+    // A streaming session still sees the updates its own action caused
+    if (session.listener) sent.filter(m => m !== reply).forEach(m => session.listener?.(m));
+    if (!reply) {
+      throw new GameError(ErrorCode.SERVER_ERROR, 'Server error occurred');
+    }
+    if (reply.type === 'error') {
+      throw new GameError(reply.error.code, reply.error.message, reply.error.details, reply.error.fields);
+    }
+    return reply;
+  }
+
+  private authenticate(req: http.IncomingMessage, gameId: string, allowSpectators: boolean = false): HttpSession {
+    return this.findSession(this.bearerToken(req), req.headers['accept-language'], gameId, allowSpectators);
+  }
+
+  // The session a token belongs to, seated in the given game (or any game, if none is
+  // given) or watching it where spectators are allowed
+  findSession(token: string | undefined, acceptLanguage?: string, gameId?: string, allowSpectators: boolean = false): HttpSession {
+    const session = token ? this.sessions.get(token) : undefined;
+    if (!session) {
+      throw new GameError(ErrorCode.UNAUTHORIZED, 'A valid session token is required');
+    }
+
+    const connection = this.gameManager.getConnection(session as unknown as WebSocket);
+    const spectating = allowSpectators ? this.gameManager.getSpectating(session as unknown as WebSocket) : undefined;
+    const seated = connection !== undefined && (gameId === undefined || connection.gameId === gameId);
+    const watching = spectating !== undefined && (gameId === undefined || spectating === gameId);
+    if (!seated && !watching) {
+      throw new GameError(ErrorCode.NOT_IN_GAME, 'You are not a player in this game', { gameId });
+    }
+    this.setLocale(session, acceptLanguage);
+    return session;
+  }
+
+  // The account a request is made by, for what players share with friends: null for a
+  // guest, and refused if the token is not a valid account token
+  private viewerOf(req: http.IncomingMessage): string | null {
+    const token = this.bearerToken(req);
+    if (!token) return null;
+    const user = this.accounts.verify(token);
+    if (!user) {
+      throw new GameError(ErrorCode.UNAUTHORIZED, 'That account token is invalid or has expired');
+    }
+    return user.id;
+  }
+
+  private bearerToken(req: http.IncomingMessage): string | undefined {
+    return req.headers.authorization?.match(/^Bearer\s+(\S+)$/i)?.[1];
+  }
+
+  private setLocale(session: HttpSession, acceptLanguage: string | undefined): void {
+    if (acceptLanguage) {
+      session.collect(() => this.gameManager.handleMessage(session as unknown as WebSocket, { type: 'setLocale', locale: acceptLanguage }));
+    }
+  }
+
+  // An Idempotency-Key header doubles as the protocol's moveId
+  private moveId(body: any, req: http.IncomingMessage): string | undefined {
+    const header = req.headers['idempotency-key'];
+    return body.moveId ?? (Array.isArray(header) ? header[0] : header);
+  }
+
+  private endSession(session: HttpSession): void {
+    session.close();
+    this.sessions.delete(session.token);
+  }
+
+  // Drop sessions whose players stopped polling and are not streaming; run periodically by the scheduler
+  expireSessions(): string {
+    const now = Date.now();
+    let expired = 0;
+    this.sessions.forEach(session => {
+      if (!session.listener && now - session.lastSeen > SESSION_TIMEOUT) {
+        console.log(`Expiring idle API session ${session.token}`);
+        this.gameManager.removePlayer(session as unknown as WebSocket);
+        this.endSession(session);
+        expired++;
+      }
+    });
+    return `${expired} session(s) expired`;
+  }
+
+  private readBody(req: http.IncomingMessage): Promise<any> {
+    return new Promise((resolve, reject) => {
+      const chunks: Buffer[] = [];
+      let size = 0;
+      req.on('data', (chunk: Buffer) => {
+        size += chunk.length;
+        if (size > MAX_BODY_BYTES) {
+          reject(new GameError(ErrorCode.INVALID_MESSAGE, 'Request body too large', { maxBytes: MAX_BODY_BYTES }));
+          req.destroy();
+          return;
+        }
+        chunks.push(chunk);
+      });
+      req.on('end', () => {
+        if (chunks.length === 0) {
+          resolve({});
+          return;
+        }
+        try {
+          const body = JSON.parse(Buffer.concat(chunks).toString('utf-8'));
+          resolve(body && typeof body === 'object' ? body : {});
+        } catch {
+          reject(new GameError(ErrorCode.INVALID_MESSAGE, 'Request body must be JSON'));
+        }
+      });
+      req.on('error', reject);
+    });
+  }
+
+  // The whole leaderboard, page by page
+  private leaderboardCsv(req: http.IncomingMessage, res: http.ServerResponse): void {
+    const locale = negotiateLocale(req.headers['accept-language']);
+    const format = negotiateFormat(req.headers['accept-language']);
+    const viewerId = this.viewerOf(req);
+    const entries: LeaderboardEntry[] = [];
+    let cursor: string | null | undefined;
+    do {
+      const page = this.accounts.leaderboard({ cursor: cursor ?? undefined }, viewerId);
+      entries.push(...page.entries);
+      cursor = page.nextCursor;
+    } while (cursor);
+
+    const percent = (rate: number | null) => rate === null ? null : Math.round(rate * 1000) / 10;
+    const columns = ['rank', 'player', 'rating', 'ratedGames', 'wins', 'losses', 'winRate'];
+    const rows = entries.map(entry => [entry.rank, entry.name, entry.rating, entry.ratedGames, entry.wins, entry.losses, percent(winRate(entry))]);
+    this.replyCsv(res, 'leaderboard.csv', toCsv(columns.map(column => translate(`export.${column}`, locale)), rows, format));
+  }
+
+  // One row per move log entry, cells named in the game's coordinate system
+  private summaryCsv(session: HttpSession, gameId: string, req: http.IncomingMessage, res: http.ServerResponse): void {
+    const summary = this.dispatch(session, { type: 'getGameSummary' }, 'gameSummary');
+    const locale = negotiateLocale(req.headers['accept-language']);
+    const format = negotiateFormat(req.headers['accept-language']);
+    const names: string[] = summary.players.map((player: { name: string }) => player.name);
+    const columns = ['entry', 'move', 'player', 'action', 'cell', 'outcome', 'thinkSeconds', 'time'];
+    const rows = (summary.moveLog as MoveLogEntry[]).map(entry => [
+      entry.seq,
+      entry.moveCount,
+      names[entry.playerId] ?? null,
+      entry.ability ?? entry.action,
+      entry.x === undefined ? null : formatCell(summary.config.coordinates, entry.x, entry.y!),
+      entry.outcome ?? (entry.found === undefined ? null : entry.found ? 'found' : 'nothing'),
+      entry.thinkMs === undefined ? null : entry.thinkMs / 1000,
+      formatDate(entry.timestamp, format)
+    ]);
+    this.replyCsv(res, `${gameId}.csv`, toCsv(columns.map(column => translate(`export.${column}`, locale)), rows, format));
+  }
+
+  // The summary's boardImage on its own, for embedding
+  private summarySvg(session: HttpSession, gameId: string, res: http.ServerResponse): void {
+    const summary = this.dispatch(session, { type: 'getGameSummary' }, 'gameSummary');
+    res.writeHead(200, { 'Content-Type': 'image/svg+xml; charset=utf-8', 'Content-Disposition': `inline; filename="${gameId}.svg"` });
+    res.end(summary.boardImage);
+  }
+
+  private replyCsv(res: http.ServerResponse, filename: string, csv: string): void {
+    res.writeHead(200, { 'Content-Type': 'text/csv; charset=utf-8', 'Content-Disposition': `attachment; filename="${filename}"` });
+    res.end(csv);
+  }
+
+  private reply(res: http.ServerResponse, status: number, body: any, headers: Record<string, string> = {}): void {
+    res.writeHead(status, { 'Content-Type': 'application/json', ...headers });
+    res.end(JSON.stringify(body));
+  }
+}
+
+export { HttpApi, HttpSession };
@@ -0,0 +1,181 @@
+// The REST API over a real HTTP server: sessions handed out on joining and checked on
+// every request as Bearer tokens, account tokens, and protocol replies and errors coming
+// back with their HTTP statuses. Run with `npm test`.
+
+import { describe, it, before, after, mock } from 'node:test';
+import * as assert from 'assert';
+import * as http from 'http';
+import type { AddressInfo } from 'net';
+import { HttpApi } from './api.cjs';
+import { GameManager } from './server.cjs';
+import { Accounts } from './accounts.cjs';
+import { FeatureFlags } from './flags.cjs';
+import { StaffDirectory } from './roles.cjs';
+import { MemoryStore } from './store.cjs';
+import { DEFAULT_CONFIG, RULES_VERSION } from './game.cjs';
+import { ErrorCode } from './errors.cjs';
+
+let server: http.Server;
+let base: string;
+
+before(async () => {
+  mock.timers.enable({ apis: ['setInterval'] });  // The manager's clock tick
+  const accounts = new Accounts();
+  const manager = new GameManager(new FeatureFlags(), DEFAULT_CONFIG, new MemoryStore(), accounts);
+  const api = new HttpApi(manager, new StaffDirectory(), undefined, accounts);
+  server = http.createServer((req, res) => api.handle(req, res));
+  await new Promise<void>(resolve => server.listen(0, '127.0.0.1', resolve));
+  base = `http://127.0.0.1:${(server.address() as AddressInfo).port}`;
+});
+
+after(() => {
+  server.close();
+  mock.timers.reset();
+});
+
+async function call(method: string, path: string, options: { token?: string; body?: any; headers?: Record<string, string> } = {}): Promise<{ status: number; body: any }> {
+  const response = await fetch(`${base}${path}`, {
+    method,
+    headers: {
+      ...(options.token && { Authorization: `Bearer ${options.token}` }),
+      ...(options.body !== undefined && { 'Content-Type': 'application/json' }),
+      ...options.headers
+    },
+    body: options.body === undefined ? undefined : JSON.stringify(options.body)
+  });
+  const text = await response.text();
+  return { status: response.status, body: text ? JSON.parse(text) : null };
+}
+
+// Two players seated in a new room, settings agreed
+async function seated(gameId: string): Promise<{ first: string; second: string }> {
+  const created = await call('POST', '/api/games', { body: { playerName: 'first', gameId } });
+  assert.strictEqual(created.status, 201);
+  const joined = await call('POST', `/api/games/${gameId}/join`, { body: { playerName: 'second' } });
+  assert.strictEqual(joined.status, 201);
+  await call('POST', `/api/games/${gameId}/settings/accept`, { token: joined.body.token });
+  return { first: created.body.token, second: joined.body.token };
+}
+
+describe('sessions', () => {
+  it('hands out a session token on joining and accepts it as a Bearer token', async () => {
+    const { first } = await seated('REST1');
+    const state = await call('GET', '/api/games/REST1/state', { token: first });
+    assert.strictEqual(state.status, 200);
+    assert.strictEqual(state.body.type, 'gameState');
+    assert.strictEqual(state.body.gameId, 'REST1');
+    assert.strictEqual(state.body.phase, 'placement');
+  });
+
+  it('refuses a request without a valid session', async () => {
+    await seated('REST2');
+    for (const token of [undefined, 'not-a-session']) {
+      const { status, body } = await call('GET', '/api/games/REST2/state', { token });
+      assert.strictEqual(status, 401);
+      assert.strictEqual(body.error.code, ErrorCode.UNAUTHORIZED);
+    }
+  });
+
+  it('refuses a session in another game', async () => {
+    const { first } = await seated('REST3');
+    await seated('REST4');
+    const { status, body } = await call('GET', '/api/games/REST4/state', { token: first });
+    assert.strictEqual(status, 403);
+    assert.strictEqual(body.error.code, ErrorCode.NOT_IN_GAME);
+  });
+
+  it('ends a session when the player leaves', async () => {
+    const { first } = await seated('REST5');
+    assert.strictEqual((await call('DELETE', '/api/games/REST5/session', { token: first })).status, 200);
+    assert.strictEqual((await call('GET', '/api/games/REST5/state', { token: first })).status, 401);
+  });
+
+  it('checks the rules version a client names before making its session', async () => {
+    const header = (version: string) => ({ headers: { 'X-Tanks-Rules-Version': version } });
+    const created = await call('POST', '/api/games', { body: { playerName: 'first', gameId: 'RULES1' }, ...header(String(RULES_VERSION)) });
+    assert.strictEqual(created.status, 201);
+
+    const refused = await call('POST', '/api/games/RULES1/join', { body: { playerName: 'second' }, ...header(String(RULES_VERSION + 1)) });
+    assert.strictEqual(refused.status, 409);
+    assert.strictEqual(refused.body.error.code, ErrorCode.INCOMPATIBLE_RULES);
+    assert.strictEqual(refused.body.token, undefined);
+    assert.strictEqual((await call('POST', '/api/games/RULES1/spectate', header('one'))).body.error.code, ErrorCode.VALIDATION_FAILED);
+
+    assert.strictEqual((await call('POST', '/api/games/RULES1/join', { body: { playerName: 'second' } })).status, 201, 'the seat is still free');
+  });
+
+  it('never creates a room on joining', async () => {
+    const { status, body } = await call('POST', '/api/games/NOROOM/join', { body: { playerName: 'lost' } });
+    assert.strictEqual(status, 404);
+    assert.strictEqual(body.error.code, ErrorCode.GAME_NOT_FOUND);
+  });
+});
+
+describe('dispatch', () => {
+  it('runs actions through the protocol and returns their replies', async () => {
+    const { first, second } = await seated('REST6');
+    const placed = await call('POST', '/api/games/REST6/place', { token: first, body: { x: 0, y: 0 } });
+    assert.strictEqual(placed.status, 200);
+    assert.strictEqual(placed.body.type, 'placeTankResult');
+    assert.strictEqual(placed.body.success, true);
+
+    const events = await call('GET', '/api/games/REST6/events', { token: second });
+    assert.ok(events.body.events.some((event: any) => event.type === 'gameState'), 'the other player is told by event');
+  });
+
+  it('returns protocol errors with their status and a translated message', async () => {
+    const { first } = await seated('REST7');
+    const english = await call('POST', '/api/games/REST7/place', { token: first, body: { x: 40, y: 0 } });
+    assert.strictEqual(english.status, 422);
+    assert.strictEqual(english.body.success, false);
+    assert.strictEqual(english.body.error.code, ErrorCode.OUT_OF_BOUNDS);
+
+    const spanish = await call('POST', '/api/games/REST7/place', { token: first, body: { x: 0, y: 40 }, headers: { 'Accept-Language': 'es' } });
+    assert.strictEqual(spanish.body.error.code, ErrorCode.OUT_OF_BOUNDS);
+    assert.notStrictEqual(spanish.body.error.message, english.body.error.message);
+  });
+
+  it('answers If-None-Match with 304 while the state is unchanged', async () => {
+    const { first } = await seated('REST8');
+    const response = await fetch(`${base}/api/games/REST8/state`, { headers: { Authorization: `Bearer ${first}` } });
+    const etag = response.headers.get('etag')!;
+    await response.text();
+    const again = await fetch(`${base}/api/games/REST8/state`, { headers: { Authorization: `Bearer ${first}`, 'If-None-Match': etag } });
+    assert.strictEqual(again.status, 304);
+  });
+
+  it('refuses unknown endpoints and bodies that are not JSON', async () => {
+    assert.strictEqual((await call('GET', '/api/nothing')).body.error.code, ErrorCode.NOT_FOUND);
+    const response = await fetch(`${base}/api/games`, { method: 'POST', body: '{not json' });
+    assert.strictEqual((await response.json()).error.code, ErrorCode.INVALID_MESSAGE);
+  });
+});
+
+describe('account tokens', () => {
+  it('signs a new game in with the account token given as the Bearer token', async () => {
+    const registered = await call('POST', '/api/users', { body: { name: 'rest_player', password: 'correct horse' } });
+    assert.strictEqual(registered.status, 201);
+    const account = registered.body.token;
+
+    const created = await call('POST', '/api/games', { token: account, body: { playerName: 'ignored', gameId: 'REST9' } });
+    assert.strictEqual(created.status, 201);
+    const inbox = await call('GET', '/api/users/me/inbox', { token: account });
+    assert.strictEqual(inbox.status, 200);
+    assert.ok(Array.isArray(inbox.body.games));
+  });
+
+  it('refuses an account request with a session token or none', async () => {
+    const { first } = await seated('REST10');
+    for (const token of [undefined, first]) {
+      const { status, body } = await call('GET', '/api/users/me/inbox', { token });
+      assert.strictEqual(status, 401);
+      assert.strictEqual(body.error.code, ErrorCode.UNAUTHORIZED);
+    }
+  });
+
+  it('refuses a forged account token rather than creating the game as a guest', async () => {
+    const { status, body } = await call('POST', '/api/games', { token: 'u1.9999999999999.forged', body: { playerName: 'x', gameId: 'REST11' } });
+    assert.strictEqual(status, 401);
+    assert.strictEqual(body.error.code, ErrorCode.UNAUTHORIZED);
+  });
+});
@@ -0,0 +1,74 @@
+// Cold storage for games nobody is playing any more: gzipped snapshots in one directory,
+// named <ID>-<timestamp>.json.gz so the newest copy of a game sorts last. Retention
+// (retention.cts) archives saves nobody came back to, and the server archives finished
+// games as they leave memory, so a finished game goes
+//
+//   active    being played, in memory
+//   finished  over, in memory, its summary, moves and cells served as they are
+//   archived  gone from memory, kept here; asking for its summary, moves, cells or
+//             snapshot loads it back in for a while, and replay.cjs reads it directly
+//
+// Finished games are only archived when TANKS_ARCHIVE_FINISHED is set; otherwise they
+// are dropped with the other stale games and never written to disk.
+//
+//   TANKS_ARCHIVE_DIR       where archives go (default ./archive)
+//   TANKS_ARCHIVE_FINISHED  minutes a finished game stays in memory before it is archived;
+//                           0 archives it only when it would be dropped anyway
+
+import * as fs from 'fs';
+import * as path from 'path';
+import * as zlib from 'zlib';
+import type { GameSnapshot } from './store.cjs';
+
+const DEFAULT_ARCHIVE_DIR = './archive';
+const MAX_FINISHED_MINUTES = 7 * 24 * 60;
+
+interface ArchivePolicy {
+  finishedMinutes: number;  // How long finished games stay in memory
+  archiveDir: string;
+}
+
+class GameArchive {
+  readonly dir: string;
+
+  constructor(dir: string = process.env.TANKS_ARCHIVE_DIR || DEFAULT_ARCHIVE_DIR) {
+    this.dir = dir;
+  }
+
+  // Write a copy of the game; returns the file and its size
+  put(gameId: string, snapshot: GameSnapshot): { file: string; bytes: number } {
+    const bundle = zlib.gzipSync(JSON.stringify(snapshot, null, 2));
+    fs.mkdirSync(this.dir, { recursive: true });
+    const stamp = snapshot.savedAt.replace(/[^0-9]/g, '').slice(0, 14);
+    const file = path.join(this.dir, `${gameId.toUpperCase()}-${stamp}.json.gz`);
+    fs.writeFileSync(file, bundle);
+    return { file, bytes: bundle.length };
+  }
+
+  // The newest copy of a game, if there is one
+  find(gameId: string): string | null {
+    if (!fs.existsSync(this.dir)) return null;
+    const prefix = `${gameId.toUpperCase()}-`;
+    const copies = fs.readdirSync(this.dir).filter(name => name.startsWith(prefix) && name.endsWith('.json.gz')).sort();
+    return copies.length > 0 ? path.join(this.dir, copies[copies.length - 1]) : null;
+  }
+
+  load(gameId: string): GameSnapshot | null {
+    const file = this.find(gameId);
+    return file ? JSON.parse(zlib.gunzipSync(fs.readFileSync(file)).toString('utf-8')) : null;
+  }
+}
+
+// Whether finished games are archived, from the environment. Invalid settings throw
+// rather than quietly keeping or dropping every finished game.
+function loadArchivePolicy(env: NodeJS.ProcessEnv = process.env): ArchivePolicy | null {
+  if (env.TANKS_ARCHIVE_FINISHED === undefined || env.TANKS_ARCHIVE_FINISHED === '') return null;
+  const finishedMinutes = Number(env.TANKS_ARCHIVE_FINISHED);
+  if (!Number.isInteger(finishedMinutes) || finishedMinutes < 0 || finishedMinutes > MAX_FINISHED_MINUTES) {
+    throw new Error(`TANKS_ARCHIVE_FINISHED must be an integer between 0 and ${MAX_FINISHED_MINUTES}`);
+  }
+  return { finishedMinutes, archiveDir: env.TANKS_ARCHIVE_DIR || DEFAULT_ARCHIVE_DIR };
+}
+
+export { GameArchive, loadArchivePolicy, DEFAULT_ARCHIVE_DIR };
+export type { ArchivePolicy };
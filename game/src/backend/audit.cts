@@ -0,0 +1,88 @@
+// Record of staff actions, kept so moderators and admins can be held to account.
+// Entries stay in memory for the admin API and, when a file is given (TANKS_AUDIT_LOG),
+// are also appended to it as one JSON object per line and read back on startup.
+
+import * as fs from 'fs';
+import type { Permission, Role } from './roles.cjs';
+
+const MAX_ENTRIES = 5000; // Entries kept in memory; the file keeps everything
+const MAX_PAGE_SIZE = 200;
+
+interface AuditEntry {
+  seq: number;
+  timestamp: string;
+  actor: string;
+  role: Role;
+  action: Permission;
+  target: { gameId?: string; playerId?: number; flag?: number };  // Empty for server-wide actions; flag is a moderation flag's seq
+  reason?: string;
+}
+
+interface AuditQuery {
+  actor?: string;
+  action?: string;
+  gameId?: string;
+  since?: string;  // ISO timestamp; only entries at or after it
+  limit?: number;
+}
+
+class AuditLog {
+  private entries: AuditEntry[] = [];
+  private file: string | undefined;
+
+  constructor(file?: string) {
+    this.file = file || undefined;
+    if (!this.file || !fs.existsSync(this.file)) return;
+
+    fs.readFileSync(this.file, 'utf-8').split('\n').forEach(line => {
+      if (!line.trim()) return;
+      try {
+        this.entries.push(JSON.parse(line));
+      } catch {
+        console.error(`Skipping unreadable audit log line in ${this.file}`);
+      }
+    });
+    this.entries = this.entries.slice(-MAX_ENTRIES);
+  }
+
+  record(entry: Omit<AuditEntry, 'seq' | 'timestamp'>): AuditEntry {
+    const last = this.entries[this.entries.length - 1];
+    const recorded: AuditEntry = { seq: (last?.seq ?? 0) + 1, timestamp: new Date().toISOString(), ...entry };
+    this.entries.push(recorded);
+    if (this.entries.length > MAX_ENTRIES) this.entries.shift();
+
+    console.log(`Audit: ${recorded.actor} (${recorded.role}) ${recorded.action} ${JSON.stringify(recorded.target)}${recorded.reason ? `: ${recorded.reason}` : ''}`);
+    if (this.file) {
+      try {
+        fs.appendFileSync(this.file, `${JSON.stringify(recorded)}\n`);
+      } catch (error) {
+        // The action has already happened; losing the file copy must not hide it
+        console.error('Failed to append to the audit log:', error);
+      }
+    }
+    return recorded;
+  }
+
+  // Matching entries, newest first
+  query(query: AuditQuery = {}): AuditEntry[] {
+    const limit = Math.min(Math.max(Number(query.limit) || 50, 1), MAX_PAGE_SIZE);
+    return this.entries
+      .filter(entry => (!query.actor || entry.actor === query.actor) &&
+        (!query.action || entry.action === query.action) &&
+        (!query.gameId || entry.target.gameId === query.gameId.toUpperCase()) &&
+        (!query.since || entry.timestamp >= query.since))
+      .reverse()
+      .slice(0, limit);
+  }
+
+  // Everything staff did about a moderation flag or to any of its games, newest first
+  related(flag: number, gameIds: string[]): AuditEntry[] {
+    return this.entries
+      .filter(entry => entry.target.flag === flag || (entry.target.gameId !== undefined && gameIds.includes(entry.target.gameId)))
+      .reverse()
+      .slice(0, MAX_PAGE_SIZE);
+  }
+}
+
+export { AuditLog };
+export type { AuditEntry, AuditQuery };
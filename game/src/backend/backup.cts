@@ -0,0 +1,228 @@
+// Back up and restore the saved games and player accounts in a store, independent of how
+// the store keeps them. An account carries its rating and stats, so the leaderboard comes
+// back with it. A backup is a single JSON file carrying a SHA-256 digest per game and per
+// account and one over the whole set; restore checks every digest, every snapshot and
+// every account before writing any.
+//
+//   node backup.cjs backup <file>
+//   node backup.cjs restore <file> [--overwrite]
+//
+// Games and accounts go to and from the storage the server uses (TANKS_STORAGE, see
+// store.cts), so a backup also moves them between file and SQLite storage. Restoring skips
+// games and accounts that are already saved unless --overwrite is given. A version 1
+// backup, written before accounts were backed up, restores its games only.
+
+import * as fs from 'fs';
+import * as crypto from 'crypto';
+import { Utils } from './server.cjs';
+import { SNAPSHOT_VERSION, openStorage, type Store, type Storage, type GameSnapshot } from './store.cjs';
+import type { AccountRepository, UserAccount } from './accounts.cjs';
+
+const BACKUP_FORMAT = 'tanks-backup';
+const BACKUP_VERSION = 2;
+const READABLE_VERSIONS = [1, BACKUP_VERSION];
+const STAT_FIELDS = ['gamesPlayed', 'wins', 'losses', 'shots', 'hits', 'ratedGames', 'timedMoves', 'thinkMs', 'gradedShots', 'shotQuality'];
+
+interface BackupEntry {
+  gameId: string;
+  sha256: string;  // Of the snapshot's JSON
+  snapshot: GameSnapshot;
+}
+
+interface AccountEntry {
+  userId: string;
+  sha256: string;  // Of the account's JSON
+  account: UserAccount;
+}
+
+interface Backup {
+  format: string;
+  version: number;
+  createdAt: string;
+  sha256: string;  // Of the entries' JSON, so a dropped or reordered game or account is noticed too
+  games: BackupEntry[];
+  users: AccountEntry[];
+}
+
+interface RestoreResult {
+  restored: string[];  // Game ids
+  skipped: string[];
+  restoredUsers: string[];  // User ids
+  skippedUsers: string[];
+}
+
+function digest(value: unknown): string {
+  return crypto.createHash('sha256').update(JSON.stringify(value)).digest('hex');
+}
+
+// What the whole-set digest covers: version 1 backups have games only
+function contents(backup: any): unknown {
+  return backup.version === 1 ? backup.games : { games: backup.games, users: backup.users };
+}
+
+// Read every saved game and account. Each snapshot is written atomically, so each one
+// read is whole.
+function createBackup(store: Store, accounts: AccountRepository): Backup {
+  const games: BackupEntry[] = [];
+  store.list().sort().forEach(gameId => {
+    const snapshot = store.load(gameId);
+    if (snapshot) games.push({ gameId, sha256: digest(snapshot), snapshot });
+  });
+  const users: AccountEntry[] = accounts.loadAll()
+    .sort((a, b) => a.id.localeCompare(b.id))
+    .map(account => ({ userId: account.id, sha256: digest(account), account }));
+  const backup = { format: BACKUP_FORMAT, version: BACKUP_VERSION, createdAt: new Date().toISOString(), games, users };
+  return { ...backup, sha256: digest(contents(backup)) };
+}
+
+// What is wrong with an account's fields, if anything
+function accountProblem(account: any): string | null {
+  const missing = ['id', 'name', 'passwordHash', 'createdAt'].filter(field => typeof account[field] !== 'string');
+  if (missing.length > 0) return `${missing.join(', ')} missing`;
+  if (!Number.isFinite(account.rating)) return 'rating is not a number';
+  const stats = STAT_FIELDS.filter(field => !Number.isFinite(account.stats?.[field]));
+  if (stats.length > 0) return `stats ${stats.join(', ')} missing`;
+  if (!Array.isArray(account.privacy?.friends)) return 'privacy is missing';
+  return null;
+}
+
+// Every problem with a backup, or none if it is safe to restore
+function verifyBackup(backup: any): string[] {
+  if (backup?.format !== BACKUP_FORMAT || !READABLE_VERSIONS.includes(backup.version)) {
+    return [`not a version ${READABLE_VERSIONS.join(' or ')} ${BACKUP_FORMAT} file`];
+  }
+  if (!Array.isArray(backup.games)) return ['games is missing'];
+  if (backup.version !== 1 && !Array.isArray(backup.users)) return ['users is missing'];
+  if (digest(contents(backup)) !== backup.sha256) return ['checksum mismatch: the file was modified or is incomplete'];
+
+  const problems: string[] = [];
+  const seen = new Set<string>();
+  backup.games.forEach((entry: any, index: number) => {
+    const label = `game ${entry?.gameId ?? `#${index + 1}`}`;
+    if (digest(entry?.snapshot) !== entry?.sha256) {
+      problems.push(`${label}: checksum mismatch`);
+      return;
+    }
+    if (seen.has(entry.gameId)) problems.push(`${label}: listed twice`);
+    seen.add(entry.gameId);
+    if (entry.snapshot.version !== SNAPSHOT_VERSION) {
+      problems.push(`${label}: snapshot version ${entry.snapshot.version}, expected ${SNAPSHOT_VERSION}`);
+      return;
+    }
+    try {
+      const game = Utils.restoreGame(entry.snapshot.game);
+      if (game.id !== entry.gameId) problems.push(`${label}: snapshot is of game ${game.id}`);
+    } catch (error) {
+      problems.push(`${label}: ${(error as Error).message}${(error as any).fields ? ` (${JSON.stringify((error as any).fields)})` : ''}`);
+    }
+  });
+
+  const seenUsers = new Set<string>();
+  const names = new Set<string>();
+  (backup.users ?? []).forEach((entry: any, index: number) => {
+    const label = `account ${entry?.userId ?? `#${index + 1}`}`;
+    if (digest(entry?.account) !== entry?.sha256) {
+      problems.push(`${label}: checksum mismatch`);
+      return;
+    }
+    if (seenUsers.has(entry.userId)) problems.push(`${label}: listed twice`);
+    seenUsers.add(entry.userId);
+    const problem = accountProblem(entry.account);
+    if (problem) {
+      problems.push(`${label}: ${problem}`);
+      return;
+    }
+    if (entry.account.id !== entry.userId) problems.push(`${label}: account is ${entry.account.id}`);
+    // Names are unique regardless of case, as the users table has them
+    if (names.has(entry.account.name.toLowerCase())) problems.push(`${label}: name ${entry.account.name} is taken twice`);
+    names.add(entry.account.name.toLowerCase());
+  });
+  return problems;
+}
+
+// Write a verified backup's games and accounts into the store; returns the ids written and
+// skipped. An account may not take the name of a different saved one.
+function restoreBackup(store: Store, accounts: AccountRepository, backup: Backup, overwrite: boolean = false): RestoreResult {
+  const problems = verifyBackup(backup);
+  const saved = accounts.loadAll();
+  const takenNames = new Map(saved.map(account => [account.name.toLowerCase(), account.id]));
+  (backup.users ?? []).forEach(({ userId, account }) => {
+    const owner = takenNames.get(account.name.toLowerCase());
+    if (owner !== undefined && owner !== userId) problems.push(`account ${userId}: name ${account.name} belongs to saved account ${owner}`);
+  });
+  if (problems.length > 0) {
+    throw new Error(`Backup cannot be restored:\n  ${problems.join('\n  ')}`);
+  }
+
+  const existing = new Set(store.list().map(id => id.toUpperCase()));
+  const restored: string[] = [];
+  const skipped: string[] = [];
+  backup.games.forEach(({ gameId, snapshot }) => {
+    if (existing.has(gameId.toUpperCase()) && !overwrite) {
+      skipped.push(gameId);
+      return;
+    }
+    store.save(gameId, snapshot);
+    restored.push(gameId);
+  });
+
+  const existingUsers = new Set(saved.map(account => account.id));
+  const restoredUsers: string[] = [];
+  const skippedUsers: string[] = [];
+  (backup.users ?? []).forEach(({ userId, account }) => {
+    if (existingUsers.has(userId) && !overwrite) {
+      skippedUsers.push(userId);
+      return;
+    }
+    accounts.save(account);
+    restoredUsers.push(userId);
+  });
+  return { restored, skipped, restoredUsers, skippedUsers };
+}
+
+function main(args: string[]): void {
+  const [command, file] = args.filter(arg => !arg.startsWith('--'));
+  if ((command !== 'backup' && command !== 'restore') || !file) {
+    console.error('Usage: node backup.cjs backup <file>\n       node backup.cjs restore <file> [--overwrite]');
+    process.exit(2);
+  }
+
+  let storage: Storage;
+  try {
+    storage = openStorage();
+  } catch (error) {
+    console.error((error as Error).message);
+    process.exit(2);
+  }
+
+  const { store, accounts, description } = storage;
+  try {
+    if (command === 'backup') {
+      const backup = createBackup(store, accounts);
+      fs.writeFileSync(`${file}.tmp`, JSON.stringify(backup, null, 2));
+      fs.renameSync(`${file}.tmp`, file);
+      console.log(`Backed up ${backup.games.length} game(s) and ${backup.users.length} account(s) from ${description} to ${file}`);
+    } else {
+      const backup = JSON.parse(fs.readFileSync(file, 'utf-8'));
+      const { restored, skipped, restoredUsers, skippedUsers } = restoreBackup(store, accounts, backup, args.includes('--overwrite'));
+      console.log(`Restored ${restored.length} game(s) and ${restoredUsers.length} account(s) into ${description}`);
+      if (skipped.length > 0) {
+        console.log(`Skipped ${skipped.length} game(s) already saved (use --overwrite to replace): ${skipped.join(', ')}`);
+      }
+      if (skippedUsers.length > 0) {
+        console.log(`Skipped ${skippedUsers.length} account(s) already saved (use --overwrite to replace): ${skippedUsers.join(', ')}`);
+      }
+    }
+  } catch (error) {
+    console.error((error as Error).message);
+    process.exit(1);
+  }
+  process.exit(0);
+}
+
+if (require.main === module) {
+  main(process.argv.slice(2));
+}
+
+export { createBackup, verifyBackup, restoreBackup };
+export type { Backup, BackupEntry, AccountEntry, RestoreResult };
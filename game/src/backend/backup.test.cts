@@ -0,0 +1,190 @@
+// Backups: what verifyBackup catches before a restore writes anything, and games and
+// accounts coming back exactly as they were backed up. Run with `npm test`.
+
+import { describe, it } from 'node:test';
+import * as assert from 'assert';
+import * as crypto from 'crypto';
+import { createBackup, verifyBackup, restoreBackup, type Backup } from './backup.cjs';
+import { MemoryStore, type GameSnapshot } from './store.cjs';
+import type { AccountRepository, UserAccount } from './accounts.cjs';
+
+// Accounts held in the process; the file repository only reads back what is on disk
+class MemoryAccounts implements AccountRepository {
+  users: Map<string, UserAccount> = new Map();
+
+  loadAll(): UserAccount[] {
+    return [...this.users.values()].map(user => structuredClone(user));
+  }
+
+  save(user: UserAccount): void {
+    this.users.set(user.id, structuredClone(user));
+  }
+}
+
+function snapshot(id: string): GameSnapshot {
+  const board = Array.from({ length: 8 }, () => Array(8).fill(0));
+  return {
+    version: 1,
+    savedAt: '2026-05-01T12:00:00.000Z',
+    game: {
+      id,
+      phase: 'placement',
+      rulesVersion: 1,
+      config: { boardSize: 8 },
+      moveCount: 0,
+      players: [{ name: 'a', board, visibleEnemyBoard: board, tanks: [], resumeToken: 'token' }]
+    }
+  };
+}
+
+function account(id: string, name: string, rating: number): UserAccount {
+  return {
+    id,
+    name,
+    passwordHash: 'aa:bb',
+    createdAt: '2026-01-01T00:00:00.000Z',
+    rating,
+    stats: { gamesPlayed: 4, wins: 3, losses: 1, shots: 50, hits: 14, ratedGames: 4, timedMoves: 50, thinkMs: 61000, gradedShots: 0, shotQuality: 0 },
+    privacy: { profile: 'public', history: 'friends', liveGames: 'private', friends: [] }
+  };
+}
+
+function source(): { store: MemoryStore; accounts: MemoryAccounts } {
+  const store = new MemoryStore();
+  store.save('ABCD', snapshot('ABCD'));
+  store.save('EFGH', snapshot('EFGH'));
+  const accounts = new MemoryAccounts();
+  accounts.save(account('u2', 'bob', 980));
+  accounts.save(account('u1', 'alice', 1234));
+  return { store, accounts };
+}
+
+const sha256 = (value: unknown) => crypto.createHash('sha256').update(JSON.stringify(value)).digest('hex');
+
+// Edit a backup and put right every digest, as someone forging one would
+function forged(backup: Backup, edit: (copy: Backup) => void): Backup {
+  const copy: Backup = structuredClone(backup);
+  edit(copy);
+  copy.games.forEach(entry => { entry.sha256 = sha256(entry.snapshot); });
+  copy.users.forEach(entry => { entry.sha256 = sha256(entry.account); });
+  copy.sha256 = sha256({ games: copy.games, users: copy.users });
+  return copy;
+}
+
+describe('createBackup', () => {
+  it('takes every game and account, in order, with their digests', () => {
+    const { store, accounts } = source();
+    const backup = createBackup(store, accounts);
+    assert.deepStrictEqual(backup.games.map(entry => entry.gameId), ['ABCD', 'EFGH']);
+    assert.deepStrictEqual(backup.users.map(entry => entry.userId), ['u1', 'u2']);
+    assert.strictEqual(backup.users[0].sha256, sha256(backup.users[0].account));
+    assert.deepStrictEqual(verifyBackup(JSON.parse(JSON.stringify(backup))), []);
+  });
+});
+
+describe('verifyBackup', () => {
+  const backup = createBackup(source().store, source().accounts);
+
+  it('notices any change, dropped entry or reordering', () => {
+    const changed: Backup = structuredClone(backup);
+    changed.users[0].account.rating = 3000;
+    const dropped: Backup = structuredClone(backup);
+    dropped.games.pop();
+    const reordered: Backup = structuredClone(backup);
+    reordered.users.reverse();
+    [changed, dropped, reordered].forEach(copy => {
+      assert.deepStrictEqual(verifyBackup(copy), ['checksum mismatch: the file was modified or is incomplete']);
+    });
+  });
+
+  it('checks each entry against its own digest', () => {
+    const copy = forged(backup, () => { });
+    copy.users[1].account.rating = 3000;
+    copy.sha256 = sha256({ games: copy.games, users: copy.users });
+    assert.deepStrictEqual(verifyBackup(copy), ['account u2: checksum mismatch']);
+  });
+
+  it('refuses snapshots the server could not load', () => {
+    const copy = forged(backup, copy => {
+      copy.games[0].snapshot.game.phase = 'exploded';
+      copy.games[1].snapshot.version = 99;
+    });
+    assert.deepStrictEqual(verifyBackup(copy).map(problem => problem.split(':')[0]), ['game ABCD', 'game EFGH']);
+  });
+
+  it('refuses accounts that are incomplete, listed twice or share a name', () => {
+    const copy = forged(backup, copy => {
+      copy.users.push(structuredClone(copy.users[0]));
+      copy.users.push({ ...copy.users[1], userId: 'u3', account: { ...copy.users[1].account, id: 'u3', name: 'ALICE' } });
+      copy.users.push({ ...copy.users[1], userId: 'u4', account: { ...copy.users[1].account, id: 'u4', rating: 'high' as any } });
+    });
+    assert.deepStrictEqual(verifyBackup(copy), [
+      'account u1: listed twice',
+      'account u1: name alice is taken twice',
+      'account u3: name ALICE is taken twice',
+      'account u4: rating is not a number'
+    ]);
+  });
+
+  it('refuses files that are not backups', () => {
+    [null, {}, { ...backup, format: 'zip' }, { ...backup, version: 3 }].forEach(file => {
+      assert.deepStrictEqual(verifyBackup(file), ['not a version 1 or 2 tanks-backup file']);
+    });
+    assert.deepStrictEqual(verifyBackup({ ...backup, users: undefined }), ['users is missing']);
+  });
+});
+
+describe('restoreBackup', () => {
+  it('brings back the games and accounts as they were', () => {
+    const original = source();
+    const backup = JSON.parse(JSON.stringify(createBackup(original.store, original.accounts)));
+    const store = new MemoryStore();
+    const accounts = new MemoryAccounts();
+    assert.deepStrictEqual(restoreBackup(store, accounts, backup), {
+      restored: ['ABCD', 'EFGH'], skipped: [], restoredUsers: ['u1', 'u2'], skippedUsers: []
+    });
+    assert.deepStrictEqual(store.load('ABCD'), original.store.load('ABCD'));
+    assert.deepStrictEqual(accounts.loadAll().sort((a, b) => a.id.localeCompare(b.id)), original.accounts.loadAll().sort((a, b) => a.id.localeCompare(b.id)));
+  });
+
+  it('skips what is already saved unless told to overwrite it', () => {
+    const { store, accounts } = source();
+    const backup = createBackup(store, accounts);
+    accounts.save(account('u1', 'alice', 1500));
+    assert.deepStrictEqual(restoreBackup(store, accounts, backup), {
+      restored: [], skipped: ['ABCD', 'EFGH'], restoredUsers: [], skippedUsers: ['u1', 'u2']
+    });
+    assert.strictEqual(accounts.users.get('u1')!.rating, 1500);
+
+    restoreBackup(store, accounts, backup, true);
+    assert.strictEqual(accounts.users.get('u1')!.rating, 1234);
+  });
+
+  it('writes nothing when a name belongs to a different saved account', () => {
+    const backup = createBackup(source().store, source().accounts);
+    const store = new MemoryStore();
+    const accounts = new MemoryAccounts();
+    accounts.save(account('u9', 'Alice', 1000));
+    assert.throws(() => restoreBackup(store, accounts, backup), /account u1: name alice belongs to saved account u9/);
+    assert.deepStrictEqual(store.list(), []);
+    assert.deepStrictEqual([...accounts.users.keys()], ['u9']);
+  });
+
+  it('writes nothing from a backup that fails verification', () => {
+    const backup = forged(createBackup(source().store, source().accounts), copy => { copy.games[1].snapshot.game.id = '!'; });
+    const store = new MemoryStore();
+    const accounts = new MemoryAccounts();
+    assert.throws(() => restoreBackup(store, accounts, backup), /Backup cannot be restored/);
+    assert.deepStrictEqual(store.list(), []);
+    assert.strictEqual(accounts.users.size, 0);
+  });
+
+  it('restores the games of a version 1 backup, which has no accounts', () => {
+    const { games } = createBackup(source().store, source().accounts);
+    const backup = { format: 'tanks-backup', version: 1, createdAt: '2025-01-01T00:00:00.000Z', sha256: sha256(games), games } as any;
+    assert.deepStrictEqual(verifyBackup(backup), []);
+    assert.deepStrictEqual(restoreBackup(new MemoryStore(), new MemoryAccounts(), backup), {
+      restored: ['ABCD', 'EFGH'], skipped: [], restoredUsers: [], skippedUsers: []
+    });
+  });
+});
@@ -0,0 +1,247 @@
+// Bots: opponents written as separate programs, in any language, that the server runs
+// and talks to over their stdin and stdout. A bot seat is a ServerSeat like an AI seat
+// (see seat.cts) and is held to the same rules; the program only has to read one
+// JSON object per line and, when asked for a move, answer with one line of its own.
+//
+//   -> { "type": "start", "protocol": 1, "playerId": 1, "config": {...}, "cells": { "empty": 0, ... }, "moveTimeMs": 2000 }
+//   -> { "type": "place", "lengths": [1, 1, 1], "moveTimeMs": 2000 }
+//   <- { "tanks": [{ "x": 0, "y": 0, "orientation": "horizontal" }, ...] }
+//   -> { "type": "bomb", "moveCount": 6, "myBoard": [[...]], "enemyBoard": [[...]], "myTanks": 3, "enemyTanks": 2, "moveTimeMs": 2000 }
+//   <- { "x": 3, "y": 4 }
+//   -> { "type": "gameOver", "won": true }
+//
+// Boards are rows of cells, y then x, from the top-left, holding the numbers in `cells`;
+// the enemy board is what the fog shows. A reply that is late, not JSON, or not a legal
+// move is answered with { "type": "illegal" | "timeout", "reason", "played" } and
+// the seat plays a random legal move in its place, so a broken bot loses games rather
+// than stalling them. Anything the program writes to stderr goes to the server log.
+//
+// Operators register bots with TANKS_BOTS (inline JSON), naming the command to run for each:
+//   { "alice": ["python3", "bots/alice.py"], "bob": { "command": ["./bob"], "moveTimeMs": 500 } }
+// TANKS_BOT_MOVE_MS sets the default time a bot has for each reply. Players pick a bot
+// with playBot; botmatch.cts plays one against the built-in AI from the command line.
+
+import * as crypto from 'crypto';
+import * as readline from 'readline';
+import { spawn, type ChildProcess } from 'child_process';
+import { WebSocket } from 'ws';
+import type { GameManager } from './server.cjs';
+import { ServerSeat } from './seat.cjs';
+import { requireIntegers, type GameError } from './errors.cjs';
+import { Rules, CellState, type GameConfig } from './game.cjs';
+import { AI_STRATEGIES, generatePlacements } from './ai.cjs';
+
+const BOT_PROTOCOL_VERSION = 1;
+const BOT_NAME_PATTERN = /^[A-Za-z0-9_-]{1,20}$/;
+const DEFAULT_MOVE_TIME_MS = 2000;
+const MAX_MOVE_TIME_MS = 60 * 1000;
+const EXIT_GRACE_MS = 1000;  // How long a bot has to exit after the game before it is killed
+
+interface BotDefinition {
+  name: string;
+  command: string[];  // Program and its arguments; run directly, not through a shell
+  moveTimeMs: number;
+}
+
+// The move the seat is waiting on the program for
+interface PendingMove {
+  key: string;  // Phase and move number, so a repeated gameState doesn't ask twice
+  timer: NodeJS.Timeout;
+  onReply: (reply: any) => void;  // Throws if the reply is not a legal move
+  fallback: () => string;         // Plays a random legal move and describes it
+}
+
+function requireMoveTime(ms: unknown, setting: string): number {
+  if (!Number.isInteger(ms) || (ms as number) < 1 || (ms as number) > MAX_MOVE_TIME_MS) {
+    throw new Error(`${setting} must be an integer between 1 and ${MAX_MOVE_TIME_MS}`);
+  }
+  return ms as number;
+}
+
+// The bots named in the environment. Invalid settings throw, so a typo cannot quietly
+// leave a bot unregistered.
+function loadBots(env: NodeJS.ProcessEnv = process.env): Record<string, BotDefinition> {
+  const defaultMoveTime = requireMoveTime(env.TANKS_BOT_MOVE_MS ? Number(env.TANKS_BOT_MOVE_MS) : DEFAULT_MOVE_TIME_MS, 'TANKS_BOT_MOVE_MS');
+  if (!env.TANKS_BOTS) return {};
+
+  let entries: Record<string, any>;
+  try {
+    entries = JSON.parse(env.TANKS_BOTS);
+  } catch {
+    throw new Error('TANKS_BOTS must be a JSON object');
+  }
+  if (!entries || typeof entries !== 'object' || Array.isArray(entries)) {
+    throw new Error('TANKS_BOTS must be a JSON object');
+  }
+
+  const bots: Record<string, BotDefinition> = {};
+  Object.entries(entries).forEach(([name, value]) => {
+    const command = Array.isArray(value) ? value : value?.command;
+    if (!BOT_NAME_PATTERN.test(name)) {
+      throw new Error(`TANKS_BOTS: ${name} is not a valid name; use 1-20 letters, digits, - or _`);
+    }
+    if (!Array.isArray(command) || command.length === 0 || !command.every(part => typeof part === 'string' && part.length > 0)) {
+      throw new Error(`TANKS_BOTS: ${name} needs a command, as a list of the program and its arguments`);
+    }
+    const moveTimeMs = Array.isArray(value) ? defaultMoveTime : requireMoveTime(value.moveTimeMs ?? defaultMoveTime, `TANKS_BOTS: ${name} moveTimeMs`);
+    bots[name] = { name, command, moveTimeMs };
+  });
+  return bots;
+}
+
+// Why a bomb at (x, y) can't be dropped, or null if it can
+function illegalShot(config: GameConfig, enemyBoard: number[][], x: unknown, y: unknown): string | null {
+  if (!Number.isInteger(x) || !Number.isInteger(y)) return 'x and y must be whole numbers';
+  if (!Rules.isValidPosition(x as number, y as number, config.boardSize)) return `(${x}, ${y}) is off the ${config.boardSize}x${config.boardSize} board`;
+  const cell = enemyBoard[y as number][x as number];
+  if (cell === CellState.HIT || cell === CellState.MISS) return `(${x}, ${y}) has already been bombed`;
+  return null;
+}
+
+// One seat played by an external program. ServerSeat plays it; the program is asked for
+// each move the seat owes.
+class BotPlayer extends ServerSeat {
+  readonly name: string;
+  private definition: BotDefinition;
+  private child: ChildProcess;
+  private exited: boolean = false;
+  private started: boolean = false;
+  private asked: string | null = null;  // Key of the last move asked for
+  private pending: PendingMove | null = null;
+
+  constructor(gameManager: GameManager, definition: BotDefinition) {
+    super(gameManager, `Bot ${definition.name}`, 0);
+    this.definition = definition;
+    this.name = definition.name;
+
+    const [program, ...args] = definition.command;
+    this.child = spawn(program, args, { stdio: ['pipe', 'pipe', 'pipe'] });
+    readline.createInterface({ input: this.child.stdout! }).on('line', line => this.receive(line));
+    readline.createInterface({ input: this.child.stderr! }).on('line', line => console.log(`Bot ${this.name}: ${line}`));
+    this.child.stdin!.on('error', () => {});  // A bot that has exited can't be written to; 'exit' deals with it
+    this.child.on('error', error => this.lost(`could not be started: ${error.message}`));
+    this.child.on('exit', code => this.lost(`exited with code ${code}`));
+  }
+
+  close(): void {
+    super.close();
+    if (this.pending) clearTimeout(this.pending.timer);
+    this.pending = null;
+    if (!this.exited) {
+      this.child.stdin!.end();
+      setTimeout(() => this.child.kill(), EXIT_GRACE_MS).unref();
+    }
+  }
+
+  protected observe(state: any): void {
+    if (!this.started && state.phase !== 'waiting') {
+      this.started = true;
+      const cells = Object.fromEntries(Object.entries(CellState).filter(([, value]) => typeof value === 'number').map(([name, value]) => [name.toLowerCase(), value]));
+      this.write({ type: 'start', protocol: BOT_PROTOCOL_VERSION, playerId: state.playerId, config: state.config, cells, moveTimeMs: this.definition.moveTimeMs });
+    }
+  }
+
+  protected placeTanks(state: any): void {
+    const config: GameConfig = state.config;
+    const lengths = Array.from({ length: config.tanksPerPlayer }, (_, i) => Rules.tankLength(config, i));
+    this.ask('placement', { type: 'place', lengths }, reply => {
+      // Laid out on a scratch fleet first, so a bad layout leaves nothing half placed
+      const tanks = reply?.tanks;
+      if (!Array.isArray(tanks) || tanks.length !== config.tanksPerPlayer) throw new Error(`tanks must list ${config.tanksPerPlayer} tanks`);
+      const scratch = Rules.createSide(config);
+      tanks.forEach(tank => {
+        requireIntegers(tank ?? {}, ['x', 'y']);
+        Rules.placeTank(config, scratch, tank.x, tank.y, tank.orientation ?? 'horizontal');
+      });
+      this.placeFleet(tanks);
+    }, () => {
+      const tanks = generatePlacements(config.boardSize, lengths, false);
+      this.placeFleet(tanks);
+      return `tanks at ${tanks.map(({ x, y }) => `(${x}, ${y})`).join(', ')}`;
+    });
+  }
+
+  protected takeTurn(state: any): void {
+    const config: GameConfig = state.config;
+    const request = {
+      type: 'bomb', moveCount: state.moveCount, myBoard: state.myBoard, enemyBoard: state.enemyBoard,
+      myTanks: state.myTanks, enemyTanks: state.enemyTanks
+    };
+    this.ask(`bomb#${state.moveCount}`, request, reply => {
+      const reason = illegalShot(config, state.enemyBoard, reply?.x, reply?.y);
+      if (reason) throw new Error(reason);
+      this.bomb(reply);
+    }, () => {
+      const target = AI_STRATEGIES.easy.chooseTarget({ enemyBoard: state.enemyBoard, explosionRadius: config.explosionRadius, random: crypto.randomInt });
+      this.bomb(target);
+      return `a bomb at (${target.x}, ${target.y})`;
+    });
+  }
+
+  protected gameOver(state: any): void {
+    if (this.asked !== 'gameOver') {
+      this.asked = 'gameOver';
+      this.write({ type: 'gameOver', won: state.winner === state.playerId });
+      this.child.stdin!.end();
+    }
+  }
+
+  // Ask the program for a move, once per key. A late, malformed or illegal reply is
+  // answered with the random move played in its place.
+  private ask(key: string, request: Record<string, any>, onReply: (reply: any) => void, fallback: () => string): void {
+    if (this.asked === key) return;
+    this.asked = key;
+    if (this.exited) {
+      fallback();
+      return;
+    }
+
+    const timer = setTimeout(() => {
+      if (this.pending?.key !== key) return;
+      this.pending = null;
+      this.write({ type: 'timeout', reason: `no reply within ${this.definition.moveTimeMs}ms`, played: fallback() });
+    }, this.definition.moveTimeMs);
+    this.pending = { key, timer, onReply, fallback };
+    this.write({ ...request, moveTimeMs: this.definition.moveTimeMs });
+  }
+
+  private receive(line: string): void {
+    const pending = this.pending;
+    if (!pending) {
+      if (line.trim()) console.log(`Bot ${this.name} replied out of turn: ${line.slice(0, 200)}`);
+      return;
+    }
+    clearTimeout(pending.timer);
+    this.pending = null;
+
+    try {
+      pending.onReply(JSON.parse(line));
+    } catch (error) {
+      const fields = (error as GameError).fields?.map(f => `${f.field} ${f.reason}`).join('; ');
+      const reason = error instanceof SyntaxError ? 'reply is not JSON' : fields || (error as Error).message;
+      console.log(`Bot ${this.name} made an illegal move: ${reason}`);
+      this.write({ type: 'illegal', reason, played: pending.fallback() });
+    }
+  }
+
+  // The program has gone; whatever it still owes is played at random, as is the rest of the game
+  private lost(reason: string): void {
+    if (this.exited) return;
+    this.exited = true;
+    if (this.readyState !== WebSocket.OPEN || this.asked === 'gameOver') return;
+    console.log(`Bot ${this.name} ${reason}; playing at random from here`);
+    const pending = this.pending;
+    this.pending = null;
+    if (pending) {
+      clearTimeout(pending.timer);
+      pending.fallback();
+    }
+  }
+
+  private write(message: Record<string, any>): void {
+    if (!this.exited) this.child.stdin!.write(`${JSON.stringify(message)}\n`);
+  }
+}
+
+export { BotPlayer, BOT_PROTOCOL_VERSION, DEFAULT_MOVE_TIME_MS, loadBots, requireMoveTime, illegalShot };
+export type { BotDefinition };
@@ -0,0 +1,77 @@
+// Play a bot (see bot.cts) against the built-in AI at the command line, to try one out
+// before registering it on a server. The game runs on a server of its own in memory,
+// under the same rules, time limit and illegal-move handling as a real one, and every
+// bomb is printed as it lands. The program's stderr is shown as it runs.
+//
+//   node botmatch.cjs [--against easy|medium|hard] [--move-time MS] [--no-color] [server flags] -- <program> [args...]
+
+import { WebSocket } from 'ws';
+import { GameManager, GamePhase, Utils } from './server.cjs';
+import type { GameError } from './errors.cjs';
+import { Rules, DEFAULT_CONFIG } from './game.cjs';
+import { AiPlayer, AI_DIFFICULTIES, type AiDifficulty } from './ai.cjs';
+import { BotPlayer, DEFAULT_MOVE_TIME_MS, requireMoveTime } from './bot.cjs';
+import { MemoryStore } from './store.cjs';
+import { formatCell } from './coords.cjs';
+import { renderBoards, useColor } from './render.cjs';
+
+const USAGE = 'Usage: node botmatch.cjs [--against easy|medium|hard] [--move-time MS] [--no-color] [server flags] -- <program> [args...]';
+
+function main(args: string[]): void {
+  const split = args.indexOf('--');
+  const command = split === -1 ? [] : args.slice(split + 1);
+  const options = split === -1 ? args : args.slice(0, split);
+  const valueOf = (flag: string) => {
+    const at = options.indexOf(flag);
+    return at === -1 ? undefined : options[at + 1];
+  };
+  const own = new Set(['--against', '--move-time']);
+  const serverFlags = options.filter((arg, i) => arg !== '--no-color' && !own.has(arg) && !own.has(options[i - 1]));
+
+  let difficulty: AiDifficulty;
+  let moveTimeMs: number;
+  let config = DEFAULT_CONFIG;
+  try {
+    if (command.length === 0) throw new Error('Name the bot program to run after --');
+    difficulty = (valueOf('--against') ?? 'hard') as AiDifficulty;
+    if (!AI_DIFFICULTIES.includes(difficulty)) throw new Error(`--against must be one of ${AI_DIFFICULTIES.join(', ')}`);
+    moveTimeMs = requireMoveTime(valueOf('--move-time') === undefined ? DEFAULT_MOVE_TIME_MS : Number(valueOf('--move-time')), '--move-time');
+    config = Rules.resolveConfig(Utils.parseServerArgs(serverFlags).config);
+  } catch (error) {
+    const fields: { field: string; reason: string }[] = (error as GameError).fields ?? [];
+    console.error([(error as Error).message, ...fields.map(f => `  ${f.field} ${f.reason}`)].join('\n'));
+    console.error(USAGE);
+    process.exit(2);
+  }
+  const color = useColor(options);
+
+  const gameManager = new GameManager(undefined, config, new MemoryStore());  // Nothing from a trial game is kept
+  const ai = new AiPlayer(gameManager, difficulty);
+  const bot = new BotPlayer(gameManager, { name: 'bot', command, moveTimeMs });
+  const names = [`AI (${difficulty})`, `Bot (${command[0]})`];
+
+  gameManager.events.subscribe('botmatch', event => {
+    if (event.type === 'bombResolved') {
+      const outcome = event.destroyed ? 'destroyed a tank' : event.hit ? 'hit' : 'miss';
+      console.log(`${names[event.playerId]} bombs ${formatCell(config.coordinates, event.x, event.y)}: ${outcome} (${event.thinkMs}ms)`);
+    } else if (event.type === 'gameOver') {
+      const players = gameManager.getSnapshot(event.gameId).game.players;
+      console.log('');
+      console.log(renderBoards(players.map((player, i) => ({ title: names[i], board: Rules.boardView(player).myBoard })), { color }));
+      console.log(`\n${names[event.result.result.winner]} wins after ${event.result.result.moveCount} moves`);
+      // Let the bot hear the result before everything stops
+      setTimeout(() => process.exit(0), 200);
+    }
+  });
+
+  const gameId = gameManager.createGame();
+  gameManager.joinGame(gameId, ai as unknown as WebSocket, names[0]);
+  gameManager.joinGame(gameId, bot as unknown as WebSocket, names[1]);
+  if (gameManager.getPhase(gameId) === GamePhase.SETUP) {
+    gameManager.acceptSettings(gameId, 1);
+  }
+}
+
+if (require.main === module) {
+  main(process.argv.slice(2));
+}
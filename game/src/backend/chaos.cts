@@ -0,0 +1,159 @@
+// Fault injection, to exercise reconnection, idempotent retries and recovery from storage
+// failures against a real server instead of waiting for them to happen. Three faults can be
+// turned on, each at its own rate:
+//
+//   storageErrors  chance that a save, load, removal or listing of saved games fails
+//   eventDelayMs   longest delay added before a message reaches a WebSocket client; each
+//                  message waits a random time up to it, and messages keep their order
+//   dropRate       chance that a message from a WebSocket client is lost and its
+//                  connection dropped instead of the message being handled
+//
+// The injector only exists when the server is started with TANKS_CHAOS=1, and never when
+// NODE_ENV is production. It starts with every fault off; staff turn them on and off
+// through the admin API (PUT /api/chaos, see api.cts) without a restart.
+
+import { WebSocket } from 'ws';
+import { ErrorCode, GameError, type FieldError } from './errors.cjs';
+import type { Store, GameSnapshot } from './store.cjs';
+
+const MAX_EVENT_DELAY_MS = 60 * 1000;
+
+interface FaultSettings {
+  storageErrors: number;
+  eventDelayMs: number;
+  dropRate: number;
+}
+
+// How many of each fault have been injected since the server started
+interface FaultCounts {
+  storageErrors: number;
+  delayedMessages: number;
+  droppedConnections: number;
+}
+
+interface ChaosStatus {
+  enabled: boolean;
+  settings: FaultSettings;
+  injected: FaultCounts;
+}
+
+const NO_FAULTS: FaultSettings = { storageErrors: 0, eventDelayMs: 0, dropRate: 0 };
+
+function chaosEnabled(env: NodeJS.ProcessEnv = process.env): boolean {
+  return env.TANKS_CHAOS === '1' && env.NODE_ENV !== 'production';
+}
+
+class FaultInjector {
+  readonly enabled: boolean;
+  private settings: FaultSettings = { ...NO_FAULTS };
+  private injected: FaultCounts = { storageErrors: 0, delayedMessages: 0, droppedConnections: 0 };
+  private random: () => number;
+
+  constructor(enabled: boolean = chaosEnabled(), random: () => number = Math.random) {
+    this.enabled = enabled;
+    this.random = random;
+  }
+
+  status(): ChaosStatus {
+    return { enabled: this.enabled, settings: { ...this.settings }, injected: { ...this.injected } };
+  }
+
+  // Change some of the settings; the rest stay as they were
+  configure(changes: Partial<Record<keyof FaultSettings, unknown>>): ChaosStatus {
+    this.requireEnabled();
+    const errors: FieldError[] = [];
+    const next = { ...this.settings };
+    (['storageErrors', 'dropRate'] as const).forEach(field => {
+      const value = changes[field];
+      if (value === undefined) return;
+      if (typeof value !== 'number' || !(value >= 0 && value <= 1)) {
+        errors.push({ field, reason: 'must be a number from 0 to 1' });
+      } else {
+        next[field] = value;
+      }
+    });
+    if (changes.eventDelayMs !== undefined) {
+      const value = changes.eventDelayMs;
+      if (typeof value !== 'number' || !Number.isInteger(value) || value < 0 || value > MAX_EVENT_DELAY_MS) {
+        errors.push({ field: 'eventDelayMs', reason: `must be an integer from 0 to ${MAX_EVENT_DELAY_MS}` });
+      } else {
+        next.eventDelayMs = value;
+      }
+    }
+    if (errors.length > 0) {
+      throw new GameError(ErrorCode.VALIDATION_FAILED, 'Invalid fault settings', undefined, errors);
+    }
+
+    this.settings = next;
+    console.log(`Fault injection: ${JSON.stringify(this.settings)}`);
+    return this.status();
+  }
+
+  reset(): ChaosStatus {
+    return this.configure(NO_FAULTS);
+  }
+
+  // The store itself unless faults can be injected, else one that fails at storageErrors
+  wrapStore(store: Store): Store {
+    if (!this.enabled) return store;
+    const fault = (operation: string) => {
+      if (this.random() >= this.settings.storageErrors) return;
+      this.injected.storageErrors++;
+      throw new Error(`Injected storage fault during ${operation}`);
+    };
+    return {
+      save: (gameId: string, snapshot: GameSnapshot) => {
+        fault('save');
+        store.save(gameId, snapshot);
+      },
+      load: (gameId: string) => {
+        fault('load');
+        return store.load(gameId);
+      },
+      remove: (gameId: string) => {
+        fault('remove');
+        store.remove(gameId);
+      },
+      list: () => {
+        fault('list');
+        return store.list();
+      }
+    };
+  }
+
+  // Hold back what is sent to the connection by up to eventDelayMs, keeping messages in order
+  attach(ws: WebSocket): void {
+    if (!this.enabled) return;
+    const send = ws.send.bind(ws) as (...args: any[]) => void;
+    let lastDueAt = 0;
+    ws.send = ((...args: any[]) => {
+      const now = Date.now();
+      const delay = Math.floor(this.random() * this.settings.eventDelayMs);
+      if (delay === 0 && lastDueAt <= now) {
+        send(...args);
+        return;
+      }
+      this.injected.delayedMessages++;
+      lastDueAt = Math.max(now + delay, lastDueAt);
+      setTimeout(() => {
+        if (ws.readyState === WebSocket.OPEN) send(...args);
+      }, lastDueAt - now);
+    }) as WebSocket['send'];
+  }
+
+  // Whether the message just received should be lost along with its connection
+  dropConnection(): boolean {
+    if (!this.enabled || this.random() >= this.settings.dropRate) return false;
+    this.injected.droppedConnections++;
+    return true;
+  }
+
+  private requireEnabled(): void {
+    if (!this.enabled) {
+      throw new GameError(ErrorCode.FEATURE_DISABLED, 'Fault injection is off; start the server with TANKS_CHAOS=1 outside production to use it');
+    }
+  }
+}
+
+export { FaultInjector, chaosEnabled };
+export type { FaultSettings, FaultCounts, ChaosStatus };
@@ -0,0 +1,460 @@
+// Wire codecs for the WebSocket protocol.
+// JSON is the default; binary codecs are negotiated through the WebSocket subprotocol.
+
+interface Codec {
+  name: string;
+  subprotocol: string;
+  binary: boolean;
+  encode(value: any): string | Buffer;
+  decode(data: Buffer | string): any;
+}
+
+const JsonCodec: Codec = {
+  name: 'json',
+  subprotocol: 'tanks.json',
+  binary: false,
+  encode(value: any): string {
+    return JSON.stringify(value);
+  },
+  decode(data: Buffer | string): any {
+    return JSON.parse(data.toString());
+  }
+};
+
+// Set a decoded map entry as an own property, as JSON.parse does, so a '__proto__' key in a
+// frame is only ever data and never replaces the object's prototype
+function setEntry(map: Record<string, any>, key: any, value: any): void {
+  Object.defineProperty(map, String(key), { value, writable: true, enumerable: true, configurable: true });
+}
+
+// Minimal MessagePack implementation covering the types used by the protocol:
+// nil, booleans, numbers, strings, binary, arrays and maps.
+class MsgPackWriter {
+  private chunks: Buffer[] = [];
+
+  write(value: any): void {
+    if (value === null || value === undefined) {
+      this.bytes(0xc0);
+    } else if (typeof value === 'boolean') {
+      this.bytes(value ? 0xc3 : 0xc2);
+    } else if (typeof value === 'number') {
+      this.number(value);
+    } else if (typeof value === 'string') {
+      this.string(value);
+    } else if (Buffer.isBuffer(value) || value instanceof Uint8Array) {
+      this.binary(Buffer.from(value));
+    } else if (Array.isArray(value)) {
+      this.header(value.length, 0x90, 0x0f, 0xdc, 0xdd);
+      value.forEach(item => this.write(item === undefined ? null : item));
+    } else if (typeof value === 'object') {
+      if (typeof value.toJSON === 'function') {
+        this.write(value.toJSON());
+        return;
+      }
+      const entries = Object.entries(value).filter(([, v]) => v !== undefined && typeof v !== 'function');
+      this.header(entries.length, 0x80, 0x0f, 0xde, 0xdf);
+      entries.forEach(([key, v]) => {
+        this.string(key);
+        this.write(v);
+      });
+    } else {
+      throw new Error(`Cannot encode value of type ${typeof value}`);
+    }
+  }
+
+  finish(): Buffer {
+    return Buffer.concat(this.chunks);
+  }
+
+  private bytes(...values: number[]): void {
+    this.chunks.push(Buffer.from(values));
+  }
+
+  private number(value: number): void {
+    // NaN and the infinities go out as nil, which is what JSON makes of them
+    if (!Number.isFinite(value)) {
+      this.bytes(0xc0);
+      return;
+    }
+    if (Number.isInteger(value) && value >= -0x80000000 && value <= 0xffffffff) {
+      if (value >= 0 && value <= 0x7f) {
+        this.bytes(value);
+      } else if (value < 0 && value >= -0x20) {
+        this.bytes(value & 0xff);
+      } else if (value >= 0) {
+        if (value <= 0xff) {
+          this.bytes(0xcc, value);
+        } else if (value <= 0xffff) {
+          const buf = Buffer.alloc(3);
+          buf[0] = 0xcd;
+          buf.writeUInt16BE(value, 1);
+          this.chunks.push(buf);
+        } else {
+          const buf = Buffer.alloc(5);
+          buf[0] = 0xce;
+          buf.writeUInt32BE(value, 1);
+          this.chunks.push(buf);
+        }
+      } else if (value >= -0x80) {
+        const buf = Buffer.alloc(2);
+        buf[0] = 0xd0;
+        buf.writeInt8(value, 1);
+        this.chunks.push(buf);
+      } else if (value >= -0x8000) {
+        const buf = Buffer.alloc(3);
+        buf[0] = 0xd1;
+        buf.writeInt16BE(value, 1);
+        this.chunks.push(buf);
+      } else {
+        const buf = Buffer.alloc(5);
+        buf[0] = 0xd2;
+        buf.writeInt32BE(value, 1);
+        this.chunks.push(buf);
+      }
+      return;
+    }
+
+    const buf = Buffer.alloc(9);
+    buf[0] = 0xcb;
+    buf.writeDoubleBE(value, 1);
+    this.chunks.push(buf);
+  }
+
+  private string(value: string): void {
+    const data = Buffer.from(value, 'utf-8');
+    if (data.length <= 0x1f) {
+      this.bytes(0xa0 | data.length);
+    } else if (data.length <= 0xff) {
+      this.bytes(0xd9, data.length);
+    } else {
+      this.length(data.length, 0xda, 0xdb);
+    }
+    this.chunks.push(data);
+  }
+
+  private binary(data: Buffer): void {
+    if (data.length <= 0xff) {
+      this.bytes(0xc4, data.length);
+    } else {
+      this.length(data.length, 0xc5, 0xc6);
+    }
+    this.chunks.push(data);
+  }
+
+  private header(length: number, fixBase: number, fixMax: number, code16: number, code32: number): void {
+    if (length <= fixMax) {
+      this.bytes(fixBase | length);
+    } else {
+      this.length(length, code16, code32);
+    }
+  }
+
+  private length(length: number, code16: number, code32: number): void {
+    if (length <= 0xffff) {
+      const buf = Buffer.alloc(3);
+      buf[0] = code16;
+      buf.writeUInt16BE(length, 1);
+      this.chunks.push(buf);
+    } else {
+      const buf = Buffer.alloc(5);
+      buf[0] = code32;
+      buf.writeUInt32BE(length, 1);
+      this.chunks.push(buf);
+    }
+  }
+}
+
+class MsgPackReader {
+  private offset = 0;
+
+  constructor(private data: Buffer) { }
+
+  read(): any {
+    const code = this.data[this.offset++];
+    if (code === undefined) throw new Error('Unexpected end of MessagePack data');
+
+    if (code <= 0x7f) return code;
+    if (code >= 0xe0) return code - 0x100;
+    if ((code & 0xf0) === 0x80) return this.map(code & 0x0f);
+    if ((code & 0xf0) === 0x90) return this.array(code & 0x0f);
+    if ((code & 0xe0) === 0xa0) return this.string(code & 0x1f);
+
+    switch (code) {
+      case 0xc0: return null;
+      case 0xc2: return false;
+      case 0xc3: return true;
+      case 0xc4: return this.binary(this.uint(1));
+      case 0xc5: return this.binary(this.uint(2));
+      case 0xc6: return this.binary(this.uint(4));
+      case 0xca: return this.take(4).readFloatBE(0);
+      case 0xcb: return this.take(8).readDoubleBE(0);
+      case 0xcc: return this.uint(1);
+      case 0xcd: return this.uint(2);
+      case 0xce: return this.uint(4);
+      case 0xcf: return Number(this.take(8).readBigUInt64BE(0));
+      case 0xd0: return this.take(1).readInt8(0);
+      case 0xd1: return this.take(2).readInt16BE(0);
+      case 0xd2: return this.take(4).readInt32BE(0);
+      case 0xd3: return Number(this.take(8).readBigInt64BE(0));
+      case 0xd9: return this.string(this.uint(1));
+      case 0xda: return this.string(this.uint(2));
+      case 0xdb: return this.string(this.uint(4));
+      case 0xdc: return this.array(this.uint(2));
+      case 0xdd: return this.array(this.uint(4));
+      case 0xde: return this.map(this.uint(2));
+      case 0xdf: return this.map(this.uint(4));
+      default:
+        throw new Error(`Unsupported MessagePack type 0x${code.toString(16)}`);
+    }
+  }
+
+  done(): boolean {
+    return this.offset >= this.data.length;
+  }
+
+  private take(length: number): Buffer {
+    if (this.offset + length > this.data.length) throw new Error('Unexpected end of MessagePack data');
+    const slice = this.data.subarray(this.offset, this.offset + length);
+    this.offset += length;
+    return slice;
+  }
+
+  private uint(size: 1 | 2 | 4): number {
+    const slice = this.take(size);
+    return size === 1 ? slice[0] : size === 2 ? slice.readUInt16BE(0) : slice.readUInt32BE(0);
+  }
+
+  private string(length: number): string {
+    return this.take(length).toString('utf-8');
+  }
+
+  private binary(length: number): Buffer {
+    return Buffer.from(this.take(length));
+  }
+
+  private array(length: number): any[] {
+    const result: any[] = [];
+    for (let i = 0; i < length; i++) result.push(this.read());
+    return result;
+  }
+
+  private map(length: number): Record<string, any> {
+    const result: Record<string, any> = {};
+    for (let i = 0; i < length; i++) {
+      const key = this.read();
+      setEntry(result, key, this.read());
+    }
+    return result;
+  }
+}
+
+const MsgPackCodec: Codec = {
+  name: 'msgpack',
+  subprotocol: 'tanks.msgpack',
+  binary: true,
+  encode(value: any): Buffer {
+    const writer = new MsgPackWriter();
+    writer.write(value);
+    return writer.finish();
+  },
+  decode(data: Buffer | string): any {
+    const reader = new MsgPackReader(Buffer.isBuffer(data) ? data : Buffer.from(data));
+    const value = reader.read();
+    if (!reader.done()) throw new Error('Trailing bytes after MessagePack value');
+    return value;
+  }
+};
+
+// Minimal CBOR (RFC 8949) implementation for constrained clients, covering the
+// same value types as the MessagePack codec. Indefinite-length items are not supported.
+class CborWriter {
+  private chunks: Buffer[] = [];
+
+  write(value: any): void {
+    if (value === null || value === undefined) {
+      this.bytes(0xf6);
+    } else if (typeof value === 'boolean') {
+      this.bytes(value ? 0xf5 : 0xf4);
+    } else if (typeof value === 'number') {
+      if (!Number.isFinite(value)) {
+        this.bytes(0xf6);  // As JSON: null
+      } else if (Number.isInteger(value) && Math.abs(value) <= 0xffffffff) {
+        if (value >= 0) {
+          this.head(0, value);
+        } else {
+          this.head(1, -1 - value);
+        }
+      } else {
+        const buf = Buffer.alloc(9);
+        buf[0] = 0xfb;
+        buf.writeDoubleBE(value, 1);
+        this.chunks.push(buf);
+      }
+    } else if (typeof value === 'string') {
+      const data = Buffer.from(value, 'utf-8');
+      this.head(3, data.length);
+      this.chunks.push(data);
+    } else if (Buffer.isBuffer(value) || value instanceof Uint8Array) {
+      this.head(2, value.length);
+      this.chunks.push(Buffer.from(value));
+    } else if (Array.isArray(value)) {
+      this.head(4, value.length);
+      value.forEach(item => this.write(item === undefined ? null : item));
+    } else if (typeof value === 'object') {
+      if (typeof value.toJSON === 'function') {
+        this.write(value.toJSON());
+        return;
+      }
+      const entries = Object.entries(value).filter(([, v]) => v !== undefined && typeof v !== 'function');
+      this.head(5, entries.length);
+      entries.forEach(([key, v]) => {
+        this.write(key);
+        this.write(v);
+      });
+    } else {
+      throw new Error(`Cannot encode value of type ${typeof value}`);
+    }
+  }
+
+  finish(): Buffer {
+    return Buffer.concat(this.chunks);
+  }
+
+  private bytes(...values: number[]): void {
+    this.chunks.push(Buffer.from(values));
+  }
+
+  private head(majorType: number, argument: number): void {
+    const major = majorType << 5;
+    if (argument < 24) {
+      this.bytes(major | argument);
+    } else if (argument <= 0xff) {
+      this.bytes(major | 24, argument);
+    } else if (argument <= 0xffff) {
+      const buf = Buffer.alloc(3);
+      buf[0] = major | 25;
+      buf.writeUInt16BE(argument, 1);
+      this.chunks.push(buf);
+    } else {
+      const buf = Buffer.alloc(5);
+      buf[0] = major | 26;
+      buf.writeUInt32BE(argument, 1);
+      this.chunks.push(buf);
+    }
+  }
+}
+
+class CborReader {
+  private offset = 0;
+
+  constructor(private data: Buffer) { }
+
+  read(): any {
+    const initial = this.take(1)[0];
+    const majorType = initial >> 5;
+    const info = initial & 0x1f;
+
+    if (majorType === 7) return this.simple(info);
+
+    const argument = this.argument(info);
+    switch (majorType) {
+      case 0: return argument;
+      case 1: return -1 - argument;
+      case 2: return Buffer.from(this.take(argument));
+      case 3: return this.take(argument).toString('utf-8');
+      case 4: {
+        const result: any[] = [];
+        for (let i = 0; i < argument; i++) result.push(this.read());
+        return result;
+      }
+      case 5: {
+        const result: Record<string, any> = {};
+        for (let i = 0; i < argument; i++) {
+          const key = this.read();
+          setEntry(result, key, this.read());
+        }
+        return result;
+      }
+      default:
+        // Major type 6: tags carry no meaning for the protocol, so unwrap the tagged value
+        return this.read();
+    }
+  }
+
+  done(): boolean {
+    return this.offset >= this.data.length;
+  }
+
+  private take(length: number): Buffer {
+    if (this.offset + length > this.data.length) throw new Error('Unexpected end of CBOR data');
+    const slice = this.data.subarray(this.offset, this.offset + length);
+    this.offset += length;
+    return slice;
+  }
+
+  private argument(info: number): number {
+    if (info < 24) return info;
+    switch (info) {
+      case 24: return this.take(1)[0];
+      case 25: return this.take(2).readUInt16BE(0);
+      case 26: return this.take(4).readUInt32BE(0);
+      case 27: return Number(this.take(8).readBigUInt64BE(0));
+      default:
+        throw new Error('Indefinite-length CBOR items are not supported');
+    }
+  }
+
+  private simple(info: number): any {
+    switch (info) {
+      case 20: return false;
+      case 21: return true;
+      case 22: return null;
+      case 23: return undefined;
+      case 25: return this.half(this.take(2).readUInt16BE(0));
+      case 26: return this.take(4).readFloatBE(0);
+      case 27: return this.take(8).readDoubleBE(0);
+      default:
+        throw new Error(`Unsupported CBOR simple value ${info}`);
+    }
+  }
+
+  private half(bits: number): number {
+    const sign = bits & 0x8000 ? -1 : 1;
+    const exponent = (bits >> 10) & 0x1f;
+    const fraction = bits & 0x3ff;
+    if (exponent === 0) return sign * Math.pow(2, -14) * (fraction / 1024);
+    if (exponent === 0x1f) return fraction ? NaN : sign * Infinity;
+    return sign * Math.pow(2, exponent - 15) * (1 + fraction / 1024);
+  }
+}
+
+const CborCodec: Codec = {
+  name: 'cbor',
+  subprotocol: 'tanks.cbor',
+  binary: true,
+  encode(value: any): Buffer {
+    const writer = new CborWriter();
+    writer.write(value);
+    return writer.finish();
+  },
+  decode(data: Buffer | string): any {
+    const reader = new CborReader(Buffer.isBuffer(data) ? data : Buffer.from(data));
+    const value = reader.read();
+    if (!reader.done()) throw new Error('Trailing bytes after CBOR value');
+    return value;
+  }
+};
+
+const CODECS: Codec[] = [JsonCodec, MsgPackCodec, CborCodec];
+
+// Pick the first codec the client offered as a subprotocol, falling back to JSON
+function selectCodec(protocols: Iterable<string>): Codec {
+  for (const protocol of protocols) {
+    const codec = CODECS.find(c => c.subprotocol === protocol);
+    if (codec) return codec;
+  }
+  return JsonCodec;
+}
+
+export { JsonCodec, MsgPackCodec, CborCodec, CODECS, selectCodec };
+export type { Codec };
@@ -0,0 +1,126 @@
+// Round trips through the binary codecs: every protocol message a client can be sent must
+// decode to what the JSON codec would have delivered. Run with `npm test`.
+
+import { describe, it } from 'node:test';
+import * as assert from 'assert';
+import { JsonCodec, MsgPackCodec, CborCodec, type Codec } from './codec.cjs';
+
+// Messages as the server sends them, trimmed to the shapes that matter to a codec
+const MESSAGES: Record<string, any> = {
+  welcome: {
+    type: 'welcome',
+    success: true,
+    protocolVersion: 2,
+    rulesVersion: 1,
+    codec: 'msgpack',
+    variants: ['multiCellTanks', 'abilities', 'timers']
+  },
+  gameState: {
+    type: 'gameState',
+    gameId: 'ABCD',
+    phase: 'battle',
+    currentTurn: 1,
+    isMyTurn: false,
+    myBoard: [[0, 1, 2], [3, 0, 0], [0, 0, 1]],
+    enemyBoard: [[0, 0, 2], [0, 3, 0], [0, 0, 0]],
+    players: [
+      { id: 0, name: 'Ünïcødé Commander', ready: true, tanksRemaining: 3 },
+      { id: 1, name: '坦克 🛡️', ready: true, tanksRemaining: 2 }
+    ],
+    myAbilities: { airstrike: 1, cluster: 0, scan: 2 },
+    clock: { remainingMs: [593250, 601000], turnStartedAt: 1760457600123 },
+    winProbability: 0.6180339887,
+    turnsLeft: null
+  },
+  bombResult: {
+    type: 'bombResult',
+    success: true,
+    x: 7,
+    y: 0,
+    hit: true,
+    cells: [{ x: 7, y: 0, state: 3 }],
+    gameOver: false
+  },
+  error: {
+    type: 'joined',
+    success: false,
+    error: {
+      code: 'INCOMPATIBLE_RULES',
+      message: 'Esta partida se guardó con la versión 99 de las reglas',
+      status: 409,
+      details: { rulesVersion: 99, supported: { min: 1, max: 1 } },
+      fields: [{ field: 'game', reason: 'must be a saved game' }]
+    }
+  }
+};
+
+// Numbers at the edges of each codec's integer and float encodings
+const NUMBERS = {
+  positive: [0, 1, 0x7f, 0x80, 0xff, 0x100, 0xffff, 0x10000, 0xffffffff, 2 ** 32, 2 ** 40, Number.MAX_SAFE_INTEGER],
+  negative: [-1, -0x20, -0x21, -0x80, -0x81, -0x8000, -0x8001, -0x80000000, -0x80000001, -(2 ** 40), Number.MIN_SAFE_INTEGER],
+  floats: [0.5, -3.25, Math.PI, 1e-7, 1e300, -1.7976931348623157e308, Number.EPSILON]
+};
+
+// What the JSON codec delivers for the same value
+function viaJson(value: any): any {
+  return JsonCodec.decode(JsonCodec.encode(value));
+}
+
+function roundTrip(codec: Codec, value: any): any {
+  const encoded = codec.encode(value);
+  assert.ok(Buffer.isBuffer(encoded), `${codec.name} should encode to a buffer`);
+  return codec.decode(encoded);
+}
+
+[MsgPackCodec, CborCodec].forEach(codec => {
+  describe(`${codec.name} codec`, () => {
+    Object.entries(MESSAGES).forEach(([name, message]) => {
+      it(`round-trips a ${name} message`, () => {
+        assert.deepStrictEqual(roundTrip(codec, message), viaJson(message));
+      });
+    });
+
+    Object.entries(NUMBERS).forEach(([kind, numbers]) => {
+      it(`round-trips ${kind} numbers`, () => {
+        numbers.forEach(n => assert.strictEqual(roundTrip(codec, n), n, `${n}`));
+        assert.deepStrictEqual(roundTrip(codec, { numbers }), viaJson({ numbers }));
+      });
+    });
+
+    it('round-trips nested maps and arrays', () => {
+      const nested = { a: [{ b: [[1, [2, { c: [] }]], {}] }], d: { e: { f: { g: ['deep', -5, 2.5, null, true, false] } } } };
+      assert.deepStrictEqual(roundTrip(codec, nested), viaJson(nested));
+    });
+
+    it('round-trips non-ASCII strings', () => {
+      ['', 'é', 'Ünïcødé', '坦克戦', '🛡️💥', 'x'.repeat(40) + 'ß'.repeat(40), 'ü'.repeat(70000)].forEach(text => {
+        assert.strictEqual(roundTrip(codec, text), text);
+        assert.deepStrictEqual(roundTrip(codec, { [text]: text }), viaJson({ [text]: text }));
+      });
+    });
+
+    it('sends NaN and the infinities as null, as JSON does', () => {
+      const message = { type: 'gameState', winProbability: NaN, remainingMs: [Infinity, -Infinity, 5] };
+      assert.deepStrictEqual(roundTrip(codec, message), viaJson(message));
+      assert.deepStrictEqual(roundTrip(codec, message), { type: 'gameState', winProbability: null, remainingMs: [null, null, 5] });
+    });
+
+    it('leaves out undefined fields, as JSON does', () => {
+      const message = { type: 'gameState', winner: undefined, moves: [undefined, 1] };
+      assert.deepStrictEqual(roundTrip(codec, message), viaJson(message));
+    });
+
+    it('keeps a __proto__ key as data', () => {
+      const decoded = roundTrip(codec, JSON.parse('{"__proto__": {"polluted": true}, "type": "chat"}'));
+      assert.strictEqual(Object.getPrototypeOf(decoded), Object.prototype);
+      assert.strictEqual(decoded.polluted, undefined);
+      assert.deepStrictEqual(decoded.__proto__, { polluted: true });
+      assert.strictEqual(({} as any).polluted, undefined);
+    });
+
+    it('refuses trailing bytes', () => {
+      const encoded = codec.encode({ type: 'ping' }) as Buffer;
+      assert.throws(() => codec.decode(Buffer.concat([encoded, Buffer.from([0])])));
+    });
+  });
+});
@@ -0,0 +1,182 @@
+// Collusion and win-trading detection for the rated ladder. Read the finished games from
+// the event log (TANKS_EVENT_LOG, see events.cts), look for pairs of accounts whose rated
+// games against each other look arranged, and raise each pair in the moderation queue
+// (see moderation.cts) for a moderator to judge. Two patterns are looked for, among
+// quick games only, those over in QUICK_GAME_MOVES turns or fewer:
+//
+//   repeatedLosses  one account losing quick games to the same opponent again and again,
+//                   feeding it rating
+//   alternating     a run of quick games between the pair the two win by turns, so both
+//                   climb while neither loses ground for long
+//
+// Only games within the last WINDOW_DAYS count. Nothing is done to the accounts; a flag is
+// raised once for the same games however often they are found.
+//
+// The server runs the check every day at 04:00 UTC when the event log is a file. To run
+// it by hand, which only looks unless --raise is given (then with the server stopped, as
+// it reads the moderation queue only at startup):
+//
+//   node collusion.cjs <event-log> [--raise] [--json]
+
+import * as fs from 'fs';
+import { ModerationQueue, type ModerationFlag } from './moderation.cjs';
+import type { GameOver } from './events.cjs';
+
+const COLLUSION_RUN_AT = '04:00';  // UTC, when the server checks each day
+const QUICK_GAME_MOVES = 12;
+const REPEATED_LOSSES = 3;         // Quick losses to the same opponent before the pair is flagged
+const ALTERNATING_RUN = 4;         // Quick games in a row, won by turns
+const WINDOW_DAYS = 30;
+
+type CollusionPattern = 'repeatedLosses' | 'alternating';
+
+interface Suspicion {
+  pattern: CollusionPattern;
+  accounts: { userId: string; name: string | null }[];  // For repeated losses, the winner first
+  gameIds: string[];  // Oldest first
+  reason: string;
+}
+
+interface CollusionReport {
+  games: number;  // Finished games read from the log
+  rated: number;  // Those between two signed-in players, within the window
+  suspicions: Suspicion[];
+  raised: ModerationFlag[];
+  skipped: number;  // Lines that were not JSON
+}
+
+// A rated game as the checks need it
+interface RatedGame {
+  gameId: string;
+  finishedAt: number;
+  winner: { userId: string; name: string | null };
+  loser: { userId: string; name: string | null };
+  quick: boolean;
+}
+
+function ratedGames(log: string, now: number, report: CollusionReport): RatedGame[] {
+  const since = now - WINDOW_DAYS * 24 * 60 * 60 * 1000;
+  const games: RatedGame[] = [];
+  log.split('\n').forEach(line => {
+    if (!line.trim()) return;
+    let event: GameOver;
+    try {
+      event = JSON.parse(line);
+    } catch {
+      report.skipped++;
+      return;
+    }
+    if (event?.type !== 'gameOver') return;
+    report.games++;
+
+    const { gameId, players, winner, moveCount, finishedAt } = event.result.result;
+    const won = players[winner];
+    const lost = players[1 - winner];
+    const at = Date.parse(finishedAt);
+    if (!won?.userId || !lost?.userId || won.userId === lost.userId || !(at >= since)) return;
+    report.rated++;
+    games.push({
+      gameId,
+      finishedAt: at,
+      winner: { userId: won.userId, name: won.name ?? null },
+      loser: { userId: lost.userId, name: lost.name ?? null },
+      quick: moveCount <= QUICK_GAME_MOVES
+    });
+  });
+  return games.sort((a, b) => a.finishedAt - b.finishedAt);
+}
+
+// What the pair's games between them look like
+function checkPair(games: RatedGame[]): Suspicion[] {
+  const suspicions: Suspicion[] = [];
+  const quick = games.filter(game => game.quick);
+  const name = (account: { userId: string; name: string | null }) => account.name ?? account.userId;
+
+  const lossesBy: Map<string, RatedGame[]> = new Map();
+  quick.forEach(game => lossesBy.set(game.loser.userId, [...(lossesBy.get(game.loser.userId) ?? []), game]));
+  lossesBy.forEach(losses => {
+    if (losses.length < REPEATED_LOSSES) return;
+    const { winner, loser } = losses[0];
+    suspicions.push({
+      pattern: 'repeatedLosses',
+      accounts: [winner, loser],
+      gameIds: losses.map(game => game.gameId),
+      reason: `${name(loser)} lost ${losses.length} quick rated games to ${name(winner)}`
+    });
+  });
+
+  // The longest run of consecutive games, all quick, whose winner changes every game
+  let run: RatedGame[] = [];
+  let longest: RatedGame[] = [];
+  games.forEach(game => {
+    const previous = run[run.length - 1];
+    run = game.quick && previous && previous.winner.userId !== game.winner.userId ? [...run, game] : game.quick ? [game] : [];
+    if (run.length > longest.length) longest = run;
+  });
+  if (longest.length >= ALTERNATING_RUN) {
+    suspicions.push({
+      pattern: 'alternating',
+      accounts: [longest[0].winner, longest[0].loser],
+      gameIds: longest.map(game => game.gameId),
+      reason: `${name(longest[0].winner)} and ${name(longest[0].loser)} won ${longest.length} quick rated games in a row by turns`
+    });
+  }
+  return suspicions;
+}
+
+// Check every pair in the log, raising what looks arranged in `queue` if given
+function detectCollusion(log: string, queue: ModerationQueue | null = null, now: number = Date.now()): CollusionReport {
+  const report: CollusionReport = { games: 0, rated: 0, suspicions: [], raised: [], skipped: 0 };
+  const byPair: Map<string, RatedGame[]> = new Map();
+  ratedGames(log, now, report).forEach(game => {
+    const pair = [game.winner.userId, game.loser.userId].sort().join(' ');
+    byPair.set(pair, [...(byPair.get(pair) ?? []), game]);
+  });
+
+  byPair.forEach(games => report.suspicions.push(...checkPair(games)));
+  report.suspicions.forEach(suspicion => {
+    const pair = suspicion.accounts.map(account => account.userId).sort().join(' ');
+    const raised = queue?.raise({
+      kind: 'collusion',
+      key: `${suspicion.pattern} ${pair} ${suspicion.gameIds[suspicion.gameIds.length - 1]}`,
+      accounts: suspicion.accounts,
+      gameIds: suspicion.gameIds,
+      reason: suspicion.reason
+    });
+    if (raised) report.raised.push(raised);
+  });
+  return report;
+}
+
+function describeCollusion(report: CollusionReport): string {
+  const lines = [`Collusion: ${report.rated} rated game(s) of ${report.games} checked, ${report.suspicions.length} suspicious pair pattern(s), ` +
+    `${report.raised.length} flag(s) raised` + (report.skipped > 0 ? `, ${report.skipped} line(s) skipped` : '')];
+  report.suspicions.forEach(suspicion => lines.push(`  ${suspicion.pattern}: ${suspicion.reason} (${suspicion.gameIds.join(', ')})`));
+  return lines.join('\n');
+}
+
+function main(args: string[]): void {
+  const file = args.find(arg => !arg.startsWith('--'));
+  if (!file) {
+    console.error('Usage: node collusion.cjs <event-log> [--raise] [--json]');
+    process.exit(2);
+  }
+
+  let log: string;
+  try {
+    log = fs.readFileSync(file, 'utf-8');
+  } catch (error) {
+    console.error((error as Error).message);
+    process.exit(2);
+  }
+  const report = detectCollusion(log, args.includes('--raise') ? new ModerationQueue(process.env.TANKS_MODERATION_QUEUE) : null);
+  console.log(args.includes('--json') ? JSON.stringify(report, null, 2) : describeCollusion(report));
+  process.exit(0);
+}
+
+if (require.main === module) {
+  main(process.argv.slice(2));
+}
+
+export { detectCollusion, describeCollusion, COLLUSION_RUN_AT, QUICK_GAME_MOVES };
+export type { Suspicion, CollusionReport, CollusionPattern };
@@ -0,0 +1,131 @@
+// Commentary: a line of text for each entry of the move log, in the manner of a match
+// commentator ("Ana probes the center... and finds armor at C3!"). Spectators receive
+// each line as it happens, replays print it after each entry, and the commentary server
+// event carries it to webhooks for chat bots to post.
+//
+// Every kind of moment has a few wordings to pick from. The pick is drawn from the game id
+// and the entry's number, so a replay of a game says what was said as it was played. Lines
+// name cells in the coordinate system they are made for and never say where a tank was
+// placed or moved to while its owner's opponent could still use it. Templates are English;
+// {player} and {opponent} are the players' names, and the rest are filled from the entry:
+//
+//   {cell}       the cell aimed at          {area}       which part of the board it is in
+//   {shot}       the special shot fired     {streak}     hits in a row, this one included
+//   {Shot}       the same, capitalized
+//   {destroyed}  tanks this entry destroyed {remaining}  the opponent's tanks still standing
+
+import * as crypto from 'crypto';
+import { CellState, type GameConfig, type MoveLogEntry, type Tank } from './game.cjs';
+import { formatCell } from './coords.cjs';
+
+type Moment =
+  | 'place' | 'remove' | 'confirm' | 'move' | 'miss' | 'hit' | 'streak' | 'destroyed' | 'victory'
+  | 'strikeMiss' | 'strikeHit' | 'scanFound' | 'scanEmpty' | 'timeoutSkip' | 'timeoutForfeit';
+
+const STREAK_LENGTH = 3;  // Hits in a row worth remarking on
+
+const TEMPLATES: Record<Moment, string[]> = {
+  place: ['{player} rolls a tank into position.', '{player} deploys another tank.', '{player} tucks a tank away somewhere in the fog.'],
+  remove: ['{player} has second thoughts and pulls a tank back.', '{player} takes a tank off the board to think again.'],
+  confirm: ['{player} locks in the fleet.', '{player} is ready for battle.', '{player} is dug in and waiting.'],
+  move: ['{player} slips a tank away to new cover.', '{player} repositions a tank under the fog.'],
+  miss: ['{player} probes {area}... nothing at {cell}.', '{player} fires at {cell}. Just dirt.', 'A shell from {player} lands at {cell} and finds nothing.'],
+  hit: ['{player} probes {area}... and finds armor at {cell}!', 'Contact! {player} hits at {cell}!', '{player} lands one on {cell} - {opponent} is hit!'],
+  streak: ['{player} is on a roll: {streak} hits in a row, the latest at {cell}!', 'Another one! That is {streak} straight hits for {player}, now at {cell}.'],
+  destroyed: ['{player} destroys {destroyed} at {cell}! {opponent} has {remaining} left.', 'Boom! {opponent} loses {destroyed} at {cell}, {remaining} to go.'],
+  victory: ["{player} hits {cell} and wipes out the last of {opponent}'s tanks. Victory!", 'That is the game! {player} finishes it at {cell}.'],
+  strikeMiss: ['{player} calls in {shot} at {cell}, but it finds nothing.', '{Shot} from {player} pounds {area} around {cell} - all empty.'],
+  strikeHit: ['{player} calls in {shot} at {cell}, and it connects!', '{Shot} from {player} tears through {area} at {cell} - {opponent} is hit!'],
+  scanFound: ['{player} sweeps around {cell}, and the scanner lights up!', 'Something is hiding near {cell} - the scan from {player} says so.'],
+  scanEmpty: ['{player} scans around {cell}: all quiet.', 'The scan from {player} around {cell} comes back empty.'],
+  timeoutSkip: ['{player} runs out of time; the turn passes to {opponent}.', 'The clock beats {player}. Over to {opponent}.'],
+  timeoutForfeit: ['{player} runs out of time and forfeits. {opponent} wins!', 'Time is up for {player}, and with it the game. {opponent} takes it!']
+};
+
+// What is known about the game beyond the entry
+interface CommentaryContext {
+  gameId: string;
+  names: string[];
+  config: GameConfig;
+  moveLog: MoveLogEntry[];  // Up to and including the entry
+  destroyed: number;        // The opponent's tanks the entry destroyed
+  remaining: number;        // The opponent's tanks standing after it
+}
+
+// Of the tanks given, those destroyed since the board stood as `before`
+function tanksDestroyedSince(tanks: Tank[], before: CellState[][]): number {
+  return tanks.filter(tank => tank.destroyed && !tank.cells.every(({ x, y }) => before[y]?.[x] === CellState.HIT)).length;
+}
+
+function plural(count: number, noun: string): string {
+  return count === 1 ? `a ${noun}` : `${count} ${noun}s`;
+}
+
+// Which part of the board a cell is in, as a commentator would say it
+function areaOf(x: number, y: number, size: number): string {
+  const last = size - 1;
+  const offCenter = Math.max(Math.abs(x - last / 2), Math.abs(y - last / 2));
+  if ((x === 0 || x === last) && (y === 0 || y === last)) return 'a corner';
+  if (x === 0 || x === last || y === 0 || y === last) {
+    return `the ${y === 0 ? 'north' : y === last ? 'south' : x === 0 ? 'west' : 'east'} edge`;
+  }
+  if (offCenter <= size / 6) return 'the center';
+  return `the ${y < last / 2 ? 'north' : 'south'}${x < last / 2 ? 'west' : 'east'}`;
+}
+
+// The player's hits in a row, counting back from the entry; a miss or timeout ends a run
+function hitStreak(moveLog: MoveLogEntry[], entry: MoveLogEntry): number {
+  let streak = 0;
+  for (let i = moveLog.length - 1; i >= 0; i--) {
+    const earlier = moveLog[i];
+    if (earlier.seq > entry.seq || earlier.playerId !== entry.playerId) continue;
+    if (earlier.action === 'timeout' || earlier.outcome === 'miss') break;
+    if (earlier.outcome === 'hit' || earlier.outcome === 'victory') streak++;
+  }
+  return streak;
+}
+
+function momentOf(entry: MoveLogEntry, context: CommentaryContext): Moment {
+  switch (entry.action) {
+    case 'place':
+    case 'remove':
+    case 'confirm':
+    case 'move':
+      return entry.action;
+    case 'timeout':
+      return entry.timeoutAction === 'forfeit' ? 'timeoutForfeit' : 'timeoutSkip';
+    case 'ability':
+      if (entry.ability === 'scan') return entry.found ? 'scanFound' : 'scanEmpty';
+      break;
+  }
+  if (entry.outcome === 'victory') return 'victory';
+  if (context.destroyed > 0) return 'destroyed';
+  if (entry.action === 'ability') return entry.outcome === 'hit' ? 'strikeHit' : 'strikeMiss';
+  if (entry.outcome !== 'hit') return 'miss';
+  return hitStreak(context.moveLog, entry) >= STREAK_LENGTH ? 'streak' : 'hit';
+}
+
+// The same wording for the same entry of the same game, every time
+function pick(templates: string[], gameId: string, seq: number): string {
+  return templates[crypto.createHash('sha256').update(`${gameId}:${seq}`).digest().readUInt32BE(0) % templates.length];
+}
+
+function commentate(entry: MoveLogEntry, context: CommentaryContext): string {
+  const { config, names } = context;
+  const hasCell = entry.x !== undefined && entry.y !== undefined && entry.action !== 'place' && entry.action !== 'remove' && entry.action !== 'move';
+  const shot = entry.ability === 'airstrike' ? `an airstrike along the ${entry.direction}` : 'a cluster bomb';
+  const params: Record<string, string> = {
+    player: names[entry.playerId] ?? `Player ${entry.playerId + 1}`,
+    opponent: names[1 - entry.playerId] ?? `Player ${2 - entry.playerId}`,
+    shot,
+    Shot: shot.charAt(0).toUpperCase() + shot.slice(1),
+    streak: String(hitStreak(context.moveLog, entry)),
+    destroyed: plural(context.destroyed, 'tank'),
+    remaining: plural(context.remaining, 'tank'),
+    ...(hasCell && { cell: formatCell(config.coordinates, entry.x!, entry.y!), area: areaOf(entry.x!, entry.y!, config.boardSize) })
+  };
+  return pick(TEMPLATES[momentOf(entry, context)], context.gameId, entry.seq).replace(/\{(\w+)\}/g, (match, name) => params[name] ?? match);
+}
+
+export { commentate, tanksDestroyedSince, areaOf, TEMPLATES };
+export type { CommentaryContext, Moment };
@@ -0,0 +1,72 @@
+// Board coordinates. The engine has a single form: x is the column and y the row, both
+// counted from 0 at the top-left corner, and that is what every x and y field in the
+// protocol holds. Cell names written for people, such as the one in "Hit at C5", follow
+// a coordinate system set per game, which a client may swap for its own:
+//
+//   letterNumber   C5    column letter, then row from 1 (the default)
+//   oneBased       3,5   column, then row, from 1
+//   zeroBased      2,4   column, then row, from 0, the same numbers as x and y
+//
+// A client may also send a cell name in place of x and y, and a player may type one at a
+// terminal. Whatever the system, either form is read, in any case and with a comma or
+// spaces between numbers: "c5", "C 5", "3,5", "3 5" and "(3, 5)" all work. Numbers count
+// from 0 in the zeroBased system and from 1 otherwise, as the row labels do.
+
+import { ErrorCode, GameError } from './errors.cjs';
+import type { Position } from './game.cjs';
+
+type CoordinateSystem = 'letterNumber' | 'oneBased' | 'zeroBased';
+
+const COORDINATE_SYSTEMS: CoordinateSystem[] = ['letterNumber', 'oneBased', 'zeroBased'];
+
+function formatCell(system: CoordinateSystem, x: number, y: number): string {
+  switch (system) {
+    case 'oneBased': return `${x + 1},${y + 1}`;
+    case 'zeroBased': return `${x},${y}`;
+    default: return `${String.fromCharCode(65 + x)}${y + 1}`;
+  }
+}
+
+// The canonical position a cell name stands for on a board of `size`
+function parseCell(system: CoordinateSystem, name: string, size: number): Position {
+  const text = String(name ?? '').trim().toUpperCase();
+  const lettered = /^([A-Z])\s*(\d+)$/.exec(text);
+  const numbered = /^\(?\s*(\d+)\s*(?:,|\s)\s*(\d+)\s*\)?$/.exec(text);
+  const base = system === 'zeroBased' ? 0 : 1;
+
+  let position: Position | null = null;
+  if (lettered) position = { x: lettered[1].charCodeAt(0) - 65, y: Number(lettered[2]) - 1 };
+  if (numbered) position = { x: Number(numbered[1]) - base, y: Number(numbered[2]) - base };
+  if (position && position.x >= 0 && position.x < size && position.y >= 0 && position.y < size) return position;
+
+  // Say what was wrong, and show both forms with the board's own bounds
+  const last = size - 1;
+  const numbers: CoordinateSystem = base === 0 ? 'zeroBased' : 'oneBased';
+  const forms = `a column letter and row such as ${formatCell('letterNumber', 2, 4)} (A1 to ${formatCell('letterNumber', last, last)}), ` +
+    `or column and row numbers such as ${formatCell(numbers, 2, 4)} (${formatCell(numbers, 0, 0)} to ${formatCell(numbers, last, last)})`;
+  throw new GameError(ErrorCode.VALIDATION_FAILED, 'Invalid cell', undefined, [{
+    field: 'cell',
+    reason: position ? `${text} is off the ${size}x${size} board; give ${forms}` : `must be ${forms}`
+  }]);
+}
+
+// How the columns and rows of a board of `size` are labelled
+function axisLabels(system: CoordinateSystem, size: number): { columns: string[]; rows: string[] } {
+  const numbers = (base: number) => Array.from({ length: size }, (_, i) => String(i + base));
+  return {
+    columns: system === 'letterNumber' ? Array.from({ length: size }, (_, x) => String.fromCharCode(65 + x)) : numbers(system === 'zeroBased' ? 0 : 1),
+    rows: numbers(system === 'zeroBased' ? 0 : 1)
+  };
+}
+
+function requireCoordinateSystem(value: unknown): CoordinateSystem {
+  if (!COORDINATE_SYSTEMS.includes(value as CoordinateSystem)) {
+    throw new GameError(ErrorCode.VALIDATION_FAILED, 'Invalid coordinate system', undefined, [
+      { field: 'coordinates', reason: `must be one of ${COORDINATE_SYSTEMS.join(', ')}` }
+    ]);
+  }
+  return value as CoordinateSystem;
+}
+
+export { COORDINATE_SYSTEMS, formatCell, parseCell, axisLabels, requireCoordinateSystem };
+export type { CoordinateSystem };
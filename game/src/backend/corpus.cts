@@ -0,0 +1,165 @@
+// Replay a directory of archived games through the current rules and report every game
+// that no longer comes out the way it did, so a change to the engine can be checked
+// against real games before it ships. Each game is replayed from its move log as
+// replay.cjs does, and the replay is held against the record:
+//
+//   entries  every logged bomb, special shot and timeout has the same outcome, on the
+//            same turn; only the first entry that differs is reported
+//   result   the game ends in the same phase with the same winner after as many moves
+//   boards   a snapshot's boards match the replay's, cell for cell
+//   hash     a signed result's stateHash matches the replay's final boards
+//
+//   node corpus.cjs <directory> [--json]
+//
+// The directory is searched recursively for summaries and snapshots (.json, and gzipped
+// .json.gz as the retention archive writes them). A game won because a player never came
+// back ends off the log; its replay stops in battle and only its boards are checked.
+// Exits 1 if any game diverged or could not be read.
+
+import * as fs from 'fs';
+import * as path from 'path';
+import { GameManager, GamePhase } from './server.cjs';
+import { replayGame, type ReplayOutcome } from './replay.cjs';
+import { readGameFile, type GameRecord } from './resolve.cjs';
+import { stateHashOf } from './results.cjs';
+import { MemoryStore } from './store.cjs';
+import type { MoveLogEntry } from './game.cjs';
+
+// What a replayed entry must agree with the record on
+const ENTRY_FIELDS: (keyof MoveLogEntry)[] = ['action', 'playerId', 'moveCount', 'outcome', 'found', 'timeoutAction'];
+
+interface Divergence {
+  check: 'entries' | 'result' | 'boards' | 'hash' | 'replay';
+  seq?: number;       // The move log entry, for entries and a replay that was refused
+  expected: unknown;
+  actual: unknown;
+}
+
+interface CorpusGame {
+  file: string;
+  gameId: string | null;
+  entries: number;
+  divergences: Divergence[];
+  error?: string;  // Not a game record, or unreadable
+}
+
+interface CorpusReport {
+  directory: string;
+  files: number;
+  replayed: number;
+  diverged: number;
+  unreadable: number;
+  games: CorpusGame[];  // Those that diverged or could not be read
+  durationMs: number;
+}
+
+function corpusFiles(directory: string): string[] {
+  return fs.readdirSync(directory, { withFileTypes: true }).flatMap(entry => {
+    const file = path.join(directory, entry.name);
+    if (entry.isDirectory()) return corpusFiles(file);
+    return /\.json(\.gz)?$/.test(entry.name) ? [file] : [];
+  }).sort();
+}
+
+function compareEntries(outcome: ReplayOutcome): Divergence[] {
+  for (const { entry, logged } of outcome.steps) {
+    const field = ENTRY_FIELDS.find(name => entry[name] !== undefined && entry[name] !== logged?.[name]);
+    if (field) {
+      return [{ check: 'entries', seq: entry.seq, expected: { [field]: entry[field] }, actual: { [field]: logged?.[field] ?? null } }];
+    }
+  }
+  return [];
+}
+
+// Replay one archived game and hold the replay against it
+function checkGame(gameManager: GameManager, game: GameRecord): Divergence[] {
+  const { moveLog, signedResult: signed } = game;
+  let outcome: ReplayOutcome;
+  try {
+    outcome = replayGame(game.config, game.firstTurn, moveLog, { gameManager });
+  } catch (error) {
+    const seq = Number((error as Error).message.match(/^Move log entry (\d+)/)?.[1]);
+    return [{ check: 'replay', ...(Number.isInteger(seq) && { seq }), expected: 'the whole log replays', actual: (error as Error).message }];
+  }
+
+  const divergences = compareEntries(outcome);
+  const abandoned = signed?.result.reason === 'abandoned';
+  const expected = { phase: abandoned ? GamePhase.BATTLE : game.phase, winner: abandoned ? null : game.winner, moveCount: game.moveCount };
+  const actual = { phase: outcome.phase, winner: outcome.winner, moveCount: outcome.moveCount };
+  if (JSON.stringify(expected) !== JSON.stringify(actual)) {
+    divergences.push({ check: 'result', expected, actual });
+  }
+
+  const { boards } = game;
+  if (boards && JSON.stringify(boards) !== JSON.stringify(outcome.boards)) {
+    divergences.push({ check: 'boards', expected: stateHashOf(boards, []), actual: stateHashOf(outcome.boards, []) });
+  }
+  const recordedHash = signed?.result.stateHash;
+  if (recordedHash) {
+    const replayedHash = stateHashOf(outcome.boards, moveLog);
+    if (replayedHash !== recordedHash) divergences.push({ check: 'hash', expected: recordedHash, actual: replayedHash });
+  }
+  return divergences;
+}
+
+function runCorpus(directory: string): CorpusReport {
+  const startedAt = Date.now();
+  const files = corpusFiles(directory);
+  const gameManager = new GameManager(undefined, undefined, new MemoryStore());
+  const report: CorpusReport = { directory, files: files.length, replayed: 0, diverged: 0, unreadable: 0, games: [], durationMs: 0 };
+  files.forEach(file => {
+    let game: GameRecord;
+    try {
+      game = readGameFile(file);
+    } catch (error) {
+      report.unreadable++;
+      report.games.push({ file, gameId: null, entries: 0, divergences: [], error: (error as Error).message });
+      return;
+    }
+
+    report.replayed++;
+    const divergences = checkGame(gameManager, game);
+    if (divergences.length > 0) {
+      report.diverged++;
+      report.games.push({ file, gameId: game.id, entries: game.moveLog.length, divergences });
+    }
+  });
+  report.durationMs = Date.now() - startedAt;
+  return report;
+}
+
+function describeCorpus(report: CorpusReport): string {
+  const lines = [`Replayed ${report.replayed} of ${report.files} file(s) from ${report.directory} in ${(report.durationMs / 1000).toFixed(1)} s: ` +
+    `${report.diverged} diverged, ${report.unreadable} unreadable`];
+  report.games.forEach(game => {
+    lines.push('', `${game.file}${game.gameId ? ` (game ${game.gameId})` : ''}`);
+    if (game.error) lines.push(`  unreadable: ${game.error}`);
+    game.divergences.forEach(({ check, seq, expected, actual }) => {
+      lines.push(`  ${check}${seq !== undefined ? ` at entry ${seq}` : ''}: expected ${JSON.stringify(expected)}, replay gives ${JSON.stringify(actual)}`);
+    });
+  });
+  return lines.join('\n');
+}
+
+function main(args: string[]): void {
+  const directory = args.find(arg => !arg.startsWith('--'));
+  if (!directory || !fs.existsSync(directory) || !fs.statSync(directory).isDirectory()) {
+    if (directory) console.error(`${directory} is not a directory`);
+    console.error('Usage: node corpus.cjs <directory> [--json]');
+    process.exit(2);
+  }
+
+  // What the replayed games log as they are played would bury the report
+  const print = console.log;
+  console.log = () => {};
+  const report = runCorpus(directory);
+  print(args.includes('--json') ? JSON.stringify(report, null, 2) : describeCorpus(report));
+  process.exit(report.diverged > 0 || report.unreadable > 0 ? 1 : 0);
+}
+
+if (require.main === module) {
+  main(process.argv.slice(2));
+}
+
+export { runCorpus, describeCorpus, corpusFiles };
+export type { CorpusReport, CorpusGame, Divergence };
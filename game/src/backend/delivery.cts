@@ -0,0 +1,142 @@
+// Delivery shaping, to keep players' latency low when a game draws a crowd. Each WebSocket
+// connection is sent to at most once every interval set for its role; whatever comes up
+// in between waits and goes out together at the end of it. While a message waits, a newer
+// one superseding it (a game state, a lobby update, server stats) takes its place, so a
+// spectator who falls behind gets the latest board rather than every board in between.
+// Events, commentary and replies all still arrive, in order.
+//
+//   player     seated in a game
+//   spectator  watching one
+//   lobby      neither
+//
+// A connection that has been sent nothing for a whole interval is sent to at once, so a
+// quiet game is not held back at all.
+//
+//   TANKS_DELIVERY_INTERVALS  milliseconds per role, e.g. "spectator=500,lobby=1000";
+//                             unset gives spectators 250 and everyone else no delay
+//
+// REST and gRPC sessions pick replies out of what is sent while a request runs (see
+// api.cts), so only connections attached here are shaped.
+
+import { WebSocket } from 'ws';
+
+const MAX_INTERVAL_MS = 5000;
+const DELIVERY_ROLES: DeliveryRole[] = ['player', 'spectator', 'lobby'];
+const DEFAULT_INTERVALS: DeliveryIntervals = { player: 0, spectator: 250, lobby: 0 };
+
+// Messages a later one of the same type, for the same game, makes obsolete
+const SUPERSEDED = new Set(['gameState', 'spectatorState', 'gameUpdate', 'serverStats']);
+
+type DeliveryRole = 'player' | 'spectator' | 'lobby';
+type DeliveryIntervals = Record<DeliveryRole, number>;
+
+interface Outbox {
+  queue: { key: string | null; frame: string | Buffer }[];
+  lastSentAt: number;
+  timer: NodeJS.Timeout | null;
+}
+
+// How many messages have been held back and how many of those were superseded
+interface DeliveryCounts {
+  delayed: number;
+  superseded: number;
+}
+
+// The intervals from the environment; invalid settings throw
+function loadDeliveryIntervals(env: NodeJS.ProcessEnv = process.env): DeliveryIntervals {
+  const intervals = { ...DEFAULT_INTERVALS };
+  (env.TANKS_DELIVERY_INTERVALS ?? '').split(',').map(part => part.trim()).filter(Boolean).forEach(part => {
+    const [role, value] = part.split('=').map(side => side.trim());
+    const ms = Number(value);
+    if (!DELIVERY_ROLES.includes(role as DeliveryRole) || !Number.isInteger(ms) || ms < 0 || ms > MAX_INTERVAL_MS) {
+      throw new Error(`TANKS_DELIVERY_INTERVALS must list role=milliseconds, roles ${DELIVERY_ROLES.join(', ')} and 0-${MAX_INTERVAL_MS} ms; got "${part}"`);
+    }
+    intervals[role as DeliveryRole] = ms;
+  });
+  return intervals;
+}
+
+// Which superseding message this is, if any
+function supersedeKey(message: any): string | null {
+  return SUPERSEDED.has(message?.type) ? `${message.type}:${message.gameId ?? ''}` : null;
+}
+
+class DeliveryShaper {
+  readonly intervals: DeliveryIntervals;
+  private outboxes: WeakMap<WebSocket, Outbox> = new WeakMap();
+  private counts: DeliveryCounts = { delayed: 0, superseded: 0 };
+
+  constructor(intervals: DeliveryIntervals = DEFAULT_INTERVALS) {
+    this.intervals = intervals;
+  }
+
+  // Shape what is sent to this connection from now on
+  attach(ws: WebSocket): void {
+    this.outboxes.set(ws, { queue: [], lastSentAt: 0, timer: null });
+  }
+
+  shapes(ws: WebSocket): boolean {
+    return this.outboxes.has(ws);
+  }
+
+  status(): { intervals: DeliveryIntervals; counts: DeliveryCounts } {
+    return { intervals: { ...this.intervals }, counts: { ...this.counts } };
+  }
+
+  // Send an encoded message to the connection now or with the next batch
+  deliver(ws: WebSocket, role: DeliveryRole, message: any, frame: string | Buffer): void {
+    const outbox = this.outboxes.get(ws);
+    if (!outbox) {
+      ws.send(frame);
+      return;
+    }
+    const interval = this.intervals[role];
+    const now = Date.now();
+    if (outbox.queue.length === 0 && now - outbox.lastSentAt >= interval) {
+      outbox.lastSentAt = now;
+      ws.send(frame);
+      return;
+    }
+
+    const key = supersedeKey(message);
+    if (key !== null) {
+      const earlier = outbox.queue.findIndex(queued => queued.key === key);
+      if (earlier !== -1) {
+        outbox.queue.splice(earlier, 1);
+        this.counts.superseded++;
+      }
+    }
+    outbox.queue.push({ key, frame });
+    // Due already, e.g. for a spectator who just sat down to play: what waited goes with it
+    if (now - outbox.lastSentAt >= interval) {
+      this.flush(ws);
+      return;
+    }
+    this.counts.delayed++;
+    if (!outbox.timer) {
+      outbox.timer = setTimeout(() => this.flush(ws), outbox.lastSentAt + interval - now);
+    }
+  }
+
+  // Stop shaping a connection that has gone, dropping whatever it was still owed
+  detach(ws: WebSocket): void {
+    const outbox = this.outboxes.get(ws);
+    if (outbox?.timer) clearTimeout(outbox.timer);
+    this.outboxes.delete(ws);
+  }
+
+  private flush(ws: WebSocket): void {
+    const outbox = this.outboxes.get(ws);
+    if (!outbox) return;
+    if (outbox.timer) clearTimeout(outbox.timer);
+    outbox.timer = null;
+    outbox.lastSentAt = Date.now();
+    const queue = outbox.queue;
+    outbox.queue = [];
+    if (ws.readyState !== WebSocket.OPEN) return;
+    queue.forEach(({ frame }) => ws.send(frame));
+  }
+}
+
+export { DeliveryShaper, loadDeliveryIntervals, supersedeKey, DELIVERY_ROLES, DEFAULT_INTERVALS };
+export type { DeliveryRole, DeliveryIntervals, DeliveryCounts };
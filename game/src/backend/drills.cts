@@ -0,0 +1,147 @@
+// Practice drills: a position from the middle of a game, and a few shots to play from it.
+// Positions come from games the computer plays against itself until one of the kind asked
+// for turns up. Each shot is graded against the density strategy's view of the same board
+// (scoreTargets in ai.cts): 100 for one of its best cells, less the further below them.
+//
+//   wounded   a multi-cell tank has been hit but not destroyed; finish it off
+//   endgame   two enemy tanks are left somewhere on the board
+
+import * as crypto from 'crypto';
+import { ErrorCode, GameError } from './errors.cjs';
+import { Rules, CellState, DEFAULT_CONFIG, type GameConfig, type Position, type Side } from './game.cjs';
+import { AI_STRATEGIES, generatePlacements, scoreTargets, gradeShot, bestTargets, type RandomInt } from './ai.cjs';
+
+type DrillKind = 'wounded' | 'endgame';
+
+const DRILL_KINDS: DrillKind[] = ['wounded', 'endgame'];
+const DRILL_SHOTS = 3;          // Shots graded per drill, unless the objective is met sooner
+const MAX_GENERATION_ATTEMPTS = 50;
+
+const DRILL_CONFIGS: Record<DrillKind, GameConfig> = {
+  wounded: { ...DEFAULT_CONFIG, tanksPerPlayer: 3, tankLengths: [2, 3, 2] },
+  endgame: { ...DEFAULT_CONFIG, tanksPerPlayer: 4 }
+};
+
+// The grade of one shot
+interface DrillShot {
+  x: number;
+  y: number;
+  hit: boolean;
+  destroyed: boolean;
+  score: number;       // 0-100
+  best: Position[];    // What the evaluator would have bombed
+}
+
+// What the player is shown of a drill: their view of the enemy board, never the board itself
+interface DrillView {
+  drillId: string;
+  kind: DrillKind;
+  config: GameConfig;
+  enemyBoard: CellState[][];
+  tanksLeft: number;
+  shotsLeft: number;
+  shots: DrillShot[];
+  averageScore: number | null;
+  done: boolean;
+}
+
+class Drill {
+  readonly id: string = crypto.randomUUID();
+  readonly kind: DrillKind;
+  readonly config: GameConfig;
+  private attacker: Side;
+  private defender: Side;
+  private shots: DrillShot[] = [];
+  private woundedTank: number | null;  // Index of the tank to finish off in a 'wounded' drill
+
+  private constructor(kind: DrillKind, attacker: Side, defender: Side, woundedTank: number | null) {
+    this.kind = kind;
+    this.config = DRILL_CONFIGS[kind];
+    this.attacker = attacker;
+    this.defender = defender;
+    this.woundedTank = woundedTank;
+  }
+
+  static generate(kind: DrillKind, random: RandomInt = crypto.randomInt): Drill {
+    if (!DRILL_KINDS.includes(kind)) {
+      throw new GameError(ErrorCode.VALIDATION_FAILED, 'Invalid drill', undefined, [
+        { field: 'kind', reason: `must be one of ${DRILL_KINDS.join(', ')}` }
+      ]);
+    }
+    for (let attempt = 0; attempt < MAX_GENERATION_ATTEMPTS; attempt++) {
+      const drill = Drill.playUntil(kind, random);
+      if (drill) return drill;
+    }
+    throw new GameError(ErrorCode.SERVER_ERROR, 'Could not set up a drill', { kind });
+  }
+
+  // Play the hunt strategy against a fleet laid out by the computer, stopping at the
+  // first position of the kind wanted; null if the game ended without one
+  private static playUntil(kind: DrillKind, random: RandomInt): Drill | null {
+    const config = DRILL_CONFIGS[kind];
+    const attacker = Rules.createSide(config);
+    const defender = Rules.createSide(config);
+    const lengths = Array.from({ length: config.tanksPerPlayer }, (_, i) => Rules.tankLength(config, i));
+    generatePlacements(config.boardSize, lengths, true, random)
+      .forEach(({ x, y, orientation }) => Rules.placeTank(config, defender, x, y, orientation));
+
+    const strategy = AI_STRATEGIES.medium;
+    while (defender.tanksAlive > 0) {
+      if (kind === 'wounded') {
+        const wounded = defender.tanks.findIndex(tank => !tank.destroyed && tank.cells.length > 1 &&
+          tank.cells.some(cell => defender.board[cell.y][cell.x] === CellState.HIT));
+        if (wounded !== -1) return new Drill(kind, attacker, defender, wounded);
+      } else if (defender.tanksAlive === 2) {
+        return new Drill(kind, attacker, defender, null);
+      }
+
+      const target = strategy.chooseTarget({
+        enemyBoard: Rules.boardView(attacker).enemyBoard,
+        explosionRadius: config.explosionRadius,
+        random
+      });
+      Rules.bomb(config, attacker, defender, target.x, target.y);
+    }
+    return null;
+  }
+
+  shoot(x: number, y: number): DrillShot {
+    if (this.isDone()) {
+      throw new GameError(ErrorCode.GAME_OVER, 'This drill is over; start another');
+    }
+    // Grade against the board as it was before the shot
+    const scores = scoreTargets({ enemyBoard: Rules.boardView(this.attacker).enemyBoard, explosionRadius: this.config.explosionRadius });
+    const { hit, destroyed } = Rules.bomb(this.config, this.attacker, this.defender, x, y);
+
+    const shot: DrillShot = {
+      x, y, hit, destroyed,
+      score: gradeShot(scores, x, y),
+      best: bestTargets(scores)
+    };
+    this.shots.push(shot);
+    return shot;
+  }
+
+  view(): DrillView {
+    const done = this.isDone();
+    return {
+      drillId: this.id,
+      kind: this.kind,
+      config: this.config,
+      enemyBoard: Rules.boardView(this.attacker).enemyBoard,
+      tanksLeft: this.defender.tanksAlive,
+      shotsLeft: done ? 0 : DRILL_SHOTS - this.shots.length,
+      shots: this.shots,
+      averageScore: this.shots.length > 0 ? Math.round(this.shots.reduce((sum, s) => sum + s.score, 0) / this.shots.length) : null,
+      done
+    };
+  }
+
+  private isDone(): boolean {
+    if (this.shots.length >= DRILL_SHOTS || this.defender.tanksAlive === 0) return true;
+    return this.woundedTank !== null && this.defender.tanks[this.woundedTank].destroyed;
+  }
+}
+
+export { Drill, DRILL_KINDS, DRILL_SHOTS };
+export type { DrillKind, DrillShot, DrillView };
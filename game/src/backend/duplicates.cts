@@ -0,0 +1,196 @@
+// Find recorded games that are the same game played again: the same settings, the same
+// fleets and the same battle, shot for shot, once each board has been turned or mirrored
+// and the players swapped as need be. Imported corpora are deduplicated this way, and the
+// same two accounts playing one game over and over is what a script farming rating
+// points between them looks like.
+//
+//   node duplicates.cjs <directory> [--json]
+//
+// The directory is searched as corpus.cjs searches it. Each board is matched up on its
+// own, since one player's layout and the shots at it have nothing to do with the other's.
+// Fleets are compared as they stood when the battle began, so the order tanks were placed
+// in and any taken back do not matter; timing and cell names do not either. Exits 1 if
+// any games are duplicates or could not be read.
+
+import * as fs from 'fs';
+import * as crypto from 'crypto';
+import { Rules, BOARD_TRANSFORMS, type BoardTransform, type MoveLogEntry, type Position } from './game.cjs';
+import { readGameFile, type GameRecord } from './resolve.cjs';
+import { corpusFiles } from './corpus.cjs';
+
+// Entries of the battle; everything before it only goes to build the fleets
+const BATTLE_ACTIONS: MoveLogEntry['action'][] = ['move', 'bomb', 'ability', 'timeout'];
+
+interface DuplicateGame {
+  file: string;
+  gameId: string | null;
+  players: { name: string | null; userId: string | null }[];  // Swapped, if need be, to line up with the group's first game
+}
+
+interface DuplicateGroup {
+  fingerprint: string;
+  games: DuplicateGame[];
+  repeatedPairs: string[][];  // Pairs of accounts, both signed in, who played more than one of the games
+}
+
+interface DuplicatesReport {
+  directory: string;
+  files: number;
+  read: number;
+  unreadable: { file: string; error: string }[];
+  groups: DuplicateGroup[];  // Only games with at least one duplicate
+  durationMs: number;
+}
+
+interface Fingerprint {
+  key: string;       // SHA-256 of the game written out the same way for every duplicate
+  swapped: boolean;  // Player 1 of the record is player 0 of the key
+}
+
+// Each player's tanks as they stood when the battle began, rebuilt from the placements
+function startingFleets(game: GameRecord): Position[][][] {
+  const sides = [Rules.createSide(game.config), Rules.createSide(game.config)];
+  game.moveLog.forEach(entry => {
+    const side = sides[entry.playerId];
+    if (entry.action === 'place') Rules.placeTank(game.config, side, entry.x!, entry.y!, entry.orientation);
+    if (entry.action === 'remove') Rules.removeTank(game.config, side, entry.x!, entry.y!);
+  });
+  return sides.map(side => side.tanks.map(tank => tank.cells));
+}
+
+// The game written out with each player's board seen through a symmetry and the players
+// swapped or not; the smallest of all such writings is the game's fingerprint
+function describeVariant(game: GameRecord, fleets: Position[][][], transforms: BoardTransform[], swapped: boolean): string {
+  const { boardSize } = game.config;
+  const cell = (board: number, x: number, y: number) => {
+    const { x: tx, y: ty } = Rules.transformPosition({ x, y }, boardSize, transforms[board]);
+    return `${tx},${ty}`;
+  };
+  const label = (playerId: number) => swapped ? 1 - playerId : playerId;
+
+  // Tanks as their cells, in no particular order
+  const fleetText = [0, 1].map(playerId => fleets[playerId]
+    .map(cells => cells.map(c => cell(playerId, c.x, c.y)).sort().join(' '))
+    .sort().join(' | '));
+  const battle = game.moveLog.filter(entry => BATTLE_ACTIONS.includes(entry.action)).map(entry => {
+    const player = label(entry.playerId);
+    const target = 1 - entry.playerId;
+    switch (entry.action) {
+      case 'move':
+        return `${player} move ${cell(entry.playerId, entry.x!, entry.y!)}>${cell(entry.playerId, entry.toX!, entry.toY!)}`;
+      case 'bomb':
+        return `${player} bomb ${cell(target, entry.x!, entry.y!)} ${entry.outcome}`;
+      case 'timeout':
+        return `${player} timeout ${entry.timeoutAction}`;
+    }
+    if (entry.ability === 'airstrike') {
+      // Named by the line it strikes, which turns with the board, not the cell it was aimed at
+      const along = entry.direction === 'row' ? [{ x: 0, y: entry.y! }, { x: 1, y: entry.y! }] : [{ x: entry.x!, y: 0 }, { x: entry.x!, y: 1 }];
+      const [a, b] = along.map(c => Rules.transformPosition(c, boardSize, transforms[target]));
+      return `${player} airstrike ${a.y === b.y ? `row ${a.y}` : `column ${a.x}`} ${entry.outcome}`;
+    }
+    return `${player} ${entry.ability} ${cell(target, entry.x!, entry.y!)} ${entry.ability === 'scan' ? entry.found : entry.outcome}`;
+  });
+
+  const order = swapped ? [1, 0] : [0, 1];
+  return [fleetText[order[0]], fleetText[order[1]], ...battle].join('\n');
+}
+
+function fingerprint(game: GameRecord): Fingerprint {
+  // The names of cells and who was to move first by policy change nothing about how it went
+  const { coordinates, firstMove, ...settings } = game.config;
+  const fleets = startingFleets(game);
+  let best: Fingerprint | null = null;
+  for (const swapped of [false, true]) {
+    for (const first of BOARD_TRANSFORMS) {
+      for (const second of BOARD_TRANSFORMS) {
+        const key = describeVariant(game, fleets, [first, second], swapped);
+        if (!best || key < best.key) best = { key, swapped };
+      }
+    }
+  }
+  const winner = game.winner === null ? null : (best!.swapped ? 1 - game.winner : game.winner);
+  const text = `${JSON.stringify(settings)}\nwinner ${winner}\n${best!.key}`;
+  return { key: crypto.createHash('sha256').update(text).digest('hex'), swapped: best!.swapped };
+}
+
+// Group the games that are duplicates of each other
+function findDuplicates(games: { file: string; game: GameRecord }[]): DuplicateGroup[] {
+  const byKey: Map<string, DuplicateGame[]> = new Map();
+  games.forEach(({ file, game }) => {
+    const { key, swapped } = fingerprint(game);
+    const players = [0, 1].map(i => ({ name: game.names[i] ?? null, userId: game.userIds[i] ?? null }));
+    if (!byKey.has(key)) byKey.set(key, []);
+    byKey.get(key)!.push({ file, gameId: game.id, players: swapped ? players.reverse() : players });
+  });
+
+  return [...byKey.entries()].filter(([, copies]) => copies.length > 1).map(([key, copies]) => {
+    const pairs: Map<string, number> = new Map();
+    copies.forEach(({ players }) => {
+      if (players.some(p => !p.userId)) return;
+      const pair = players.map(p => p.userId!).sort().join(' ');
+      pairs.set(pair, (pairs.get(pair) ?? 0) + 1);
+    });
+    return {
+      fingerprint: key,
+      games: copies,
+      repeatedPairs: [...pairs.entries()].filter(([, count]) => count > 1).map(([pair]) => pair.split(' '))
+    };
+  });
+}
+
+function runDuplicates(directory: string): DuplicatesReport {
+  const startedAt = Date.now();
+  const files = corpusFiles(directory);
+  const report: DuplicatesReport = { directory, files: files.length, read: 0, unreadable: [], groups: [], durationMs: 0 };
+  const games: { file: string; game: GameRecord }[] = [];
+  files.forEach(file => {
+    try {
+      const game = readGameFile(file);
+      startingFleets(game);  // A log whose placements do not add up is as good as unreadable
+      games.push({ file, game });
+      report.read++;
+    } catch (error) {
+      report.unreadable.push({ file, error: (error as Error).message });
+    }
+  });
+  report.groups = findDuplicates(games);
+  report.durationMs = Date.now() - startedAt;
+  return report;
+}
+
+function describeDuplicates(report: DuplicatesReport): string {
+  const duplicates = report.groups.reduce((total, group) => total + group.games.length - 1, 0);
+  const lines = [`Read ${report.read} of ${report.files} file(s) from ${report.directory} in ${(report.durationMs / 1000).toFixed(1)} s: ` +
+    `${duplicates} duplicate(s) in ${report.groups.length} group(s), ${report.unreadable.length} unreadable`];
+  report.groups.forEach((group, index) => {
+    lines.push('', `Group ${index + 1}, ${group.games.length} games:`);
+    group.games.forEach(game => {
+      const players = game.players.map(p => p.name ?? '?').join(' vs ');
+      lines.push(`  ${game.file}${game.gameId ? ` (game ${game.gameId})` : ''}: ${players}`);
+    });
+    group.repeatedPairs.forEach(pair => lines.push(`  the same accounts played more than one of these: ${pair.join(' and ')}`));
+  });
+  report.unreadable.forEach(({ file, error }) => lines.push('', `${file}`, `  unreadable: ${error}`));
+  return lines.join('\n');
+}
+
+function main(args: string[]): void {
+  const directory = args.find(arg => !arg.startsWith('--'));
+  if (!directory || !fs.existsSync(directory) || !fs.statSync(directory).isDirectory()) {
+    if (directory) console.error(`${directory} is not a directory`);
+    console.error('Usage: node duplicates.cjs <directory> [--json]');
+    process.exit(2);
+  }
+
+  const report = runDuplicates(directory);
+  console.log(args.includes('--json') ? JSON.stringify(report, null, 2) : describeDuplicates(report));
+  process.exit(report.groups.length > 0 || report.unreadable.length > 0 ? 1 : 0);
+}
+
+if (require.main === module) {
+  main(process.argv.slice(2));
+}
+
+export { fingerprint, findDuplicates, runDuplicates, describeDuplicates };
+export type { DuplicateGroup, DuplicateGame, DuplicatesReport, Fingerprint };
@@ -0,0 +1,137 @@
+// Stable, machine-readable error codes shared by every transport.
+// Codes never change meaning; clients may switch on them.
+
+import { DEFAULT_LOCALE, translate } from './i18n.cjs';
+
+enum ErrorCode {
+  INVALID_MESSAGE = 'INVALID_MESSAGE',
+  NOT_FOUND = 'NOT_FOUND',
+  UNAUTHORIZED = 'UNAUTHORIZED',
+  FORBIDDEN = 'FORBIDDEN',
+  VALIDATION_FAILED = 'VALIDATION_FAILED',
+  NOT_IN_GAME = 'NOT_IN_GAME',
+  GAME_NOT_FOUND = 'GAME_NOT_FOUND',
+  GAME_FULL = 'GAME_FULL',
+  INVALID_ROOM_ID = 'INVALID_ROOM_ID',
+  ROOM_EXISTS = 'ROOM_EXISTS',
+  WRONG_PHASE = 'WRONG_PHASE',
+  NOT_YOUR_TURN = 'NOT_YOUR_TURN',
+  GAME_OVER = 'GAME_OVER',
+  GAME_VOIDED = 'GAME_VOIDED',
+  OUT_OF_BOUNDS = 'OUT_OF_BOUNDS',
+  CELL_OCCUPIED = 'CELL_OCCUPIED',
+  ALL_TANKS_PLACED = 'ALL_TANKS_PLACED',
+  NO_TANK_AT_SOURCE = 'NO_TANK_AT_SOURCE',
+  NO_TANK_THERE = 'NO_TANK_THERE',
+  PLACEMENT_INCOMPLETE = 'PLACEMENT_INCOMPLETE',
+  PLACEMENT_CONFIRMED = 'PLACEMENT_CONFIRMED',
+  INVALID_MOVE = 'INVALID_MOVE',
+  ALREADY_BOMBED = 'ALREADY_BOMBED',
+  ABILITY_UNAVAILABLE = 'ABILITY_UNAVAILABLE',
+  MISSING_SEQUENCE = 'MISSING_SEQUENCE',
+  STALE_MOVE = 'STALE_MOVE',
+  FEATURE_DISABLED = 'FEATURE_DISABLED',
+  ACTION_TOO_SOON = 'ACTION_TOO_SOON',
+  STORAGE_ERROR = 'STORAGE_ERROR',
+  MAINTENANCE = 'MAINTENANCE',
+  NAME_TAKEN = 'NAME_TAKEN',
+  INCOMPATIBLE_CLIENT = 'INCOMPATIBLE_CLIENT',
+  INCOMPATIBLE_RULES = 'INCOMPATIBLE_RULES',
+  SERVER_ERROR = 'SERVER_ERROR'
+}
+
+// HTTP status each code maps to when surfaced over HTTP
+const ERROR_HTTP_STATUS: Record<ErrorCode, number> = {
+  [ErrorCode.INVALID_MESSAGE]: 400,
+  [ErrorCode.NOT_FOUND]: 404,
+  [ErrorCode.UNAUTHORIZED]: 401,
+  [ErrorCode.FORBIDDEN]: 403,
+  [ErrorCode.VALIDATION_FAILED]: 422,
+  [ErrorCode.NOT_IN_GAME]: 403,
+  [ErrorCode.GAME_NOT_FOUND]: 404,
+  [ErrorCode.GAME_FULL]: 409,
+  [ErrorCode.INVALID_ROOM_ID]: 422,
+  [ErrorCode.ROOM_EXISTS]: 409,
+  [ErrorCode.WRONG_PHASE]: 409,
+  [ErrorCode.NOT_YOUR_TURN]: 409,
+  [ErrorCode.GAME_OVER]: 409,
+  [ErrorCode.GAME_VOIDED]: 410,
+  [ErrorCode.OUT_OF_BOUNDS]: 422,
+  [ErrorCode.CELL_OCCUPIED]: 409,
+  [ErrorCode.ALL_TANKS_PLACED]: 409,
+  [ErrorCode.NO_TANK_AT_SOURCE]: 422,
+  [ErrorCode.NO_TANK_THERE]: 422,
+  [ErrorCode.PLACEMENT_INCOMPLETE]: 409,
+  [ErrorCode.PLACEMENT_CONFIRMED]: 409,
+  [ErrorCode.INVALID_MOVE]: 422,
+  [ErrorCode.ALREADY_BOMBED]: 409,
+  [ErrorCode.ABILITY_UNAVAILABLE]: 409,
+  [ErrorCode.MISSING_SEQUENCE]: 400,
+  [ErrorCode.STALE_MOVE]: 409,
+  [ErrorCode.FEATURE_DISABLED]: 403,
+  [ErrorCode.ACTION_TOO_SOON]: 429,
+  [ErrorCode.STORAGE_ERROR]: 503,
+  [ErrorCode.MAINTENANCE]: 503,
+  [ErrorCode.NAME_TAKEN]: 409,
+  [ErrorCode.INCOMPATIBLE_CLIENT]: 409,
+  [ErrorCode.INCOMPATIBLE_RULES]: 409,
+  [ErrorCode.SERVER_ERROR]: 500
+};
+
+interface FieldError {
+  field: string;
+  reason: string;
+}
+
+interface ErrorEnvelope {
+  code: ErrorCode;
+  message: string;
+  status: number;
+  details?: Record<string, any>;
+  fields?: FieldError[];
+}
+
+class GameError extends Error {
+  code: ErrorCode;
+  details?: Record<string, any>;
+  fields?: FieldError[];
+
+  constructor(code: ErrorCode, message: string, details?: Record<string, any>, fields?: FieldError[]) {
+    super(message);
+    this.name = 'GameError';
+    this.code = code;
+    this.details = details;
+    this.fields = fields;
+  }
+
+  // Message is translated by code when the locale has a catalog entry
+  toEnvelope(locale: string = DEFAULT_LOCALE): ErrorEnvelope {
+    return {
+      code: this.code,
+      message: translate(`error.${this.code}`, locale, this.details, this.message),
+      status: ERROR_HTTP_STATUS[this.code],
+      details: this.details,
+      fields: this.fields
+    };
+  }
+}
+
+// Wrap anything thrown into a GameError so callers always get a code
+function toGameError(error: unknown): GameError {
+  if (error instanceof GameError) return error;
+  return new GameError(ErrorCode.SERVER_ERROR, 'Server error occurred');
+}
+
+// Reject a message whose named fields are not integers
+function requireIntegers(message: Record<string, any>, fields: string[]): void {
+  const invalid = fields
+    .filter(field => !Number.isInteger(message[field]))
+    .map(field => ({ field, reason: message[field] === undefined ? 'required' : 'must be an integer' }));
+
+  if (invalid.length > 0) {
+    throw new GameError(ErrorCode.VALIDATION_FAILED, 'Invalid action payload', undefined, invalid);
+  }
+}
+
+export { ErrorCode, ERROR_HTTP_STATUS, GameError, toGameError, requireIntegers };
+export type { ErrorEnvelope, FieldError };
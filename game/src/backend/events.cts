@@ -0,0 +1,227 @@
+// Server-side events for anything outside the game to react to: logging, metrics and
+// other services. GameManager emits a typed event on its bus as games are created and
+// played; subscribers are called in the order they subscribed, and one that throws or
+// rejects is logged and skipped so it can never hold up or break a game.
+//
+// Unlike the gameEvent messages players receive, these carry nothing hidden from
+// either player, so they are safe to hand to another service.
+//
+// Built in, and set from the environment:
+//
+//   TANKS_EVENT_LOG         write every event as one JSON object per line to this file, or '-' for stdout
+//   TANKS_WEBHOOK_URLS      comma-separated URLs each event is POSTed to as JSON
+//   TANKS_WEBHOOK_EVENTS    comma-separated event types to POST (default gameOver); commentary
+//                           suits a bot posting a game to a chat channel as it is played
+//   TANKS_WEBHOOK_SECRET    signs each POST: X-Tanks-Signature is sha256=<hex HMAC of the body>
+//
+// Prometheus metrics are always on and served at GET /metrics.
+
+import * as fs from 'fs';
+import * as crypto from 'crypto';
+import type { GameConfig } from './game.cjs';
+import type { SignedResult } from './results.cjs';
+import type { MoveStats } from './analysis.cjs';
+
+const EVENT_TYPES: ServerEvent['type'][] = ['gameCreated', 'tankPlaced', 'bombResolved', 'gameOver', 'commentary'];
+const WEBHOOK_TIMEOUT_MS = 5000;
+const MOVE_RATE_WINDOW_MS = 60 * 1000;  // Moves per second is averaged over this long
+
+interface GameCreated {
+  type: 'gameCreated';
+  gameId: string;
+  config: GameConfig;
+}
+
+// Where the tank went stays with its owner
+interface TankPlaced {
+  type: 'tankPlaced';
+  gameId: string;
+  playerId: number;
+  tanksRemaining: number;
+}
+
+interface BombResolved {
+  type: 'bombResolved';
+  gameId: string;
+  playerId: number;
+  x: number;
+  y: number;
+  cell: string;
+  hit: boolean;
+  destroyed: boolean;
+  tanksRemaining: number;  // The defender's
+  thinkMs: number;
+  quality?: number;        // 0-100, in games with move analysis
+}
+
+// The signed result, so a receiver can check it came from this server (see results.cts),
+// and how each side played, by seat
+interface GameOver {
+  type: 'gameOver';
+  gameId: string;
+  result: SignedResult;
+  moveStats: MoveStats[];
+  shooting: { shots: number; hits: number }[];  // Cells bombed or struck, special shots included
+  placement?: boolean[];  // For each player, whether it was one of their placement matches (see rating.cts)
+  boardImage: string;     // Both final boards as SVG (see image.cts), for a receiver to post
+}
+
+// A line of commentary on a move log entry (see commentary.cts), e.g. for a chat bot to post
+interface Commentary {
+  type: 'commentary';
+  gameId: string;
+  seq: number;  // The entry
+  playerId: number;
+  text: string;
+}
+
+type ServerEvent = GameCreated | TankPlaced | BombResolved | GameOver | Commentary;
+
+type Subscriber = (event: ServerEvent, at: Date) => void | Promise<void>;
+
+class EventBus {
+  private subscribers: { name: string; handler: Subscriber }[] = [];
+
+  // Returns a function that unsubscribes
+  subscribe(name: string, handler: Subscriber): () => void {
+    const entry = { name, handler };
+    this.subscribers.push(entry);
+    return () => {
+      this.subscribers = this.subscribers.filter(subscriber => subscriber !== entry);
+    };
+  }
+
+  emit(event: ServerEvent): void {
+    const at = new Date();
+    this.subscribers.forEach(({ name, handler }) => {
+      const failed = (error: unknown) => console.error(`Event subscriber ${name} failed on ${event.type}: ${(error as Error).message}`);
+      try {
+        const pending = handler(event, at);
+        if (pending) pending.catch(failed);
+      } catch (error) {
+        failed(error);
+      }
+    });
+  }
+}
+
+// One JSON object per line, stamped with when it happened
+function jsonLogger(write: (line: string) => void): Subscriber {
+  return (event, at) => write(`${JSON.stringify({ at: at.toISOString(), ...event })}\n`);
+}
+
+// Counters kept from the events, plus the games in progress read from the server
+// when scraped, written in the Prometheus text format
+class Metrics {
+  private gamesCreated = 0;
+  private gamesFinished: Map<string, number> = new Map();  // By how the game ended
+  private tanksPlaced = 0;
+  private bombs = 0;
+  private hits = 0;
+  private recentMoves: number[] = [];  // When each bomb in the rate window landed
+  private thinkMs = 0;
+  private gradedShots = 0;
+  private shotQuality = 0;
+  private gamesInProgress: () => number;
+
+  constructor(gamesInProgress: () => number = () => 0) {
+    this.gamesInProgress = gamesInProgress;
+  }
+
+  readonly subscriber: Subscriber = (event, at) => {
+    switch (event.type) {
+      case 'gameCreated':
+        this.gamesCreated++;
+        break;
+      case 'tankPlaced':
+        this.tanksPlaced++;
+        break;
+      case 'bombResolved':
+        this.bombs++;
+        if (event.hit) this.hits++;
+        this.recentMoves.push(at.getTime());
+        this.thinkMs += event.thinkMs;
+        if (event.quality !== undefined) {
+          this.gradedShots++;
+          this.shotQuality += event.quality;
+        }
+        break;
+      case 'gameOver':
+        this.gamesFinished.set(event.result.result.reason, (this.gamesFinished.get(event.result.result.reason) ?? 0) + 1);
+        break;
+    }
+  };
+
+  render(now: number = Date.now()): string {
+    this.recentMoves = this.recentMoves.filter(time => time > now - MOVE_RATE_WINDOW_MS);
+    const metric = (name: string, type: 'counter' | 'gauge' | 'summary', help: string, samples: [string, number][]) => [
+      `# HELP ${name} ${help}`,
+      `# TYPE ${name} ${type}`,
+      ...samples.map(([labels, value]) => `${name}${labels} ${value}`)
+    ];
+    return [
+      ...metric('tanks_games_in_progress', 'gauge', 'Games waiting for players or being played', [['', this.gamesInProgress()]]),
+      ...metric('tanks_games_created_total', 'counter', 'Games created', [['', this.gamesCreated]]),
+      ...metric('tanks_games_finished_total', 'counter', 'Games won, by how they ended',
+        [...this.gamesFinished].map(([reason, count]): [string, number] => [`{reason="${reason}"}`, count])),
+      ...metric('tanks_tanks_placed_total', 'counter', 'Tanks placed', [['', this.tanksPlaced]]),
+      ...metric('tanks_moves_total', 'counter', 'Bombs dropped', [['', this.bombs]]),
+      ...metric('tanks_hits_total', 'counter', 'Bombs that hit a tank', [['', this.hits]]),
+      ...metric('tanks_moves_per_second', 'gauge', `Bombs dropped per second over the last ${MOVE_RATE_WINDOW_MS / 1000} seconds`,
+        [['', this.recentMoves.length / (MOVE_RATE_WINDOW_MS / 1000)]]),
+      ...metric('tanks_hit_rate', 'gauge', 'Share of bombs that hit a tank', [['', this.bombs === 0 ? 0 : this.hits / this.bombs]]),
+      ...metric('tanks_think_seconds', 'summary', 'Time players took over each bomb', [['_sum', this.thinkMs / 1000], ['_count', this.bombs]]),
+      ...metric('tanks_shot_quality', 'gauge', 'Average grade of bombs in games with move analysis, 0-100',
+        [['', this.gradedShots === 0 ? 0 : this.shotQuality / this.gradedShots]])
+    ].join('\n') + '\n';
+  }
+}
+
+// POST each event of the chosen types to every URL. Delivery is best effort: a
+// receiver that is down or slow misses the event and the failure is logged.
+function webhookSender(urls: string[], types: ServerEvent['type'][], secret?: string): Subscriber {
+  return async (event, at) => {
+    if (!types.includes(event.type)) return;
+    const body = JSON.stringify({ at: at.toISOString(), ...event });
+    const headers: Record<string, string> = { 'Content-Type': 'application/json' };
+    if (secret) headers['X-Tanks-Signature'] = `sha256=${crypto.createHmac('sha256', secret).update(body).digest('hex')}`;
+
+    await Promise.all(urls.map(async url => {
+      const response = await fetch(url, { method: 'POST', headers, body, signal: AbortSignal.timeout(WEBHOOK_TIMEOUT_MS) });
+      if (!response.ok) throw new Error(`${url} answered ${response.status}`);
+    }));
+  };
+}
+
+// Subscribe the logger and webhooks the environment asks for, and say what was set
+// up. Invalid settings throw, so a typo cannot quietly drop every event.
+function attachHooks(bus: EventBus, env: NodeJS.ProcessEnv = process.env): string[] {
+  const attached: string[] = [];
+  const list = (value: string | undefined) => (value ?? '').split(',').map(item => item.trim()).filter(Boolean);
+
+  if (env.TANKS_EVENT_LOG) {
+    const file = env.TANKS_EVENT_LOG;
+    bus.subscribe('eventLog', jsonLogger(file === '-' ? line => process.stdout.write(line) : line => fs.appendFileSync(file, line)));
+    attached.push(`event log to ${file === '-' ? 'stdout' : file}`);
+  }
+
+  const urls = list(env.TANKS_WEBHOOK_URLS);
+  if (urls.length > 0) {
+    urls.forEach(url => {
+      if (!URL.canParse(url) || !/^https?:$/.test(new URL(url).protocol)) {
+        throw new Error(`TANKS_WEBHOOK_URLS: ${url} is not an http or https URL`);
+      }
+    });
+    const types = env.TANKS_WEBHOOK_EVENTS ? list(env.TANKS_WEBHOOK_EVENTS) : ['gameOver'];
+    const unknown = types.filter(type => !EVENT_TYPES.includes(type as ServerEvent['type']));
+    if (unknown.length > 0) {
+      throw new Error(`TANKS_WEBHOOK_EVENTS must list only ${EVENT_TYPES.join(', ')}`);
+    }
+    bus.subscribe('webhooks', webhookSender(urls, types as ServerEvent['type'][], env.TANKS_WEBHOOK_SECRET || undefined));
+    attached.push(`${types.join(', ')} webhooks to ${urls.length} URL(s)`);
+  }
+  return attached;
+}
+
+export { EVENT_TYPES, EventBus, Metrics, jsonLogger, webhookSender, attachHooks };
+export type { ServerEvent, GameCreated, TankPlaced, BombResolved, GameOver, Commentary, Subscriber };
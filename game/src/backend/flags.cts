@@ -0,0 +1,81 @@
+// Feature flags for experimental rules and server behavior.
+// Operators override the defaults with the TANKS_FEATURE_FLAGS environment variable
+// (inline JSON) or a JSON file named by TANKS_FEATURE_FLAGS_FILE, e.g.
+//   { "tankMovement": false, "settingsNegotiation": { "enabled": true, "rollout": 25 } }
+// A rollout percentage enables the flag for that share of games, chosen by game id.
+
+import * as fs from 'fs';
+import * as crypto from 'crypto';
+
+type FeatureFlag = 'tankMovement' | 'settingsNegotiation' | 'customRoomIds' | 'chat' | 'spectators' | 'moveAnalysis';
+
+interface FlagSetting {
+  enabled: boolean;
+  rollout: number; // 0-100
+}
+
+const DEFAULT_FLAGS: Record<FeatureFlag, FlagSetting> = {
+  tankMovement: { enabled: true, rollout: 100 },
+  settingsNegotiation: { enabled: true, rollout: 100 },
+  customRoomIds: { enabled: true, rollout: 100 },
+  chat: { enabled: true, rollout: 100 },
+  spectators: { enabled: true, rollout: 100 },
+  moveAnalysis: { enabled: true, rollout: 100 }  // Grade every bomb against the density strategy (see ai.cts)
+};
+
+class FeatureFlags {
+  private settings: Record<FeatureFlag, FlagSetting> = { ...DEFAULT_FLAGS };
+
+  // Reload overrides from the environment; unknown flags are ignored
+  load(env: NodeJS.ProcessEnv = process.env): void {
+    const settings = { ...DEFAULT_FLAGS };
+
+    let overrides: Record<string, any> = {};
+    try {
+      if (env.TANKS_FEATURE_FLAGS_FILE) {
+        overrides = JSON.parse(fs.readFileSync(env.TANKS_FEATURE_FLAGS_FILE, 'utf-8'));
+      } else if (env.TANKS_FEATURE_FLAGS) {
+        overrides = JSON.parse(env.TANKS_FEATURE_FLAGS);
+      }
+    } catch (error) {
+      console.error('Failed to read feature flags, using defaults:', error);
+    }
+
+    Object.entries(overrides).forEach(([name, value]) => {
+      if (!(name in DEFAULT_FLAGS)) {
+        console.log(`Ignoring unknown feature flag: ${name}`);
+        return;
+      }
+      const setting = typeof value === 'boolean' ? { enabled: value, rollout: 100 } : {
+        enabled: value?.enabled !== false,
+        rollout: Math.min(Math.max(Number(value?.rollout ?? 100), 0), 100)
+      };
+      settings[name as FeatureFlag] = setting;
+    });
+
+    this.settings = settings;
+  }
+
+  isEnabled(flag: FeatureFlag, gameId?: string): boolean {
+    const setting = this.settings[flag];
+    if (!setting.enabled) return false;
+    if (setting.rollout >= 100) return true;
+    if (!gameId) return false;
+
+    // Stable bucket per game so a game never flips mid-match
+    const bucket = crypto.createHash('sha1').update(`${flag}:${gameId}`).digest().readUInt16BE(0) % 100;
+    return bucket < setting.rollout;
+  }
+
+  // Evaluate every flag for one game, or globally when no game id is given
+  snapshot(gameId?: string): Record<FeatureFlag, boolean> {
+    const result = {} as Record<FeatureFlag, boolean>;
+    (Object.keys(this.settings) as FeatureFlag[]).forEach(flag => {
+      result[flag] = this.isEnabled(flag, gameId);
+    });
+    return result;
+  }
+}
+
+export { FeatureFlags, DEFAULT_FLAGS };
+export type { FeatureFlag, FlagSetting };
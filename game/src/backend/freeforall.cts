@@ -0,0 +1,155 @@
+// Free-for-all for three or more players taking turns at one screen or one API client
+// (hot seat). Everyone has a fleet on their own board; on their turn a player picks an
+// opponent still in the game and bombs a cell of that opponent's board, uncovering what
+// is around it on that board only. Turns go round the seats in order, passing over
+// anyone who has lost their last tank, and the last player with a tank left wins.
+//
+// Fleets are laid out at random, since everyone can see the screen while placing. Special
+// shots, tank movement and clocks are two-player features and play no part. Matches are
+// played through the REST API (see api.cts) or at a terminal with hotseat.cts.
+
+import * as crypto from 'crypto';
+import { ErrorCode, GameError } from './errors.cjs';
+import { Rules, DEFAULT_CONFIG, type CellState, type GameConfig, type Side } from './game.cjs';
+import { generatePlacements, type RandomInt } from './ai.cjs';
+import { formatCell } from './coords.cjs';
+
+const MIN_PLAYERS = 3;
+const MAX_PLAYERS = 6;
+const MAX_NAME_LENGTH = 20;
+
+interface FreeForAllPlayer {
+  name: string;
+  fleet: Side;
+  views: CellState[][][];  // What this player has uncovered of each seat's board; their own stays empty
+  eliminatedOnMove: number | null;
+}
+
+interface FreeForAllShot {
+  playerId: number;
+  target: number;
+  x: number;
+  y: number;
+  cell: string;
+  hit: boolean;
+  destroyed: boolean;
+  eliminated: boolean;  // That was the target's last tank
+}
+
+// The match as one seat sees it: every fleet's size, and that seat's own board and views
+interface FreeForAllView {
+  matchId: string;
+  config: GameConfig;
+  players: { id: number; name: string; tanksAlive: number; eliminated: boolean }[];
+  turn: number | null;    // Seat to move; null once someone has won
+  moveCount: number;
+  winner: number | null;
+  lastShot: FreeForAllShot | null;
+  seat: number;
+  myBoard: CellState[][];
+  enemyBoards: { playerId: number; board: CellState[][] }[];
+}
+
+class FreeForAll {
+  readonly id: string = crypto.randomUUID();
+  readonly config: GameConfig;
+  readonly createdAt: number = Date.now();
+  private players: FreeForAllPlayer[];
+  private turn = 0;
+  private moveCount = 0;
+  private winner: number | null = null;
+  private lastShot: FreeForAllShot | null = null;
+
+  private constructor(config: GameConfig, players: FreeForAllPlayer[]) {
+    this.config = config;
+    this.players = players;
+  }
+
+  static create(names: unknown, proposedConfig?: unknown, base: GameConfig = DEFAULT_CONFIG, random: RandomInt = crypto.randomInt): FreeForAll {
+    const valid = Array.isArray(names) && names.length >= MIN_PLAYERS && names.length <= MAX_PLAYERS &&
+      names.every(name => typeof name === 'string' && name.trim().length > 0 && name.trim().length <= MAX_NAME_LENGTH);
+    if (!valid) {
+      throw new GameError(ErrorCode.VALIDATION_FAILED, 'Invalid free-for-all', undefined, [
+        { field: 'players', reason: `must list ${MIN_PLAYERS} to ${MAX_PLAYERS} names of up to ${MAX_NAME_LENGTH} characters` }
+      ]);
+    }
+
+    const config: GameConfig = {
+      ...Rules.resolveConfig(proposedConfig, base),
+      turnTimeSeconds: 0,
+      gameTimeSeconds: 0,
+      airstrikes: 0,
+      clusterBombs: 0,
+      scans: 0,
+      maxTurns: 0,
+      shotBudget: 0,
+      concedeWithinShots: 0
+    };
+    const lengths = Array.from({ length: config.tanksPerPlayer }, (_, i) => Rules.tankLength(config, i));
+    const players = (names as string[]).map(name => {
+      const fleet = Rules.createSide(config);
+      generatePlacements(config.boardSize, lengths, true, random)
+        .forEach(({ x, y, orientation }) => Rules.placeTank(config, fleet, x, y, orientation));
+      return { name: name.trim(), fleet, views: names.map(() => Rules.createEmptyBoard(config.boardSize)), eliminatedOnMove: null };
+    });
+    return new FreeForAll(config, players);
+  }
+
+  bomb(playerId: number, target: number, x: number, y: number): FreeForAllShot {
+    if (this.winner !== null) {
+      throw new GameError(ErrorCode.GAME_OVER, 'This match is over', { winner: this.winner });
+    }
+    if (playerId !== this.turn) {
+      throw new GameError(ErrorCode.NOT_YOUR_TURN, 'Not your turn', { turn: this.turn });
+    }
+    const defender = this.players[target];
+    if (!Number.isInteger(target) || !defender || target === playerId || defender.eliminatedOnMove !== null) {
+      throw new GameError(ErrorCode.VALIDATION_FAILED, 'Invalid target', undefined, [
+        { field: 'target', reason: 'must be the seat of an opponent still in the match' }
+      ]);
+    }
+
+    // Rules.bomb sees a two-player game: this player's view of the one board under fire
+    const attacker = this.players[playerId];
+    const { hit, destroyed } = Rules.bomb(this.config, { ...attacker.fleet, visibleEnemyBoard: attacker.views[target] }, defender.fleet, x, y);
+    const eliminated = defender.fleet.tanksAlive === 0;
+    if (eliminated) defender.eliminatedOnMove = this.moveCount;
+    this.moveCount++;
+
+    const standing = this.players.map((_, seat) => seat).filter(seat => this.players[seat].eliminatedOnMove === null);
+    if (standing.length === 1) {
+      this.winner = standing[0];
+    } else {
+      this.turn = standing.find(seat => seat > playerId) ?? standing[0];
+    }
+    this.lastShot = { playerId, target, x, y, cell: formatCell(this.config.coordinates, x, y), hit, destroyed, eliminated };
+    return this.lastShot;
+  }
+
+  // Seat defaults to the player to move, or the winner once there is one
+  view(seat: number = this.winner ?? this.turn): FreeForAllView {
+    const viewer = this.players[seat];
+    if (!Number.isInteger(seat) || !viewer) {
+      throw new GameError(ErrorCode.VALIDATION_FAILED, 'Invalid seat', undefined, [
+        { field: 'seat', reason: `must be a seat from 0 to ${this.players.length - 1}` }
+      ]);
+    }
+    return {
+      matchId: this.id,
+      config: this.config,
+      players: this.players.map((player, id) => ({
+        id, name: player.name, tanksAlive: player.fleet.tanksAlive, eliminated: player.eliminatedOnMove !== null
+      })),
+      turn: this.winner === null ? this.turn : null,
+      moveCount: this.moveCount,
+      winner: this.winner,
+      lastShot: this.lastShot,
+      seat,
+      myBoard: Rules.boardView(viewer.fleet).myBoard,
+      enemyBoards: viewer.views.map((board, playerId) => ({ playerId, board: board.map(row => [...row]) })).filter(({ playerId }) => playerId !== seat)
+    };
+  }
+}
+
+export { FreeForAll, MIN_PLAYERS, MAX_PLAYERS };
+export type { FreeForAllShot, FreeForAllView };
@@ -0,0 +1,893 @@
+// The game itself: boards, tanks, settings and the rules for placing, moving and
+// bombing. Nothing here knows about sockets, rooms or whose turn it is, so the server,
+// AI players and offline tools all share one implementation of the rules.
+
+import { ErrorCode, GameError } from './errors.cjs';
+import { COORDINATE_SYSTEMS, axisLabels, type CoordinateSystem } from './coords.cjs';
+
+// Game Constants
+// The rules as implemented here. Raise it with any change that could make the same settings
+// and moves play out differently, so saves and clients made under other rules are refused
+// instead of quietly played under these. A change that only adds a setting, off by default,
+// leaves it alone. Saves from before it was kept count as version 1.
+const RULES_VERSION = 1;
+const MIN_RULES_VERSION = 1;  // The oldest rules a saved game can be carried forward from
+const BOARD_SIZE = 8;
+const TANKS_PER_PLAYER = 3;
+const EXPLOSION_RADIUS = 1;
+const DEFAULT_CONFIG: GameConfig = {
+  boardSize: BOARD_SIZE,
+  tanksPerPlayer: TANKS_PER_PLAYER,
+  explosionRadius: EXPLOSION_RADIUS,
+  firstMove: 'creator',
+  tankLengths: [],
+  turnTimeSeconds: 0,
+  gameTimeSeconds: 0,
+  timeoutAction: 'skip',
+  airstrikes: 0,
+  clusterBombs: 0,
+  scans: 0,
+  maxTurns: 0,
+  shotBudget: 0,
+  concedeWithinShots: 0,
+  coordinates: 'letterNumber'
+};
+const CONFIG_LIMITS = {
+  boardSize: { min: 5, max: 12 },
+  tanksPerPlayer: { min: 1, max: 10 },
+  explosionRadius: { min: 0, max: 2 },
+  turnTimeSeconds: { min: 0, max: 600 },    // 0: no turn clock
+  gameTimeSeconds: { min: 0, max: 7200 },   // 0: no overall budget
+  airstrikes: { min: 0, max: 3 },           // Special shots each player starts with
+  clusterBombs: { min: 0, max: 3 },
+  scans: { min: 0, max: 3 },
+  maxTurns: { min: 0, max: 400 },           // 0: the battle runs until a fleet is gone
+  shotBudget: { min: 0, max: 144 },         // 0: shots are not counted
+  concedeWithinShots: { min: 0, max: 5 }    // 0: a forced loss is never offered for conceding
+};
+const FIRST_MOVE_POLICIES: FirstMovePolicy[] = ['creator', 'joiner', 'random'];
+const TIMEOUT_ACTIONS: TimeoutAction[] = ['skip', 'forfeit'];
+const TANK_LENGTH_LIMITS = { min: 1, max: 4 };
+const BOARD_TRANSFORMS: BoardTransform[] = [false, true].flatMap(mirrored =>
+  ([0, 1, 2, 3] as const).map(rotations => ({ rotations, mirrored })));
+const ORIENTATIONS: Orientation[] = ['horizontal', 'vertical'];
+const ABILITIES: Ability[] = ['airstrike', 'cluster', 'scan'];
+const STRIKE_DIRECTIONS: StrikeDirection[] = ['row', 'column'];
+// The setting that says how many of each special shot a player gets
+const ABILITY_SETTINGS: Record<Ability, 'airstrikes' | 'clusterBombs' | 'scans'> = {
+  airstrike: 'airstrikes',
+  cluster: 'clusterBombs',
+  scan: 'scans'
+};
+const ABILITY_AREA_RADIUS = 1; // Cluster bombs and scans cover the 3x3 square around their target
+// How a battle stopped by maxTurns or shotBudget is decided, in order; the first that differs wins
+const LIMIT_TIEBREAKS = ['tanks standing', 'accuracy', 'moved second'];
+
+// Types
+enum CellState {
+  EMPTY = 0,
+  TANK = 1,
+  HIT = 2,
+  MISS = 3,
+  REVEALED = 4
+}
+
+const BOARD_TEXT_SYMBOLS: Record<CellState, string> = {
+  [CellState.EMPTY]: '.',
+  [CellState.TANK]: 'T',
+  [CellState.HIT]: 'X',
+  [CellState.MISS]: 'o',
+  [CellState.REVEALED]: '~'
+};
+
+interface Position {
+  x: number;
+  y: number;
+}
+
+// One of the eight symmetries of a square board
+interface BoardTransform {
+  rotations: 0 | 1 | 2 | 3;  // Quarter turns clockwise
+  mirrored: boolean;         // Flipped left-right before turning
+}
+
+// Tanks extend right (horizontal) or down (vertical) from the cell they are placed on
+type Orientation = 'horizontal' | 'vertical';
+
+interface Tank {
+  cells: Position[];
+  orientation: Orientation;
+  destroyed: boolean;  // Every cell has been hit
+}
+
+// Who opens the battle: the room creator, the player who joined, or a coin flip
+type FirstMovePolicy = 'creator' | 'joiner' | 'random';
+
+// Special shots, each used in place of a bomb: an airstrike hits every cell of a row or
+// column, a cluster bomb every cell of a 3x3 square, and a scan tells whether a 3x3
+// square holds any tank without harming it
+type Ability = 'airstrike' | 'cluster' | 'scan';
+type StrikeDirection = 'row' | 'column';
+
+// The outcome of one cell of a multi-cell strike
+interface StrikeCell {
+  x: number;
+  y: number;
+  hit: boolean;
+  destroyed: boolean;  // This hit finished off its tank
+}
+
+// What happens when a player's turn clock runs out. Running out of overall game
+// time always forfeits, since there is no time left to play the next turn with.
+type TimeoutAction = 'skip' | 'forfeit';
+
+interface GameConfig {
+  boardSize: number;
+  tanksPerPlayer: number;
+  explosionRadius: number;
+  firstMove: FirstMovePolicy;
+  tankLengths: number[];  // Length of each tank in placement order; unlisted tanks are 1 cell
+  turnTimeSeconds: number;  // Time allowed for each turn
+  gameTimeSeconds: number;  // Time each player has for all of their turns together
+  timeoutAction: TimeoutAction;
+  airstrikes: number;
+  clusterBombs: number;
+  scans: number;
+  maxTurns: number;     // Turns of the battle, both players' together, before it is decided on the boards
+  shotBudget: number;   // Bombs and special shots each player may take; out of them, their turns pass
+  concedeWithinShots: number;  // A player whose loss is forced within this many of the opponent's shots may concede it
+  coordinates: CoordinateSystem;  // How cells are named to people; x and y are always from 0
+}
+
+// One action in the order it was taken; enough to rebuild the game from scratch
+interface MoveLogEntry {
+  seq: number;
+  action: 'place' | 'remove' | 'confirm' | 'move' | 'bomb' | 'ability' | 'timeout';
+  playerId: number;
+  moveCount: number;  // Turn number the action was taken on
+  timestamp: number;
+  x?: number;                           // place, remove, move, bomb, ability
+  y?: number;
+  orientation?: Orientation;            // place
+  toX?: number;                         // move
+  toY?: number;
+  outcome?: 'hit' | 'miss' | 'victory';  // bomb, and airstrikes and cluster bombs
+  ability?: Ability;                    // ability
+  direction?: StrikeDirection;          // airstrike
+  found?: boolean;                      // scan
+  timeoutAction?: TimeoutAction;        // timeout
+  thinkMs?: number;                     // move, bomb, ability: time since the action before it
+  quality?: number;                     // bomb, in games with move analysis: 0-100, see gradeShot in ai.cts
+  premove?: { x: number; y: number; outcome: 'hit' | 'miss' };  // bomb: played by the server from a premove on this condition
+}
+
+// One cell of a board changing state, stamped with the logged action that changed it.
+// From these a board can be drawn as it stood after any entry of the move log (see
+// Rules.boardAt), and a renderer can pick out the last shot or fade older ones.
+interface CellChange {
+  seq: number;        // Move log entry
+  moveCount: number;  // Turn it came on
+  playerId: number;   // Who took the action
+  owner: number;      // Whose side the board belongs to
+  view: 'own' | 'enemy';  // The owner's own board, or their view of the enemy's
+  x: number;
+  y: number;
+  from: CellState;
+  to: CellState;
+}
+
+// One player's half of the game: their own board, what the fog lets them see of the
+// enemy's, and their tanks
+interface Side {
+  board: CellState[][];
+  visibleEnemyBoard: CellState[][];
+  tanks: Tank[];  // In placement order; destroyed tanks stay listed
+  tanksAlive: number;
+  abilitiesUsed: Record<Ability, number>;
+}
+
+// The boards as one player may see them. Every copy of a board that leaves the
+// server is built from one of these, never from the opponent's own board.
+interface BoardView {
+  myBoard: CellState[][];     // In full, tanks included
+  enemyBoard: CellState[][];  // Hits, misses and whatever blasts have uncovered
+}
+
+// Something the rules let a side do to the boards, in the form of the message that does it
+// (see Rules.placementActions and Rules.battleActions)
+type BoardAction =
+  | { type: 'placeTank'; x: number; y: number; orientation: Orientation }
+  | { type: 'removeTank'; x: number; y: number }
+  | { type: 'confirmPlacement' }
+  | { type: 'moveTank'; fromX: number; fromY: number; toX: number; toY: number }
+  | { type: 'bomb'; x: number; y: number }
+  | { type: 'useAbility'; ability: Ability; x: number; y: number; direction?: StrikeDirection };
+
+// The rules a set of settings amounts to, spelled out so clients need not work them
+// out from the settings themselves (see Rules.describe)
+interface RulesDescription {
+  version: number;  // RULES_VERSION
+  board: { size: number; coordinates: CoordinateSystem; columns: string; rows: string };
+  tanks: { count: number; lengths: number[]; cells: number; orientations: Orientation[] };
+  bomb: { explosionRadius: number; revealedArea: string };  // The square uncovered around each bomb
+  abilities: { name: Ability; perPlayer: number; area: string; harmsTanks: boolean }[];  // Only those in play
+  firstMove: FirstMovePolicy;
+  timers: { turnSeconds: number | null; gameSeconds: number | null; onTimeout: TimeoutAction };  // null: no clock
+  limits: { maxTurns: number | null; shotBudget: number | null; decidedBy: string[] };  // null: no limit
+  concede: { withinShots: number | null };  // null: never offered
+  config: GameConfig;
+}
+
+class Rules {
+  static createEmptyBoard(boardSize: number): CellState[][] {
+    return Array(boardSize).fill(null).map(() => Array(boardSize).fill(CellState.EMPTY));
+  }
+
+  // A fresh half of the game with nothing placed yet
+  static createSide(config: GameConfig): Side {
+    return {
+      board: Rules.createEmptyBoard(config.boardSize),
+      visibleEnemyBoard: Rules.createEmptyBoard(config.boardSize),
+      tanks: [],
+      tanksAlive: 0,
+      abilitiesUsed: { airstrike: 0, cluster: 0, scan: 0 }
+    };
+  }
+
+  static isValidPosition(x: number, y: number, boardSize: number): boolean {
+    return x >= 0 && y >= 0 && x < boardSize && y < boardSize;
+  }
+
+  static tankLength(config: GameConfig, index: number): number {
+    return config.tankLengths[index] ?? 1;
+  }
+
+  // Total cells covered by one player's full set of tanks
+  static fleetCells(config: GameConfig): number {
+    let cells = 0;
+    for (let i = 0; i < config.tanksPerPlayer; i++) cells += Rules.tankLength(config, i);
+    return cells;
+  }
+
+  // Cells a tank of the given length covers when placed at (x, y)
+  static tankCells(x: number, y: number, length: number, orientation: Orientation): Position[] {
+    return Array.from({ length }, (_, i) => orientation === 'horizontal' ? { x: x + i, y } : { x, y: y + i });
+  }
+
+  // Length of the next tank to place: the first in the fleet's order that is not on the
+  // board, which may be an earlier one if it was taken back
+  static nextTankLength(config: GameConfig, side: Side): number {
+    const placed = side.tanks.map(tank => tank.cells.length);
+    for (let i = 0; i < config.tanksPerPlayer; i++) {
+      const length = Rules.tankLength(config, i);
+      const index = placed.indexOf(length);
+      if (index === -1) return length;
+      placed.splice(index, 1);
+    }
+    return Rules.tankLength(config, side.tanks.length);
+  }
+
+  // Place the side's next tank with its top-left cell at (x, y). The settings fix its
+  // length; every cell it covers must be on the board and free.
+  static placeTank(config: GameConfig, side: Side, x: number, y: number, orientation: Orientation = 'horizontal'): Tank {
+    const { boardSize, tanksPerPlayer } = config;
+    if (side.tanks.length >= tanksPerPlayer) {
+      throw new GameError(ErrorCode.ALL_TANKS_PLACED, 'All tanks have already been placed', { tanksPerPlayer });
+    }
+
+    if (!ORIENTATIONS.includes(orientation)) {
+      throw new GameError(ErrorCode.VALIDATION_FAILED, 'Invalid action payload', undefined, [
+        { field: 'orientation', reason: `must be one of ${ORIENTATIONS.join(', ')}` }
+      ]);
+    }
+
+    const length = Rules.nextTankLength(config, side);
+    const cells = Rules.tankCells(x, y, length, orientation);
+    if (!cells.every(cell => Rules.isValidPosition(cell.x, cell.y, boardSize))) {
+      throw new GameError(ErrorCode.OUT_OF_BOUNDS, 'Position is outside the board', { x, y, length, orientation, boardSize });
+    }
+    const occupied = cells.find(cell => side.board[cell.y][cell.x] !== CellState.EMPTY);
+    if (occupied) {
+      throw new GameError(ErrorCode.CELL_OCCUPIED, 'There is already a tank there', occupied);
+    }
+
+    const tank: Tank = { cells, orientation, destroyed: false };
+    cells.forEach(cell => { side.board[cell.y][cell.x] = CellState.TANK; });
+    side.tanks.push(tank);
+    side.tanksAlive++;
+    return tank;
+  }
+
+  // Take back the tank covering (x, y) before the battle, freeing its cells
+  static removeTank(config: GameConfig, side: Side, x: number, y: number): Tank {
+    if (!Rules.isValidPosition(x, y, config.boardSize)) {
+      throw new GameError(ErrorCode.OUT_OF_BOUNDS, 'Position is outside the board', { x, y, boardSize: config.boardSize });
+    }
+    const index = side.tanks.findIndex(tank => tank.cells.some(cell => cell.x === x && cell.y === y));
+    if (index === -1) {
+      throw new GameError(ErrorCode.NO_TANK_THERE, 'You have no tank there', { x, y });
+    }
+
+    const [tank] = side.tanks.splice(index, 1);
+    tank.cells.forEach(cell => { side.board[cell.y][cell.x] = CellState.EMPTY; });
+    side.tanksAlive--;
+    return tank;
+  }
+
+  // Shift the undamaged tank covering (fromX, fromY) so that cell lands on (toX, toY)
+  static moveTank(config: GameConfig, side: Side, opponent: Side, fromX: number, fromY: number, toX: number, toY: number): void {
+    const { boardSize } = config;
+    if (!Rules.isValidPosition(fromX, fromY, boardSize) || !Rules.isValidPosition(toX, toY, boardSize)) {
+      throw new GameError(ErrorCode.OUT_OF_BOUNDS, 'Position is outside the board', { fromX, fromY, toX, toY, boardSize });
+    }
+
+    // Check if there's a tank at source; the whole tank shifts by the same offset
+    const tank = side.tanks.find(t => !t.destroyed && t.cells.some(c => c.x === fromX && c.y === fromY));
+    if (!tank || side.board[fromY][fromX] !== CellState.TANK) {
+      throw new GameError(ErrorCode.NO_TANK_AT_SOURCE, 'There is no tank to move there', { x: fromX, y: fromY });
+    }
+    if (tank.cells.some(c => side.board[c.y][c.x] === CellState.HIT)) {
+      throw new GameError(ErrorCode.INVALID_MOVE, 'Damaged tanks cannot move', { x: fromX, y: fromY });
+    }
+
+    const dx = toX - fromX;
+    const dy = toY - fromY;
+    if (dx === 0 && dy === 0) {
+      throw new GameError(ErrorCode.INVALID_MOVE, 'Tanks can only move onto empty cells', { x: toX, y: toY });
+    }
+    const destination = tank.cells.map(c => ({ x: c.x + dx, y: c.y + dy }));
+    const ownCell = (x: number, y: number) => tank.cells.some(c => c.x === x && c.y === y);
+    const blocked = destination.find(c => !Rules.isValidPosition(c.x, c.y, boardSize) ||
+      (side.board[c.y][c.x] !== CellState.EMPTY && !ownCell(c.x, c.y)));
+    if (blocked) {
+      throw new GameError(ErrorCode.INVALID_MOVE, 'Tanks can only move onto empty cells', blocked);
+    }
+
+    // Move tank
+    tank.cells.forEach(c => { side.board[c.y][c.x] = CellState.EMPTY; });
+    destination.forEach(c => { side.board[c.y][c.x] = CellState.TANK; });
+
+    // Keep the opponent's view honest: cells they can see show the tank arriving or leaving
+    tank.cells.forEach(c => {
+      if (opponent.visibleEnemyBoard[c.y][c.x] === CellState.TANK) {
+        opponent.visibleEnemyBoard[c.y][c.x] = CellState.REVEALED;
+      }
+    });
+    destination.forEach(c => {
+      if (opponent.visibleEnemyBoard[c.y][c.x] === CellState.REVEALED) {
+        opponent.visibleEnemyBoard[c.y][c.x] = CellState.TANK;
+      }
+    });
+    tank.cells = destination;
+  }
+
+  // Drop a bomb on the defender's (x, y) and uncover the blast area for the attacker
+  static bomb(config: GameConfig, attacker: Side, defender: Side, x: number, y: number): { hit: boolean; destroyed: boolean } {
+    if (!Rules.isValidPosition(x, y, config.boardSize)) {
+      throw new GameError(ErrorCode.OUT_OF_BOUNDS, 'Out of bounds', { x, y, boardSize: config.boardSize });
+    }
+
+    // Check if already bombed
+    if (attacker.visibleEnemyBoard[y][x] === CellState.HIT || attacker.visibleEnemyBoard[y][x] === CellState.MISS) {
+      throw new GameError(ErrorCode.ALREADY_BOMBED, 'Already bombed', { x, y });
+    }
+
+    const { hit, destroyed } = Rules.strikeCell(attacker, defender, x, y);
+    // The last tank ends the game, so there is nothing left to uncover
+    if (defender.tanksAlive === 0) {
+      return { hit, destroyed };
+    }
+
+    // Reveal area around explosion for attacker
+    Rules.revealArea(config, attacker, defender, x, y);
+
+    // Update defender's board to show revealed areas
+    Rules.updateDefenderVisibility(config, defender, attacker, x, y);
+
+    // IMPORTANT: Ensure the bombed position shows correct state (this must be AFTER revealArea)
+    attacker.visibleEnemyBoard[y][x] = hit ? CellState.HIT : CellState.MISS;
+
+    return { hit, destroyed };
+  }
+
+  // How many of each special shot a side has left under these settings
+  static abilitiesLeft(config: GameConfig, side: Side): Record<Ability, number> {
+    return Object.fromEntries(ABILITIES.map(ability =>
+      [ability, Math.max(config[ABILITY_SETTINGS[ability]] - side.abilitiesUsed[ability], 0)])) as Record<Ability, number>;
+  }
+
+  // Turns of the battle left before maxTurns, once moveCount turns have been played;
+  // null with no turn limit
+  static turnsLeft(config: GameConfig, moveCount: number): number | null {
+    return config.maxTurns > 0 ? Math.max(config.maxTurns - moveCount, 0) : null;
+  }
+
+  // Shots a player has left of the shot budget, counted from the move log; null with no budget
+  static shotsLeft(config: GameConfig, moveLog: MoveLogEntry[], playerId: number): number | null {
+    if (config.shotBudget === 0) return null;
+    const taken = moveLog.filter(entry => entry.playerId === playerId && (entry.action === 'bomb' || entry.action === 'ability')).length;
+    return Math.max(config.shotBudget - taken, 0);
+  }
+
+  // Whether a limit has stopped the battle: the last turn has been played, or neither
+  // player has a shot left
+  static limitReached(config: GameConfig, moveCount: number, moveLog: MoveLogEntry[]): boolean {
+    if (Rules.turnsLeft(config, moveCount) === 0) return true;
+    return config.shotBudget > 0 && [0, 1].every(playerId => Rules.shotsLeft(config, moveLog, playerId) === 0);
+  }
+
+  // The winner of a battle a limit stopped, by LIMIT_TIEBREAKS: more tanks standing, then the
+  // greater share of bombed cells that were hits, then whoever moved second, as the player
+  // who had the fewer turns
+  static limitWinner(sides: Side[], firstPlayer: number): number {
+    const accuracy = (side: Side) => {
+      const cells = side.visibleEnemyBoard.flat();
+      const shots = cells.filter(cell => cell === CellState.HIT || cell === CellState.MISS).length;
+      return shots > 0 ? cells.filter(cell => cell === CellState.HIT).length / shots : 0;
+    };
+    if (sides[0].tanksAlive !== sides[1].tanksAlive) return sides[0].tanksAlive > sides[1].tanksAlive ? 0 : 1;
+    const [first, second] = sides.map(accuracy);
+    if (first !== second) return first > second ? 0 : 1;
+    return 1 - firstPlayer;
+  }
+
+  // Refuse a game saved under rules these cannot play: newer ones, or ones too old to be
+  // carried forward. `version` is as the save recorded it, undefined before versions were.
+  static requireRulesVersion(version: unknown): number {
+    const recorded = version === undefined ? 1 : version;
+    if (typeof recorded === 'number' && Number.isInteger(recorded) && recorded >= MIN_RULES_VERSION && recorded <= RULES_VERSION) return recorded;
+    const newer = typeof recorded === 'number' && recorded > RULES_VERSION;
+    throw new GameError(ErrorCode.INCOMPATIBLE_RULES, `This game was saved under rules version ${recorded}, which this server (version ${RULES_VERSION}) cannot play`, {
+      rulesVersion: recorded,
+      supported: { min: MIN_RULES_VERSION, max: RULES_VERSION },
+      hint: newer ? 'Resume it on a server running the release that saved it, or a later one' : 'It is too old to be resumed on this release'
+    });
+  }
+
+  // Strike every cell of the row or column through (x, y). Cells already bombed are
+  // passed over; unlike a bomb, nothing around the strike is uncovered.
+  static airstrike(config: GameConfig, attacker: Side, defender: Side, x: number, y: number, direction: StrikeDirection): StrikeCell[] {
+    if (!STRIKE_DIRECTIONS.includes(direction)) {
+      throw new GameError(ErrorCode.VALIDATION_FAILED, 'Invalid airstrike', undefined, [
+        { field: 'direction', reason: `must be one of ${STRIKE_DIRECTIONS.join(', ')}` }
+      ]);
+    }
+    Rules.requireTarget(config, x, y);
+    Rules.requireAbility(config, attacker, 'airstrike');
+    const line = Array.from({ length: config.boardSize }, (_, i) => direction === 'row' ? { x: i, y } : { x, y: i });
+    return Rules.strikeArea(config, attacker, defender, 'airstrike', line, x, y);
+  }
+
+  // Strike every cell of the 3x3 square around (x, y)
+  static clusterBomb(config: GameConfig, attacker: Side, defender: Side, x: number, y: number): StrikeCell[] {
+    Rules.requireTarget(config, x, y);
+    Rules.requireAbility(config, attacker, 'cluster');
+    return Rules.strikeArea(config, attacker, defender, 'cluster', Rules.squareAround(config, x, y), x, y);
+  }
+
+  // Whether any tank still stands in the 3x3 square around (x, y); nothing is harmed or uncovered
+  static scan(config: GameConfig, attacker: Side, defender: Side, x: number, y: number): boolean {
+    Rules.requireTarget(config, x, y);
+    Rules.requireAbility(config, attacker, 'scan');
+    attacker.abilitiesUsed.scan++;
+    return Rules.squareAround(config, x, y).some(c => defender.board[c.y][c.x] === CellState.TANK);
+  }
+
+  // Everything open to a side placing its tanks: its next tank wherever it fits, taking
+  // back any tank it has placed, and confirming once the fleet is complete
+  static placementActions(config: GameConfig, side: Side): BoardAction[] {
+    const actions: BoardAction[] = [];
+    if (side.tanks.length < config.tanksPerPlayer) {
+      const length = Rules.nextTankLength(config, side);
+      // A one-cell tank covers the same cell either way, so it is listed once
+      (length > 1 ? ORIENTATIONS : ORIENTATIONS.slice(0, 1)).forEach(orientation => {
+        Rules.allCells(config.boardSize).forEach(({ x, y }) => {
+          const cells = Rules.tankCells(x, y, length, orientation);
+          if (cells.every(c => Rules.isValidPosition(c.x, c.y, config.boardSize) && side.board[c.y][c.x] === CellState.EMPTY)) {
+            actions.push({ type: 'placeTank', x, y, orientation });
+          }
+        });
+      });
+    }
+    side.tanks.forEach(tank => actions.push({ type: 'removeTank', x: tank.cells[0].x, y: tank.cells[0].y }));
+    if (side.tanks.length === config.tanksPerPlayer) actions.push({ type: 'confirmPlacement' });
+    return actions;
+  }
+
+  // Every turn open to the attacker: a bomb on each cell it has not bombed, each special
+  // shot it has left wherever it would strike something new, and, if tanks may move,
+  // every shift of an undamaged tank. Only the attacker's own view is consulted, so the
+  // list gives nothing away. An airstrike is listed once per row and column, aimed from
+  // its first cell, since every cell along it strikes the same line.
+  static battleActions(config: GameConfig, attacker: Side, tankMovement: boolean): BoardAction[] {
+    const { boardSize } = config;
+    const cells = Rules.allCells(boardSize);
+    const unbombed = (c: Position) => attacker.visibleEnemyBoard[c.y][c.x] !== CellState.HIT && attacker.visibleEnemyBoard[c.y][c.x] !== CellState.MISS;
+    const actions: BoardAction[] = cells.filter(unbombed).map(({ x, y }) => ({ type: 'bomb', x, y }));
+
+    const left = Rules.abilitiesLeft(config, attacker);
+    if (left.airstrike > 0) {
+      for (let y = 0; y < boardSize; y++) {
+        if (cells.some(c => c.y === y && unbombed(c))) actions.push({ type: 'useAbility', ability: 'airstrike', x: 0, y, direction: 'row' });
+      }
+      for (let x = 0; x < boardSize; x++) {
+        if (cells.some(c => c.x === x && unbombed(c))) actions.push({ type: 'useAbility', ability: 'airstrike', x, y: 0, direction: 'column' });
+      }
+    }
+    if (left.cluster > 0) {
+      cells.filter(c => Rules.squareAround(config, c.x, c.y).some(unbombed))
+        .forEach(({ x, y }) => actions.push({ type: 'useAbility', ability: 'cluster', x, y }));
+    }
+    if (left.scan > 0) {
+      cells.forEach(({ x, y }) => actions.push({ type: 'useAbility', ability: 'scan', x, y }));
+    }
+    if (tankMovement) actions.push(...Rules.tankMoves(config, attacker));
+    return actions;
+  }
+
+  // Merge a proposed partial config over a base config and validate every field
+  static resolveConfig(proposed: any, base: GameConfig = DEFAULT_CONFIG): GameConfig {
+    if (proposed !== undefined && (typeof proposed !== 'object' || proposed === null)) {
+      throw new GameError(ErrorCode.VALIDATION_FAILED, 'Invalid game settings', undefined, [{ field: 'config', reason: 'must be an object' }]);
+    }
+
+    const config: GameConfig = { ...base, ...(proposed || {}) };
+    const fields: { field: string; reason: string }[] = [];
+    (Object.keys(CONFIG_LIMITS) as (keyof typeof CONFIG_LIMITS)[]).forEach(key => {
+      const { min, max } = CONFIG_LIMITS[key];
+      if (!Number.isInteger(config[key]) || config[key] < min || config[key] > max) {
+        fields.push({ field: key, reason: `must be an integer between ${min} and ${max}` });
+      }
+    });
+
+    if (!FIRST_MOVE_POLICIES.includes(config.firstMove)) {
+      fields.push({ field: 'firstMove', reason: `must be one of ${FIRST_MOVE_POLICIES.join(', ')}` });
+    }
+    if (!TIMEOUT_ACTIONS.includes(config.timeoutAction)) {
+      fields.push({ field: 'timeoutAction', reason: `must be one of ${TIMEOUT_ACTIONS.join(', ')}` });
+    }
+    if (!COORDINATE_SYSTEMS.includes(config.coordinates)) {
+      fields.push({ field: 'coordinates', reason: `must be one of ${COORDINATE_SYSTEMS.join(', ')}` });
+    }
+
+    const { min, max } = TANK_LENGTH_LIMITS;
+    if (!Array.isArray(config.tankLengths) || config.tankLengths.some(length => !Number.isInteger(length) || length < min || length > max)) {
+      fields.push({ field: 'tankLengths', reason: `must be a list of integers between ${min} and ${max}` });
+    } else if (fields.length === 0 && config.tankLengths.length > config.tanksPerPlayer) {
+      fields.push({ field: 'tankLengths', reason: 'must not list more tanks than tanksPerPlayer' });
+    } else if (fields.length === 0 && config.tankLengths.some(length => length > config.boardSize)) {
+      fields.push({ field: 'tankLengths', reason: 'tanks must fit on the board' });
+    }
+
+    // Leave room on the board so placement stays meaningful
+    if (fields.length === 0) {
+      if (Rules.fleetCells(config) > Math.floor(config.boardSize * config.boardSize / 4)) {
+        fields.push({ field: 'tanksPerPlayer', reason: 'tanks must fill at most a quarter of the board' });
+      }
+    }
+
+    if (fields.length > 0) {
+      throw new GameError(ErrorCode.VALIDATION_FAILED, 'Invalid game settings', undefined, fields);
+    }
+
+    return {
+      boardSize: config.boardSize,
+      tanksPerPlayer: config.tanksPerPlayer,
+      explosionRadius: config.explosionRadius,
+      firstMove: config.firstMove,
+      tankLengths: [...config.tankLengths],
+      turnTimeSeconds: config.turnTimeSeconds,
+      gameTimeSeconds: config.gameTimeSeconds,
+      timeoutAction: config.timeoutAction,
+      airstrikes: config.airstrikes,
+      clusterBombs: config.clusterBombs,
+      scans: config.scans,
+      maxTurns: config.maxTurns,
+      shotBudget: config.shotBudget,
+      concedeWithinShots: config.concedeWithinShots,
+      coordinates: config.coordinates
+    };
+  }
+
+  // Generated from the settings and the constants the rules below use, so it cannot
+  // drift from how games are actually played
+  static describe(config: GameConfig): RulesDescription {
+    const square = (radius: number) => `${2 * radius + 1}x${2 * radius + 1}`;
+    const { columns, rows } = axisLabels(config.coordinates, config.boardSize);
+    return {
+      version: RULES_VERSION,
+      board: {
+        size: config.boardSize,
+        coordinates: config.coordinates,
+        columns: `${columns[0]}-${columns[columns.length - 1]}`,
+        rows: `${rows[0]}-${rows[rows.length - 1]}`
+      },
+      tanks: {
+        count: config.tanksPerPlayer,
+        lengths: Array.from({ length: config.tanksPerPlayer }, (_, i) => Rules.tankLength(config, i)),
+        cells: Rules.fleetCells(config),
+        orientations: [...ORIENTATIONS]
+      },
+      bomb: { explosionRadius: config.explosionRadius, revealedArea: square(config.explosionRadius) },
+      abilities: ABILITIES.filter(ability => config[ABILITY_SETTINGS[ability]] > 0).map(ability => ({
+        name: ability,
+        perPlayer: config[ABILITY_SETTINGS[ability]],
+        area: ability === 'airstrike' ? STRIKE_DIRECTIONS.join(' or ') : square(ABILITY_AREA_RADIUS),
+        harmsTanks: ability !== 'scan'
+      })),
+      firstMove: config.firstMove,
+      timers: {
+        turnSeconds: config.turnTimeSeconds > 0 ? config.turnTimeSeconds : null,
+        gameSeconds: config.gameTimeSeconds > 0 ? config.gameTimeSeconds : null,
+        onTimeout: config.timeoutAction
+      },
+      limits: {
+        maxTurns: config.maxTurns > 0 ? config.maxTurns : null,
+        shotBudget: config.shotBudget > 0 ? config.shotBudget : null,
+        decidedBy: [...LIMIT_TIEBREAKS]
+      },
+      concede: { withinShots: config.concedeWithinShots > 0 ? config.concedeWithinShots : null },
+      config: { ...config, tankLengths: [...config.tankLengths] }
+    };
+  }
+
+  // Copies, so a view that is queued or held by a caller cannot change with the game
+  // The cells that differ between two copies of a board, in reading order
+  static diffBoard(before: CellState[][], after: CellState[][]): (Position & { from: CellState; to: CellState })[] {
+    const changed: (Position & { from: CellState; to: CellState })[] = [];
+    after.forEach((row, y) => row.forEach((to, x) => {
+      if (before[y][x] !== to) changed.push({ x, y, from: before[y][x], to });
+    }));
+    return changed;
+  }
+
+  // One board as it stood after move log entry `seq`, rebuilt from that board's changes
+  static boardAt(boardSize: number, changes: CellChange[], seq: number): CellState[][] {
+    const board = Rules.createEmptyBoard(boardSize);
+    changes.forEach(change => {
+      if (change.seq <= seq) board[change.y][change.x] = change.to;
+    });
+    return board;
+  }
+
+  static boardView(side: Side): BoardView {
+    return {
+      myBoard: side.board.map(row => [...row]),
+      enemyBoard: side.visibleEnemyBoard.map(row => [...row])
+    };
+  }
+
+  // What anyone may know of a side's board: only the hits and misses `attacker`, its
+  // opponent, has scored on it. This is the view spectators get of both boards.
+  static resultsView(attacker: Side): CellState[][] {
+    return attacker.visibleEnemyBoard.map(row => row.map(cell => cell === CellState.HIT || cell === CellState.MISS ? cell : CellState.EMPTY));
+  }
+
+  // Plain-text board format: one row per line, '.' empty and 'T' tank. Exported
+  // boards also use 'X' hit, 'o' miss and '~' revealed. Rows may instead be separated
+  // by '/' to fit on one line; blank lines and lines starting with '#' are ignored.
+  static boardToText(board: CellState[][]): string {
+    return board.map(row => row.map(cell => BOARD_TEXT_SYMBOLS[cell]).join('')).join('\n');
+  }
+
+  // Parse a placement layout into tank positions, reporting every bad row
+  static parseLayout(text: string, boardSize: number): Position[] {
+    if (typeof text !== 'string') {
+      throw new GameError(ErrorCode.VALIDATION_FAILED, 'Invalid layout', undefined, [{ field: 'layout', reason: 'must be a string' }]);
+    }
+
+    const rows = text.split(/\r?\n|\//).map(row => row.trim()).filter(row => row && !row.startsWith('#'));
+    const fields: { field: string; reason: string }[] = [];
+    const tanks: Position[] = [];
+
+    if (rows.length !== boardSize) {
+      fields.push({ field: 'layout', reason: `must have ${boardSize} rows, found ${rows.length}` });
+    }
+    rows.slice(0, boardSize).forEach((row, y) => {
+      if (row.length !== boardSize) {
+        fields.push({ field: `layout[${y}]`, reason: `must have ${boardSize} cells, found ${row.length}` });
+      } else if (!/^[.T]+$/i.test(row)) {
+        fields.push({ field: `layout[${y}]`, reason: "may only contain '.' and 'T'" });
+      } else {
+        [...row].forEach((cell, x) => {
+          if (cell.toUpperCase() === 'T') tanks.push({ x, y });
+        });
+      }
+    });
+
+    if (fields.length > 0) {
+      throw new GameError(ErrorCode.VALIDATION_FAILED, 'Invalid layout', undefined, fields);
+    }
+    return tanks;
+  }
+
+  // Map a cell through a symmetry: mirror left-right first, then turn clockwise
+  static transformPosition(position: Position, boardSize: number, transform: BoardTransform): Position {
+    let { x, y } = position;
+    if (transform.mirrored) x = boardSize - 1 - x;
+    for (let i = 0; i < transform.rotations; i++) {
+      [x, y] = [boardSize - 1 - y, x];
+    }
+    return { x, y };
+  }
+
+  static transformBoard<T>(board: T[][], transform: BoardTransform): T[][] {
+    const boardSize = board.length;
+    const result: T[][] = board.map(row => [...row]);
+    board.forEach((row, y) => row.forEach((cell, x) => {
+      const target = Rules.transformPosition({ x, y }, boardSize, transform);
+      result[target.y][target.x] = cell;
+    }));
+    return result;
+  }
+
+  static rotateBoard<T>(board: T[][], turns: number = 1): T[][] {
+    return Rules.transformBoard(board, { rotations: (((turns % 4) + 4) % 4) as BoardTransform['rotations'], mirrored: false });
+  }
+
+  static reflectBoard<T>(board: T[][]): T[][] {
+    return Rules.transformBoard(board, { rotations: 0, mirrored: true });
+  }
+
+  // Reduce a placement to one representative of its eight symmetric variants, so
+  // rotated or mirrored copies of the same layout compare equal. The key is the
+  // smallest variant written in the one-line layout format parseLayout accepts.
+  static canonicalPlacement(positions: Position[], boardSize: number): { positions: Position[]; key: string; transform: BoardTransform } {
+    let best: { positions: Position[]; key: string; transform: BoardTransform } | null = null;
+    for (const transform of BOARD_TRANSFORMS) {
+      const variant = positions
+        .map(position => Rules.transformPosition(position, boardSize, transform))
+        .sort((a, b) => a.y - b.y || a.x - b.x);
+      const rows = Array.from({ length: boardSize }, () => new Array(boardSize).fill('.'));
+      variant.forEach(({ x, y }) => { rows[y][x] = 'T'; });
+      const key = rows.map(row => row.join('')).join('/');
+
+      if (!best || key < best.key) {
+        best = { positions: variant, key, transform };
+      }
+    }
+    return best!;
+  }
+
+  // Every cell of the board, row by row
+  private static allCells(boardSize: number): Position[] {
+    return Array.from({ length: boardSize * boardSize }, (_, i) => ({ x: i % boardSize, y: Math.floor(i / boardSize) }));
+  }
+
+  // Each shift Rules.moveTank allows, the tank named by its first cell
+  private static tankMoves(config: GameConfig, side: Side): BoardAction[] {
+    const { boardSize } = config;
+    const actions: BoardAction[] = [];
+    side.tanks.filter(tank => !tank.destroyed && tank.cells.every(c => side.board[c.y][c.x] === CellState.TANK)).forEach(tank => {
+      const from = tank.cells[0];
+      const ownCell = (x: number, y: number) => tank.cells.some(c => c.x === x && c.y === y);
+      Rules.allCells(boardSize).forEach(to => {
+        const dx = to.x - from.x;
+        const dy = to.y - from.y;
+        if (dx === 0 && dy === 0) return;
+        const fits = tank.cells.every(c => Rules.isValidPosition(c.x + dx, c.y + dy, boardSize) &&
+          (side.board[c.y + dy][c.x + dx] === CellState.EMPTY || ownCell(c.x + dx, c.y + dy)));
+        if (fits) actions.push({ type: 'moveTank', fromX: from.x, fromY: from.y, toX: to.x, toY: to.y });
+      });
+    });
+    return actions;
+  }
+
+  private static requireTarget(config: GameConfig, x: number, y: number): void {
+    if (!Rules.isValidPosition(x, y, config.boardSize)) {
+      throw new GameError(ErrorCode.OUT_OF_BOUNDS, 'Out of bounds', { x, y, boardSize: config.boardSize });
+    }
+  }
+
+  private static squareAround(config: GameConfig, centerX: number, centerY: number): Position[] {
+    const cells: Position[] = [];
+    for (let y = centerY - ABILITY_AREA_RADIUS; y <= centerY + ABILITY_AREA_RADIUS; y++) {
+      for (let x = centerX - ABILITY_AREA_RADIUS; x <= centerX + ABILITY_AREA_RADIUS; x++) {
+        if (Rules.isValidPosition(x, y, config.boardSize)) cells.push({ x, y });
+      }
+    }
+    return cells;
+  }
+
+  private static requireAbility(config: GameConfig, side: Side, ability: Ability): void {
+    if (Rules.abilitiesLeft(config, side)[ability] === 0) {
+      throw new GameError(ErrorCode.ABILITY_UNAVAILABLE, 'You have none of that special shot left', { ability });
+    }
+  }
+
+  // Resolve a multi-cell strike, refusing one that would only land on cells already bombed
+  private static strikeArea(config: GameConfig, attacker: Side, defender: Side, ability: Ability, cells: Position[], x: number, y: number): StrikeCell[] {
+    const targets = cells.filter(c => attacker.visibleEnemyBoard[c.y][c.x] !== CellState.HIT && attacker.visibleEnemyBoard[c.y][c.x] !== CellState.MISS);
+    if (targets.length === 0) {
+      throw new GameError(ErrorCode.ALREADY_BOMBED, 'Every cell there has already been bombed', { x, y });
+    }
+    attacker.abilitiesUsed[ability]++;
+    return targets.map(c => ({ ...c, ...Rules.strikeCell(attacker, defender, c.x, c.y) }));
+  }
+
+  // Hit or miss one cell, marking both boards. A tank is destroyed once its last cell is hit.
+  private static strikeCell(attacker: Side, defender: Side, x: number, y: number): { hit: boolean; destroyed: boolean } {
+    const targetCell = defender.board[y][x];
+    const hitTank = targetCell === CellState.TANK ? defender.tanks.find(t => t.cells.some(c => c.x === x && c.y === y)) : undefined;
+    if (!hitTank) {
+      if (targetCell === CellState.EMPTY) {
+        defender.board[y][x] = CellState.MISS;
+      }
+      attacker.visibleEnemyBoard[y][x] = CellState.MISS;
+      return { hit: false, destroyed: false };
+    }
+
+    const destroyed = hitTank.cells.every(c => (c.x === x && c.y === y) || defender.board[c.y][c.x] === CellState.HIT);
+    defender.board[y][x] = CellState.HIT;
+    attacker.visibleEnemyBoard[y][x] = CellState.HIT;
+    if (destroyed) {
+      hitTank.destroyed = true;
+      defender.tanksAlive--;
+    }
+    return { hit: true, destroyed };
+  }
+
+  private static updateDefenderVisibility(config: GameConfig, defender: Side, attacker: Side, centerX: number, centerY: number): void {
+    const radius = config.explosionRadius;
+    for (let dy = -radius; dy <= radius; dy++) {
+      for (let dx = -radius; dx <= radius; dx++) {
+        const x = centerX + dx;
+        const y = centerY + dy;
+
+        if (Rules.isValidPosition(x, y, config.boardSize)) {
+          const defenderCell = defender.board[y][x];
+
+          // If this cell is empty and the attacker can now see it, mark as REVEALED on defender's board
+          if (defenderCell === CellState.EMPTY && attacker.visibleEnemyBoard[y][x] !== CellState.EMPTY) {
+            defender.board[y][x] = CellState.REVEALED;
+          }
+        }
+      }
+    }
+  }
+
+  private static revealArea(config: GameConfig, attacker: Side, defender: Side, centerX: number, centerY: number): void {
+    const radius = config.explosionRadius;
+    for (let dy = -radius; dy <= radius; dy++) {
+      for (let dx = -radius; dx <= radius; dx++) {
+        const x = centerX + dx;
+        const y = centerY + dy;
+
+        if (Rules.isValidPosition(x, y, config.boardSize)) {
+          const defenderCell = defender.board[y][x];
+          const currentVisibleState = attacker.visibleEnemyBoard[y][x];
+
+          // Don't overwrite already known HIT/MISS states
+          if (currentVisibleState === CellState.HIT || currentVisibleState === CellState.MISS) {
+            continue;
+          }
+
+          // Only update if not already revealed/visible
+          if (currentVisibleState === CellState.EMPTY) {
+            if (defenderCell === CellState.TANK) {
+              attacker.visibleEnemyBoard[y][x] = CellState.TANK;
+            } else if (defenderCell === CellState.HIT) {
+              attacker.visibleEnemyBoard[y][x] = CellState.HIT;
+            } else if (defenderCell === CellState.MISS) {
+              attacker.visibleEnemyBoard[y][x] = CellState.MISS;
+            } else if (defenderCell === CellState.REVEALED) {
+              attacker.visibleEnemyBoard[y][x] = CellState.REVEALED;
+            } else {
+              attacker.visibleEnemyBoard[y][x] = CellState.REVEALED;
+            }
+          }
+        }
+      }
+    }
+  }
+
+}
+
+export {
+  Rules, CellState, BOARD_TEXT_SYMBOLS, RULES_VERSION, MIN_RULES_VERSION, DEFAULT_CONFIG, CONFIG_LIMITS, LIMIT_TIEBREAKS, FIRST_MOVE_POLICIES, TIMEOUT_ACTIONS, TANK_LENGTH_LIMITS,
+  BOARD_TRANSFORMS, ORIENTATIONS, ABILITIES, STRIKE_DIRECTIONS
+};
+export type {
+  Position, BoardTransform, Orientation, Tank, Side, BoardView, FirstMovePolicy, TimeoutAction, GameConfig, MoveLogEntry,
+  CellChange, Ability, StrikeDirection, StrikeCell, RulesDescription, BoardAction
+};
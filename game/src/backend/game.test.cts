@@ -0,0 +1,172 @@
+// The rules on their own, without a server: settings, placing and taking back tanks of
+// every length, bombing them down cell by cell, moving them, and the rules version gate.
+// Run with `npm test`.
+
+import { describe, it } from 'node:test';
+import * as assert from 'assert';
+import { Rules, CellState, DEFAULT_CONFIG, RULES_VERSION, type GameConfig, type Side } from './game.cjs';
+import { ErrorCode } from './errors.cjs';
+
+function config(settings: Partial<GameConfig> = {}): GameConfig {
+  return Rules.resolveConfig(settings);
+}
+
+// A side with its tanks placed where listed, each taking the next length in the fleet
+function sideWith(settings: GameConfig, tanks: [number, number, ('horizontal' | 'vertical')?][]): Side {
+  const side = Rules.createSide(settings);
+  tanks.forEach(([x, y, orientation]) => Rules.placeTank(settings, side, x, y, orientation));
+  return side;
+}
+
+function throwsCode(action: () => unknown, code: ErrorCode): void {
+  assert.throws(action, (error: any) => error.code === code, `expected ${code}`);
+}
+
+describe('settings', () => {
+  it('fills in the defaults', () => {
+    assert.deepStrictEqual(config(), DEFAULT_CONFIG);
+  });
+
+  it('names every field that is out of range', () => {
+    assert.throws(() => config({ boardSize: 40, tanksPerPlayer: 0, firstMove: 'loser' as any }), (error: any) => {
+      assert.strictEqual(error.code, ErrorCode.VALIDATION_FAILED);
+      assert.deepStrictEqual(error.fields.map((f: any) => f.field), ['boardSize', 'tanksPerPlayer', 'firstMove']);
+      return true;
+    });
+  });
+
+  it('refuses tank lengths that do not fit the fleet or the board', () => {
+    throwsCode(() => config({ tanksPerPlayer: 2, tankLengths: [2, 2, 2] }), ErrorCode.VALIDATION_FAILED);
+    throwsCode(() => config({ tankLengths: [5] }), ErrorCode.VALIDATION_FAILED);
+    throwsCode(() => config({ boardSize: 5, tanksPerPlayer: 3, tankLengths: [4, 4, 4] }), ErrorCode.VALIDATION_FAILED);
+    assert.strictEqual(Rules.fleetCells(config({ tanksPerPlayer: 4, tankLengths: [3, 2] })), 7);
+  });
+});
+
+describe('placement', () => {
+  const settings = config({ tanksPerPlayer: 3, tankLengths: [3, 2] });
+
+  it('covers every cell of a tank along its orientation', () => {
+    const side = sideWith(settings, [[0, 0, 'horizontal'], [7, 1, 'vertical'], [4, 4]]);
+    assert.deepStrictEqual(side.tanks.map(tank => tank.cells), [
+      [{ x: 0, y: 0 }, { x: 1, y: 0 }, { x: 2, y: 0 }],
+      [{ x: 7, y: 1 }, { x: 7, y: 2 }],
+      [{ x: 4, y: 4 }]
+    ]);
+    assert.strictEqual(side.board.flat().filter(cell => cell === CellState.TANK).length, 6);
+    assert.strictEqual(side.tanksAlive, 3);
+  });
+
+  it('keeps every cell on the board', () => {
+    const side = Rules.createSide(settings);
+    throwsCode(() => Rules.placeTank(settings, side, 6, 0, 'horizontal'), ErrorCode.OUT_OF_BOUNDS);
+    throwsCode(() => Rules.placeTank(settings, side, 0, 6, 'vertical'), ErrorCode.OUT_OF_BOUNDS);
+    throwsCode(() => Rules.placeTank(settings, side, -1, 0), ErrorCode.OUT_OF_BOUNDS);
+    assert.strictEqual(side.tanks.length, 0);
+  });
+
+  it('refuses a tank over any cell of another', () => {
+    const side = sideWith(settings, [[2, 2, 'horizontal']]);
+    assert.throws(() => Rules.placeTank(settings, side, 4, 1, 'vertical'), (error: any) => {
+      assert.strictEqual(error.code, ErrorCode.CELL_OCCUPIED);
+      assert.deepStrictEqual(error.details, { x: 4, y: 2 });
+      return true;
+    });
+  });
+
+  it('refuses an unknown orientation and a tank too many', () => {
+    const side = sideWith(settings, [[0, 0], [0, 2], [0, 4]]);
+    throwsCode(() => Rules.placeTank(settings, side, 6, 6), ErrorCode.ALL_TANKS_PLACED);
+    throwsCode(() => Rules.placeTank(settings, Rules.createSide(settings), 0, 0, 'diagonal' as any), ErrorCode.VALIDATION_FAILED);
+  });
+
+  it('takes back the tank under any of its cells and places that length again next', () => {
+    const side = sideWith(settings, [[0, 0], [0, 2]]);
+    const removed = Rules.removeTank(settings, side, 2, 0);
+    assert.strictEqual(removed.cells.length, 3);
+    assert.deepStrictEqual(side.board[0], Array(8).fill(CellState.EMPTY));
+    assert.strictEqual(side.tanksAlive, 1);
+    assert.strictEqual(Rules.nextTankLength(settings, side), 3);
+
+    Rules.placeTank(settings, side, 5, 5, 'vertical');
+    assert.strictEqual(Rules.nextTankLength(settings, side), 1);
+    throwsCode(() => Rules.removeTank(settings, side, 7, 7), ErrorCode.NO_TANK_THERE);
+    throwsCode(() => Rules.removeTank(settings, side, 8, 0), ErrorCode.OUT_OF_BOUNDS);
+  });
+
+  it('offers confirmation only once the fleet is complete', () => {
+    const partial = Rules.placementActions(settings, sideWith(settings, [[0, 0], [0, 2]]));
+    assert.ok(!partial.some(action => action.type === 'confirmPlacement'));
+    assert.ok(partial.every(action => action.type !== 'placeTank' || action.orientation === 'horizontal'), 'a one-cell tank is listed once');
+
+    const full = Rules.placementActions(settings, sideWith(settings, [[0, 0], [0, 2], [0, 4]]));
+    assert.deepStrictEqual(full.map(action => action.type), ['removeTank', 'removeTank', 'removeTank', 'confirmPlacement']);
+  });
+});
+
+describe('battle', () => {
+  const settings = config({ tanksPerPlayer: 2, tankLengths: [2], explosionRadius: 0 });
+
+  it('destroys a tank only once all of its cells are hit', () => {
+    const attacker = Rules.createSide(settings);
+    const defender = sideWith(settings, [[3, 3, 'vertical'], [0, 0]]);
+    assert.deepStrictEqual(Rules.bomb(settings, attacker, defender, 3, 3), { hit: true, destroyed: false });
+    assert.strictEqual(defender.tanksAlive, 2);
+    assert.deepStrictEqual(Rules.bomb(settings, attacker, defender, 5, 5), { hit: false, destroyed: false });
+    assert.deepStrictEqual(Rules.bomb(settings, attacker, defender, 3, 4), { hit: true, destroyed: true });
+    assert.strictEqual(defender.tanksAlive, 1);
+    assert.ok(defender.tanks[0].destroyed);
+    assert.strictEqual(attacker.visibleEnemyBoard[5][5], CellState.MISS);
+    throwsCode(() => Rules.bomb(settings, attacker, defender, 3, 3), ErrorCode.ALREADY_BOMBED);
+  });
+
+  it('uncovers the blast area around a bomb', () => {
+    const wide = config({ explosionRadius: 1 });
+    const attacker = Rules.createSide(wide);
+    const defender = sideWith(wide, [[1, 1], [6, 6], [6, 0]]);
+    Rules.bomb(wide, attacker, defender, 2, 2);
+    assert.strictEqual(attacker.visibleEnemyBoard[1][1], CellState.TANK);
+    assert.strictEqual(attacker.visibleEnemyBoard[2][2], CellState.MISS);
+    assert.strictEqual(attacker.visibleEnemyBoard[6][6], CellState.EMPTY);
+  });
+
+  it('moves an undamaged tank whole, and never a damaged one', () => {
+    const attacker = Rules.createSide(settings);
+    const side = sideWith(settings, [[0, 0, 'horizontal'], [5, 5]]);
+    Rules.moveTank(settings, side, attacker, 1, 0, 1, 2);
+    assert.deepStrictEqual(side.tanks[0].cells, [{ x: 0, y: 2 }, { x: 1, y: 2 }]);
+    assert.strictEqual(side.board[0][0], CellState.EMPTY);
+    throwsCode(() => Rules.moveTank(settings, side, attacker, 0, 2, 4, 5), ErrorCode.INVALID_MOVE);
+
+    Rules.bomb(settings, attacker, side, 0, 2);
+    throwsCode(() => Rules.moveTank(settings, side, attacker, 1, 2, 1, 4), ErrorCode.INVALID_MOVE);
+    throwsCode(() => Rules.moveTank(settings, side, attacker, 7, 7, 6, 7), ErrorCode.NO_TANK_AT_SOURCE);
+  });
+
+  it('decides a battle a limit stopped on the tiebreaks in turn', () => {
+    const [a, b] = [sideWith(settings, [[0, 0], [4, 4]]), sideWith(settings, [[0, 0], [4, 4]])];
+    assert.strictEqual(Rules.limitWinner([a, b], 0), 1, 'level on everything: whoever moved second');
+    Rules.bomb(settings, a, b, 0, 0);
+    assert.strictEqual(Rules.limitWinner([a, b], 0), 0, 'the better accuracy');
+    Rules.bomb(settings, a, b, 1, 0);
+    Rules.bomb(settings, b, a, 7, 7);
+    assert.strictEqual(Rules.limitWinner([a, b], 1), 0, 'more tanks standing');
+  });
+});
+
+describe('rules version', () => {
+  it('carries forward saves from before versions were recorded', () => {
+    assert.strictEqual(Rules.requireRulesVersion(undefined), 1);
+    assert.strictEqual(Rules.requireRulesVersion(RULES_VERSION), RULES_VERSION);
+  });
+
+  it('refuses newer or malformed versions with the supported range', () => {
+    [RULES_VERSION + 1, 0, '1', 1.5].forEach(version => {
+      assert.throws(() => Rules.requireRulesVersion(version), (error: any) => {
+        assert.strictEqual(error.code, ErrorCode.INCOMPATIBLE_RULES);
+        assert.deepStrictEqual(error.details.supported, { min: 1, max: RULES_VERSION });
+        return true;
+      });
+    });
+  });
+});
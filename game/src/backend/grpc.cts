@@ -0,0 +1,507 @@
+// gRPC access for bot clients, described by tanks.proto and started with --grpc-port.
+// Calls are turned into the same protocol messages the REST API sends and run through
+// its sessions (api.cts), so tokens, validation, idempotency and error codes are shared:
+// a session created here can also be read through GET /api/games/{id}/state.
+//
+// gRPC is served over plaintext HTTP/2 with node:http2, and messages are encoded by the
+// small protobuf codec below, which knows only the field types tanks.proto uses. Message
+// compression is not supported.
+
+import * as http2 from 'http2';
+import { ErrorCode, GameError, toGameError, type ErrorEnvelope } from './errors.cjs';
+import { negotiateLocale } from './i18n.cjs';
+import type { HttpApi, HttpSession } from './api.cjs';
+import type { GameManager } from './server.cjs';
+
+const MAX_MESSAGE_BYTES = 64 * 1024;
+const SERVICE = 'tanks.v1.Tanks';
+
+// gRPC status codes used here
+const GrpcStatus = {
+  OK: 0,
+  INVALID_ARGUMENT: 3,
+  NOT_FOUND: 5,
+  ALREADY_EXISTS: 6,
+  PERMISSION_DENIED: 7,
+  RESOURCE_EXHAUSTED: 8,
+  FAILED_PRECONDITION: 9,
+  ABORTED: 10,
+  UNIMPLEMENTED: 12,
+  INTERNAL: 13,
+  UNAVAILABLE: 14,
+  UNAUTHENTICATED: 16
+};
+
+// Status for an error, by its HTTP status unless the code needs a closer match
+const GRPC_STATUS_BY_HTTP: Record<number, number> = {
+  400: GrpcStatus.INVALID_ARGUMENT,
+  401: GrpcStatus.UNAUTHENTICATED,
+  403: GrpcStatus.PERMISSION_DENIED,
+  404: GrpcStatus.NOT_FOUND,
+  409: GrpcStatus.FAILED_PRECONDITION,
+  410: GrpcStatus.FAILED_PRECONDITION,
+  422: GrpcStatus.INVALID_ARGUMENT,
+  429: GrpcStatus.RESOURCE_EXHAUSTED,
+  503: GrpcStatus.UNAVAILABLE
+};
+const GRPC_STATUS_BY_CODE: Partial<Record<ErrorCode, number>> = {
+  [ErrorCode.ROOM_EXISTS]: GrpcStatus.ALREADY_EXISTS,
+  [ErrorCode.NAME_TAKEN]: GrpcStatus.ALREADY_EXISTS,
+  [ErrorCode.STALE_MOVE]: GrpcStatus.ABORTED
+};
+
+// One field of a protobuf message, keyed by its field number in MessageSpec. Fields are
+// named as in the protocol messages, not as in tanks.proto.
+interface FieldSpec {
+  name: string;
+  type: 'int32' | 'bool' | 'string' | 'enum' | 'message';
+  values?: string[];        // enum: the protocol value for each enum number
+  message?: MessageSpec;
+  repeated?: true;
+  optional?: true;          // Left undefined when absent, instead of taking the type's default
+}
+
+type MessageSpec = Record<number, FieldSpec>;
+
+const ConfigSpec: MessageSpec = {
+  1: { name: 'boardSize', type: 'int32', optional: true },
+  2: { name: 'tanksPerPlayer', type: 'int32', optional: true },
+  3: { name: 'explosionRadius', type: 'int32', optional: true },
+  4: { name: 'firstMove', type: 'string', optional: true },
+  5: { name: 'tankLengths', type: 'int32', repeated: true },
+  6: { name: 'turnTimeSeconds', type: 'int32', optional: true },
+  7: { name: 'gameTimeSeconds', type: 'int32', optional: true },
+  8: { name: 'timeoutAction', type: 'string', optional: true },
+  9: { name: 'airstrikes', type: 'int32', optional: true },
+  10: { name: 'clusterBombs', type: 'int32', optional: true },
+  11: { name: 'scans', type: 'int32', optional: true },
+  12: { name: 'coordinates', type: 'string', optional: true },
+  13: { name: 'maxTurns', type: 'int32', optional: true },
+  14: { name: 'shotBudget', type: 'int32', optional: true },
+  15: { name: 'concedeWithinShots', type: 'int32', optional: true }
+};
+
+const ORIENTATIONS = ['horizontal', 'vertical'];
+
+const MESSAGES: Record<string, MessageSpec> = {
+  CreateGameRequest: {
+    1: { name: 'playerName', type: 'string' },
+    2: { name: 'gameId', type: 'string' },
+    3: { name: 'difficulty', type: 'enum', values: ['', 'easy', 'medium', 'hard'] },
+    4: { name: 'config', type: 'message', message: ConfigSpec },
+    5: { name: 'rulesVersion', type: 'int32', optional: true }
+  },
+  JoinGameRequest: {
+    1: { name: 'gameId', type: 'string' },
+    2: { name: 'playerName', type: 'string' },
+    3: { name: 'rulesVersion', type: 'int32', optional: true }
+  },
+  Session: {
+    1: { name: 'token', type: 'string' },
+    2: { name: 'gameId', type: 'string' },
+    3: { name: 'playerId', type: 'int32' },
+    4: { name: 'resumeToken', type: 'string' },
+    5: { name: 'config', type: 'message', message: ConfigSpec }
+  },
+  PlaceTankRequest: {
+    1: { name: 'x', type: 'int32' },
+    2: { name: 'y', type: 'int32' },
+    3: { name: 'orientation', type: 'enum', values: ORIENTATIONS },
+    4: { name: 'moveId', type: 'string' }
+  },
+  PlaceTankReply: {
+    1: { name: 'x', type: 'int32' },
+    2: { name: 'y', type: 'int32' },
+    3: { name: 'orientation', type: 'enum', values: ORIENTATIONS }
+  },
+  ConfirmPlacementRequest: {
+    1: { name: 'moveId', type: 'string' }
+  },
+  ConfirmPlacementReply: {},
+  BombRequest: {
+    1: { name: 'x', type: 'int32' },
+    2: { name: 'y', type: 'int32' },
+    3: { name: 'expectedMove', type: 'int32' },
+    4: { name: 'moveId', type: 'string' }
+  },
+  BombReply: {
+    1: { name: 'x', type: 'int32' },
+    2: { name: 'y', type: 'int32' },
+    3: { name: 'outcome', type: 'enum', values: ['miss', 'hit', 'victory'] },
+    4: { name: 'cell', type: 'string' },
+    5: { name: 'destroyed', type: 'bool' },
+    6: { name: 'gameOver', type: 'bool' },
+    7: { name: 'result', type: 'string' }
+  },
+  StreamEventsRequest: {},
+  Event: {
+    1: { name: 'type', type: 'string' },
+    2: { name: 'json', type: 'string' }
+  }
+};
+
+const WireType = { VARINT: 0, FIXED64: 1, LENGTH_DELIMITED: 2, FIXED32: 5 };
+
+function encodeVarint(value: number): Buffer {
+  // Negative int32s take all ten bytes, as in any protobuf implementation
+  let remaining = BigInt.asUintN(64, BigInt(value));
+  const bytes: number[] = [];
+  while (remaining > 0x7Fn) {
+    bytes.push(Number(remaining & 0x7Fn) | 0x80);
+    remaining >>= 7n;
+  }
+  bytes.push(Number(remaining));
+  return Buffer.from(bytes);
+}
+
+function encodeMessage(spec: MessageSpec, value: Record<string, any>): Buffer {
+  const chunks: Buffer[] = [];
+  const tag = (number: number, wireType: number) => chunks.push(encodeVarint((number << 3) | wireType));
+  const scalar = (field: FieldSpec, item: any): number =>
+    field.type === 'bool' ? (item ? 1 : 0) : field.type === 'enum' ? Math.max(field.values!.indexOf(item), 0) : Number(item) | 0;
+
+  Object.entries(spec).forEach(([key, field]) => {
+    const number = Number(key);
+    const item = value[field.name];
+    if (item === undefined || item === null) return;
+
+    if (field.type === 'string' || field.type === 'message') {
+      (field.repeated ? item : [item]).forEach((element: any) => {
+        const data = field.type === 'string' ? Buffer.from(String(element), 'utf-8') : encodeMessage(field.message!, element);
+        tag(number, WireType.LENGTH_DELIMITED);
+        chunks.push(encodeVarint(data.length), data);
+      });
+    } else if (field.repeated) {
+      // Packed, the proto3 default for repeated scalars
+      const data = Buffer.concat((item as any[]).map(element => encodeVarint(scalar(field, element))));
+      tag(number, WireType.LENGTH_DELIMITED);
+      chunks.push(encodeVarint(data.length), data);
+    } else {
+      tag(number, WireType.VARINT);
+      chunks.push(encodeVarint(scalar(field, item)));
+    }
+  });
+  return Buffer.concat(chunks);
+}
+
+class ProtobufReader {
+  private offset = 0;
+
+  constructor(private data: Buffer) { }
+
+  done(): boolean {
+    return this.offset >= this.data.length;
+  }
+
+  varint(): bigint {
+    let result = 0n;
+    for (let shift = 0n; shift < 70n; shift += 7n) {
+      if (this.done()) throw new Error('Truncated varint');
+      const byte = this.data[this.offset++];
+      result |= BigInt(byte & 0x7F) << shift;
+      if ((byte & 0x80) === 0) return BigInt.asUintN(64, result);
+    }
+    throw new Error('Varint too long');
+  }
+
+  bytes(): Buffer {
+    const length = Number(this.varint());
+    if (this.offset + length > this.data.length) throw new Error('Truncated field');
+    const bytes = this.data.subarray(this.offset, this.offset + length);
+    this.offset += length;
+    return bytes;
+  }
+
+  skip(wireType: number): void {
+    if (wireType === WireType.VARINT) this.varint();
+    else if (wireType === WireType.LENGTH_DELIMITED) this.bytes();
+    else if (wireType === WireType.FIXED64) this.offset += 8;
+    else if (wireType === WireType.FIXED32) this.offset += 4;
+    else throw new Error(`Unsupported wire type ${wireType}`);
+  }
+}
+
+// Decode into a protocol message; unknown fields are skipped, as protobuf requires
+function decodeMessage(spec: MessageSpec, data: Buffer): Record<string, any> {
+  const value: Record<string, any> = {};
+  const reader = new ProtobufReader(data);
+  const scalar = (field: FieldSpec, raw: bigint): any =>
+    field.type === 'bool' ? raw !== 0n : field.type === 'enum' ? field.values![Number(raw)] : Number(BigInt.asIntN(32, raw));
+
+  while (!reader.done()) {
+    const key = reader.varint();
+    const field = spec[Number(key >> 3n)];
+    const wireType = Number(key & 7n);
+    if (!field) {
+      reader.skip(wireType);
+      continue;
+    }
+
+    let items: any[];
+    if (field.type === 'string' || field.type === 'message') {
+      if (wireType !== WireType.LENGTH_DELIMITED) throw new Error(`Field ${field.name} has the wrong wire type`);
+      const bytes = reader.bytes();
+      items = [field.type === 'string' ? bytes.toString('utf-8') : decodeMessage(field.message!, bytes)];
+    } else if (wireType === WireType.LENGTH_DELIMITED) {
+      // Packed repeated scalars
+      const packed = new ProtobufReader(reader.bytes());
+      items = [];
+      while (!packed.done()) items.push(scalar(field, packed.varint()));
+    } else if (wireType === WireType.VARINT) {
+      items = [scalar(field, reader.varint())];
+    } else {
+      throw new Error(`Field ${field.name} has the wrong wire type`);
+    }
+
+    if (field.repeated) value[field.name] = [...(value[field.name] ?? []), ...items];
+    else value[field.name] = items[items.length - 1];  // The last occurrence wins
+  }
+
+  // proto3 defaults for whatever was not sent
+  Object.values(spec).forEach(field => {
+    if (value[field.name] !== undefined || field.optional || field.type === 'message') return;
+    value[field.name] = field.repeated ? [] : { int32: 0, bool: false, string: '', enum: field.values?.[0] }[field.type];
+  });
+  return value;
+}
+
+// What a method handler gets to know about the call
+interface GrpcCall {
+  token: string | undefined;        // From "authorization: Bearer ..." metadata
+  acceptLanguage: string | undefined;
+}
+
+interface GrpcMethod {
+  request: MessageSpec;
+  response: MessageSpec;
+  // Unary methods return their reply; streaming methods write through `send` and
+  // return a function that stops the stream
+  handler: (request: Record<string, any>, call: GrpcCall, send?: (message: Record<string, any>) => void, end?: () => void) => any;
+  streaming?: true;
+}
+
+class GrpcServer {
+  private gameManager: GameManager;
+  private api: HttpApi;
+  private methods: Record<string, GrpcMethod>;
+
+  constructor(gameManager: GameManager, api: HttpApi) {
+    this.gameManager = gameManager;
+    this.api = api;
+
+    this.methods = {
+      CreateGame: {
+        request: MESSAGES.CreateGameRequest,
+        response: MESSAGES.Session,
+        handler: (request, call) => {
+          const config = this.gameConfig(request.config);
+          return this.startSession(call, request.difficulty
+            ? { type: 'playAi', playerName: request.playerName, difficulty: request.difficulty, config }
+            : { type: 'join', gameId: request.gameId || undefined, playerName: request.playerName, config }, request.rulesVersion);
+        }
+      },
+      JoinGame: {
+        request: MESSAGES.JoinGameRequest,
+        response: MESSAGES.Session,
+        handler: (request, call) => {
+          // Joining never creates a room implicitly, as in the REST API
+          const gameId = String(request.gameId).toUpperCase();
+          if (!this.gameManager.hasGame(gameId)) {
+            throw new GameError(ErrorCode.GAME_NOT_FOUND, 'Game not found', { gameId });
+          }
+          return this.startSession(call, { type: 'join', gameId: request.gameId, playerName: request.playerName }, request.rulesVersion);
+        }
+      },
+      PlaceTank: {
+        request: MESSAGES.PlaceTankRequest,
+        response: MESSAGES.PlaceTankReply,
+        handler: (request, call) => this.action(call, { ...request, type: 'placeTank', moveId: request.moveId || undefined }, 'placeTankResult')
+      },
+      ConfirmPlacement: {
+        request: MESSAGES.ConfirmPlacementRequest,
+        response: MESSAGES.ConfirmPlacementReply,
+        handler: (request, call) => this.action(call, { type: 'confirmPlacement', moveId: request.moveId || undefined }, 'confirmPlacementResult')
+      },
+      Bomb: {
+        request: MESSAGES.BombRequest,
+        response: MESSAGES.BombReply,
+        handler: (request, call) => this.action(call, { ...request, type: 'bomb', moveId: request.moveId || undefined }, 'bombResult')
+      },
+      StreamEvents: {
+        request: MESSAGES.StreamEventsRequest,
+        response: MESSAGES.Event,
+        streaming: true,
+        handler: (request, call, send, end) => {
+          const session = this.api.findSession(call.token, call.acceptLanguage, undefined, true);
+          if (session.listener) {
+            throw new GameError(ErrorCode.VALIDATION_FAILED, 'This session is already streaming its events');
+          }
+          const toEvent = (message: any) => ({ type: message.type, json: JSON.stringify(message) });
+          session.drainEvents().forEach(message => send!(toEvent(message)));
+          session.listener = message => message ? send!(toEvent(message)) : end!();
+          return () => {
+            if (session.listener) session.listener = null;
+          };
+        }
+      }
+    };
+  }
+
+  createServer(): http2.Http2Server {
+    const server = http2.createServer();
+    server.on('stream', (stream, headers) => this.handle(stream, headers));
+    return server;
+  }
+
+  private handle(stream: http2.ServerHttp2Stream, headers: http2.IncomingHttpHeaders): void {
+    const path = String(headers[':path'] ?? '');
+    const name = path.startsWith(`/${SERVICE}/`) ? path.slice(SERVICE.length + 2) : '';
+    const method = Object.hasOwn(this.methods, name) ? this.methods[name] : undefined;
+    const call: GrpcCall = {
+      token: String(headers.authorization ?? '').match(/^Bearer\s+(\S+)$/i)?.[1],
+      acceptLanguage: headers['accept-language'] as string | undefined
+    };
+    const locale = negotiateLocale(call.acceptLanguage);
+    stream.on('error', error => console.error('gRPC stream error:', error));
+
+    if (headers[':method'] !== 'POST' || !String(headers['content-type'] ?? '').startsWith('application/grpc')) {
+      stream.respond({ ':status': 415 }, { endStream: true });
+      return;
+    }
+    if (!method) {
+      this.fail(stream, GrpcStatus.UNIMPLEMENTED, `Unknown method ${path}`);
+      return;
+    }
+
+    // Headers go out with the first reply message, so a call that fails before then
+    // can still end trailers-only
+    const respond = () => {
+      if (stream.headersSent) return;
+      stream.respond({ ':status': 200, 'content-type': 'application/grpc+proto' }, { waitForTrailers: true });
+      stream.once('wantTrailers', () => stream.sendTrailers({ 'grpc-status': String(GrpcStatus.OK) }));
+    };
+
+    this.readRequest(stream).then(data => {
+      let request: Record<string, any>;
+      try {
+        request = decodeMessage(method.request, data);
+      } catch (error) {
+        throw new GameError(ErrorCode.INVALID_MESSAGE, 'Malformed protobuf message', { reason: (error as Error).message });
+      }
+
+      if (!method.streaming) {
+        const reply = encodeMessage(method.response, method.handler(request, call));
+        respond();
+        stream.end(this.frame(reply));
+        return;
+      }
+
+      let open = true;
+      let stop: (() => void) | undefined;
+      const send = (message: Record<string, any>) => {
+        if (!open || stream.closed) return;
+        respond();
+        stream.write(this.frame(encodeMessage(method.response, message)));
+      };
+      const end = () => {
+        if (!open) return;
+        open = false;
+        stop?.();
+        if (!stream.closed) {
+          respond();
+          stream.end();
+        }
+      };
+      stop = method.handler(request, call, send, end);
+      respond();
+      stream.once('close', () => {
+        open = false;
+        stop?.();
+      });
+    }).catch(error => {
+      const gameError = toGameError(error);
+      if (gameError.code === ErrorCode.SERVER_ERROR) console.error('gRPC error:', error);
+      const envelope = gameError.toEnvelope(locale);
+      this.fail(stream, GRPC_STATUS_BY_CODE[envelope.code] ?? GRPC_STATUS_BY_HTTP[envelope.status] ?? GrpcStatus.INTERNAL, envelope.message, envelope);
+    });
+  }
+
+  // Seat a new session, returning what a Session message carries
+  private startSession(call: GrpcCall, message: Record<string, any>, rulesVersion?: number): Record<string, any> {
+    const { session, reply } = this.api.startSession(message, 'joined', call.token, call.acceptLanguage, rulesVersion);
+    const joined = this.succeeded(reply);
+    return { token: session.token, gameId: joined.gameId, playerId: joined.playerId, resumeToken: joined.resumeToken, config: joined.config };
+  }
+
+  private action(call: GrpcCall, message: Record<string, any>, replyType: string): Record<string, any> {
+    const session: HttpSession = this.api.findSession(call.token, call.acceptLanguage);
+    return this.succeeded(this.api.dispatch(session, message, replyType));
+  }
+
+  // A reply that failed becomes the error it carries
+  private succeeded(reply: any): any {
+    if (reply.success === false) {
+      const { code, message, details, fields } = reply.error as ErrorEnvelope;
+      throw new GameError(code, message, details, fields);
+    }
+    return reply;
+  }
+
+  // Unset GameConfig fields are left for the server's defaults; proto3 cannot tell an
+  // empty tank_lengths from an unset one, so empty means unset
+  private gameConfig(config: Record<string, any> | undefined): Record<string, any> | undefined {
+    if (!config) return undefined;
+    const { tankLengths, ...rest } = config;
+    return Object.fromEntries(Object.entries({ ...rest, tankLengths: tankLengths.length > 0 ? tankLengths : undefined })
+      .filter(([, value]) => value !== undefined));
+  }
+
+  // A trailers-only response carrying the error
+  private fail(stream: http2.ServerHttp2Stream, status: number, message: string, envelope?: ErrorEnvelope): void {
+    const trailers: http2.OutgoingHttpHeaders = {
+      ':status': 200,
+      'content-type': 'application/grpc+proto',
+      'grpc-status': String(status),
+      'grpc-message': encodeURIComponent(message)
+    };
+    if (envelope) trailers['tanks-error-bin'] = Buffer.from(JSON.stringify(envelope)).toString('base64');
+    stream.respond(trailers, { endStream: true });
+  }
+
+  // Length-prefixed, uncompressed
+  private frame(message: Buffer): Buffer {
+    const header = Buffer.alloc(5);
+    header.writeUInt32BE(message.length, 1);
+    return Buffer.concat([header, message]);
+  }
+
+  // The one request message every method of this service takes
+  private readRequest(stream: http2.ServerHttp2Stream): Promise<Buffer> {
+    return new Promise((resolve, reject) => {
+      const chunks: Buffer[] = [];
+      let size = 0;
+      stream.on('data', (chunk: Buffer) => {
+        size += chunk.length;
+        if (size > MAX_MESSAGE_BYTES + 5) {
+          reject(new GameError(ErrorCode.INVALID_MESSAGE, 'Request message too large', { maxBytes: MAX_MESSAGE_BYTES }));
+          return;
+        }
+        chunks.push(chunk);
+      });
+      stream.on('end', () => {
+        const data = Buffer.concat(chunks);
+        if (data.length < 5 || data.readUInt32BE(1) !== data.length - 5) {
+          reject(new GameError(ErrorCode.INVALID_MESSAGE, 'Expected exactly one request message'));
+        } else if (data[0] !== 0) {
+          reject(new GameError(ErrorCode.INVALID_MESSAGE, 'Compressed messages are not supported'));
+        } else {
+          resolve(data.subarray(5));
+        }
+      });
+      stream.on('error', reject);
+    });
+  }
+}
+
+export { GrpcServer, encodeMessage, decodeMessage, MESSAGES };
+export type { MessageSpec, FieldSpec };
@@ -0,0 +1,162 @@
+// Play a free-for-all (see freeforall.cts) at one terminal, passing it round the players.
+// Each turn shows only the board of whoever is to move, and asks for the screen to be
+// handed on first so nobody sees another player's fleet.
+//
+// The first run on a machine opens with a walk through the symbols, how to aim and the
+// commands; --intro shows it again. All of it is built from the match's own settings and
+// the symbols and colours the boards are drawn with, so it always matches what is on screen.
+//
+//   node hotseat.cjs <name> <name> <name> [...] [--no-color] [--intro] [--board-size N] [...any other server flag]
+
+import * as fs from 'fs';
+import * as os from 'os';
+import * as path from 'path';
+import * as readline from 'readline/promises';
+import { Utils } from './server.cjs';
+import type { GameError } from './errors.cjs';
+import { Rules } from './game.cjs';
+import { FreeForAll } from './freeforall.cjs';
+import { axisLabels, formatCell, parseCell } from './coords.cjs';
+import { renderBoards, renderLegend, explainLegend, useColor } from './render.cjs';
+import { describeRules } from './rules.cjs';
+
+// Its presence means the introduction has been shown on this machine
+const ONBOARDED_FILE = process.env.TANKS_ONBOARDED_FILE || path.join(os.homedir(), '.tanks', 'onboarded');
+
+// Typed at the prompt in place of a shot
+const COMMANDS: Record<string, string> = {
+  legend: 'what each symbol on the boards means',
+  rules: 'the rules this match is played under',
+  help: 'how to aim, and these commands',
+  quit: 'stop the match'
+};
+
+function explainAiming(match: FreeForAll): string {
+  const { coordinates, boardSize } = match.config;
+  const { columns, rows } = axisLabels(coordinates, boardSize);
+  const numbers = axisLabels(coordinates === 'zeroBased' ? 'zeroBased' : 'oneBased', boardSize).columns;
+  return [
+    `  Type an opponent's number and a cell, e.g. "2 ${formatCell(coordinates, 2, 4)}". A cell is the column letter and`,
+    `  the row (${formatCell('letterNumber', 2, 4)}), or the column and row as numbers from ${numbers[0]} (${numbers[2]},${rows[4]} or ${numbers[2]} ${rows[4]}), in any case.`,
+    `  Columns run ${columns[0]}-${columns[columns.length - 1]} from the left and rows ${rows[0]}-${rows[rows.length - 1]} from the top.`
+  ].join('\n');
+}
+
+function explainCommands(): string {
+  const width = Math.max(...Object.keys(COMMANDS).map(name => name.length));
+  return Object.entries(COMMANDS).map(([name, help]) => `  ${name.padEnd(width)}  ${help}`).join('\n');
+}
+
+function introduction(match: FreeForAll, color: boolean): string {
+  return [
+    'How to play',
+    '  Everyone has a fleet hidden on their own board. On your turn, bomb a cell on one',
+    '  opponent\'s board; the blast uncovers the cells around it. Lose your last tank and',
+    '  you are out. The last player with a tank left wins.',
+    '',
+    'The boards',
+    explainLegend({ color }),
+    '',
+    'Aiming',
+    explainAiming(match),
+    '',
+    'Commands',
+    explainCommands()
+  ].join('\n');
+}
+
+function firstRun(): boolean {
+  return !fs.existsSync(ONBOARDED_FILE);
+}
+
+// Best effort; a machine that can't keep the marker just sees the introduction again
+function markOnboarded(): void {
+  try {
+    fs.mkdirSync(path.dirname(ONBOARDED_FILE), { recursive: true });
+    fs.writeFileSync(ONBOARDED_FILE, `${new Date().toISOString()}\n`);
+  } catch {
+    // Nothing to do
+  }
+}
+
+async function play(match: FreeForAll, color: boolean, intro: boolean = false): Promise<void> {
+  const prompt = readline.createInterface({ input: process.stdin, output: process.stdout });
+  const example = formatCell(match.config.coordinates, 2, 4);
+  const commands: Record<string, () => string> = {
+    legend: () => explainLegend({ color }),
+    rules: () => describeRules({ ...Rules.describe(match.config), tankMovement: false }),
+    help: () => `${explainAiming(match)}\n\n${explainCommands()}`
+  };
+  console.log(intro ? introduction(match, color) : `${renderLegend({ color })}\nType help for how to aim and the other commands`);
+
+  let view = match.view();
+  while (view.winner === null) {
+    const me = view.players[view.seat];
+    await prompt.question(`\nPass the screen to ${me.name} and press Enter`);
+    console.log('');
+    console.log(renderBoards([
+      { title: me.name, board: view.myBoard },
+      ...view.enemyBoards.map(({ playerId, board }) => ({ title: `${playerId + 1}. ${view.players[playerId].name}`, board }))
+    ], { color, coordinates: match.config.coordinates }));
+    console.log(view.enemyBoards.map(({ playerId }) => {
+      const them = view.players[playerId];
+      return `${playerId + 1}. ${them.name}: ${them.eliminated ? 'out' : `${them.tanksAlive} tank(s) left`}`;
+    }).join(', '));
+
+    for (;;) {
+      const answer = (await prompt.question(`${me.name}, bomb whom and where? (e.g. ${view.enemyBoards[0].playerId + 1} ${example}) `)).trim();
+      const command = answer.toLowerCase();
+      if (command === 'quit') {
+        prompt.close();
+        return;
+      }
+      if (Object.hasOwn(commands, command)) {
+        console.log(commands[command]());
+        continue;
+      }
+
+      const [seat, ...cell] = answer.split(/\s+/);
+      try {
+        const { x, y } = parseCell(match.config.coordinates, cell.join(' '), match.config.boardSize);
+        const shot = match.bomb(view.seat, Number(seat) - 1, x, y);
+        const them = view.players[shot.target].name;
+        console.log(shot.eliminated ? `${shot.cell}: ${them}'s last tank is gone; ${them} is out`
+          : `${shot.cell}: ${shot.destroyed ? `destroyed one of ${them}'s tanks` : shot.hit ? `hit ${them}'s tank` : 'miss'}`);
+        break;
+      } catch (error) {
+        const fields: { field: string; reason: string }[] = (error as GameError).fields ?? [];
+        console.log([(error as Error).message, ...fields.map(f => `  ${f.field} ${f.reason}`), 'Type help for how to aim'].join('\n'));
+      }
+    }
+    view = match.view();
+  }
+
+  console.log(`\n${view.players[view.winner!].name} wins after ${view.moveCount} shots`);
+  prompt.close();
+}
+
+async function main(args: string[]): Promise<void> {
+  let match: FreeForAll;
+  try {
+    const flagAt = args.findIndex(arg => arg.startsWith('--'));
+    const names = flagAt === -1 ? args : args.slice(0, flagAt);
+    const flags = flagAt === -1 ? [] : args.slice(flagAt).filter(arg => arg !== '--no-color' && arg !== '--intro');
+    match = FreeForAll.create(names, Utils.parseServerArgs(flags).config);
+  } catch (error) {
+    const fields: { field: string; reason: string }[] = (error as GameError).fields ?? [];
+    console.error([(error as Error).message, ...fields.map(f => `  ${f.field} ${f.reason}`)].join('\n'));
+    console.error('Usage: node hotseat.cjs <name> <name> <name> [...] [--no-color] [--intro] [server flags]');
+    process.exit(2);
+  }
+
+  const intro = args.includes('--intro') || firstRun();
+  if (intro) markOnboarded();
+  await play(match, useColor(args), intro);
+  process.exit(0);
+}
+
+if (require.main === module) {
+  main(process.argv.slice(2));
+}
+
+export { play, introduction };
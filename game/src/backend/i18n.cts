@@ -0,0 +1,254 @@
+// Server-side message catalog. English error texts live with the code that
+// throws them; other locales translate them by error code. Quick-chat phrases (see
+// QUICK_CHAT in server.cts) reach each player in their own language.
+//
+// Numbers and dates in summaries, leaderboards and CSV exports follow the full locale
+// a client asks for (de-CH, en-GB), which may be more specific than the catalog
+// language its messages are written in.
+
+const DEFAULT_LOCALE = 'en';
+
+const MESSAGES: Record<string, Record<string, string>> = {
+  en: {
+    'result.hit': 'DIRECT HIT at ({cell})!',
+    'result.miss': 'Miss at ({cell})',
+    'result.victory': 'DIRECT HIT at ({cell})! VICTORY! All enemy tanks destroyed!',
+    'result.strike': 'Strike at ({cell}): {hits} hit, {misses} missed',
+    'result.strikeVictory': 'Strike at ({cell}): {hits} hit! VICTORY! All enemy tanks destroyed!',
+    'result.scanFound': 'Scan around ({cell}): tanks detected!',
+    'result.scanEmpty': 'Scan around ({cell}): no tanks',
+    'quickChat.hello': 'Hello!',
+    'quickChat.goodLuck': 'Good luck!',
+    'quickChat.niceShot': 'Nice shot!',
+    'quickChat.closeOne': 'That was close!',
+    'quickChat.thinking': 'Let me think...',
+    'quickChat.oops': 'Oops!',
+    'quickChat.thanks': 'Thanks!',
+    'quickChat.goodGame': 'Good game!',
+    'quickChat.rematch': 'Rematch?',
+    'export.rank': 'Rank',
+    'export.player': 'Player',
+    'export.rating': 'Rating',
+    'export.ratedGames': 'Rated games',
+    'export.wins': 'Wins',
+    'export.losses': 'Losses',
+    'export.winRate': 'Win rate (%)',
+    'export.entry': 'Entry',
+    'export.move': 'Move',
+    'export.action': 'Action',
+    'export.cell': 'Cell',
+    'export.outcome': 'Outcome',
+    'export.thinkSeconds': 'Think time (s)',
+    'export.time': 'Time'
+  },
+  es: {
+    'result.hit': '¡IMPACTO DIRECTO en ({cell})!',
+    'result.miss': 'Fallo en ({cell})',
+    'result.victory': '¡IMPACTO DIRECTO en ({cell})! ¡VICTORIA! ¡Todos los tanques enemigos destruidos!',
+    'result.strike': 'Ataque en ({cell}): {hits} impactos, {misses} fallos',
+    'result.strikeVictory': 'Ataque en ({cell}): ¡{hits} impactos! ¡VICTORIA! ¡Todos los tanques enemigos destruidos!',
+    'result.scanFound': 'Escaneo en ({cell}): ¡tanques detectados!',
+    'result.scanEmpty': 'Escaneo en ({cell}): ningún tanque',
+    'quickChat.hello': '¡Hola!',
+    'quickChat.goodLuck': '¡Buena suerte!',
+    'quickChat.niceShot': '¡Buen tiro!',
+    'quickChat.closeOne': '¡Por poco!',
+    'quickChat.thinking': 'Déjame pensar...',
+    'quickChat.oops': '¡Uy!',
+    'quickChat.thanks': '¡Gracias!',
+    'quickChat.goodGame': '¡Buena partida!',
+    'quickChat.rematch': '¿La revancha?',
+    'export.rank': 'Puesto',
+    'export.player': 'Jugador',
+    'export.rating': 'Puntuación',
+    'export.ratedGames': 'Partidas puntuadas',
+    'export.wins': 'Victorias',
+    'export.losses': 'Derrotas',
+    'export.winRate': 'Porcentaje de victorias (%)',
+    'export.entry': 'Entrada',
+    'export.move': 'Jugada',
+    'export.action': 'Acción',
+    'export.cell': 'Casilla',
+    'export.outcome': 'Resultado',
+    'export.thinkSeconds': 'Tiempo de reflexión (s)',
+    'export.time': 'Hora',
+    'error.INVALID_MESSAGE': 'Formato de mensaje no válido',
+    'error.NOT_FOUND': 'Recurso no encontrado',
+    'error.UNAUTHORIZED': 'Se requiere un token de sesión válido',
+    'error.FORBIDDEN': 'No tienes permiso para esta acción',
+    'error.VALIDATION_FAILED': 'Datos de la acción no válidos',
+    'error.NOT_IN_GAME': 'No estás en esta partida',
+    'error.GAME_NOT_FOUND': 'Partida no encontrada',
+    'error.GAME_FULL': 'La partida está llena',
+    'error.INVALID_ROOM_ID': 'ID de sala no válido. Usa de 4 a 10 caracteres alfanuméricos.',
+    'error.ROOM_EXISTS': 'Esa sala ya existe. Elige otro ID.',
+    'error.WRONG_PHASE': 'Esa acción no está permitida en esta fase',
+    'error.NOT_YOUR_TURN': 'No es tu turno',
+    'error.GAME_OVER': 'La partida ha terminado',
+    'error.GAME_VOIDED': 'Un moderador ha anulado la partida',
+    'error.OUT_OF_BOUNDS': 'Posición fuera del tablero',
+    'error.CELL_OCCUPIED': 'Ya hay un tanque ahí',
+    'error.ALL_TANKS_PLACED': 'Ya has colocado todos tus tanques',
+    'error.NO_TANK_AT_SOURCE': 'No hay ningún tanque que mover ahí',
+    'error.NO_TANK_THERE': 'No hay ningún tanque tuyo ahí',
+    'error.PLACEMENT_INCOMPLETE': 'Coloca todos tus tanques antes de confirmar',
+    'error.PLACEMENT_CONFIRMED': 'Ya has confirmado la colocación de tus tanques',
+    'error.INVALID_MOVE': 'Los tanques solo pueden moverse a casillas vacías',
+    'error.ALREADY_BOMBED': 'Ya has bombardeado esa casilla',
+    'error.ABILITY_UNAVAILABLE': 'No te queda ese disparo especial',
+    'error.MISSING_SEQUENCE': 'Falta el número de jugada',
+    'error.STALE_MOVE': 'Jugada obsoleta: la partida ha avanzado',
+    'error.FEATURE_DISABLED': 'Esta función no está disponible en este servidor',
+    'error.ACTION_TOO_SOON': 'Acción repetida demasiado rápido; espera un momento',
+    'error.STORAGE_ERROR': 'No se pudo acceder a la partida guardada',
+    'error.MAINTENANCE': 'El servidor entra en mantenimiento; no se pueden empezar partidas nuevas',
+    'error.NAME_TAKEN': 'Ese nombre ya está registrado',
+    'error.INCOMPATIBLE_CLIENT': 'Tu cliente no es compatible; actualízalo',
+    'error.INCOMPATIBLE_RULES': 'Este servidor no puede jugar con la versión {rulesVersion} de las reglas',
+    'error.SERVER_ERROR': 'Se produjo un error en el servidor'
+  },
+  fr: {
+    'result.hit': 'TOUCHÉ en ({cell}) !',
+    'result.miss': 'Raté en ({cell})',
+    'result.victory': 'TOUCHÉ en ({cell}) ! VICTOIRE ! Tous les chars ennemis sont détruits !',
+    'result.strike': 'Frappe en ({cell}) : {hits} touchés, {misses} ratés',
+    'result.strikeVictory': 'Frappe en ({cell}) : {hits} touchés ! VICTOIRE ! Tous les chars ennemis sont détruits !',
+    'result.scanFound': 'Scan autour de ({cell}) : chars détectés !',
+    'result.scanEmpty': 'Scan autour de ({cell}) : aucun char',
+    'quickChat.hello': 'Salut !',
+    'quickChat.goodLuck': 'Bonne chance !',
+    'quickChat.niceShot': 'Joli tir !',
+    'quickChat.closeOne': "C'était moins une !",
+    'quickChat.thinking': 'Laisse-moi réfléchir...',
+    'quickChat.oops': 'Oups !',
+    'quickChat.thanks': 'Merci !',
+    'quickChat.goodGame': 'Bien joué !',
+    'quickChat.rematch': 'Une revanche ?',
+    'export.rank': 'Rang',
+    'export.player': 'Joueur',
+    'export.rating': 'Classement',
+    'export.ratedGames': 'Parties classées',
+    'export.wins': 'Victoires',
+    'export.losses': 'Défaites',
+    'export.winRate': 'Taux de victoire (%)',
+    'export.entry': 'Entrée',
+    'export.move': 'Coup',
+    'export.action': 'Action',
+    'export.cell': 'Case',
+    'export.outcome': 'Résultat',
+    'export.thinkSeconds': 'Temps de réflexion (s)',
+    'export.time': 'Heure',
+    'error.INVALID_MESSAGE': 'Format de message invalide',
+    'error.NOT_FOUND': 'Ressource introuvable',
+    'error.UNAUTHORIZED': 'Un jeton de session valide est requis',
+    'error.FORBIDDEN': "Vous n'avez pas l'autorisation pour cette action",
+    'error.VALIDATION_FAILED': "Données d'action invalides",
+    'error.NOT_IN_GAME': "Vous n'êtes pas dans cette partie",
+    'error.GAME_NOT_FOUND': 'Partie introuvable',
+    'error.GAME_FULL': 'La partie est complète',
+    'error.INVALID_ROOM_ID': 'ID de salon invalide. Utilisez 4 à 10 caractères alphanumériques.',
+    'error.ROOM_EXISTS': 'Ce salon existe déjà. Choisissez un autre ID.',
+    'error.WRONG_PHASE': "Cette action n'est pas autorisée dans cette phase",
+    'error.NOT_YOUR_TURN': "Ce n'est pas votre tour",
+    'error.GAME_OVER': 'La partie est terminée',
+    'error.GAME_VOIDED': 'Un modérateur a annulé la partie',
+    'error.OUT_OF_BOUNDS': 'Position hors du plateau',
+    'error.CELL_OCCUPIED': 'Il y a déjà un char ici',
+    'error.ALL_TANKS_PLACED': 'Tous vos chars sont déjà placés',
+    'error.NO_TANK_AT_SOURCE': "Il n'y a aucun char à déplacer ici",
+    'error.NO_TANK_THERE': "Vous n'avez aucun char ici",
+    'error.PLACEMENT_INCOMPLETE': 'Placez tous vos chars avant de confirmer',
+    'error.PLACEMENT_CONFIRMED': 'Vous avez déjà confirmé le placement de vos chars',
+    'error.INVALID_MOVE': 'Les chars ne peuvent aller que sur des cases vides',
+    'error.ALREADY_BOMBED': 'Cette case a déjà été bombardée',
+    'error.ABILITY_UNAVAILABLE': "Il ne vous reste plus ce tir spécial",
+    'error.MISSING_SEQUENCE': 'Numéro de coup manquant',
+    'error.STALE_MOVE': 'Coup périmé : la partie a avancé',
+    'error.FEATURE_DISABLED': "Cette fonctionnalité n'est pas disponible sur ce serveur",
+    'error.ACTION_TOO_SOON': 'Action répétée trop vite, patientez un instant',
+    'error.STORAGE_ERROR': "La partie enregistrée est inaccessible",
+    'error.MAINTENANCE': 'Le serveur passe en maintenance ; aucune nouvelle partie ne peut commencer',
+    'error.NAME_TAKEN': 'Ce nom est déjà enregistré',
+    'error.INCOMPATIBLE_CLIENT': "Votre client n'est pas compatible ; mettez-le à jour",
+    'error.INCOMPATIBLE_RULES': 'Ce serveur ne sait pas jouer avec la version {rulesVersion} des règles',
+    'error.SERVER_ERROR': 'Une erreur serveur est survenue'
+  }
+};
+
+const SUPPORTED_LOCALES = Object.keys(MESSAGES);
+
+// The tags of an Accept-Language style header, most preferred first
+function rankLanguages(acceptLanguage: string): { tag: string; language: string }[] {
+  return acceptLanguage.split(',').map(part => {
+    const [tag, ...params] = part.trim().split(';');
+    const q = params.find(p => p.trim().startsWith('q='));
+    return { tag: tag.trim(), language: tag.trim().toLowerCase().split('-')[0], q: q ? parseFloat(q.trim().slice(2)) : 1 };
+  }).filter(entry => entry.q > 0).sort((a, b) => b.q - a.q);
+}
+
+// Pick the best supported locale from an Accept-Language style header
+function negotiateLocale(acceptLanguage: string | undefined): string {
+  if (!acceptLanguage) return DEFAULT_LOCALE;
+  const match = rankLanguages(acceptLanguage).find(entry => SUPPORTED_LOCALES.includes(entry.language));
+  return match ? match.language : DEFAULT_LOCALE;
+}
+
+// The locale numbers and dates are formatted in: the most preferred one Intl knows,
+// whether or not the catalog has its messages
+function negotiateFormat(acceptLanguage: string | undefined): string {
+  if (!acceptLanguage) return DEFAULT_LOCALE;
+  for (const { tag } of rankLanguages(acceptLanguage)) {
+    try {
+      const [supported] = Intl.NumberFormat.supportedLocalesOf(tag);
+      if (supported) return supported;
+    } catch {
+      // Not a well-formed tag
+    }
+  }
+  return DEFAULT_LOCALE;
+}
+
+function formatNumber(value: number, format: string, options: Intl.NumberFormatOptions = {}): string {
+  return new Intl.NumberFormat(format, { maximumFractionDigits: 2, ...options }).format(value);
+}
+
+function formatPercent(ratio: number, format: string): string {
+  return formatNumber(ratio, format, { style: 'percent', maximumFractionDigits: 1 });
+}
+
+// In UTC, so a game reads the same wherever the server runs
+function formatDate(epochMs: number, format: string): string {
+  return new Intl.DateTimeFormat(format, { dateStyle: 'medium', timeStyle: 'long', timeZone: 'UTC' }).format(epochMs);
+}
+
+// Whole minutes and seconds, e.g. "12 min, 5 sec"
+function formatDuration(ms: number, format: string): string {
+  const seconds = Math.round(ms / 1000);
+  const unit = (value: number, name: string) => formatNumber(value, format, { style: 'unit', unit: name, unitDisplay: 'short' });
+  const parts = seconds >= 60 ? [unit(Math.floor(seconds / 60), 'minute'), unit(seconds % 60, 'second')] : [unit(seconds, 'second')];
+  return new Intl.ListFormat(format, { style: 'narrow', type: 'unit' }).format(parts);
+}
+
+// A CSV that spreadsheets in the locale open as they are: where the decimal separator
+// is a comma, fields are separated by semicolons. Numbers take the locale's decimal
+// separator but no grouping, which spreadsheets would read as text.
+function toCsv(header: string[], rows: (string | number | null)[][], format: string): string {
+  const decimal = new Intl.NumberFormat(format).formatToParts(1.5).find(part => part.type === 'decimal')?.value;
+  const separator = decimal === ',' ? ';' : ',';
+  const field = (value: string | number | null) => {
+    const text = value === null ? '' : typeof value === 'number' ? formatNumber(value, format, { useGrouping: false }) : value;
+    return /["\r\n]/.test(text) || text.includes(separator) ? `"${text.replace(/"/g, '""')}"` : text;
+  };
+  return [header, ...rows].map(row => row.map(field).join(separator)).join('\r\n') + '\r\n';
+}
+
+// Look up a message, falling back to English and then to the provided text
+function translate(key: string, locale: string, params: Record<string, any> = {}, fallback?: string): string {
+  const template = MESSAGES[locale]?.[key] ?? MESSAGES[DEFAULT_LOCALE][key] ?? fallback ?? key;
+  return template.replace(/\{(\w+)\}/g, (match, name) => (name in params ? String(params[name]) : match));
+}
+
+export {
+  DEFAULT_LOCALE, SUPPORTED_LOCALES, negotiateLocale, negotiateFormat, translate, formatNumber, formatPercent, formatDate,
+  formatDuration, toCsv
+};
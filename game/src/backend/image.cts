@@ -0,0 +1,89 @@
+// Board images: boards side by side as SVG, with their columns and rows labelled in a
+// coordinate system (see coords.cts), a title over each and a legend beneath, in the
+// colours of the web client. The client saves them as PNG snapshots; the post-game summary
+// and the gameOver event carry the final boards, for webhooks and chat bots to post.
+// Cells picked out, as in render.cts, are outlined.
+
+import { CellState } from './game.cjs';
+import { axisLabels, type CoordinateSystem } from './coords.cjs';
+import type { RenderedBoard } from './render.cjs';
+
+const CELL = 32;
+const MARGIN = 30;
+const LEGEND_HEIGHT = 40;
+const FONT = 'Arial, sans-serif';
+
+const BACKGROUND = '#0f1419';
+const GRID = '#1f2937';
+const TEXT = '#f8fafc';
+const LABELS = '#ccc';
+const HIGHLIGHT = '#facc15';
+const ENEMY_TANK = '#ef4444';
+const CELL_FILLS: Record<CellState, string> = {
+  [CellState.EMPTY]: '#1e293b',
+  [CellState.TANK]: '#10b981',
+  [CellState.HIT]: '#f59e0b',
+  [CellState.MISS]: '#3b82f6',
+  [CellState.REVEALED]: '#64748b'
+};
+
+interface ImageBoard extends RenderedBoard {
+  enemy?: boolean;  // Tanks on it are the opponent's, drawn red rather than green
+}
+
+interface ImageOptions {
+  coordinates?: CoordinateSystem;  // How the columns and rows are labelled; letters and numbers if unset
+}
+
+function escapeXml(text: string): string {
+  return text.replace(/[&<>"']/g, c => `&#${c.charCodeAt(0)};`);
+}
+
+function label(x: number, y: number, text: string, attributes: string): string {
+  return `<text x="${x}" y="${y}" ${attributes}>${escapeXml(text)}</text>`;
+}
+
+function boardsSvg(boards: ImageBoard[], options: ImageOptions = {}): string {
+  const size = boards[0]?.board.length ?? 0;
+  const labels = axisLabels(options.coordinates ?? 'letterNumber', size);
+  const boardPixels = size * CELL;
+  const width = Math.max(boards.length, 1) * (boardPixels + MARGIN) + MARGIN;
+  const height = boardPixels + MARGIN * 2 + LEGEND_HEIGHT;
+
+  const parts = [`<rect width="${width}" height="${height}" fill="${BACKGROUND}"/>`];
+  boards.forEach(({ title, board, highlight = [], enemy }, index) => {
+    const left = MARGIN + index * (boardPixels + MARGIN);
+    parts.push(label(left, 14, title, `fill="${TEXT}" font-weight="bold" font-size="14"`));
+    labels.columns.forEach((text, x) => parts.push(label(left + x * CELL + CELL / 2, MARGIN - 4, text, `fill="${LABELS}" font-size="12" text-anchor="middle"`)));
+    labels.rows.forEach((text, y) => parts.push(label(left - 4, MARGIN + y * CELL + CELL / 2 + 4, text, `fill="${LABELS}" font-size="12" text-anchor="end"`)));
+    board.forEach((row, y) => row.forEach((state, x) => {
+      const fill = state === CellState.TANK && enemy ? ENEMY_TANK : CELL_FILLS[state];
+      parts.push(`<rect x="${left + x * CELL}" y="${MARGIN + y * CELL}" width="${CELL}" height="${CELL}" fill="${fill}" stroke="${GRID}"/>`);
+    }));
+    highlight.forEach(({ x, y }) => {
+      parts.push(`<rect x="${left + x * CELL + 2}" y="${MARGIN + y * CELL + 2}" width="${CELL - 4}" height="${CELL - 4}" fill="none" stroke="${HIGHLIGHT}" stroke-width="2"/>`);
+    });
+  });
+
+  // Enemy tanks only get a key where a board shows them
+  const legend: [string, string][] = [
+    ['Tank', CELL_FILLS[CellState.TANK]],
+    ...(boards.some(board => board.enemy) ? [['Enemy tank', ENEMY_TANK] as [string, string]] : []),
+    ['Hit', CELL_FILLS[CellState.HIT]],
+    ['Miss', CELL_FILLS[CellState.MISS]],
+    ['Revealed', CELL_FILLS[CellState.REVEALED]]
+  ];
+  let legendX = MARGIN;
+  const legendY = boardPixels + MARGIN * 2;
+  legend.forEach(([name, color]) => {
+    parts.push(`<rect x="${legendX}" y="${legendY}" width="12" height="12" fill="${color}"/>`);
+    parts.push(label(legendX + 18, legendY + 11, name, `fill="${TEXT}" font-size="12"`));
+    legendX += 18 + name.length * 7 + 22;  // Roughly the width of the name at 12px
+  });
+
+  return `<svg xmlns="http://www.w3.org/2000/svg" width="${width}" height="${height}" viewBox="0 0 ${width} ${height}" font-family="${FONT}">` +
+    `${parts.join('')}</svg>`;
+}
+
+export { boardsSvg };
+export type { ImageBoard, ImageOptions };
@@ -0,0 +1,52 @@
+// Board images: labels in the game's coordinate system, the legend, outlined cells, and
+// names from players kept from breaking the SVG. Run with `npm test`.
+
+import { describe, it } from 'node:test';
+import * as assert from 'assert';
+import { boardsSvg } from './image.cjs';
+import { CellState, Rules } from './game.cjs';
+
+function board(): CellState[][] {
+  const cells = Rules.createEmptyBoard(4);
+  cells[0][1] = CellState.TANK;
+  cells[2][3] = CellState.HIT;
+  cells[3][0] = CellState.MISS;
+  return cells;
+}
+
+const rects = (svg: string) => svg.match(/<rect /g)?.length ?? 0;
+
+describe('boardsSvg', () => {
+  it('draws every cell of each board, side by side', () => {
+    const one = boardsSvg([{ title: 'a', board: board() }]);
+    const two = boardsSvg([{ title: 'a', board: board() }, { title: 'b', board: board() }]);
+    assert.ok(one.startsWith('<svg xmlns="http://www.w3.org/2000/svg"'));
+    assert.strictEqual(rects(two) - rects(one), 16);
+    assert.ok(Number(/width="(\d+)"/.exec(two)![1]) > Number(/width="(\d+)"/.exec(one)![1]));
+  });
+
+  it('labels columns and rows in the coordinate system asked for', () => {
+    const texts = (svg: string) => [...svg.matchAll(/<text [^>]*>([^<]*)<\/text>/g)].map(match => match[1]);
+    assert.deepStrictEqual(texts(boardsSvg([{ title: 'a', board: board() }])).slice(1, 9), ['A', 'B', 'C', 'D', '1', '2', '3', '4']);
+    assert.deepStrictEqual(texts(boardsSvg([{ title: 'a', board: board() }], { coordinates: 'zeroBased' })).slice(1, 9), ['0', '1', '2', '3', '0', '1', '2', '3']);
+  });
+
+  it('keys enemy tanks only where a board shows them', () => {
+    assert.ok(!boardsSvg([{ title: 'a', board: board() }]).includes('Enemy tank'));
+    const svg = boardsSvg([{ title: 'a', board: board() }, { title: 'b', board: board(), enemy: true }]);
+    assert.ok(svg.includes('>Enemy tank<') && svg.includes('fill="#ef4444"'));
+  });
+
+  it('outlines highlighted cells', () => {
+    const plain = boardsSvg([{ title: 'a', board: board() }]);
+    const highlighted = boardsSvg([{ title: 'a', board: board(), highlight: [{ x: 3, y: 2 }] }]);
+    assert.strictEqual(rects(highlighted) - rects(plain), 1);
+    assert.ok(highlighted.includes('fill="none"'));
+  });
+
+  it('escapes titles', () => {
+    const svg = boardsSvg([{ title: '<script>&"', board: board() }]);
+    assert.ok(!svg.includes('<script>'));
+    assert.ok(svg.includes('&#60;script&#62;&#38;&#34;'));
+  });
+});
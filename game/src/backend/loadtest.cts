@@ -0,0 +1,322 @@
+// Load a running server with simulated players, to size a deployment before real
+// tournaments. Clients pair up in rooms of their own and play scripted games over the
+// WebSocket protocol exactly as a browser would: join, accept the settings, place a
+// fleet, confirm it and bomb cell after cell until someone wins. Every request is timed
+// from sending it to its reply, and every failure is counted by its error code.
+//
+//   node loadtest.cjs <ws://host:port> [--clients N] [--games N] [--ramp S] [--timeout S] [--config JSON] [--json]
+//
+// --clients (default 100, even) connect over --ramp seconds (default 10), and each pair
+// plays --games games (default 1) one after another on fresh connections. A game not
+// over within --timeout seconds (default 120) counts as failed. --config takes the
+// settings each room is created with, as a game does. Thousands of clients may need a
+// higher open file limit (ulimit -n) on both ends.
+
+import * as crypto from 'crypto';
+import { WebSocket } from 'ws';
+import { CellState } from './game.cjs';
+
+const MAX_CLIENTS = 100_000;
+
+interface LoadTestOptions {
+  url: string;
+  clients: number;
+  games: number;
+  rampMs: number;
+  timeoutMs: number;
+  config: Record<string, unknown> | undefined;
+}
+
+interface LatencySummary {
+  count: number;
+  p50: number;
+  p90: number;
+  p99: number;
+  max: number;
+}
+
+interface LoadTestReport {
+  url: string;
+  clients: number;
+  games: number;       // Played to the end
+  failedGames: number;
+  requests: number;
+  failedRequests: number;
+  errors: Record<string, number>;         // Failures by error code, or what went wrong
+  latencyMs: Record<string, LatencySummary>;  // By request type, and 'connect'
+  durationMs: number;
+}
+
+// Shared by every client of a run
+class LoadRecorder {
+  requests: number = 0;
+  failedRequests: number = 0;
+  games: number = 0;
+  failedGames: number = 0;
+  readonly errors: Map<string, number> = new Map();
+  readonly latencies: Map<string, number[]> = new Map();
+
+  time(action: string, ms: number): void {
+    const samples = this.latencies.get(action) ?? [];
+    samples.push(ms);
+    this.latencies.set(action, samples);
+  }
+
+  error(reason: string): void {
+    this.errors.set(reason, (this.errors.get(reason) ?? 0) + 1);
+  }
+}
+
+function percentile(sorted: number[], p: number): number {
+  return sorted[Math.max(Math.ceil((p / 100) * sorted.length) - 1, 0)];
+}
+
+// The first run of empty cells long enough for the next tank, scanning row by row
+function freeRun(board: number[][], length: number): { x: number; y: number } | null {
+  for (let y = 0; y < board.length; y++) {
+    for (let x = 0; x + length <= board.length; x++) {
+      if (board[y].slice(x, x + length).every(cell => cell === CellState.EMPTY)) return { x, y };
+    }
+  }
+  return null;
+}
+
+// One side of a scripted game; resolves with whether it saw the game through
+function playSeat(options: LoadTestOptions, roomId: string, seat: number, recorder: LoadRecorder): Promise<boolean> {
+  return new Promise(resolve => {
+    const openedAt = Date.now();
+    const ws = new WebSocket(options.url);
+    const pending: Map<string, { action: string; sentAt: number }> = new Map();  // Reply type -> request awaiting it
+    let state: any = null;
+    let playerId: number | null = null;
+    let accepted = false;
+    let confirmed = false;
+    let finished = false;
+
+    const finish = (completed: boolean, reason?: string) => {
+      if (finished) return;
+      finished = true;
+      clearTimeout(timer);
+      if (reason) recorder.error(reason);
+      ws.removeAllListeners();
+      ws.on('error', () => {});
+      ws.close();
+      resolve(completed);
+    };
+    const timer = setTimeout(() => finish(false, 'timeout'), options.timeoutMs);
+
+    const request = (message: Record<string, unknown>, replyType: string) => {
+      if (pending.has(replyType)) return;
+      pending.set(replyType, { action: message.type as string, sentAt: Date.now() });
+      recorder.requests++;
+      ws.send(JSON.stringify(message));
+    };
+
+    // Whatever the latest state calls for, unless that request is still out
+    const step = () => {
+      if (!state || playerId === null) return;
+      if (state.phase === 'gameover') {
+        finish(true);
+      } else if (state.phase === 'setup' && playerId === 1 && !accepted) {
+        accepted = true;
+        request({ type: 'acceptSettings' }, 'acceptSettingsResult');
+      } else if (state.phase === 'placement' && state.nextTankLength) {
+        const spot = freeRun(state.myBoard, state.nextTankLength);
+        if (!spot) {
+          finish(false, 'no room for the fleet');
+          return;
+        }
+        request({ type: 'placeTank', ...spot, orientation: 'horizontal' }, 'placeTankResult');
+      } else if (state.phase === 'placement' && !confirmed) {
+        confirmed = true;
+        request({ type: 'confirmPlacement' }, 'confirmPlacementResult');
+      } else if (state.phase === 'battle' && state.currentTurn === playerId) {
+        const cells = (state.enemyBoard as number[][]).flatMap((row, y) => row.map((cell, x) => ({ x, y, cell })));
+        const target = cells.find(({ cell }) => cell !== CellState.HIT && cell !== CellState.MISS);
+        if (target) request({ type: 'bomb', x: target.x, y: target.y, expectedMove: state.moveCount }, 'bombResult');
+      }
+    };
+
+    ws.on('open', () => {
+      recorder.time('connect', Date.now() - openedAt);
+      request({ type: 'join', gameId: roomId, playerName: `load-${roomId}-${seat}`, ...(options.config && { config: options.config }) }, 'joined');
+    });
+    ws.on('message', data => {
+      let message: any;
+      try {
+        message = JSON.parse(data.toString());
+      } catch {
+        finish(false, 'unreadable message');
+        return;
+      }
+
+      const awaited = pending.get(message.type);
+      if (awaited) {
+        pending.delete(message.type);
+        recorder.time(awaited.action, Date.now() - awaited.sentAt);
+        if (message.success === false) {
+          recorder.failedRequests++;
+          recorder.error(message.error?.code ?? `${awaited.action} failed`);
+          if (awaited.action === 'join') {
+            finish(false);
+            return;
+          }
+        }
+      }
+      if (message.type === 'error') {
+        recorder.failedRequests++;
+        recorder.error(message.error?.code ?? 'error');
+      } else if (message.type === 'joined' && message.success) {
+        playerId = message.playerId;
+      } else if (message.type === 'gameState') {
+        state = message;
+      } else if (message.type === 'gameAborted') {
+        finish(false, 'game aborted');
+        return;
+      }
+      step();
+    });
+    ws.on('error', error => finish(false, `connection: ${(error as Error).message}`));
+    ws.on('close', () => finish(false, 'closed by the server'));
+  });
+}
+
+async function playPair(options: LoadTestOptions, runId: string, pair: number, recorder: LoadRecorder): Promise<void> {
+  for (let game = 0; game < options.games; game++) {
+    const roomId = `L${runId}${(pair * options.games + game).toString(36)}`.toUpperCase();
+    const seats = await Promise.all([0, 1].map(seat => playSeat(options, roomId, seat, recorder)));
+    if (seats.every(Boolean)) {
+      recorder.games++;
+    } else {
+      recorder.failedGames++;
+    }
+  }
+}
+
+async function loadTest(options: LoadTestOptions): Promise<LoadTestReport> {
+  const recorder = new LoadRecorder();
+  const runId = crypto.randomBytes(2).toString('hex');  // Keeps rooms of runs against the same server apart
+  const pairs = options.clients / 2;
+  const startedAt = Date.now();
+  await Promise.all(Array.from({ length: pairs }, (_, pair) => new Promise<void>(resolve => {
+    setTimeout(() => playPair(options, runId, pair, recorder).then(resolve), (pair * options.rampMs) / pairs);
+  })));
+
+  const latencyMs: Record<string, LatencySummary> = {};
+  recorder.latencies.forEach((samples, action) => {
+    const sorted = [...samples].sort((a, b) => a - b);
+    latencyMs[action] = {
+      count: sorted.length,
+      p50: percentile(sorted, 50),
+      p90: percentile(sorted, 90),
+      p99: percentile(sorted, 99),
+      max: sorted[sorted.length - 1]
+    };
+  });
+  return {
+    url: options.url,
+    clients: options.clients,
+    games: recorder.games,
+    failedGames: recorder.failedGames,
+    requests: recorder.requests,
+    failedRequests: recorder.failedRequests,
+    errors: Object.fromEntries(recorder.errors),
+    latencyMs,
+    durationMs: Date.now() - startedAt
+  };
+}
+
+function describeLoadTest(report: LoadTestReport): string {
+  const { games, failedGames, requests, failedRequests } = report;
+  const percent = (count: number, of: number) => `${of > 0 ? ((100 * count) / of).toFixed(2) : '0.00'}%`;
+  const actions = Object.keys(report.latencyMs);
+  const width = Math.max(...actions.map(action => action.length), 'request'.length);
+  return [
+    `${report.clients} clients against ${report.url} for ${(report.durationMs / 1000).toFixed(1)} s`,
+    `  games     ${games} finished, ${failedGames} failed (${percent(failedGames, games + failedGames)})`,
+    `  requests  ${requests} sent, ${failedRequests} failed (${percent(failedRequests, requests)})`,
+    ...(actions.length > 0 ? [
+      '',
+      `  ${'request'.padEnd(width)}  ${['count', 'p50', 'p90', 'p99', 'max'].map(column => column.padStart(7)).join('  ')}  (ms)`,
+      ...actions.map(action => {
+        const { count, p50, p90, p99, max } = report.latencyMs[action];
+        return `  ${action.padEnd(width)}  ${[count, p50, p90, p99, max].map(value => String(value).padStart(7)).join('  ')}`;
+      })
+    ] : []),
+    ...(Object.keys(report.errors).length > 0
+      ? ['', '  errors', ...Object.entries(report.errors).sort((a, b) => b[1] - a[1]).map(([reason, count]) => `    ${String(count).padStart(7)}  ${reason}`)]
+      : [])
+  ].join('\n');
+}
+
+// The value following `flag`, if it was given
+function optionValue(args: string[], flag: string): string | undefined {
+  const index = args.indexOf(flag);
+  return index === -1 ? undefined : args[index + 1];
+}
+
+function parseLoadTestArgs(args: string[]): LoadTestOptions {
+  const valued = ['--clients', '--games', '--ramp', '--timeout', '--config'];
+  const [url, ...extra] = args.filter((arg, i) => !arg.startsWith('--') && !valued.includes(args[i - 1]));
+  if (!url || extra.length > 0) {
+    throw new Error('Name the one server to load, e.g. ws://localhost:3000');
+  }
+  if (!/^wss?:\/\//.test(url)) {
+    throw new Error('The server must be a ws:// or wss:// URL');
+  }
+
+  const number = (flag: string, fallback: number, min: number, max: number, whole: boolean = true): number => {
+    const raw = optionValue(args, flag);
+    if (raw === undefined) return fallback;
+    const value = Number(raw);
+    if (!Number.isFinite(value) || (whole && !Number.isInteger(value)) || value < min || value > max) {
+      throw new Error(`${flag} must be ${whole ? 'a whole number' : 'a number'} from ${min} to ${max}`);
+    }
+    return value;
+  };
+  const clients = number('--clients', 100, 2, MAX_CLIENTS);
+  if (clients % 2 !== 0) {
+    throw new Error('--clients must be even; clients play in pairs');
+  }
+
+  const rawConfig = optionValue(args, '--config');
+  let config: Record<string, unknown> | undefined;
+  if (rawConfig !== undefined) {
+    try {
+      config = JSON.parse(rawConfig);
+    } catch {
+      throw new Error('--config must be JSON');
+    }
+  }
+
+  return {
+    url,
+    clients,
+    games: number('--games', 1, 1, 1000),
+    rampMs: number('--ramp', 10, 0, 3600, false) * 1000,
+    timeoutMs: number('--timeout', 120, 1, 3600, false) * 1000,
+    config
+  };
+}
+
+async function main(args: string[]): Promise<void> {
+  let options: LoadTestOptions;
+  try {
+    options = parseLoadTestArgs(args);
+  } catch (error) {
+    console.error((error as Error).message);
+    console.error('Usage: node loadtest.cjs <ws://host:port> [--clients N] [--games N] [--ramp S] [--timeout S] [--config JSON] [--json]');
+    process.exit(2);
+  }
+
+  const report = await loadTest(options);
+  console.log(args.includes('--json') ? JSON.stringify(report, null, 2) : describeLoadTest(report));
+  process.exit(report.failedGames > 0 ? 1 : 0);
+}
+
+if (require.main === module) {
+  main(process.argv.slice(2));
+}
+
+export { loadTest, describeLoadTest, parseLoadTestArgs };
+export type { LoadTestOptions, LoadTestReport, LatencySummary };
@@ -0,0 +1,160 @@
+// Moderation queue: things a moderator should look at, raised by the server or by players.
+//
+//   collusion     accounts that look to be trading wins (see collusion.cts)
+//   accuracy      a player whose shots found tanks far more often than the public state of
+//                 the game explains, as seeing the hidden board would (see analysis.cts)
+//   chatReport    a chat message a player reported, with the messages before it
+//   playerReport  an opponent a player reported, for one of REPORT_CATEGORIES, with where
+//                 the game stood and its chat
+//
+// A moderator may take a flag on, so others leave it be, then resolves it. Flags stay in
+// memory for the staff API and, when a file is given (TANKS_MODERATION_QUEUE), are also
+// appended to it as one JSON object per line and read back on startup; a flag written
+// again as it is assigned or resolved replaces the earlier line.
+
+import * as fs from 'fs';
+import { ErrorCode, GameError } from './errors.cjs';
+
+const MAX_FLAGS = 5000; // Flags kept in memory; the file keeps everything
+const MAX_PAGE_SIZE = 200;
+const FLAG_STATUSES: FlagStatus[] = ['open', 'dismissed', 'actioned'];
+const REPORT_CATEGORIES: ReportCategory[] = ['cheating', 'abuse', 'stalling', 'unsportsmanlike', 'other'];
+
+type FlagStatus = 'open' | 'dismissed' | 'actioned';
+type ReportCategory = 'cheating' | 'abuse' | 'stalling' | 'unsportsmanlike' | 'other';
+
+// A chat message as it was sent in a game
+interface ChatLine {
+  id: number;  // Counts up from 1 within the game
+  playerId: number;
+  playerName: string;
+  text: string;      // A quick-chat phrase in English
+  phrase?: string;   // The quick-chat phrase's key, if it was one
+  timestamp: number;
+}
+
+interface ModerationFlag {
+  seq: number;
+  raisedAt: string;
+  kind: string;                 // What raised it, e.g. 'collusion'
+  key: string;                  // The same evidence raises one flag, however often it is found
+  accounts: { userId: string; name: string | null }[];  // Signed-in players it is about
+  gameIds: string[];
+  reason: string;
+  reportedBy?: string;          // The player who raised it, if one did
+  category?: ReportCategory;    // Player reports: what for
+  comment?: string;             // Player reports: the reporter's own words
+  context?: { phase: string; moveCount: number; players: { id: number; name: string; userId: string | null }[] };  // The game when it was raised
+  chat?: ChatLine[];            // Chat reports: the reported message last, after those before it; player reports: the game's
+  status: FlagStatus;
+  assignedTo?: string;          // The moderator who took it on, while open
+  assignedAt?: string;
+  resolvedBy?: string;
+  resolvedAt?: string;
+  note?: string;
+}
+
+interface FlagQuery {
+  status?: string;
+  kind?: string;
+  userId?: string;
+  assignedTo?: string;
+  limit?: number;
+}
+
+class ModerationQueue {
+  private flags: ModerationFlag[] = [];
+  private file: string | undefined;
+
+  constructor(file?: string) {
+    this.file = file || undefined;
+    if (!this.file || !fs.existsSync(this.file)) return;
+
+    const bySeq: Map<number, ModerationFlag> = new Map();
+    fs.readFileSync(this.file, 'utf-8').split('\n').forEach(line => {
+      if (!line.trim()) return;
+      try {
+        const flag: ModerationFlag = JSON.parse(line);
+        bySeq.set(flag.seq, flag);
+      } catch {
+        console.error(`Skipping unreadable moderation queue line in ${this.file}`);
+      }
+    });
+    this.flags = [...bySeq.values()].sort((a, b) => a.seq - b.seq).slice(-MAX_FLAGS);
+  }
+
+  // Add a flag unless one was already raised for the same evidence; returns it if added
+  raise(flag: Omit<ModerationFlag, 'seq' | 'raisedAt' | 'status'>): ModerationFlag | null {
+    if (this.flags.some(existing => existing.kind === flag.kind && existing.key === flag.key)) return null;
+    const last = this.flags[this.flags.length - 1];
+    const raised: ModerationFlag = { seq: (last?.seq ?? 0) + 1, raisedAt: new Date().toISOString(), ...flag, status: 'open' };
+    this.flags.push(raised);
+    if (this.flags.length > MAX_FLAGS) this.flags.shift();
+
+    console.log(`Moderation: flag ${raised.seq} (${raised.kind}) ${raised.reason}`);
+    this.append(raised);
+    return raised;
+  }
+
+  get(seq: number): ModerationFlag {
+    const flag = this.flags.find(candidate => candidate.seq === seq);
+    if (!flag) {
+      throw new GameError(ErrorCode.NOT_FOUND, 'No such flag', { seq });
+    }
+    return flag;
+  }
+
+  // Give an open flag to a moderator, or back to nobody with null
+  assign(seq: number, assignee: string | null): ModerationFlag {
+    const flag = this.get(seq);
+    if (flag.status !== 'open') {
+      throw new GameError(ErrorCode.WRONG_PHASE, 'The flag has already been resolved', { seq, status: flag.status });
+    }
+    Object.assign(flag, { assignedTo: assignee ?? undefined, assignedAt: assignee === null ? undefined : new Date().toISOString() });
+    this.append(flag);
+    return flag;
+  }
+
+  // Close a flag as dismissed or actioned
+  resolve(seq: number, status: unknown, actor: string, note?: string): ModerationFlag {
+    if (status !== 'dismissed' && status !== 'actioned') {
+      throw new GameError(ErrorCode.VALIDATION_FAILED, 'Invalid resolution', undefined, [
+        { field: 'status', reason: "must be 'dismissed' or 'actioned'" }
+      ]);
+    }
+    const flag = this.get(seq);
+    Object.assign(flag, { status, resolvedBy: actor, resolvedAt: new Date().toISOString(), note });
+    this.append(flag);
+    return flag;
+  }
+
+  // Matching flags, newest first
+  query(query: FlagQuery = {}): ModerationFlag[] {
+    if (query.status !== undefined && !FLAG_STATUSES.includes(query.status as FlagStatus)) {
+      throw new GameError(ErrorCode.VALIDATION_FAILED, 'Invalid filter', undefined, [
+        { field: 'status', reason: `must be one of ${FLAG_STATUSES.join(', ')}` }
+      ]);
+    }
+    const limit = Math.min(Math.max(Number(query.limit) || 50, 1), MAX_PAGE_SIZE);
+    return this.flags
+      .filter(flag => (!query.status || flag.status === query.status) &&
+        (!query.kind || flag.kind === query.kind) &&
+        (!query.userId || flag.accounts.some(account => account.userId === query.userId)) &&
+        (!query.assignedTo || flag.assignedTo === query.assignedTo))
+      .reverse()
+      .slice(0, limit);
+  }
+
+  private append(flag: ModerationFlag): void {
+    if (!this.file) return;
+    try {
+      fs.appendFileSync(this.file, `${JSON.stringify(flag)}\n`);
+    } catch (error) {
+      // Still in memory for this run; the next run finds the evidence and raises it again
+      console.error('Failed to append to the moderation queue:', error);
+    }
+  }
+}
+
+export { ModerationQueue, FLAG_STATUSES, REPORT_CATEGORIES };
+export type { ModerationFlag, FlagStatus, FlagQuery, ChatLine, ReportCategory };
@@ -0,0 +1,151 @@
+// Capability negotiation for WebSocket clients. A client may open with a hello naming the
+// protocol versions, codecs and game variants it understands; the server answers with a
+// welcome holding the newest version and the first codec both sides support, and from
+// then on sends that client only messages its version has and keeps it out of games it
+// could not show. Clients that never say hello are taken to speak version 1, as every
+// client did before negotiation, with every variant.
+//
+// A client that names the rules version it was built for (RULES_VERSION in game.cts) is
+// refused unless the server plays the same rules, with a hint saying which side is out
+// of date; until a hello with matching rules, the connection may look at the lobby but
+// join, watch or play nothing, rather than show a game under rules it no longer follows.
+// REST and gRPC clients name their rules when they create a session (see api.cts), and get
+// the same refusal.
+//
+//   -> { type: 'hello', protocolVersions: [1, 2], rulesVersion: 1, codecs: ['msgpack', 'json'], variants: ['abilities', 'timers'] }
+//   <- { type: 'welcome', protocolVersion: 2, rulesVersion: 1, codec: 'msgpack', variants: ['abilities', 'timers'], ... }
+//
+// The welcome goes out in the codec the connection opened with; the chosen codec applies,
+// both ways, to every message after it.
+
+import { ErrorCode, GameError } from './errors.cjs';
+import { Rules, RULES_VERSION, type GameConfig } from './game.cjs';
+import { CODECS, type Codec } from './codec.cjs';
+import type { FeatureFlag } from './flags.cjs';
+
+const PROTOCOL_VERSION = 2;
+const MIN_PROTOCOL_VERSION = 1;
+
+// Messages added after version 1, by the version that brought them in. Anything not
+// listed has been in the protocol from the start.
+const MESSAGES_SINCE: Record<string, number> = {
+  playerReconnected: 2,
+  commentary: 2
+};
+
+// Parts of the game a client might not be able to show. A game that uses one is closed
+// to clients that leave it out of their hello.
+type Variant = 'multiCellTanks' | 'abilities' | 'timers' | 'tankMovement' | 'settingsNegotiation' | 'limits';
+
+const VARIANTS: Variant[] = ['multiCellTanks', 'abilities', 'timers', 'tankMovement', 'settingsNegotiation', 'limits'];
+
+interface Capabilities {
+  protocolVersion: number;
+  codec: Codec;
+  variants: Set<Variant>;
+}
+
+interface Hello {
+  protocolVersions?: unknown;
+  rulesVersion?: unknown;
+  codecs?: unknown;
+  variants?: unknown;
+}
+
+// What a connection is held to before it says hello, or if it never does
+function legacyCapabilities(codec: Codec): Capabilities {
+  return { protocolVersion: MIN_PROTOCOL_VERSION, codec, variants: new Set(VARIANTS) };
+}
+
+// Settle on what both sides support. An offer the server can't meet at all is an error;
+// unknown codecs and variants are ignored, and a hello that leaves a list out keeps what
+// the connection already has.
+function negotiate(hello: Hello, current: Capabilities): Capabilities {
+  const strings = (value: unknown, field: string): string[] | null => {
+    if (value === undefined) return null;
+    if (!Array.isArray(value) || !value.every(item => typeof item === 'string')) {
+      throw new GameError(ErrorCode.VALIDATION_FAILED, 'Invalid hello', undefined, [{ field, reason: 'must be a list of strings' }]);
+    }
+    return value;
+  };
+
+  let protocolVersion = current.protocolVersion;
+  if (hello.protocolVersions !== undefined) {
+    const offered = hello.protocolVersions;
+    if (!Array.isArray(offered) || !offered.every(Number.isInteger)) {
+      throw new GameError(ErrorCode.VALIDATION_FAILED, 'Invalid hello', undefined, [
+        { field: 'protocolVersions', reason: 'must be a list of whole numbers' }
+      ]);
+    }
+    const shared = offered.filter(version => version >= MIN_PROTOCOL_VERSION && version <= PROTOCOL_VERSION);
+    if (shared.length === 0) {
+      throw new GameError(ErrorCode.INCOMPATIBLE_CLIENT, 'None of the offered protocol versions is supported', {
+        supported: { min: MIN_PROTOCOL_VERSION, max: PROTOCOL_VERSION }
+      });
+    }
+    protocolVersion = Math.max(...shared);
+  }
+
+  if (hello.rulesVersion !== undefined) {
+    if (!Number.isInteger(hello.rulesVersion)) {
+      throw new GameError(ErrorCode.VALIDATION_FAILED, 'Invalid hello', undefined, [{ field: 'rulesVersion', reason: 'must be a whole number' }]);
+    }
+    if (hello.rulesVersion !== RULES_VERSION) {
+      const older = (hello.rulesVersion as number) < RULES_VERSION;
+      throw new GameError(ErrorCode.INCOMPATIBLE_RULES, `Your client plays rules version ${hello.rulesVersion}, but this server plays version ${RULES_VERSION}`, {
+        rulesVersion: hello.rulesVersion,
+        supported: { min: RULES_VERSION, max: RULES_VERSION },
+        hint: older ? 'Reload the page or update your client to the latest release' : 'This server has not been updated yet; try again later'
+      });
+    }
+  }
+
+  const codecs = strings(hello.codecs, 'codecs');
+  const codec = codecs === null
+    ? current.codec
+    : codecs.map(name => CODECS.find(c => c.name === name)).find(c => c !== undefined) ?? current.codec;
+
+  const variants = strings(hello.variants, 'variants');
+  return {
+    protocolVersion,
+    codec,
+    variants: variants === null ? current.variants : new Set(VARIANTS.filter(variant => variants.includes(variant)))
+  };
+}
+
+// Whether a client on `capabilities` knows this message
+function understands(capabilities: Capabilities, message: { type: string }): boolean {
+  return (MESSAGES_SINCE[message.type] ?? MIN_PROTOCOL_VERSION) <= capabilities.protocolVersion;
+}
+
+// The variants a game with these settings and features plays
+function gameVariants(config: GameConfig, features: Record<FeatureFlag, boolean>): Variant[] {
+  const used: Record<Variant, boolean> = {
+    multiCellTanks: Array.from({ length: config.tanksPerPlayer }, (_, i) => Rules.tankLength(config, i)).some(length => length > 1),
+    abilities: config.airstrikes + config.clusterBombs + config.scans > 0,
+    timers: config.turnTimeSeconds > 0 || config.gameTimeSeconds > 0,
+    tankMovement: features.tankMovement,
+    settingsNegotiation: features.settingsNegotiation,
+    limits: config.maxTurns > 0 || config.shotBudget > 0
+  };
+  return VARIANTS.filter(variant => used[variant]);
+}
+
+// Refuse a game that plays a variant the client can't show
+function requireVariants(
+  capabilities: Capabilities,
+  config: GameConfig,
+  features: Record<FeatureFlag, boolean>,
+  whose: string = 'your client'
+): void {
+  const missing = gameVariants(config, features).filter(variant => !capabilities.variants.has(variant));
+  if (missing.length > 0) {
+    throw new GameError(ErrorCode.INCOMPATIBLE_CLIENT, `This game uses ${missing.join(', ')}, which ${whose} does not support`, { missing });
+  }
+}
+
+export {
+  PROTOCOL_VERSION, MIN_PROTOCOL_VERSION, MESSAGES_SINCE, VARIANTS,
+  legacyCapabilities, negotiate, understands, gameVariants, requireVariants
+};
+export type { Capabilities, Hello, Variant };
@@ -0,0 +1,44 @@
+// Elo ratings for signed-in players. Every account starts at DEFAULT_RATING, and a game
+// between two signed-in players moves the winner up and the loser down: a long way when
+// the lower-rated player wins, a little when the favourite does. Guests and the computer
+// are not rated, so games against them leave ratings alone.
+//
+// A new account's first PLACEMENT_MATCHES rated games are placement matches: they move its
+// rating much further than later games, so it finds its level within a few games, but it
+// stays off the leaderboard until they are played, and an established opponent's rating
+// is left alone, so an unsettled account cannot move the ladder.
+
+const DEFAULT_RATING = 1200;
+const K_FACTOR = 32;                 // Furthest one game can move an established rating
+const PLACEMENT_K_FACTOR = 96;       // Used for placement matches
+const PLACEMENT_MATCHES = 5;
+const PROVISIONAL_K_FACTOR = 48;     // Used for the games after them, so new players settle sooner
+const PROVISIONAL_GAMES = 10;
+const MAX_RATING_GAP = 1000;         // Widest gap a player can ask quick match to keep within
+
+// The chance the first player beats the second, going by their ratings
+function expectedScore(rating: number, opponentRating: number): number {
+  return 1 / (1 + Math.pow(10, (opponentRating - rating) / 400));
+}
+
+// Whether a player with this many rated games behind them is still playing placement matches
+function inPlacement(ratedGames: number): boolean {
+  return ratedGames < PLACEMENT_MATCHES;
+}
+
+// New ratings after `winner` beats `loser`; each side's K depends on how many rated games it has played
+function rateGame(
+  winner: { rating: number; ratedGames: number },
+  loser: { rating: number; ratedGames: number }
+): { winner: number; loser: number } {
+  const kFor = (ratedGames: number) => inPlacement(ratedGames) ? PLACEMENT_K_FACTOR : ratedGames < PROVISIONAL_GAMES ? PROVISIONAL_K_FACTOR : K_FACTOR;
+  // An established rating does not move for a game against a player still being placed
+  const moves = (side: { ratedGames: number }, other: { ratedGames: number }) => inPlacement(side.ratedGames) || !inPlacement(other.ratedGames);
+  const expected = expectedScore(winner.rating, loser.rating);
+  return {
+    winner: moves(winner, loser) ? Math.round(winner.rating + kFor(winner.ratedGames) * (1 - expected)) : winner.rating,
+    loser: moves(loser, winner) ? Math.round(loser.rating - kFor(loser.ratedGames) * (1 - expected)) : loser.rating
+  };
+}
+
+export { DEFAULT_RATING, K_FACTOR, PLACEMENT_MATCHES, MAX_RATING_GAP, expectedScore, inPlacement, rateGame };
@@ -0,0 +1,142 @@
+// Elo ratings, and quick match keeping to the rating gap players ask for: who is paired,
+// who waits, and the queue put back as it was when a match cannot be made. Run with
+// `npm test`.
+
+import { describe, it, beforeEach, afterEach, mock } from 'node:test';
+import * as assert from 'assert';
+import { WebSocket } from 'ws';
+import { DEFAULT_RATING, PLACEMENT_MATCHES, expectedScore, inPlacement, rateGame } from './rating.cjs';
+import { GameManager } from './server.cjs';
+import { Accounts } from './accounts.cjs';
+import { FeatureFlags } from './flags.cjs';
+import { MemoryStore } from './store.cjs';
+import { DEFAULT_CONFIG } from './game.cjs';
+import { ErrorCode } from './errors.cjs';
+
+// Stands in for a client's socket, keeping what it is sent
+class FakeSocket {
+  readyState: number = WebSocket.OPEN;
+  protocol: string = '';
+  sent: any[] = [];
+
+  send(data: string): void {
+    this.sent.push(JSON.parse(data));
+  }
+
+  close(): void {
+    this.readyState = WebSocket.CLOSED;
+  }
+
+  last(type: string): any {
+    return this.sent.filter(message => message.type === type).pop();
+  }
+}
+
+describe('rateGame', () => {
+  const established = (rating: number) => ({ rating, ratedGames: 20 });
+
+  it('takes from the loser what it gives the winner', () => {
+    assert.deepStrictEqual(rateGame(established(1200), established(1200)), { winner: 1216, loser: 1184 });
+    assert.strictEqual(expectedScore(1400, 1000) + expectedScore(1000, 1400), 1);
+  });
+
+  it('moves ratings further for an upset than for the favourite winning', () => {
+    const upset = rateGame(established(1000), established(1400));
+    const expected = rateGame(established(1400), established(1000));
+    assert.ok(upset.winner - 1000 > expected.winner - 1400);
+    assert.strictEqual(upset.winner - 1000, 1400 - upset.loser);
+  });
+
+  it('moves placement matches furthest, then provisional games', () => {
+    const placing = rateGame({ rating: 1200, ratedGames: 0 }, { rating: 1200, ratedGames: 0 });
+    const provisional = rateGame({ rating: 1200, ratedGames: PLACEMENT_MATCHES }, { rating: 1200, ratedGames: PLACEMENT_MATCHES });
+    assert.deepStrictEqual(placing, { winner: 1248, loser: 1152 });
+    assert.deepStrictEqual(provisional, { winner: 1224, loser: 1176 });
+    assert.ok(inPlacement(PLACEMENT_MATCHES - 1) && !inPlacement(PLACEMENT_MATCHES));
+  });
+
+  it('leaves an established rating alone in a game against a player being placed', () => {
+    assert.strictEqual(rateGame({ rating: 1200, ratedGames: 0 }, established(1500)).loser, 1500);
+    assert.strictEqual(rateGame(established(1500), { rating: 1200, ratedGames: 0 }).winner, 1500);
+  });
+});
+
+describe('quickMatch', () => {
+  let accounts: Accounts;
+  let manager: GameManager;
+
+  beforeEach(() => {
+    mock.timers.enable({ apis: ['setInterval'] });  // The manager's clock tick
+    accounts = new Accounts();
+    manager = new GameManager(new FeatureFlags(), { ...DEFAULT_CONFIG, tankLengths: [2] }, new MemoryStore(), accounts);
+  });
+
+  afterEach(() => mock.timers.reset());
+
+  function connect(): FakeSocket {
+    const socket = new FakeSocket();
+    manager.addConnection(socket as unknown as WebSocket);
+    return socket;
+  }
+
+  // A connection signed in to a new account that has won `wins` placement matches
+  function signedIn(name: string, wins: number = 0): FakeSocket {
+    const socket = connect();
+    const { user, token } = accounts.register(name, 'correct horse');
+    const { user: sparring } = accounts.register(`${name}_x`, 'correct horse');
+    for (let i = 0; i < wins; i++) accounts.recordRatedGame(user.id, sparring.id);
+    manager.handleMessage(socket as unknown as WebSocket, { type: 'signIn', token });
+    return socket;
+  }
+
+  const match = (socket: FakeSocket, maxRatingGap?: number) => manager.quickMatch(socket as unknown as WebSocket, undefined, maxRatingGap);
+
+  it('pairs the first two players to ask', () => {
+    const [a, b] = [connect(), connect()];
+    assert.strictEqual(match(a), 1);
+    assert.strictEqual(match(b), 0);
+    assert.strictEqual(a.last('joined').gameId, b.last('joined').gameId);
+  });
+
+  it('keeps to the gap either player asked for', () => {
+    const strong = signedIn('strong', 3);
+    assert.ok(accounts.ratingOf(accounts.verify(strong.last('signedIn').token)!.id) > DEFAULT_RATING + 100);
+
+    assert.strictEqual(match(strong, 100), 1);
+    const guest = connect();
+    assert.strictEqual(match(guest), 2, 'outside the gap the waiting player asked for');
+    assert.strictEqual(match(connect(), 100), 0, 'paired with the guest, who set no gap');
+    assert.strictEqual(strong.last('joined'), undefined);
+
+    assert.strictEqual(match(signedIn('rival', 3), 100), 0);
+    assert.ok(strong.last('joined'));
+  });
+
+  it('refuses a gap out of range', () => {
+    [-1, 1.5, 5000].forEach(gap => assert.throws(() => match(connect(), gap), (error: any) => error.code === ErrorCode.VALIDATION_FAILED));
+  });
+
+  it('puts the waiting player back at the front when the room cannot be made', () => {
+    const waiting = connect();
+    match(waiting);
+    const legacy = connect();
+    manager.handleMessage(legacy as unknown as WebSocket, { type: 'hello', variants: [] });
+    assert.throws(() => match(legacy), (error: any) => error.code === ErrorCode.INCOMPATIBLE_CLIENT);
+
+    assert.strictEqual(match(connect()), 0);
+    assert.ok(waiting.last('joined'), 'still first in the queue');
+  });
+
+  it('drops a waiting player whose client cannot play the room, and queues the newcomer', () => {
+    const legacy = connect();
+    manager.handleMessage(legacy as unknown as WebSocket, { type: 'hello', variants: [] });
+    match(legacy);
+
+    const newcomer = connect();
+    assert.strictEqual(match(newcomer), 1);
+    assert.strictEqual(legacy.last('error').error.code, ErrorCode.INCOMPATIBLE_CLIENT);
+    assert.strictEqual(legacy.last('joined'), undefined);
+    assert.strictEqual(match(connect()), 0);
+    assert.ok(newcomer.last('joined'));
+  });
+});
@@ -0,0 +1,99 @@
+// Terminal rendering of boards for the command-line tools: boards side by side with
+// their columns and rows labelled (see coords.cts), the same symbols as the text export, and ANSI
+// colours unless the terminal cannot show them. Cells can be picked out, e.g. those the last
+// shot changed (see CellChange in game.cts), drawn reversed in colour and bracketed without.
+
+import { CellState, BOARD_TEXT_SYMBOLS, type Position } from './game.cjs';
+import { axisLabels, type CoordinateSystem } from './coords.cjs';
+
+const BOARD_GAP = '   ';
+
+const CELL_COLORS: Record<CellState, string> = {
+  [CellState.EMPTY]: '\x1b[2m',      // dim
+  [CellState.TANK]: '\x1b[32m',      // green
+  [CellState.HIT]: '\x1b[1;31m',     // bold red
+  [CellState.MISS]: '\x1b[36m',      // cyan
+  [CellState.REVEALED]: '\x1b[34m'   // blue
+};
+const RESET = '\x1b[0m';
+const HIGHLIGHT = '\x1b[7m';  // reverse video
+
+interface RenderedBoard {
+  title: string;
+  board: CellState[][];
+  highlight?: Position[];
+}
+
+interface RenderOptions {
+  color?: boolean;
+  coordinates?: CoordinateSystem;  // How the columns and rows are labelled; letters and numbers if unset
+}
+
+// Colour is on for a terminal unless --no-color is given or NO_COLOR is set (https://no-color.org)
+function useColor(args: string[], stream: NodeJS.WriteStream = process.stdout): boolean {
+  return !args.includes('--no-color') && !process.env.NO_COLOR && Boolean(stream.isTTY);
+}
+
+function paint(state: CellState, options: RenderOptions, highlighted: boolean = false): string {
+  return options.color
+    ? `${CELL_COLORS[state]}${highlighted ? HIGHLIGHT : ''}${BOARD_TEXT_SYMBOLS[state]}${RESET}`
+    : BOARD_TEXT_SYMBOLS[state];
+}
+
+function renderBoards(boards: RenderedBoard[], options: RenderOptions = {}): string {
+  if (boards.length === 0) return '';
+  const size = boards[0].board.length;
+  const labels = axisLabels(options.coordinates ?? 'letterNumber', size);
+  const labelWidth = Math.max(...labels.rows.map(label => label.length));
+  const cellWidth = Math.max(...labels.columns.map(label => label.length));
+  const boardWidth = labelWidth + 1 + size * (cellWidth + 1) - 1;
+  const columns = `${' '.repeat(labelWidth)} ${labels.columns.map(label => label.padStart(cellWidth)).join(' ')}`;
+
+  const lines = [
+    boards.map(({ title }) => title.slice(0, boardWidth).padEnd(boardWidth)).join(BOARD_GAP),
+    boards.map(() => columns).join(BOARD_GAP)
+  ];
+  for (let y = 0; y < size; y++) {
+    const rows = boards.map(({ board, highlight = [] }) => {
+      const highlighted = (x: number) => highlight.some(cell => cell.x === x && cell.y === y);
+      // Without colour a highlighted cell is bracketed, in the spaces either side of it
+      const before = (x: number) => {
+        if (options.color) return x < size ? ' ' : '';
+        const left = x > 0 && highlighted(x - 1);
+        const right = x < size && highlighted(x);
+        return left && right ? '|' : left ? ']' : right ? '[' : x < size ? ' ' : '';
+      };
+      const cells = board[y].map((state, x) => `${before(x)}${' '.repeat(cellWidth - 1)}${paint(state, options, highlighted(x))}`);
+      return `${labels.rows[y].padStart(labelWidth)}${cells.join('')}${before(size)}`;
+    });
+    // A bracket closing the last column sits in the gap before the next board
+    lines.push(rows.map((row, index) => index === rows.length - 1 ? row : `${row}${BOARD_GAP.slice(row.endsWith(']') ? 1 : 0)}`).join(''));
+  }
+  return lines.map(line => line.trimEnd()).join('\n');
+}
+
+function renderLegend(options: RenderOptions = {}): string {
+  const names: [CellState, string][] = [
+    [CellState.EMPTY, 'empty'],
+    [CellState.TANK, 'tank'],
+    [CellState.HIT, 'hit'],
+    [CellState.MISS, 'miss'],
+    [CellState.REVEALED, 'revealed']
+  ];
+  return names.map(([state, name]) => `${paint(state, options)} ${name}`).join('  ');
+}
+
+// The legend spelled out, one symbol a line, for players who have not seen the boards before
+function explainLegend(options: RenderOptions = {}): string {
+  const meanings: [CellState, string][] = [
+    [CellState.EMPTY, 'nothing known: not bombed, and no blast has uncovered it'],
+    [CellState.TANK, 'a tank: one of yours, or an enemy tank a blast has uncovered'],
+    [CellState.HIT, 'a tank cell that has been bombed'],
+    [CellState.MISS, 'bombed, and nothing was there'],
+    [CellState.REVEALED, 'uncovered by a blast and empty; on your own board, a cell the enemy can now see']
+  ];
+  return meanings.map(([state, meaning]) => `  ${paint(state, options)}  ${meaning}`).join('\n');
+}
+
+export { renderBoards, renderLegend, explainLegend, useColor };
+export type { RenderedBoard, RenderOptions };
@@ -0,0 +1,219 @@
+// Rebuild a finished or saved game from its move log, one action at a time.
+// Every entry is applied through GameManager itself, so a replay follows exactly
+// the rules the game was played under and rejects a log that could not have happened.
+// The cells each entry changed are picked out on the boards printed after it, with a line
+// of commentary (see commentary.cts), and once the game is over both fleets are shown
+// again where they were placed.
+//
+//   node replay.cjs [--no-color] <file-or-game-id>
+//
+// The file may be a game summary (getGameSummary / GET /api/games/{id}/summary) or a
+// saved snapshot (GET /api/games/{id}/snapshot, a file from the save directory, or a
+// gzipped one from the retention archive). A game id is looked up in the server's
+// storage and then the archive (see resolve.cts).
+
+import { WebSocket } from 'ws';
+import { GameManager, GamePhase } from './server.cjs';
+import { Rules, type CellState, type GameConfig, type MoveLogEntry, type Position, type Tank } from './game.cjs';
+import { renderBoards, renderLegend, useColor } from './render.cjs';
+import { formatCell, type CoordinateSystem } from './coords.cjs';
+import { MemoryStore } from './store.cjs';
+import { resolveGame, type GameRecord } from './resolve.cjs';
+
+interface ReplayStep {
+  entry: MoveLogEntry;
+  boards: [CellState[][], CellState[][]]; // Each player's own board after the entry
+  changed: [Position[], Position[]];       // The cells of each that it changed
+  placed?: [Position[], Position[]];       // On the entry that ends the game: the cells each fleet was placed on
+  logged?: MoveLogEntry;                    // What the replay logged for the entry, to check against it
+  commentary?: string;
+}
+
+// Where a replayed game ended up
+interface ReplayOutcome {
+  steps: ReplayStep[];
+  phase: GamePhase;
+  winner: number | null;
+  moveCount: number;
+  boards: [CellState[][], CellState[][]];  // Each player's board as the server keeps it, tanks and all
+}
+
+// Seats for the replayed players; nothing needs to be delivered to them
+class ReplaySeat {
+  readyState: number = WebSocket.OPEN;
+  protocol: string = '';
+  send(): void {}
+}
+
+interface ReplayOptions {
+  names?: string[];           // The players, as the commentary names them
+  gameManager?: GameManager;  // Replays of many games may share one in-memory server
+}
+
+function replayMoveLog(config: GameConfig, firstTurn: number, moveLog: MoveLogEntry[], names?: string[]): ReplayStep[] {
+  return replayGame(config, firstTurn, moveLog, { names }).steps;
+}
+
+function replayGame(config: GameConfig, firstTurn: number, moveLog: MoveLogEntry[], options: ReplayOptions = {}): ReplayOutcome {
+  const gameManager = options.gameManager ?? new GameManager(undefined, undefined, new MemoryStore());  // A replay never touches real saves
+  const names = [0, 1].map(i => options.names?.[i] || `Player ${i + 1}`);
+  const seats = [new ReplaySeat(), new ReplaySeat()] as unknown as WebSocket[];
+
+  // Pin the first move so a 'random' policy replays the way it was drawn. The log
+  // records every timeout, so the replay runs without a clock of its own.
+  const gameId = gameManager.createGame(undefined, {
+    ...config,
+    firstMove: firstTurn === 1 ? 'joiner' : 'creator',
+    turnTimeSeconds: 0,
+    gameTimeSeconds: 0
+  });
+  gameManager.joinGame(gameId, seats[0], names[0]);
+  gameManager.joinGame(gameId, seats[1], names[1]);
+  if (gameManager.getPhase(gameId) === GamePhase.SETUP) {
+    gameManager.acceptSettings(gameId, 1);
+  }
+
+  // Logs from before placements had to be confirmed count a full fleet as confirmed
+  const confirmsPlacement = moveLog.some(entry => entry.action === 'confirm');
+  const placed = [0, 0];
+
+  const steps: ReplayStep[] = [];
+  const commentary: Map<number, string> = new Map();  // By the seq the replay logged
+  const unsubscribe = gameManager.events.subscribe('replay', event => {
+    if (event.type === 'commentary' && event.gameId === gameId) commentary.set(event.seq, event.text);
+  });
+  try {
+    moveLog.forEach(entry => {
+      const loggedBefore = gameManager.getSnapshot(gameId).game.moveLog.length;
+      try {
+        switch (entry.action) {
+          case 'place':
+            gameManager.placeTank(gameId, entry.playerId, entry.x!, entry.y!, entry.orientation);
+            if (++placed[entry.playerId] === config.tanksPerPlayer && !confirmsPlacement) {
+              gameManager.confirmPlacement(gameId, entry.playerId);
+            }
+            break;
+          case 'remove':
+            gameManager.removeTank(gameId, entry.playerId, entry.x!, entry.y!);
+            placed[entry.playerId]--;
+            break;
+          case 'confirm':
+            gameManager.confirmPlacement(gameId, entry.playerId);
+            break;
+          case 'move':
+            gameManager.moveTank(gameId, entry.playerId, entry.x!, entry.y!, entry.toX!, entry.toY!);
+            break;
+          case 'bomb':
+            gameManager.bomb(gameId, entry.playerId, entry.x!, entry.y!);
+            break;
+          case 'ability':
+            gameManager.useAbility(gameId, entry.playerId, entry.ability!, entry.x!, entry.y!, entry.direction);
+            break;
+          case 'timeout':
+            gameManager.expireTurn(gameId, entry.timeoutAction!);
+            break;
+          default:
+            throw new Error(`unknown action ${(entry as any).action}`);
+        }
+      } catch (error) {
+        throw new Error(`Move log entry ${entry.seq} cannot be replayed: ${(error as Error).message}`);
+      }
+
+      const { players, moveLog: replayedLog } = gameManager.getSnapshot(gameId).game;
+      const seq = replayedLog.length;
+      const changed = [0, 1].map(owner => gameManager.getCellHistory(gameId, owner)
+        .filter(change => change.seq === seq && change.owner === owner && change.view === 'own')
+        .map(({ x, y }) => ({ x, y })));
+      const fleets = gameManager.getPhase(gameId) === GamePhase.GAME_OVER ? gameManager.getGameSummary(gameId).fleets : null;
+      const fleetCells = fleets?.map((fleet: { tanks: Tank[] }) => fleet.tanks.flatMap(tank => tank.cells));
+      // Old logs lack the confirmations a replay adds, so match by action
+      const logged = replayedLog.slice(loggedBefore).find((logged: MoveLogEntry) => logged.action === entry.action);
+      steps.push({
+        entry,
+        boards: [Rules.boardView(players[0]).myBoard, Rules.boardView(players[1]).myBoard],
+        changed: [changed[0], changed[1]],
+        ...(fleetCells && { placed: [fleetCells[0], fleetCells[1]] }),
+        logged,
+        commentary: logged && commentary.get(logged.seq)
+      });
+    });
+
+    const game = gameManager.getSnapshot(gameId).game;
+    return { steps, phase: game.phase, winner: game.winner, moveCount: game.moveCount, boards: [game.players[0].board, game.players[1].board] };
+  } finally {
+    unsubscribe();
+    gameManager.removePlayer(seats[0]);
+    gameManager.removePlayer(seats[1]);
+  }
+}
+
+function describeEntry(entry: MoveLogEntry, names: string[], coordinates: CoordinateSystem = 'letterNumber'): string {
+  const cell = (x: number, y: number) => formatCell(coordinates, x, y);
+  const who = names[entry.playerId] ?? `Player ${entry.playerId + 1}`;
+  switch (entry.action) {
+    case 'place':
+      return `${who} places a tank at ${cell(entry.x!, entry.y!)}${entry.orientation ? ` (${entry.orientation})` : ''}`;
+    case 'remove':
+      return `${who} takes back the tank at ${cell(entry.x!, entry.y!)}`;
+    case 'confirm':
+      return `${who} confirms their placement`;
+    case 'move':
+      return `${who} moves a tank from ${cell(entry.x!, entry.y!)} to ${cell(entry.toX!, entry.toY!)}`;
+    case 'bomb':
+      return `${who} bombs ${cell(entry.x!, entry.y!)}: ${entry.outcome}`;
+    case 'ability':
+      if (entry.ability === 'scan') return `${who} scans around ${cell(entry.x!, entry.y!)}: ${entry.found ? 'tanks found' : 'nothing'}`;
+      return `${who} ${entry.ability === 'airstrike' ? `calls an airstrike along the ${entry.direction} of` : 'drops a cluster bomb on'} ${cell(entry.x!, entry.y!)}: ${entry.outcome}`;
+    case 'timeout':
+      return `${who} runs out of time: ${entry.timeoutAction === 'forfeit' ? 'forfeits' : 'turn skipped'}`;
+  }
+}
+
+function main(args: string[]): void {
+  const identifier = args.find(arg => !arg.startsWith('--'));
+  if (!identifier) {
+    console.error('Usage: node replay.cjs [--no-color] <file-or-game-id>');
+    process.exit(2);
+  }
+  const color = useColor(args);
+
+  let game: GameRecord;
+  try {
+    game = resolveGame(identifier);
+  } catch (error) {
+    console.error((error as Error).message);
+    process.exit(2);
+  }
+  const names = game.names;
+  const steps = replayMoveLog(game.config, game.firstTurn, game.moveLog, names);
+
+  console.log(renderLegend({ color }));
+  console.log('');
+  const titles = [0, 1].map(i => names[i] ?? `Player ${i + 1}`);
+  steps.forEach(({ entry, boards, changed, placed, commentary }) => {
+    console.log(`#${entry.seq} [move ${entry.moveCount}] ${describeEntry(entry, names, game.config.coordinates)}`);
+    if (commentary) console.log(`  "${commentary}"`);
+    console.log(renderBoards([
+      { title: titles[0], board: boards[0], highlight: changed[0] },
+      { title: titles[1], board: boards[1], highlight: changed[1] }
+    ], { color }));
+    console.log('');
+    if (placed) {
+      console.log('The fleets as they were placed');
+      console.log(renderBoards([
+        { title: titles[0], board: boards[0], highlight: placed[0] },
+        { title: titles[1], board: boards[1], highlight: placed[1] }
+      ], { color }));
+      console.log('');
+    }
+  });
+  console.log(`${steps.length} entries replayed`);
+  process.exit(0);
+}
+
+if (require.main === module) {
+  main(process.argv.slice(2));
+}
+
+export { replayMoveLog, replayGame };
+export type { ReplayStep, ReplayOutcome, ReplayOptions };
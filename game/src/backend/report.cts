@@ -0,0 +1,57 @@
+// Report an opponent to a server's moderators from the command line, during a game or
+// after it. The seat's resume token, handed to each player as they join, says who is
+// reporting, so the report can be sent from anywhere without taking the seat back:
+//
+//   node report.cjs <http://host:port> <game-id> <resume-token> <category> [comment...]
+//
+// The category is one of cheating, abuse, stalling, unsportsmanlike or other; anything
+// after it is the comment. The server attaches where the game stands and its chat itself
+// (see moderation.cts), and takes one report per player per game. Exits 1 if the server
+// refuses the report.
+
+import { REPORT_CATEGORIES, type ReportCategory } from './moderation.cjs';
+
+const REQUEST_TIMEOUT_MS = 10 * 1000;
+const USAGE = `Usage: node report.cjs <http://host:port> <game-id> <resume-token> <${REPORT_CATEGORIES.join('|')}> [comment...]`;
+
+async function sendReport(server: string, gameId: string, resumeToken: string, category: ReportCategory, comment?: string): Promise<{ status: number; body: any }> {
+  const url = new URL(`/api/games/${encodeURIComponent(gameId)}/report`, server);
+  const response = await fetch(url, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ resumeToken, category, comment }),
+    signal: AbortSignal.timeout(REQUEST_TIMEOUT_MS)
+  });
+  return { status: response.status, body: await response.json().catch(() => null) };
+}
+
+async function main(args: string[]): Promise<void> {
+  const [server, gameId, resumeToken, category, ...words] = args;
+  if (!category || !/^https?:\/\//.test(server)) {
+    console.error(USAGE);
+    process.exit(2);
+  }
+  if (!REPORT_CATEGORIES.includes(category as ReportCategory)) {
+    console.error(`The category must be one of ${REPORT_CATEGORIES.join(', ')}`);
+    process.exit(2);
+  }
+
+  try {
+    const comment = words.join(' ').trim() || undefined;
+    const { status, body } = await sendReport(server, gameId, resumeToken, category as ReportCategory, comment);
+    if (body?.success) {
+      console.log(`Reported your opponent in game ${body.gameId} for ${category}; the moderators will take it from here`);
+      process.exit(0);
+    }
+    console.error(`The server refused the report (${status}): ${body?.error?.message ?? 'no reason given'}`);
+  } catch (error) {
+    console.error(`Could not reach ${server}: ${(error as Error).message}`);
+  }
+  process.exit(1);
+}
+
+if (require.main === module) {
+  main(process.argv.slice(2));
+}
+
+export { sendReport };
@@ -0,0 +1,116 @@
+// Find a game from whatever names it, so every tool that reads games takes the same
+// things: a game summary or snapshot file, gzipped or not (see replay.cts for where each
+// comes from), or the id of a saved game, looked up first in the storage the server uses
+// (TANKS_STORAGE, see store.cts) and then among the retention archive's copies
+// (TANKS_ARCHIVE_DIR, see archive.cts), newest first. Whichever it was, the game comes
+// back as one GameRecord holding what the record says about how it went.
+//
+//   node resolve.cjs <file-or-game-id> [--json]
+//
+// prints where the game was found and what it holds.
+
+import * as fs from 'fs';
+import * as zlib from 'zlib';
+import { GamePhase, Utils } from './server.cjs';
+import { openStorage, type Store } from './store.cjs';
+import { GameArchive } from './archive.cjs';
+import type { CellState, GameConfig, MoveLogEntry } from './game.cjs';
+import type { SignedResult } from './results.cjs';
+
+interface GameRecord {
+  source: string;                      // Where it was found, for messages
+  id: string | null;
+  names: string[];
+  userIds: (string | null)[];          // Accounts the players were signed in with
+  config: GameConfig;
+  firstTurn: number;                   // Who moved first in battle
+  moveLog: MoveLogEntry[];
+  phase: GamePhase;                    // Summaries are only made of finished games
+  winner: number | null;
+  moveCount: number;
+  boards: CellState[][][] | null;      // Each player's own board, from snapshots only
+  signedResult: SignedResult | null;
+}
+
+interface ResolveOptions {
+  store?: Store;        // Default: the server's storage
+  archiveDir?: string;  // Default: TANKS_ARCHIVE_DIR, or ./archive
+}
+
+// A game record from a parsed summary or snapshot
+function toGameRecord(data: any, source: string): GameRecord {
+  const game = data?.game ?? data;  // Snapshots wrap the game; summaries are the game record itself
+  if (!game?.config || !Array.isArray(game.moveLog)) {
+    throw new Error(`${source} is not a game summary or snapshot`);
+  }
+  const players: any[] = Array.isArray(game.players) ? game.players : [];
+  const signed: SignedResult | null = game.signedResult ?? game.result ?? null;  // Summaries carry it by that name, snapshots as the result
+  return {
+    source,
+    id: game.id ?? game.gameId ?? null,
+    names: players.map(player => player?.name),
+    userIds: players.map((player, index) => player?.userId ?? signed?.result.players[index]?.userId ?? null),
+    config: game.config,
+    firstTurn: game.firstTurn?.playerId ?? 0,
+    moveLog: game.moveLog,
+    phase: game.phase ?? GamePhase.GAME_OVER,
+    winner: game.winner ?? null,
+    moveCount: game.moveCount ?? 0,
+    boards: players.length > 0 && players.every(player => Array.isArray(player?.board)) ? players.map(player => player.board) : null,
+    signedResult: signed
+  };
+}
+
+function readGameFile(file: string): GameRecord {
+  const raw = fs.readFileSync(file);
+  return toGameRecord(JSON.parse((file.endsWith('.gz') ? zlib.gunzipSync(raw) : raw).toString('utf-8')), file);
+}
+
+function resolveGame(identifier: string, options: ResolveOptions = {}): GameRecord {
+  if (fs.existsSync(identifier) && fs.statSync(identifier).isFile()) {
+    return readGameFile(identifier);
+  }
+  if (!Utils.validateRoomId(identifier)) {
+    throw new Error(`${identifier} is neither a file nor a game id`);
+  }
+
+  const gameId = identifier.toUpperCase();
+  const store = options.store ?? openStorage().store;
+  const snapshot = store.load(gameId);
+  if (snapshot) return toGameRecord(snapshot, `saved game ${gameId}`);
+
+  const archived = new GameArchive(options.archiveDir).find(gameId);
+  if (archived) return readGameFile(archived);
+  throw new Error(`No saved or archived game ${gameId}`);
+}
+
+function main(args: string[]): void {
+  const identifier = args.find(arg => !arg.startsWith('--'));
+  if (!identifier) {
+    console.error('Usage: node resolve.cjs <file-or-game-id> [--json]');
+    process.exit(2);
+  }
+
+  let record: GameRecord;
+  try {
+    record = resolveGame(identifier);
+  } catch (error) {
+    console.error((error as Error).message);
+    process.exit(1);
+  }
+  if (args.includes('--json')) {
+    console.log(JSON.stringify(record, null, 2));
+    process.exit(0);
+  }
+  const names = record.names.map((name, i) => name ?? `Player ${i + 1}`).join(' vs ');
+  const outcome = record.winner !== null ? `won by ${record.names[record.winner] ?? `Player ${record.winner + 1}`}` : record.phase;
+  console.log(`${record.id ?? 'Game'} from ${record.source}: ${names}, ${outcome} after ${record.moveCount} moves, ${record.moveLog.length} log entries`);
+  process.exit(0);
+}
+
+if (require.main === module) {
+  main(process.argv.slice(2));
+}
+
+export { resolveGame, readGameFile, toGameRecord };
+export type { GameRecord, ResolveOptions };
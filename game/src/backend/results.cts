@@ -0,0 +1,126 @@
+// Signed results, so ladders and tournament organisers can check that a result came from
+// this server and was not edited on the way. When a game ends the server signs who played,
+// who won and why, and a hash of the final state, with its Ed25519 key. The signature covers
+// the result as canonical JSON: keys sorted, no whitespace.
+//
+//   TANKS_RESULT_KEY_FILE  PEM file with the server's Ed25519 private key. Unset, a new key is
+//                          made at startup, and results signed before a restart can no longer
+//                          be checked against the key the server publishes.
+//
+// The public key is served at GET /api/results/key. To check a result by hand:
+//
+//   node results.cjs <summary-or-result.json> <public-key.pem>
+
+import * as fs from 'fs';
+import * as crypto from 'crypto';
+import type { CellState, MoveLogEntry } from './game.cjs';
+
+const RESULT_ALGORITHM = 'Ed25519';
+
+interface GameResult {
+  gameId: string;
+  players: { id: number; name: string; userId: string | null }[];
+  winner: number;
+  reason: 'destroyed' | 'timeout' | 'abandoned' | 'limit' | 'resigned';  // Abandoned: a dropped player did not reconnect in time; limit: maxTurns or shotBudget
+  moveCount: number;
+  finishedAt: string;
+  stateHash: string;  // SHA-256 of the final boards and move log
+}
+
+interface SignedResult {
+  result: GameResult;
+  keyId: string;
+  algorithm: string;
+  signature: string;  // base64
+}
+
+// JSON with object keys sorted at every level, so signer and verifier hash the same bytes
+function canonicalJson(value: unknown): string {
+  if (Array.isArray(value)) return `[${value.map(canonicalJson).join(',')}]`;
+  if (value && typeof value === 'object') {
+    return `{${Object.keys(value).sort().map(key => `${JSON.stringify(key)}:${canonicalJson((value as any)[key])}`).join(',')}}`;
+  }
+  return JSON.stringify(value);
+}
+
+// The stateHash of a game that ended with these boards and this move log
+function stateHashOf(boards: CellState[][][], moveLog: MoveLogEntry[]): string {
+  return crypto.createHash('sha256').update(JSON.stringify({ boards, moveLog })).digest('hex');
+}
+
+// First 16 hex digits of the SHA-256 of the public key, naming which key signed a result
+function keyIdOf(publicKey: crypto.KeyObject): string {
+  return crypto.createHash('sha256').update(publicKey.export({ type: 'spki', format: 'der' })).digest('hex').slice(0, 16);
+}
+
+class ResultSigner {
+  private privateKey: crypto.KeyObject;
+  private publicKey: crypto.KeyObject;
+  readonly keyId: string;
+
+  constructor(keyFile?: string) {
+    if (keyFile) {
+      this.privateKey = crypto.createPrivateKey(fs.readFileSync(keyFile, 'utf-8'));
+      if (this.privateKey.asymmetricKeyType !== 'ed25519') {
+        throw new Error(`${keyFile} must hold an Ed25519 private key`);
+      }
+    } else {
+      this.privateKey = crypto.generateKeyPairSync('ed25519').privateKey;
+    }
+    this.publicKey = crypto.createPublicKey(this.privateKey);
+    this.keyId = keyIdOf(this.publicKey);
+  }
+
+  sign(result: GameResult): SignedResult {
+    const signature = crypto.sign(null, Buffer.from(canonicalJson(result)), this.privateKey).toString('base64');
+    return { result, keyId: this.keyId, algorithm: RESULT_ALGORITHM, signature };
+  }
+
+  publicKeyPem(): string {
+    return this.publicKey.export({ type: 'spki', format: 'pem' }).toString();
+  }
+}
+
+function verifyResult(signed: SignedResult, publicKeyPem: string): boolean {
+  if (!signed?.result || typeof signed.signature !== 'string' || signed.algorithm !== RESULT_ALGORITHM) return false;
+  try {
+    const publicKey = crypto.createPublicKey(publicKeyPem);
+    return crypto.verify(null, Buffer.from(canonicalJson(signed.result)), publicKey, Buffer.from(signed.signature, 'base64'));
+  } catch {
+    return false;
+  }
+}
+
+function main(args: string[]): void {
+  const [file, keyFile] = args;
+  if (!file || !keyFile) {
+    console.error('Usage: node results.cjs <summary-or-result.json> <public-key.pem>');
+    process.exit(2);
+  }
+
+  let signed: SignedResult;
+  let publicKeyPem: string;
+  try {
+    const data = JSON.parse(fs.readFileSync(file, 'utf-8'));
+    signed = data.signedResult ?? data;  // A game summary carries the signed result
+    publicKeyPem = fs.readFileSync(keyFile, 'utf-8');
+  } catch (error) {
+    console.error((error as Error).message);
+    process.exit(2);
+  }
+
+  if (!verifyResult(signed, publicKeyPem)) {
+    console.error('Signature is NOT valid for this key: the result was altered or signed by another server');
+    process.exit(1);
+  }
+  const { result } = signed;
+  console.log(`Valid: game ${result.gameId} won by ${result.players[result.winner]?.name} (${result.reason}) at ${result.finishedAt}`);
+  process.exit(0);
+}
+
+if (require.main === module) {
+  main(process.argv.slice(2));
+}
+
+export { ResultSigner, verifyResult, canonicalJson, stateHashOf, RESULT_ALGORITHM };
+export type { GameResult, SignedResult };
@@ -0,0 +1,128 @@
+// Retention for saved games. Finished games never go to the store, only to the archive,
+// so what piles up is saves nobody came back to. Once a save is older than the policy allows it is either
+// archived, as a gzipped snapshot that replay.cjs can read directly (see archive.cts), or
+// purged.
+//
+//   TANKS_RETENTION_DAYS    age in days after which a save is retired; unset keeps everything
+//   TANKS_RETENTION_ACTION  'archive' (default) or 'purge'
+//   TANKS_ARCHIVE_DIR       where archived saves go (default ./archive)
+//
+// Saves are read from the storage the server uses (TANKS_STORAGE, see store.cts).
+//
+// The server applies the policy at startup and then every day at 03:00 UTC. To apply it
+// by hand:
+//
+//   node retention.cjs [--dry-run]
+
+import * as zlib from 'zlib';
+import { openStorage, type Store, type Storage } from './store.cjs';
+import { GameArchive, DEFAULT_ARCHIVE_DIR } from './archive.cjs';
+
+const RETENTION_ACTIONS: RetentionAction[] = ['archive', 'purge'];
+const RETENTION_RUN_AT = '03:00';  // UTC, when the server applies the policy each day
+const MAX_RETENTION_DAYS = 3650;
+
+type RetentionAction = 'archive' | 'purge';
+
+interface RetentionPolicy {
+  maxAgeDays: number;
+  action: RetentionAction;
+  archiveDir: string;
+}
+
+interface RetentionReport {
+  checked: number;
+  archived: string[];
+  purged: string[];
+  bytesReclaimed: number;  // Snapshot bytes removed from the store, less what the archives take
+  errors: string[];
+}
+
+// The policy from the environment, or null when retention is off. Invalid settings
+// throw, so a typo cannot quietly purge or keep everything.
+function loadRetentionPolicy(env: NodeJS.ProcessEnv = process.env): RetentionPolicy | null {
+  if (!env.TANKS_RETENTION_DAYS) return null;
+
+  const maxAgeDays = Number(env.TANKS_RETENTION_DAYS);
+  if (!Number.isInteger(maxAgeDays) || maxAgeDays < 1 || maxAgeDays > MAX_RETENTION_DAYS) {
+    throw new Error(`TANKS_RETENTION_DAYS must be an integer between 1 and ${MAX_RETENTION_DAYS}`);
+  }
+  const action = (env.TANKS_RETENTION_ACTION || 'archive') as RetentionAction;
+  if (!RETENTION_ACTIONS.includes(action)) {
+    throw new Error(`TANKS_RETENTION_ACTION must be one of ${RETENTION_ACTIONS.join(', ')}`);
+  }
+  return { maxAgeDays, action, archiveDir: env.TANKS_ARCHIVE_DIR || DEFAULT_ARCHIVE_DIR };
+}
+
+// Retire every save older than the policy allows. Games `inUse` (loaded and being
+// played) are left alone; their next save starts the clock again.
+function applyRetention(
+  store: Store,
+  policy: RetentionPolicy,
+  inUse: (gameId: string) => boolean = () => false,
+  now: number = Date.now(),
+  dryRun: boolean = false
+): RetentionReport {
+  const report: RetentionReport = { checked: 0, archived: [], purged: [], bytesReclaimed: 0, errors: [] };
+  const cutoff = now - policy.maxAgeDays * 24 * 60 * 60 * 1000;
+  const archive = new GameArchive(policy.archiveDir);
+
+  store.list().forEach(gameId => {
+    report.checked++;
+    try {
+      const snapshot = store.load(gameId);
+      const savedAt = Date.parse(snapshot?.savedAt ?? '');
+      if (!snapshot || !(savedAt < cutoff) || inUse(gameId)) return;
+
+      const stored = JSON.stringify(snapshot, null, 2);
+      let archivedBytes = 0;
+      if (policy.action === 'archive') {
+        archivedBytes = dryRun ? zlib.gzipSync(stored).length : archive.put(gameId, snapshot).bytes;
+        report.archived.push(gameId);
+      } else {
+        report.purged.push(gameId);
+      }
+
+      if (!dryRun) store.remove(gameId);
+      report.bytesReclaimed += Buffer.byteLength(stored) - archivedBytes;
+    } catch (error) {
+      report.errors.push(`${gameId}: ${(error as Error).message}`);
+    }
+  });
+  return report;
+}
+
+function describeReport(report: RetentionReport, dryRun: boolean = false): string {
+  const would = dryRun ? 'would be ' : '';
+  return `Retention: ${report.checked} save(s) checked, ${report.archived.length} ${would}archived, ` +
+    `${report.purged.length} ${would}purged, ${(report.bytesReclaimed / 1024).toFixed(1)} KiB ${dryRun ? 'to reclaim' : 'reclaimed'}` +
+    (report.errors.length > 0 ? `, ${report.errors.length} failed: ${report.errors.join('; ')}` : '');
+}
+
+function main(args: string[]): void {
+  let policy: RetentionPolicy | null;
+  let storage: Storage;
+  try {
+    policy = loadRetentionPolicy();
+    storage = openStorage();
+  } catch (error) {
+    console.error((error as Error).message);
+    process.exit(2);
+  }
+  if (!policy) {
+    console.error('Retention is off; set TANKS_RETENTION_DAYS to the age at which saves are retired');
+    process.exit(2);
+  }
+
+  const dryRun = args.includes('--dry-run');
+  const report = applyRetention(storage.store, policy, undefined, Date.now(), dryRun);
+  console.log(describeReport(report, dryRun));
+  process.exit(report.errors.length > 0 ? 1 : 0);
+}
+
+if (require.main === module) {
+  main(process.argv.slice(2));
+}
+
+export { loadRetentionPolicy, applyRetention, describeReport, RETENTION_ACTIONS, RETENTION_RUN_AT };
+export type { RetentionAction, RetentionPolicy, RetentionReport };
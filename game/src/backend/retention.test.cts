@@ -0,0 +1,99 @@
+// Retention: which saves a policy retires, what archiving leaves behind, and that a dry
+// run and games in play touch nothing. Run with `npm test`.
+
+import { describe, it } from 'node:test';
+import * as assert from 'assert';
+import * as fs from 'fs';
+import * as os from 'os';
+import * as path from 'path';
+import { loadRetentionPolicy, applyRetention, type RetentionPolicy } from './retention.cjs';
+import { GameArchive } from './archive.cjs';
+import { MemoryStore, type GameSnapshot } from './store.cjs';
+
+const DAY_MS = 24 * 60 * 60 * 1000;
+const NOW = Date.parse('2026-06-30T12:00:00.000Z');
+
+function snapshot(id: string, ageDays: number): GameSnapshot {
+  return { version: 1, savedAt: new Date(NOW - ageDays * DAY_MS).toISOString(), game: { id, phase: 'battle', moveLog: [] } };
+}
+
+// OLD1 and OLD2 are past a 30 day policy, NEW1 is not
+function store(): MemoryStore {
+  const store = new MemoryStore();
+  store.save('OLD1', snapshot('OLD1', 45));
+  store.save('OLD2', snapshot('OLD2', 31));
+  store.save('NEW1', snapshot('NEW1', 29));
+  return store;
+}
+
+function policy(action: 'archive' | 'purge'): RetentionPolicy {
+  return { maxAgeDays: 30, action, archiveDir: fs.mkdtempSync(path.join(os.tmpdir(), 'tanks-archive-')) };
+}
+
+describe('loadRetentionPolicy', () => {
+  it('is off unless a number of days is set', () => {
+    assert.strictEqual(loadRetentionPolicy({}), null);
+    assert.deepStrictEqual(loadRetentionPolicy({ TANKS_RETENTION_DAYS: '30' }), { maxAgeDays: 30, action: 'archive', archiveDir: './archive' });
+  });
+
+  it('refuses settings that would purge or keep the wrong saves', () => {
+    ['0', '1.5', 'thirty', '99999'].forEach(days => assert.throws(() => loadRetentionPolicy({ TANKS_RETENTION_DAYS: days }), /TANKS_RETENTION_DAYS/));
+    assert.throws(() => loadRetentionPolicy({ TANKS_RETENTION_DAYS: '30', TANKS_RETENTION_ACTION: 'delete' }), /TANKS_RETENTION_ACTION/);
+  });
+});
+
+describe('applyRetention', () => {
+  it('archives saves past the policy and keeps the rest', () => {
+    const saves = store();
+    const archiving = policy('archive');
+    const report = applyRetention(saves, archiving, undefined, NOW);
+    assert.deepStrictEqual(report.archived.sort(), ['OLD1', 'OLD2']);
+    assert.deepStrictEqual(report.purged, []);
+    assert.strictEqual(report.checked, 3);
+    assert.ok(report.bytesReclaimed > 0);
+    assert.deepStrictEqual(saves.list(), ['NEW1']);
+    assert.deepStrictEqual(new GameArchive(archiving.archiveDir).load('OLD1'), snapshot('OLD1', 45));
+  });
+
+  it('purges without archiving', () => {
+    const saves = store();
+    const purging = policy('purge');
+    const report = applyRetention(saves, purging, undefined, NOW);
+    assert.deepStrictEqual(report.purged.sort(), ['OLD1', 'OLD2']);
+    assert.deepStrictEqual(saves.list(), ['NEW1']);
+    assert.deepStrictEqual(fs.readdirSync(purging.archiveDir), []);
+  });
+
+  it('reports a dry run as a real one would go, changing nothing', () => {
+    const archiving = policy('archive');
+    const real = applyRetention(store(), archiving, undefined, NOW);
+
+    const saves = store();
+    const dry = policy('archive');
+    const report = applyRetention(saves, dry, undefined, NOW, true);
+    assert.deepStrictEqual(report, real);
+    assert.deepStrictEqual(saves.list().sort(), ['NEW1', 'OLD1', 'OLD2']);
+    assert.deepStrictEqual(fs.readdirSync(dry.archiveDir), []);
+  });
+
+  it('leaves games in play alone, however old their save', () => {
+    const saves = store();
+    const report = applyRetention(saves, policy('purge'), gameId => gameId === 'OLD1', NOW);
+    assert.deepStrictEqual(report.purged, ['OLD2']);
+    assert.deepStrictEqual(saves.list().sort(), ['NEW1', 'OLD1']);
+  });
+
+  it('carries on past a save it cannot read', () => {
+    const saves = store();
+    saves.save('BAD1', { ...snapshot('BAD1', 60), savedAt: 'yesterday' });
+    const load = saves.load.bind(saves);
+    saves.load = (gameId: string) => {
+      if (gameId === 'OLD1') throw new Error('disk error');
+      return load(gameId);
+    };
+    const report = applyRetention(saves, policy('purge'), undefined, NOW);
+    assert.deepStrictEqual(report.purged, ['OLD2']);
+    assert.deepStrictEqual(report.errors, ['OLD1: disk error']);
+    assert.deepStrictEqual(saves.list().sort(), ['BAD1', 'NEW1', 'OLD1'], 'a save with no valid date is kept');
+  });
+});
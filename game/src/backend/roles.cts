@@ -0,0 +1,100 @@
+// Staff roles for running a community server. Staff authenticate with bearer tokens.
+// TANKS_ADMIN_TOKEN, if set, belongs to the owner. Other staff tokens come from the
+// TANKS_STAFF_TOKENS environment variable (inline JSON) or a JSON file named by
+// TANKS_STAFF_TOKENS_FILE, e.g.
+//   { "<token>": "admin", "<another token>": { "role": "moderator", "name": "sam" } }
+// Anyone without a staff token is a player.
+//
+//   owner      runs the server; may do everything an admin can
+//   admin      reads and uploads game snapshots, hidden boards included, reads the audit log,
+//              schedules maintenance, runs background jobs and injects faults on test servers
+//   moderator  mutes players in chat, voids games and reviews the moderation queue
+//   player     plays; no staff actions
+
+import * as fs from 'fs';
+import * as crypto from 'crypto';
+
+type Role = 'owner' | 'admin' | 'moderator' | 'player';
+type Permission = 'readSnapshot' | 'writeSnapshot' | 'voidGame' | 'muteChat' | 'readAudit' | 'scheduleMaintenance' | 'runJobs' | 'injectFaults' | 'reviewFlags';
+
+// Lowest to highest; every role may do what the roles below it may
+const ROLES: Role[] = ['player', 'moderator', 'admin', 'owner'];
+
+// The lowest role allowed to take each staff action
+const PERMISSIONS: Record<Permission, Role> = {
+  readSnapshot: 'admin',
+  writeSnapshot: 'admin',
+  voidGame: 'moderator',
+  muteChat: 'moderator',
+  readAudit: 'admin',
+  scheduleMaintenance: 'admin',
+  runJobs: 'admin',
+  injectFaults: 'admin',
+  reviewFlags: 'moderator'
+};
+
+interface StaffMember {
+  name: string;
+  role: Role;
+}
+
+class StaffDirectory {
+  private members: { token: Buffer; member: StaffMember }[] = [];
+
+  // Reload staff tokens from the environment; entries with an unknown role are ignored
+  load(env: NodeJS.ProcessEnv = process.env): void {
+    const members: { token: Buffer; member: StaffMember }[] = [];
+    if (env.TANKS_ADMIN_TOKEN) {
+      members.push({ token: Buffer.from(env.TANKS_ADMIN_TOKEN), member: { name: 'owner', role: 'owner' } });
+    }
+
+    let entries: Record<string, any> = {};
+    try {
+      if (env.TANKS_STAFF_TOKENS_FILE) {
+        entries = JSON.parse(fs.readFileSync(env.TANKS_STAFF_TOKENS_FILE, 'utf-8'));
+      } else if (env.TANKS_STAFF_TOKENS) {
+        entries = JSON.parse(env.TANKS_STAFF_TOKENS);
+      }
+    } catch (error) {
+      console.error('Failed to read staff tokens, only the admin token applies:', error);
+    }
+
+    Object.entries(entries).forEach(([token, value]) => {
+      const role = typeof value === 'string' ? value : value?.role;
+      if (!token || !ROLES.includes(role) || role === 'player') {
+        console.log(`Ignoring staff token with invalid role: ${role}`);
+        return;
+      }
+      const name = typeof value?.name === 'string' ? value.name : role;
+      members.push({ token: Buffer.from(token), member: { name, role } });
+    });
+
+    this.members = members;
+  }
+
+  hasStaff(): boolean {
+    return this.members.length > 0;
+  }
+
+  // Find who a bearer token belongs to. Every entry is compared in constant time.
+  lookup(token: string): StaffMember | null {
+    const given = Buffer.from(token);
+    let found: StaffMember | null = null;
+    for (const { token: expected, member } of this.members) {
+      if (given.length === expected.length && crypto.timingSafeEqual(given, expected)) found = member;
+    }
+    return found;
+  }
+
+  // The staff member going by a name, as flags are assigned by name
+  byName(name: string): StaffMember | null {
+    return this.members.find(({ member }) => member.name === name)?.member ?? null;
+  }
+
+  static can(role: Role, permission: Permission): boolean {
+    return ROLES.indexOf(role) >= ROLES.indexOf(PERMISSIONS[permission]);
+  }
+}
+
+export { StaffDirectory, ROLES, PERMISSIONS };
+export type { Role, Permission, StaffMember };
@@ -0,0 +1,60 @@
+// Print the rules a server started with the same flags would play: board, tanks, special
+// shots, timers, turn and shot limits and the features TANKS_FEATURE_FLAGS leaves on. The
+// description comes from GameManager.getRules, the same one GET /api/rules serves.
+//
+//   node rules.cjs [--board-size N] [--tanks N] [...any other server flag] [--json]
+
+import { GameManager, Utils } from './server.cjs';
+import { Rules, type GameConfig, type RulesDescription } from './game.cjs';
+import { FeatureFlags } from './flags.cjs';
+import { MemoryStore } from './store.cjs';
+
+function describeRules(rules: RulesDescription & { tankMovement: boolean }): string {
+  const { board, tanks, bomb, abilities, timers, limits } = rules;
+  const lengths = tanks.lengths.every(length => length === 1) ? 'one cell each' : `lengths ${tanks.lengths.join(', ')}`;
+  const clocks = [
+    timers.turnSeconds !== null ? `${timers.turnSeconds} s per turn, after which the turn is ${timers.onTimeout === 'skip' ? 'skipped' : 'forfeited, losing the game'}` : null,
+    timers.gameSeconds !== null ? `${timers.gameSeconds} s per player for the game` : null
+  ].filter(clock => clock !== null);
+  const caps = [
+    limits.maxTurns !== null ? `${limits.maxTurns} turns in all` : null,
+    limits.shotBudget !== null ? `${limits.shotBudget} shots per player, special shots included` : null
+  ].filter(cap => cap !== null);
+
+  return [
+    `Board       ${board.size}x${board.size}, columns ${board.columns}, rows ${board.rows}`,
+    `Tanks       ${tanks.count} per player, ${lengths} (${tanks.cells} cells), placed ${tanks.orientations.join(' or ')}`,
+    `Bombs       uncover the ${bomb.revealedArea} square around the target`,
+    `Specials    ${abilities.length === 0 ? 'none' : abilities.map(a =>
+      `${a.name} x${a.perPlayer} (${a.area}${a.harmsTanks ? '' : ', finds tanks without harming them'})`).join(', ')}`,
+    `First move  ${rules.firstMove}`,
+    `Timers      ${clocks.length === 0 ? 'none' : clocks.join(', ')}`,
+    `Limits      ${caps.length === 0 ? 'none, the battle runs until a fleet is gone' : `${caps.join(', ')}; then decided by ${limits.decidedBy.join(', then ')}`}`,
+    `Conceding   ${rules.concede.withinShots === null ? 'never offered' : `offered once the opponent is sure to win within ${rules.concede.withinShots} shot(s)`}`,
+    `Movement    ${rules.tankMovement ? 'an undamaged tank may move instead of bombing' : 'tanks stay where they are placed'}`
+  ].join('\n');
+}
+
+function main(args: string[]): void {
+  let config: GameConfig;
+  try {
+    config = Rules.resolveConfig(Utils.parseServerArgs(args.filter(arg => arg !== '--json')).config);
+  } catch (error) {
+    const fields: { field: string; reason: string }[] = (error as any).fields ?? [];
+    console.error([(error as Error).message, ...fields.map(f => `  ${f.field} ${f.reason}`)].join('\n'));
+    console.error('Usage: node rules.cjs [server flags] [--json]');
+    process.exit(2);
+  }
+
+  const flags = new FeatureFlags();
+  flags.load();
+  const rules = new GameManager(flags, config, new MemoryStore()).getRules();
+  console.log(args.includes('--json') ? JSON.stringify(rules, null, 2) : describeRules(rules));
+  process.exit(0);
+}
+
+if (require.main === module) {
+  main(process.argv.slice(2));
+}
+
+export { describeRules };
@@ -0,0 +1,133 @@
+// Recurring background jobs. A job runs on a fixed interval or once a day at a set UTC
+// time. Each keeps a record of its runs, which the admin API lists (GET /api/jobs), and
+// staff can run one straight away instead of waiting for its turn.
+
+import { ErrorCode, GameError } from './errors.cjs';
+
+const DAY_MS = 24 * 60 * 60 * 1000;
+
+// `dailyAt` is 'HH:MM' in UTC
+type Schedule = { everyMs: number } | { dailyAt: string };
+
+// A job may return a line describing what it did, kept as its last result
+type JobTask = () => string | void;
+
+interface JobStatus {
+  name: string;
+  description: string;
+  schedule: Schedule;
+  running: boolean;
+  runs: number;
+  failures: number;
+  lastRunAt: string | null;
+  lastDurationMs: number | null;
+  lastResult: string | null;
+  lastError: string | null;
+  nextRunAt: string | null;
+}
+
+interface Job {
+  status: JobStatus;
+  task: JobTask;
+  timer: NodeJS.Timeout | null;
+}
+
+class Scheduler {
+  private jobs: Map<string, Job> = new Map();
+
+  add(name: string, schedule: Schedule, description: string, task: JobTask): void {
+    if (this.jobs.has(name)) {
+      throw new Error(`A job named ${name} is already scheduled`);
+    }
+    Scheduler.delayUntilNext(schedule, Date.now());  // Throws on a malformed schedule
+
+    const job: Job = {
+      status: {
+        name, description, schedule, running: false, runs: 0, failures: 0,
+        lastRunAt: null, lastDurationMs: null, lastResult: null, lastError: null, nextRunAt: null
+      },
+      task,
+      timer: null
+    };
+    this.jobs.set(name, job);
+    this.arm(job);
+  }
+
+  // Run a job now; its regular schedule carries on from this run
+  run(name: string): JobStatus {
+    const job = this.jobs.get(name);
+    if (!job) {
+      throw new GameError(ErrorCode.NOT_FOUND, 'No such job', { name, jobs: [...this.jobs.keys()] });
+    }
+    if (!job.status.running) {
+      this.execute(job);
+      this.arm(job);
+    }
+    return { ...job.status };
+  }
+
+  status(): JobStatus[] {
+    return [...this.jobs.values()].map(job => ({ ...job.status }));
+  }
+
+  stop(): void {
+    this.jobs.forEach(job => {
+      if (job.timer) clearTimeout(job.timer);
+      job.timer = null;
+      job.status.nextRunAt = null;
+    });
+  }
+
+  // Milliseconds from `now` until the schedule is next due
+  static delayUntilNext(schedule: Schedule, now: number): number {
+    if ('everyMs' in schedule) {
+      if (!Number.isInteger(schedule.everyMs) || schedule.everyMs <= 0) {
+        throw new Error('everyMs must be a positive integer');
+      }
+      return schedule.everyMs;
+    }
+
+    const match = /^(\d{2}):(\d{2})$/.exec(schedule.dailyAt);
+    if (!match || Number(match[1]) > 23 || Number(match[2]) > 59) {
+      throw new Error(`dailyAt must be HH:MM in UTC, not ${schedule.dailyAt}`);
+    }
+    const today = new Date(now);
+    today.setUTCHours(Number(match[1]), Number(match[2]), 0, 0);
+    const next = today.getTime() > now ? today.getTime() : today.getTime() + DAY_MS;
+    return next - now;
+  }
+
+  private arm(job: Job): void {
+    if (job.timer) clearTimeout(job.timer);
+    const delay = Scheduler.delayUntilNext(job.status.schedule, Date.now());
+    job.status.nextRunAt = new Date(Date.now() + delay).toISOString();
+    job.timer = setTimeout(() => {
+      this.execute(job);
+      this.arm(job);
+    }, delay);
+    // A pending job alone should not keep the process running
+    job.timer.unref();
+  }
+
+  private execute(job: Job): void {
+    const { status } = job;
+    const startedAt = Date.now();
+    status.running = true;
+    status.lastRunAt = new Date(startedAt).toISOString();
+    try {
+      status.lastResult = job.task() || null;
+      status.lastError = null;
+    } catch (error) {
+      status.failures++;
+      status.lastError = (error as Error).message;
+      console.error(`Job ${status.name} failed:`, error);
+    } finally {
+      status.runs++;
+      status.running = false;
+      status.lastDurationMs = Date.now() - startedAt;
+    }
+  }
+}
+
+export { Scheduler };
+export type { Schedule, JobTask, JobStatus };
@@ -0,0 +1,132 @@
+// Seats the server plays itself: the built-in AI (ai.cts) and bots run as separate
+// programs (bot.cts). A seat stands in for a WebSocket, reads the same gameState messages
+// a human client gets, and answers through GameManager.handleMessage, so it is bound by
+// exactly the rules, turn order and fog of war a human player is.
+//
+// ServerSeat does everything but choose moves: it accepts whatever settings its opponent
+// proposes, confirms its placement, and leaves when its opponent is gone for good (see
+// opponentGone). Subclasses lay out their fleet and take their turns.
+
+import { WebSocket } from 'ws';
+import type { GameManager } from './server.cjs';
+import type { Position } from './game.cjs';
+
+abstract class ServerSeat {
+  readyState: number = WebSocket.OPEN;
+  protocol: string = '';
+  protected gameManager: GameManager;
+  protected state: any = null;
+  private label: string;      // Who the seat is in the log, e.g. 'AI (hunt)'
+  private thinkTimeMs: number;
+  private timer: NodeJS.Timeout | null = null;
+  private leaving: boolean = false;
+
+  constructor(gameManager: GameManager, label: string, thinkTimeMs: number) {
+    this.gameManager = gameManager;
+    this.label = label;
+    this.thinkTimeMs = thinkTimeMs;
+  }
+
+  send(data: string | Buffer): void {
+    const message = JSON.parse(data.toString());
+
+    // React outside the server's own call stack
+    if (ServerSeat.opponentGone(message)) {
+      this.leaving = true;
+      this.schedule(() => this.leave(), 0);
+    } else if (message.type === 'gameState' && !this.leaving) {
+      this.state = message;
+      this.schedule(() => this.act(), this.thinkTimeMs);
+    } else if (message.type === 'error') {
+      console.log(`${this.label} action rejected: ${message.error?.code}`);
+    }
+  }
+
+  // An opponent who only dropped has their seat held, with the time they have to take it
+  // back as reconnectBy, and may well come back; one who gave their seat up has not
+  static opponentGone(message: { type: string; reconnectBy?: number }): boolean {
+    return message.type === 'playerDisconnected' && message.reconnectBy === undefined;
+  }
+
+  close(): void {
+    this.readyState = WebSocket.CLOSED;
+    if (this.timer) clearTimeout(this.timer);
+    this.timer = null;
+  }
+
+  // Lay out the whole fleet; called once, with no tanks on the board yet
+  protected abstract placeTanks(state: any): void;
+
+  // Play the seat's turn in the battle
+  protected abstract takeTurn(state: any): void;
+
+  // Called with every state before the seat acts on it
+  protected observe(state: any): void { }
+
+  protected gameOver(state: any): void { }
+
+  protected placeFleet(tanks: { x: number; y: number; orientation?: string }[]): void {
+    tanks.forEach(({ x, y, orientation }) => this.dispatch({ type: 'placeTank', x, y, orientation: orientation ?? 'horizontal' }));
+    this.dispatch({ type: 'confirmPlacement' });
+  }
+
+  protected bomb({ x, y }: Position): void {
+    this.dispatch({ type: 'bomb', x, y, expectedMove: this.state.moveCount });
+  }
+
+  protected dispatch(message: Record<string, any>): void {
+    this.gameManager.handleMessage(this as unknown as WebSocket, message as any);
+  }
+
+  private schedule(action: () => void, delay: number): void {
+    if (this.readyState !== WebSocket.OPEN) return;
+    if (this.timer) clearTimeout(this.timer);
+    this.timer = setTimeout(() => {
+      this.timer = null;
+      action();
+    }, delay);
+  }
+
+  private act(): void {
+    const state = this.state;
+    const me = state.players[state.playerId];
+    this.observe(state);
+
+    switch (state.phase) {
+      case 'setup':
+        // Accept whatever the opponent proposes
+        if (state.proposal && state.proposal.proposedBy !== state.playerId) {
+          this.dispatch({ type: 'acceptSettings' });
+        }
+        break;
+
+      case 'placement':
+        if (me && !me.ready && me.tanksRemaining === state.config.tanksPerPlayer) {
+          this.placeTanks(state);
+        } else if (me && !me.ready && me.tanksRemaining === 0) {
+          this.dispatch({ type: 'confirmPlacement' });
+        }
+        break;
+
+      case 'battle':
+        if (state.currentTurn === state.playerId) this.takeTurn(state);
+        break;
+
+      case 'gameover':
+        this.gameOver(state);
+        break;
+
+      case 'waiting':
+        // Alone in the room: the opponent has gone
+        this.leave();
+        break;
+    }
+  }
+
+  private leave(): void {
+    this.gameManager.removePlayer(this as unknown as WebSocket);
+    this.close();
+  }
+}
+
+export { ServerSeat };
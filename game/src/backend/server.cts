@@ -1,66 +1,250 @@
 import * as http from 'http';
 import * as path from 'path';
 import * as fs from 'fs';
+import * as crypto from 'crypto';
+import * as zlib from 'zlib';
 import { WebSocket, WebSocketServer } from 'ws';
+import { JsonCodec, CODECS, selectCodec, type Codec } from './codec.cjs';
+import { ErrorCode, GameError, toGameError, requireIntegers } from './errors.cjs';
+import { DEFAULT_LOCALE, negotiateLocale, negotiateFormat, translate, formatNumber, formatDate, formatDuration } from './i18n.cjs';
+import { FeatureFlags, type FeatureFlag } from './flags.cjs';
+import { HttpApi } from './api.cjs';
+import { GrpcServer } from './grpc.cjs';
+import { AiPlayer, AI_DIFFICULTIES, scoreTargets, gradeShot, type AiDifficulty } from './ai.cjs';
+import { FileStore, SNAPSHOT_VERSION, SAVE_DIR, openStorage, type Store, type Storage, type GameSnapshot } from './store.cjs';
+import { estimateWinProbability, forcedFinish, sparkline, moveStats, coldShooting, type SideStats } from './analysis.cjs';
+import { StaffDirectory } from './roles.cjs';
+import { AuditLog } from './audit.cjs';
+import { ModerationQueue, REPORT_CATEGORIES, type ChatLine, type ReportCategory } from './moderation.cjs';
+import { detectCollusion, describeCollusion, COLLUSION_RUN_AT } from './collusion.cjs';
+import { Accounts, type PublicUser } from './accounts.cjs';
+import { loadRetentionPolicy, applyRetention, describeReport, RETENTION_RUN_AT, type RetentionPolicy, type RetentionReport } from './retention.cjs';
+import { GameArchive, loadArchivePolicy, type ArchivePolicy } from './archive.cjs';
+import { DeliveryShaper, loadDeliveryIntervals, type DeliveryIntervals, type DeliveryRole } from './delivery.cjs';
+import { Scheduler } from './scheduler.cjs';
+import { FaultInjector } from './chaos.cjs';
+import { commentate, tanksDestroyedSince } from './commentary.cjs';
+import { DEFAULT_RATING, MAX_RATING_GAP } from './rating.cjs';
+import { ResultSigner, RESULT_ALGORITHM, stateHashOf, type GameResult, type SignedResult } from './results.cjs';
+import { Drill, type DrillKind } from './drills.cjs';
+import { FreeForAll, type FreeForAllShot, type FreeForAllView } from './freeforall.cjs';
+import { EventBus, Metrics, attachHooks } from './events.cjs';
+import { statsAggregator } from './stats.cjs';
+import { BotPlayer, loadBots, type BotDefinition } from './bot.cjs';
+import { COORDINATE_SYSTEMS, formatCell, parseCell, requireCoordinateSystem, type CoordinateSystem } from './coords.cjs';
+import { boardsSvg } from './image.cjs';
+import {
+  PROTOCOL_VERSION, MIN_PROTOCOL_VERSION, VARIANTS, legacyCapabilities, negotiate, understands, gameVariants, requireVariants,
+  type Capabilities
+} from './protocol.cjs';
+import {
+  Rules, CellState, RULES_VERSION, DEFAULT_CONFIG, CONFIG_LIMITS, FIRST_MOVE_POLICIES, TIMEOUT_ACTIONS, TANK_LENGTH_LIMITS, ORIENTATIONS,
+  ABILITIES, STRIKE_DIRECTIONS,
+  type Side, type BoardView, type Orientation, type FirstMovePolicy, type TimeoutAction, type GameConfig, type MoveLogEntry,
+  type CellChange, type Ability, type StrikeDirection, type StrikeCell, type RulesDescription, type Position, type Tank,
+  type BoardAction
+} from './game.cjs';
 
 const DEBUG = false
 
 // Game Constants
-const BOARD_SIZE = 8;
-const TANKS_PER_PLAYER = 3;
-const EXPLOSION_RADIUS = 1;
+const EMOTES = ['gl', 'gg', 'nice shot', 'ouch', 'oops', 'wow']; // Only these may be attached to a move
+// Phrases players may send by number, 1 for the first, even in games without chat; their
+// texts are in i18n.cts. Only ever add to the end, so the numbers keep their meaning.
+const QUICK_CHAT = ['hello', 'goodLuck', 'niceShot', 'closeOne', 'thinking', 'oops', 'thanks', 'goodGame', 'rematch'];
 const PORT = 3000;
+// Command-line options for the server's defaults, e.g. --board-size 10 --tanks 10
+const SERVER_FLAGS: Record<string, 'port' | 'grpcPort' | 'storage' | keyof GameConfig> = {
+  '--port': 'port',
+  '--grpc-port': 'grpcPort',
+  '--storage': 'storage',
+  '--board-size': 'boardSize',
+  '--tanks': 'tanksPerPlayer',
+  '--explosion-radius': 'explosionRadius',
+  '--first-move': 'firstMove',
+  '--turn-time': 'turnTimeSeconds',
+  '--game-time': 'gameTimeSeconds',
+  '--on-timeout': 'timeoutAction',
+  '--airstrikes': 'airstrikes',
+  '--cluster-bombs': 'clusterBombs',
+  '--scans': 'scans',
+  '--max-turns': 'maxTurns',
+  '--shot-budget': 'shotBudget',
+  '--concede-within': 'concedeWithinShots',
+  '--coordinates': 'coordinates'
+};
+const MAX_GAMES_PAGE_SIZE = 50;
+const IDEMPOTENCY_WINDOW = 32; // Remembered action results per player
+const NONCE_WINDOW = 128; // Remembered message nonces per connection
+const ACTION_DEBOUNCE_MS = 300; // Window in which a repeated action from one connection is rejected
+const CLOCK_TICK_MS = 250; // How often turn clocks are checked
+const TURN_WARNING_MS = 10 * 1000; // Players are warned when this much of their turn is left
+const MAX_PREMOVES = 8; // Queued per player
+const MAX_CHAT_KEPT = 50; // Recent chat messages per game that can still be reported
+const REPORT_CONTEXT = 5; // Messages before a reported one that go with the report
+const ACCURACY_MIN_SHOTS = 8; // Cold shots a player must have fired before their accuracy is judged
+const ACCURACY_P_VALUE = 0.0001; // Rarer than this by chance and the game is flagged for review
+const MAINTENANCE_WARNINGS_S = [3600, 1800, 900, 600, 300, 120, 60, 30, 10]; // Countdown marks at which players are warned again
+const MAX_MAINTENANCE_NOTICE_S = 24 * 60 * 60;
+const COMPRESSION_THRESHOLD = 1024; // Bytes; smaller WebSocket frames are sent uncompressed
+const COMPRESSIBLE_TYPES = new Set(['text/html', 'text/javascript', 'text/css', 'application/json', 'image/svg+xml']);
+const CRASH_DUMP_DIR = process.env.TANKS_CRASH_DIR || './crash-dumps';
+// All a connection whose hello named other rules may still send: none of them plays a game
+const RULES_FREE_MESSAGES = new Set([
+  'hello', 'getServerStats', 'getGamesList', 'getRules', 'getCapabilities', 'setLocale', 'register', 'signIn',
+  'cancelQuickMatch', 'stopSpectating', 'leaveGame'
+]);
+// How long a dropped player's seat is held for them to resume; 0 gives it up at once
+const RECONNECT_GRACE_MS = Math.max(Number(process.env.TANKS_RECONNECT_GRACE_SECONDS ?? 60) || 0, 0) * 1000;
+// Untimed battles only. A player who has not moved for TANKS_STALL_NUDGE_SECONDS is nudged,
+// and again each time as long again passes; after TANKS_STALL_TIMEOUT_SECONDS their turn
+// times out with TANKS_STALL_ACTION (skip or forfeit). A player who has lost
+// TANKS_STALL_FORFEIT_TURNS turns this way forfeits. 0 turns each of them off.
+const STALL_POLICY = {
+  nudgeMs: Math.max(Number(process.env.TANKS_STALL_NUDGE_SECONDS ?? 300) || 0, 0) * 1000,
+  timeoutMs: Math.max(Number(process.env.TANKS_STALL_TIMEOUT_SECONDS ?? 1800) || 0, 0) * 1000,
+  action: (process.env.TANKS_STALL_ACTION === 'forfeit' ? 'forfeit' : 'skip') as TimeoutAction,
+  forfeitAfter: Math.max(Math.floor(Number(process.env.TANKS_STALL_FORFEIT_TURNS ?? 3)) || 0, 0)
+};
 
 // Types
-enum CellState {
-  EMPTY = 0,
-  TANK = 1,
-  HIT = 2,
-  MISS = 3,
-  REVEALED = 4
-}
-
 enum GamePhase {
   WAITING = 'waiting',
+  SETUP = 'setup',
   PLACEMENT = 'placement',
   BATTLE = 'battle',
-  GAME_OVER = 'gameover'
-}
-
-interface Position {
-  x: number;
-  y: number;
+  GAME_OVER = 'gameover',
+  ABORTED = 'aborted'
 }
 
-interface Player {
+// Allowed phase changes. Any phase may fall back to WAITING when a player leaves,
+// and any live game may be aborted; an aborted game never changes again.
+const PHASE_TRANSITIONS: Record<GamePhase, GamePhase[]> = {
+  [GamePhase.WAITING]: [GamePhase.SETUP, GamePhase.PLACEMENT, GamePhase.ABORTED],
+  [GamePhase.SETUP]: [GamePhase.PLACEMENT, GamePhase.WAITING, GamePhase.ABORTED],
+  [GamePhase.PLACEMENT]: [GamePhase.BATTLE, GamePhase.WAITING, GamePhase.ABORTED],
+  [GamePhase.BATTLE]: [GamePhase.GAME_OVER, GamePhase.WAITING, GamePhase.ABORTED],
+  [GamePhase.GAME_OVER]: [GamePhase.WAITING, GamePhase.ABORTED],
+  [GamePhase.ABORTED]: []
+};
+
+interface Player extends Side {
   id: number;
   ws: WebSocket;
-  board: CellState[][];
-  visibleEnemyBoard: CellState[][];
-  tanks: Position[];
-  tanksAlive: number;
   ready: boolean;
   name: string;
   joinTime: number;
+  recentActions: Map<string, any>;  // moveId -> result, for idempotent retries
+  resumeToken: string;  // Secret that lets this player reclaim the seat, e.g. after a saved game is loaded
+  chatMuted: boolean;  // Set by a moderator; the player's chat messages are dropped
+  userId: string | null;  // Account the player was signed in with, whose stats the game counts towards
+  disconnectedAt: number | null;  // When the connection dropped; the seat is held until RECONNECT_GRACE_MS after
+  premoves: Premove[];  // In the order queued
+  placedTanks: Tank[];  // The fleet as it stood when the battle began, shown to everyone once the game is over
+}
+
+// "If my shot at the condition's cell is a hit (or a miss), bomb (x, y) next". Checked at
+// the start of each of the player's turns against the bomb they dropped the turn before;
+// the first that matches is played for them, and every premove on that cell is dropped.
+interface Premove {
+  condition: { x: number; y: number; outcome: 'hit' | 'miss' };
+  x: number;
+  y: number;
+}
+
+// Time accounting for the battle, present only when the settings use a clock
+interface TurnClock {
+  turnStartedAt: number;
+  banks: [number, number] | null;  // Each player's remaining game time in ms at the start of the current turn
+  warned: boolean;  // The low-time warning for the current turn has been sent
+}
+
+// Watch for stalling in a battle without a clock (see STALL_POLICY)
+interface StallWatch {
+  turnStartedAt: number;
+  nudges: number;  // Sent during the current turn
+  stalledTurns: [number, number];  // Turns each player has lost to stalling
+}
+
+// Maintenance announced by staff. From the announcement on no new games start; when
+// it begins, games in progress are saved so their players can resume them afterwards.
+interface Maintenance {
+  startsAt: number;
+  message: string | null;
+  pauseClocks: boolean;  // Stop turn and game clocks once maintenance begins
+  announcedAt: number;   // Seconds left when the last warning went out
+  begun: boolean;
+}
+
+interface SettingsProposal {
+  config: GameConfig;
+  proposedBy: number;
 }
 
 interface GameState {
   id: string;
+  config: GameConfig;
+  proposal: SettingsProposal | null;  // Pending settings during the setup phase
+  configAgreedAt: number | null;
+  features: Record<FeatureFlag, boolean>;  // Evaluated once at creation so a game never changes mid-match
+  rulesVersion: number;  // The RULES_VERSION the game is played under, kept in its saves
   players: Player[];
   actionTaken: boolean;
   currentTurn: number;
+  firstTurn: { policy: FirstMovePolicy; playerId: number } | null;  // Decided when the battle starts
+  emotes: { moveCount: number; playerId: number; emote: string; timestamp: number }[];
+  chat: ChatLine[];  // The last MAX_CHAT_KEPT messages, so players can report one; not saved
+  eventSeq: number;  // Sequence number of the last gameEvent sent
+  winProbabilityHistory: { moveCount: number; players: [number, number] }[];  // After every turn of the battle
+  moveLog: MoveLogEntry[];  // Every placement, move and bomb since placement began
+  cellHistory: CellChange[];  // Every cell those actions changed, on all four boards
+  boardsLogged: CellState[][][] | null;  // Each player's own board and enemy view as of the last logged entry; not saved
+  clock: TurnClock | null;
+  stall: StallWatch | null;  // Untimed battles only
   phase: GamePhase;
   winner: number | null;
+  result: SignedResult | null;  // Signed once the game is won, for third parties to check
   moveCount: number;
   startTime: number;
   createdAt: number;
 }
 
+// A game waiting on a signed-in player, as listed in their inbox
+interface InboxEntry {
+  gameId: string;
+  playerId: number;
+  phase: GamePhase;
+  action: 'acceptSettings' | 'place' | 'turn';  // What the game is waiting for them to do
+  opponent: string | null;
+  moveCount: number;
+  turnDeadline: number | null;  // Epoch ms, when a clock is running
+}
+
 interface GameMessage {
   type: string;
   [key: string]: any;
 }
 
+interface GamesListQuery {
+  cursor?: string;
+  limit?: number;
+  phase?: GamePhase;
+  canJoin?: boolean;
+  sort?: 'createdAt' | 'playerCount';
+  order?: 'asc' | 'desc';
+}
+
+type GameLifecycle = 'active' | 'finished' | 'archived';  // See archive.cts
+
+// What a player may do right now: the rules' actions, plus those the game itself offers
+type LegalAction = BoardAction | { type: 'acceptSettings' } | { type: 'concede' } | { type: 'leaveGame' };
+
+interface GamesListPage {
+  games: any[];
+  nextCursor: string | null;
+  total: number;
+}
+
 // Utility Functions
 class Utils {
   static generateRoomId(): string {
@@ -72,12 +256,122 @@ class Utils {
     return /^[A-Za-z0-9]{4,10}$/.test(roomId);
   }
 
-  static createEmptyBoard(): CellState[][] {
-    return Array(BOARD_SIZE).fill(null).map(() => Array(BOARD_SIZE).fill(CellState.EMPTY));
+  // Parse server command-line flags; accepts "--flag value" and "--flag=value"
+  static parseServerArgs(argv: string[]): { port?: number; grpcPort?: number; storage?: string; config: Partial<GameConfig> } {
+    const options: { port?: number; grpcPort?: number; storage?: string; config: Record<string, any> } = { config: {} };
+    for (let i = 0; i < argv.length; i++) {
+      const [flag, inline] = argv[i].split('=', 2);
+      const key = SERVER_FLAGS[flag];
+      if (!key) {
+        throw new Error(`Unknown option ${flag}. Valid options: ${Object.keys(SERVER_FLAGS).join(', ')}`);
+      }
+      const value = inline ?? argv[++i];
+      if (value === undefined) {
+        throw new Error(`Option ${flag} needs a value`);
+      }
+
+      if (key === 'port' || key === 'grpcPort') {
+        options[key] = Number(value);
+      } else if (key === 'storage') {
+        options.storage = value;
+      } else {
+        options.config[key] = key === 'firstMove' || key === 'timeoutAction' || key === 'coordinates' ? value : Number(value);
+      }
+    }
+
+    (['port', 'grpcPort'] as const).forEach(key => {
+      const port = options[key];
+      if (port !== undefined && (!Number.isInteger(port) || port < 1 || port > 65535)) {
+        throw new Error(`${key === 'port' ? '--port' : '--grpc-port'} must be an integer between 1 and 65535`);
+      }
+    });
+    if (options.grpcPort !== undefined && options.grpcPort === (options.port ?? PORT)) {
+      throw new Error('--grpc-port must differ from the HTTP port');
+    }
+    return options;
+  }
+
+  // Plain-data copy of a game with sockets dropped, safe to write to disk
+  static serializeGame(game: GameState): Record<string, any> {
+    const { boardsLogged, chat, ...rest } = game;
+    return {
+      ...rest,
+      players: game.players.map(({ ws, recentActions, ...player }) => ({
+        ...player,
+        recentActions: Object.fromEntries(recentActions)
+      }))
+    };
+  }
+  // Rebuild a game from serializeGame output. Seats start vacant until their
+  // players resume them with their tokens.
+  static restoreGame(data: any): GameState {
+    const invalid = (reason: string) => new GameError(ErrorCode.VALIDATION_FAILED, 'Invalid game snapshot', undefined, [{ field: 'game', reason }]);
+    if (!data || typeof data !== 'object' || typeof data.id !== 'string' || !Utils.validateRoomId(data.id)) {
+      throw invalid('must be a saved game with a valid id');
+    }
+    if (!Object.values(GamePhase).includes(data.phase) || data.phase === GamePhase.ABORTED) {
+      throw invalid('has an unknown or final phase');
+    }
+    // A finished game is only ever read back, so the rules it was played under don't matter
+    const rulesVersion = data.phase === GamePhase.GAME_OVER ? data.rulesVersion ?? 1 : Rules.requireRulesVersion(data.rulesVersion);
+    if (data.phase !== GamePhase.GAME_OVER && rulesVersion !== RULES_VERSION) {
+      console.log(`Carrying game ${data.id} forward from rules version ${rulesVersion} to ${RULES_VERSION}`);
+    }
+
+    const config = Rules.resolveConfig(data.config, DEFAULT_CONFIG);
+    const validBoard = (board: any) => Array.isArray(board) && board.length === config.boardSize &&
+      board.every((row: any) => Array.isArray(row) && row.length === config.boardSize && row.every((cell: any) => Number.isInteger(cell) && cell in CellState));
+    if (!Array.isArray(data.players) || data.players.length > 2 ||
+      !data.players.every((p: any) => validBoard(p?.board) && validBoard(p?.visibleEnemyBoard) && Array.isArray(p?.tanks) && typeof p?.resumeToken === 'string')) {
+      throw invalid('has malformed players or boards');
+    }
+
+    return {
+      ...data,
+      config,
+      rulesVersion: data.phase === GamePhase.GAME_OVER ? rulesVersion : RULES_VERSION,
+      result: null,  // Only games in progress are saved
+      moveLog: Array.isArray(data.moveLog) ? data.moveLog : [],
+      cellHistory: Array.isArray(data.cellHistory) ? data.cellHistory : [],  // Saved before cells were tracked: none
+      chat: [],
+      boardsLogged: data.players.flatMap((p: any) => [p.board, p.visibleEnemyBoard]).map((board: CellState[][]) => board.map(row => [...row])),
+      // The turn in progress when the game was saved starts over once it is loaded
+      clock: data.clock ? { ...data.clock, turnStartedAt: Date.now() } : null,
+      stall: data.stall ? { ...data.stall, turnStartedAt: Date.now(), nudges: 0 } : null,
+      players: data.players.map((player: any, index: number) => ({
+        ...player,
+        abilitiesUsed: { airstrike: 0, cluster: 0, scan: 0, ...player.abilitiesUsed },  // Saved before special shots existed
+        userId: typeof player.userId === 'string' ? player.userId : null,
+        disconnectedAt: null,
+        premoves: Array.isArray(player.premoves) ? player.premoves : [],
+        placedTanks: Array.isArray(player.placedTanks) ? player.placedTanks : player.tanks,  // Saved before fleets were kept: as they stand
+        id: index,
+        ws: VACANT_SEAT,
+        recentActions: new Map(Object.entries(player.recentActions || {}))
+      }))
+    };
   }
 
-  static isValidPosition(x: number, y: number): boolean {
-    return x >= 0 && y >= 0 && x < BOARD_SIZE && y < BOARD_SIZE;
+
+  // Pick the preferred supported encoding from an Accept-Encoding header
+  static negotiateEncoding(acceptEncoding: string | string[] | undefined): 'gzip' | 'deflate' | null {
+    const header = Array.isArray(acceptEncoding) ? acceptEncoding.join(',') : acceptEncoding || '';
+    const accepted = header.split(',').map(part => {
+      const [name, ...params] = part.trim().toLowerCase().split(';');
+      const q = params.find(p => p.trim().startsWith('q='));
+      const value = q ? parseFloat(q.trim().slice(2)) : 1;
+      return { name, q: Number.isFinite(value) ? value : 0 };
+    });
+
+    // An encoding named outright takes its own q, even q=0, which * cannot override;
+    // the rest take *'s. Highest q wins, gzip on a tie.
+    const wildcard = accepted.find(e => e.name === '*');
+    let best: { encoding: 'gzip' | 'deflate'; q: number } | null = null;
+    for (const encoding of ['gzip', 'deflate'] as const) {
+      const q = accepted.find(e => e.name === encoding)?.q ?? wildcard?.q ?? 0;
+      if (q > 0 && (!best || q > best.q)) best = { encoding, q };
+    }
+    return best?.encoding ?? null;
   }
 
   static getRandomName(): string {
@@ -87,44 +381,117 @@ class Utils {
   }
 }
 
+// Stands in for the socket of a seat nobody has resumed yet
+const VACANT_SEAT = { readyState: WebSocket.CLOSED, send: () => {} } as unknown as WebSocket;
+
 // Game Manager Class
 class GameManager {
   private games: Map<string, GameState> = new Map();
   private playerConnections: Map<WebSocket, { gameId: string; playerId: number }> = new Map();
   private allConnections: Set<WebSocket> = new Set();
+  private connectionCodecs: WeakMap<WebSocket, Codec> = new WeakMap();
+  private connectionLocales: WeakMap<WebSocket, string> = new WeakMap();
+  private connectionFormats: WeakMap<WebSocket, string> = new WeakMap();  // Locale numbers and dates are written in
+  private connectionCapabilities: WeakMap<WebSocket, Capabilities> = new WeakMap();  // What each client said it supports
+  private rulesMismatches: WeakMap<WebSocket, GameError> = new WeakMap();  // Clients built for other rules, and why they were refused
+  private connectionCoordinates: WeakMap<WebSocket, CoordinateSystem> = new WeakMap();  // Set by clients that pick their own
+  private lastActionAt: WeakMap<WebSocket, Map<string, { at: number; moves: number }>> = new WeakMap();  // Payload -> when it ran, and the game's log length after
+  private seenNonces: WeakMap<WebSocket, Set<string>> = new WeakMap();
+  private connectionUsers: WeakMap<WebSocket, PublicUser> = new WeakMap();  // Connections that signed in
+  private spectators: Map<string, Set<WebSocket>> = new Map();  // Game id -> connections watching it
+  private spectating: Map<WebSocket, string> = new Map();       // Connection -> the game it watches
+  private drills: Map<WebSocket, Drill> = new Map();            // Practice drill each connection is playing
+  private freeForAlls: Map<string, FreeForAll> = new Map();     // Hot-seat matches played through the REST API
+  // Players waiting for quick match, with their rating and how far from it they will accept an opponent
+  private matchQueue: { ws: WebSocket; playerName?: string; queuedAt: number; rating: number; maxRatingGap: number | null }[] = [];
+  private flags: FeatureFlags;
+  private defaultConfig: GameConfig;  // Settings a new game starts from
+  private store: Store;
+  private accounts: Accounts;
+  private signer: ResultSigner;
+  private lastClockCheck: number = Date.now();
+  private maintenance: Maintenance | null = null;
+  readonly events: EventBus;  // For logging, metrics and webhooks (see events.cts)
+  private bots: Record<string, BotDefinition>;  // External programs players may play against, by name
+  private archive: GameArchive | null;          // Where finished games go as they leave memory, if anywhere
+  private finishedTtlMs: number;                // How long they stay first; 0 for as long as they would anyway
+  private fromArchive: Set<string> = new Set();  // Games in memory that were loaded back from the archive
+  private shaper: DeliveryShaper;                // Holds back and coalesces what spectators are sent
+  private moderation: ModerationQueue;           // Where reported chat and improbable accuracy are flagged
+
+  constructor(
+    flags: FeatureFlags = new FeatureFlags(),
+    defaultConfig: GameConfig = DEFAULT_CONFIG,
+    store: Store = new FileStore(SAVE_DIR),
+    accounts: Accounts = new Accounts(),
+    signer: ResultSigner = new ResultSigner(),
+    events: EventBus = new EventBus(),
+    bots: Record<string, BotDefinition> = {},
+    archivePolicy: ArchivePolicy | null = null,
+    shaper: DeliveryShaper = new DeliveryShaper(),
+    moderation: ModerationQueue = new ModerationQueue()
+  ) {
+    this.flags = flags;
+    this.defaultConfig = defaultConfig;
+    this.store = store;
+    this.accounts = accounts;
+    this.signer = signer;
+    this.events = events;
+    this.bots = bots;
+    this.archive = archivePolicy ? new GameArchive(archivePolicy.archiveDir) : null;
+    this.finishedTtlMs = (archivePolicy?.finishedMinutes ?? 0) * 60 * 1000;
+    this.shaper = shaper;
+    this.moderation = moderation;
+    events.subscribe('stats', statsAggregator(accounts));
 
-  constructor() {
-    // Cleanup old games every 30 minutes
     setInterval(() => {
-      this.cleanupOldGames();
-    }, 30 * 60 * 1000);
+      this.checkClocks();
+      this.checkMaintenance();
+      this.checkDisconnects();
+    }, CLOCK_TICK_MS);
   }
 
-  addConnection(ws: WebSocket): void {
+  addConnection(ws: WebSocket, codec: Codec = JsonCodec, locale: string = DEFAULT_LOCALE, format: string = locale): void {
     this.allConnections.add(ws);
+    this.connectionCodecs.set(ws, codec);
+    this.connectionLocales.set(ws, locale);
+    this.connectionFormats.set(ws, format);
+    this.connectionCapabilities.set(ws, legacyCapabilities(codec));
     console.log(`New client connected. Total connections: ${this.allConnections.size}`);
 
     // Send current server stats to the new connection
     this.sendServerStats(ws);
   }
 
+  getConnection(ws: WebSocket): { gameId: string; playerId: number } | undefined {
+    return this.playerConnections.get(ws);
+  }
+
   removeConnection(ws: WebSocket): void {
     this.allConnections.delete(ws);
+    this.shaper.detach(ws);
     console.log(`Client disconnected. Total connections: ${this.allConnections.size}`);
   }
 
-  createGame(customRoomId?: string): string {
+  createGame(customRoomId?: string, proposedConfig?: Partial<GameConfig>): string {
+    this.requireNoMaintenance();
+    const config = Rules.resolveConfig(proposedConfig, this.defaultConfig);
     let gameId: string;
 
     if (customRoomId) {
+      if (!this.flags.isEnabled('customRoomIds', customRoomId.toUpperCase())) {
+        throw new GameError(ErrorCode.FEATURE_DISABLED, 'Custom room IDs are disabled on this server');
+      }
+
       // Validate custom room ID
       if (!Utils.validateRoomId(customRoomId)) {
-        throw new Error('Invalid room ID format. Use 4-10 alphanumeric characters.');
+        throw new GameError(ErrorCode.INVALID_ROOM_ID, 'Invalid room ID format. Use 4-10 alphanumeric characters.', undefined,
+          [{ field: 'gameId', reason: 'must be 4-10 alphanumeric characters' }]);
       }
 
       // Check if room already exists
       if (this.games.has(customRoomId.toUpperCase())) {
-        throw new Error('Room ID already exists. Choose a different one.');
+        throw new GameError(ErrorCode.ROOM_EXISTS, 'Room ID already exists. Choose a different one.');
       }
 
       gameId = customRoomId.toUpperCase();
@@ -137,11 +504,27 @@ class GameManager {
 
     const game: GameState = {
       id: gameId,
+      config,
+      proposal: null,
+      configAgreedAt: null,
+      features: this.flags.snapshot(gameId),
+      rulesVersion: RULES_VERSION,
       players: [],
       currentTurn: 0,
+      firstTurn: null,
+      emotes: [],
+      chat: [],
+      eventSeq: 0,
+      winProbabilityHistory: [],
+      clock: null,
+      stall: null,
+      moveLog: [],
+      cellHistory: [],
+      boardsLogged: null,
       actionTaken: false,
       phase: GamePhase.WAITING,
       winner: null,
+      result: null,
       moveCount: 0,
       startTime: Date.now(),
       createdAt: Date.now()
@@ -149,6 +532,7 @@ class GameManager {
 
     this.games.set(gameId, game);
     console.log(`Created new game: ${gameId} (${customRoomId ? 'custom' : 'random'} room ID)`);
+    this.events.emit({ type: 'gameCreated', gameId, config });
 
     // Broadcast to all connections that a new game is available
     this.broadcastNewGame(game);
@@ -156,18 +540,22 @@ class GameManager {
     return gameId;
   }
 
-  joinGame(gameId: string, ws: WebSocket, playerName?: string): { success: boolean; player?: Player; error?: string } {
+  joinGame(gameId: string, ws: WebSocket, playerName?: string): Player {
     gameId = gameId.toUpperCase();
     const game = this.games.get(gameId);
 
     if (!game) {
       console.log(`Game not found: ${gameId}`);
-      return { success: false, error: 'Game not found' };
+      throw new GameError(ErrorCode.GAME_NOT_FOUND, 'Game not found', { gameId });
     }
 
     if (game.players.length >= 2) {
       console.log(`Game full: ${gameId}`);
-      return { success: false, error: 'Game is full' };
+      throw new GameError(ErrorCode.GAME_FULL, 'Game is full', { gameId });
+    }
+    requireVariants(this.capabilitiesFor(ws), game.config, game.features);
+    if (game.phase === GamePhase.WAITING && game.players.length === 1) {
+      this.requireNoMaintenance();  // The second player would start a new match
     }
 
     // Check if this WebSocket is already in a game
@@ -176,16 +564,21 @@ class GameManager {
       this.leaveGame(ws);
     }
 
+    const user = this.connectionUsers.get(ws);
     const player: Player = {
       id: game.players.length,
       ws,
-      board: Utils.createEmptyBoard(),
-      visibleEnemyBoard: Utils.createEmptyBoard(),
-      tanks: [],
-      tanksAlive: 0,
+      ...Rules.createSide(game.config),
       ready: false,
-      name: playerName || Utils.getRandomName(),
-      joinTime: Date.now()
+      name: playerName || user?.name || Utils.getRandomName(),
+      joinTime: Date.now(),
+      recentActions: new Map(),
+      resumeToken: crypto.randomUUID(),
+      chatMuted: false,
+      userId: user?.id ?? null,
+      disconnectedAt: null,
+      premoves: [],
+      placedTanks: []
     };
 
     game.players.push(player);
@@ -193,23 +586,156 @@ class GameManager {
 
     console.log(`Player ${player.name} joined game ${gameId} as Player ${player.id + 1}`);
 
-    // Start placement phase when 2 players join
+    // Once both players are in, the creator's settings go to the joining player for approval
     if (game.players.length === 2) {
-      game.phase = GamePhase.PLACEMENT;
-      game.startTime = Date.now();
-      console.log(`Game ${gameId} entering placement phase with players: ${game.players.map(p => p.name).join(' vs ')}`);
+      if (game.features.settingsNegotiation) {
+        this.setPhase(game, GamePhase.SETUP);
+        game.proposal = { config: game.config, proposedBy: 0 };
+        console.log(`Game ${gameId} negotiating settings with players: ${game.players.map(p => p.name).join(' vs ')}`);
+      } else {
+        this.startPlacement(game, game.config);
+      }
     }
 
     if (DEBUG && game.id === '1234') {
-      game.phase = GamePhase.PLACEMENT;
+      this.setPhase(game, GamePhase.PLACEMENT);
       game.players[0].ready = true;
       console.log(`DEBUG mode: Auto-starting game ${gameId} with one player.`);
     }
 
+    if (player.userId) this.enforcePrivacy(player.userId);
     this.broadcastGameState(game);
     this.broadcastGameUpdate(game);
 
-    return { success: true, player };
+    return player;
+  }
+
+  // Pair this connection with the longest-waiting player, or queue it until someone arrives.
+  // With `maxRatingGap` only opponents rated within that many points are accepted, and a
+  // player waiting with a gap of their own is only matched within it; guests count as
+  // DEFAULT_RATING. Returns the queue position when the player has to wait, or 0 once matched.
+  quickMatch(ws: WebSocket, playerName?: string, maxRatingGap?: number): number {
+    this.requireNoMaintenance();
+    if (maxRatingGap !== undefined && (!Number.isInteger(maxRatingGap) || maxRatingGap < 0 || maxRatingGap > MAX_RATING_GAP)) {
+      throw new GameError(ErrorCode.VALIDATION_FAILED, 'Invalid rating gap', undefined, [
+        { field: 'maxRatingGap', reason: `must be an integer between 0 and ${MAX_RATING_GAP}` }
+      ]);
+    }
+    this.cancelQuickMatch(ws);
+    this.matchQueue = this.matchQueue.filter(entry => entry.ws.readyState === WebSocket.OPEN && !this.playerConnections.has(entry.ws));
+
+    const user = this.connectionUsers.get(ws);
+    const rating = user ? this.accounts.ratingOf(user.id) : DEFAULT_RATING;
+    const gap = maxRatingGap ?? null;
+    const opponentIndex = this.matchQueue.findIndex(entry => {
+      const difference = Math.abs(entry.rating - rating);
+      return (gap === null || difference <= gap) && (entry.maxRatingGap === null || difference <= entry.maxRatingGap);
+    });
+    const opponent = opponentIndex === -1 ? undefined : this.matchQueue.splice(opponentIndex, 1)[0];
+    if (!opponent) {
+      this.matchQueue.push({ ws, playerName, queuedAt: Date.now(), rating, maxRatingGap: gap });
+      console.log(`${playerName || 'Player'} queued for quick match (${this.matchQueue.length} waiting)`);
+      return this.matchQueue.length;
+    }
+
+    let game: GameState;
+    try {
+      game = this.createGameFor(ws);
+    } catch (error) {
+      this.matchQueue.unshift(opponent);
+      throw error;
+    }
+    let first: Player;
+    try {
+      first = this.joinGame(game.id, opponent.ws, opponent.playerName);
+    } catch (error) {
+      // The opponent's client can't play this game: they leave the queue and this player waits for someone else
+      this.send(opponent.ws, { type: 'error', error: toGameError(error).toEnvelope(this.localeFor(opponent.ws)) });
+      this.discardGame(game.id);
+      return this.quickMatch(ws, playerName, maxRatingGap);
+    }
+    this.sendJoined(opponent.ws, game, first);
+    const second = this.joinGame(game.id, ws, playerName);
+    this.sendJoined(ws, game, second);
+    console.log(`Quick match ${game.id}: ${first.name} vs ${second.name} after ${Date.now() - opponent.queuedAt}ms`);
+    return 0;
+  }
+
+  // Start a solo game against a computer opponent, which takes the second seat
+  playAi(ws: WebSocket, playerName?: string, difficulty: AiDifficulty = 'medium', config?: Partial<GameConfig>): string {
+    if (!AI_DIFFICULTIES.includes(difficulty)) {
+      throw new GameError(ErrorCode.VALIDATION_FAILED, 'Invalid AI difficulty', undefined, [
+        { field: 'difficulty', reason: `must be one of ${AI_DIFFICULTIES.join(', ')}` }
+      ]);
+    }
+
+    const game = this.createGameFor(ws, undefined, config);
+    const player = this.joinGame(game.id, ws, playerName);
+    this.sendJoined(ws, game, player);
+
+    const ai = new AiPlayer(this, difficulty);
+    this.joinGame(game.id, ai as unknown as WebSocket, `AI (${difficulty})`);
+    console.log(`Solo game ${game.id}: ${player.name} vs ${difficulty} AI`);
+    return game.id;
+  }
+
+  // Start a game against a registered bot (see bot.cts), which takes the second seat
+  playBot(ws: WebSocket, playerName?: string, botName?: string, config?: Partial<GameConfig>): string {
+    const definition = botName !== undefined && Object.hasOwn(this.bots, botName) ? this.bots[botName] : null;
+    if (!definition) {
+      const names = Object.keys(this.bots);
+      throw new GameError(ErrorCode.VALIDATION_FAILED, 'Invalid bot', undefined, [
+        { field: 'bot', reason: names.length > 0 ? `must be one of ${names.join(', ')}` : 'no bots are registered on this server' }
+      ]);
+    }
+
+    const game = this.createGameFor(ws, undefined, config);
+    const player = this.joinGame(game.id, ws, playerName);
+    this.sendJoined(ws, game, player);
+
+    const bot = new BotPlayer(this, definition);
+    this.joinGame(game.id, bot as unknown as WebSocket, `Bot (${definition.name})`);
+    console.log(`Bot game ${game.id}: ${player.name} vs ${definition.name}`);
+    return game.id;
+  }
+
+  // Create a game for a connection to play, unless it uses something the client can't show
+  private createGameFor(ws: WebSocket, customRoomId?: string, config?: Partial<GameConfig>): GameState {
+    const game = this.requireGame(this.createGame(customRoomId, config));
+    try {
+      requireVariants(this.capabilitiesFor(ws), game.config, game.features);
+    } catch (error) {
+      this.discardGame(game.id);
+      throw error;
+    }
+    return game;
+  }
+
+  // Drop a game nobody has sat down in yet
+  private discardGame(gameId: string): void {
+    this.games.delete(gameId);
+    this.broadcastGameRemoved(gameId);
+  }
+
+  cancelQuickMatch(ws: WebSocket): boolean {
+    const before = this.matchQueue.length;
+    this.matchQueue = this.matchQueue.filter(entry => entry.ws !== ws);
+    return this.matchQueue.length !== before;
+  }
+
+  private sendJoined(ws: WebSocket, game: GameState, player: Player): void {
+    this.send(ws, {
+      type: 'joined',
+      success: true,
+      gameId: game.id,
+      playerId: player.id,
+      playerName: player.name,
+      userId: player.userId,
+      resumeToken: player.resumeToken,
+      boardSize: game.config.boardSize,
+      tanksPerPlayer: game.config.tanksPerPlayer,
+      config: game.config
+    });
   }
 
   leaveGame(ws: WebSocket): void {
@@ -217,291 +743,1614 @@ class GameManager {
     if (!connection) return;
 
     const game = this.games.get(connection.gameId);
-    if (game) {
-      const disconnectedPlayer = game.players[connection.playerId];
-      console.log(`${disconnectedPlayer?.name || 'Player'} left game ${connection.gameId}`);
+    if (game) this.vacateSeat(game, connection.playerId);
+    this.playerConnections.delete(ws);
+  }
 
-      // Notify other players in the game
-      game.players.forEach((player, index) => {
-        if (index !== connection.playerId && player.ws.readyState === WebSocket.OPEN) {
-          player.ws.send(JSON.stringify({
-            type: 'playerDisconnected',
-            playerName: disconnectedPlayer?.name || 'Unknown Player',
-            playerId: connection.playerId
-          }));
-        }
-      });
+  // The player is gone for good: the game ends if nobody else is connected, and otherwise
+  // waits for a new opponent
+  private vacateSeat(game: GameState, playerId: number): void {
+    const disconnectedPlayer = game.players[playerId];
+    console.log(`${disconnectedPlayer?.name || 'Player'} left game ${game.id}`);
 
-      // Remove the game if no active players left
-      const activePlayers = game.players.filter(p => p.ws.readyState === WebSocket.OPEN && p.ws !== ws);
-      if (activePlayers.length === 0) {
-        this.games.delete(connection.gameId);
-        console.log(`Removed empty game: ${connection.gameId}`);
-        this.broadcastGameRemoved(connection.gameId);
-      } else if (activePlayers.length === 1 && game.phase !== GamePhase.WAITING) {
-        // Reset game to waiting state if only one player left
-        game.phase = GamePhase.WAITING;
-        game.players = activePlayers;
-        game.players[0].id = 0; // Reset player ID
-        game.currentTurn = 0;
-        this.playerConnections.set(activePlayers[0].ws, { gameId: connection.gameId, playerId: 0 });
-        this.broadcastGameState(game);
-        this.broadcastGameUpdate(game);
+    // Notify other players in the game
+    game.players.forEach((player, index) => {
+      if (index !== playerId && player.ws.readyState === WebSocket.OPEN) {
+        this.send(player.ws, {
+          type: 'playerDisconnected',
+          playerName: disconnectedPlayer?.name || 'Unknown Player',
+          playerId
+        });
       }
+    });
+
+    // Remove the game if no active players left
+    const activePlayers = game.players.filter((p, index) => index !== playerId && p.ws.readyState === WebSocket.OPEN);
+    if (activePlayers.length === 0) {
+      console.log(`Removed empty game: ${game.id}`);
+      this.retireGame(game);
+    } else if (activePlayers.length === 1 && game.phase !== GamePhase.WAITING && game.phase !== GamePhase.GAME_OVER) {
+      // Reset game to waiting state if only one player left; a finished game stays as it ended
+      this.setPhase(game, GamePhase.WAITING);
+      game.proposal = null;
+      game.configAgreedAt = null;
+      game.players = activePlayers;
+      game.players[0].id = 0; // Reset player ID
+      game.currentTurn = 0;
+      game.firstTurn = null;
+      this.playerConnections.set(activePlayers[0].ws, { gameId: game.id, playerId: 0 });
+      this.broadcastGameState(game);
+      this.broadcastGameUpdate(game);
     }
+  }
+
+  // A connection that dropped from a game under way keeps its seat for RECONNECT_GRACE_MS,
+  // so the player can take it back with their resume token and carry on where they were.
+  // False when there is no such seat to hold.
+  private holdSeat(ws: WebSocket): boolean {
+    const connection = this.playerConnections.get(ws);
+    const game = connection && this.games.get(connection.gameId);
+    if (!connection || !game || RECONNECT_GRACE_MS <= 0) return false;
+    if (![GamePhase.SETUP, GamePhase.PLACEMENT, GamePhase.BATTLE].includes(game.phase)) return false;
 
+    const player = game.players[connection.playerId];
+    player.disconnectedAt = Date.now();
     this.playerConnections.delete(ws);
+    const reconnectBy = player.disconnectedAt + RECONNECT_GRACE_MS;
+    console.log(`${player.name} dropped from game ${game.id}; holding their seat for ${RECONNECT_GRACE_MS / 1000}s`);
+
+    game.players.forEach((other, index) => {
+      if (index !== player.id && other.ws.readyState === WebSocket.OPEN) {
+        this.send(other.ws, { type: 'playerDisconnected', playerName: player.name, playerId: player.id, reconnectBy });
+      }
+    });
+    this.broadcastGameState(game);
+    return true;
   }
 
-  placeTank(gameId: string, playerId: number, x: number, y: number): boolean {
-    const game = this.games.get(gameId);
-    if (!game || game.phase !== GamePhase.PLACEMENT) {
-      return false;
+  // Runs on a timer: a dropped player who has not come back in time loses a battle by
+  // forfeit, or gives up their seat in a game that has not started
+  private checkDisconnects(): void {
+    const now = Date.now();
+    this.games.forEach(game => {
+      const player = game.players.find(p => p.disconnectedAt !== null && now - p.disconnectedAt >= RECONNECT_GRACE_MS);
+      if (!player) return;
+      player.disconnectedAt = null;
+      if (game.phase !== GamePhase.BATTLE) {
+        this.vacateSeat(game, player.id);
+        return;
+      }
+
+      const winner = 1 - player.id;
+      this.setPhase(game, GamePhase.GAME_OVER);
+      game.winner = winner;
+      game.result = this.signResult(game, 'abandoned');
+      this.recordResult(game);
+      console.log(`${player.name} did not come back and forfeits game ${game.id}`);
+      this.emitGameEvent(game, 'gameOver', { winner, winnerName: game.players[winner].name, reason: 'abandoned' });
+      this.broadcastGameState(game);
+      this.broadcastGameUpdate(game);
+    });
+  }
+
+  placeTank(gameId: string, playerId: number, x: number, y: number, orientation: Orientation = 'horizontal'): void {
+    const game = this.requireGame(gameId);
+    if (game.phase !== GamePhase.PLACEMENT) {
+      throw new GameError(ErrorCode.WRONG_PHASE, 'Tanks can only be placed during the placement phase', { phase: game.phase });
     }
 
     const player = game.players[playerId];
-    if (!player || player.tanks.length >= TANKS_PER_PLAYER) {
-      return false;
+    if (!player) {
+      throw new GameError(ErrorCode.NOT_IN_GAME, 'You are not a player in this game');
     }
-
-    if (!Utils.isValidPosition(x, y) || player.board[y][x] !== CellState.EMPTY) {
-      return false;
+    if (player.ready) {
+      throw new GameError(ErrorCode.PLACEMENT_CONFIRMED, 'Your placement is already confirmed');
     }
+    const { tanksPerPlayer } = game.config;
+    const tank = Rules.placeTank(game.config, player, x, y, orientation);
+
+    this.logMove(game, { action: 'place', playerId, x, y, orientation });
+    console.log(`${player.name} placed tank at (${x}, ${y}) - ${player.tanks.length}/${tanksPerPlayer}`);
+    this.emitGameEvent(game, 'tankPlaced', { playerId, tanksRemaining: tanksPerPlayer - player.tanks.length }, { playerId, data: { x, y, orientation, length: tank.cells.length } });
+    this.events.emit({ type: 'tankPlaced', gameId: game.id, playerId, tanksRemaining: tanksPerPlayer - player.tanks.length });
+  }
 
-    // Place tank
-    player.board[y][x] = CellState.TANK;
-    player.tanks.push({ x, y });
-    player.tanksAlive++;
+  // Take a tank back off the board; only until the player confirms their placement
+  removeTank(gameId: string, playerId: number, x: number, y: number): void {
+    const game = this.requireGame(gameId);
+    if (game.phase !== GamePhase.PLACEMENT) {
+      throw new GameError(ErrorCode.WRONG_PHASE, 'Tanks can only be taken back during the placement phase', { phase: game.phase });
+    }
+    const player = game.players[playerId];
+    if (!player) {
+      throw new GameError(ErrorCode.NOT_IN_GAME, 'You are not a player in this game');
+    }
+    if (player.ready) {
+      throw new GameError(ErrorCode.PLACEMENT_CONFIRMED, 'Your placement is already confirmed');
+    }
+    const tank = Rules.removeTank(game.config, player, x, y);
 
-    console.log(`${player.name} placed tank at (${x}, ${y}) - ${player.tanks.length}/${TANKS_PER_PLAYER}`);
+    this.logMove(game, { action: 'remove', playerId, x, y });
+    console.log(`${player.name} took back the tank at (${x}, ${y}) - ${player.tanks.length}/${game.config.tanksPerPlayer}`);
+    this.emitGameEvent(game, 'tankRemoved', { playerId, tanksRemaining: game.config.tanksPerPlayer - player.tanks.length }, { playerId, data: { x, y, cells: tank.cells } });
+  }
 
-    // Check if player is ready
-    if (player.tanks.length === TANKS_PER_PLAYER) {
-      player.ready = true;
-      console.log(`${player.name} ready for battle`);
+  // With every tank placed, the player locks in their layout. The battle starts once
+  // both have.
+  confirmPlacement(gameId: string, playerId: number): void {
+    const game = this.requireGame(gameId);
+    if (game.phase !== GamePhase.PLACEMENT) {
+      throw new GameError(ErrorCode.WRONG_PHASE, 'Placement can only be confirmed during the placement phase', { phase: game.phase });
+    }
+    const player = game.players[playerId];
+    if (!player) {
+      throw new GameError(ErrorCode.NOT_IN_GAME, 'You are not a player in this game');
+    }
+    if (player.ready) {
+      throw new GameError(ErrorCode.PLACEMENT_CONFIRMED, 'Your placement is already confirmed');
     }
+    const { tanksPerPlayer } = game.config;
+    if (player.tanks.length < tanksPerPlayer) {
+      throw new GameError(ErrorCode.PLACEMENT_INCOMPLETE, 'Place all your tanks before confirming', { tanksRemaining: tanksPerPlayer - player.tanks.length });
+    }
+
+    player.ready = true;
+    this.logMove(game, { action: 'confirm', playerId });
+    console.log(`${player.name} ready for battle`);
 
     // Check if both players are ready
-    if (game.players.length === 2 && game.players.every(p => p.ready)) {
-      game.phase = GamePhase.BATTLE;
-      console.log(`Game ${gameId} entering battle phase`);
+    const bothReady = game.players.length === 2 && game.players.every(p => p.ready);
+    if (bothReady) {
+      this.chooseFirstTurn(game);
+      this.startClock(game);
+      game.players.forEach(p => {
+        p.placedTanks = p.tanks.map(tank => ({ ...tank, cells: tank.cells.map(cell => ({ ...cell })) }));
+      });
+      this.setPhase(game, GamePhase.BATTLE);
+      this.recordWinProbability(game);
+      console.log(`Game ${gameId} entering battle phase, ${game.players[game.currentTurn].name} moves first (${game.config.firstMove})`);
     }
 
-    return true;
+    this.broadcastToGame(game, { type: 'playerReady', playerId, playerName: player.name, bothReady });
   }
 
-  moveTank(gameId: string, playerId: number, fromX: number, fromY: number, toX: number, toY: number): boolean {
-    const game = this.games.get(gameId);
-    if (!game || game.phase !== GamePhase.BATTLE || game.currentTurn !== playerId || game.actionTaken) {
-      return false;
+  // Place a whole layout at once; it must hold exactly the configured number of tanks.
+  // It still has to be confirmed like tanks placed one at a time.
+  placeLayout(gameId: string, playerId: number, layout: string): void {
+    const game = this.requireGame(gameId);
+    if (game.phase !== GamePhase.PLACEMENT) {
+      throw new GameError(ErrorCode.WRONG_PHASE, 'Tanks can only be placed during the placement phase', { phase: game.phase });
     }
-
     const player = game.players[playerId];
-    if (!player) return false;
-
-    // Validate positions
-    if (!Utils.isValidPosition(fromX, fromY) || !Utils.isValidPosition(toX, toY)) {
-      return false;
+    if (!player) {
+      throw new GameError(ErrorCode.NOT_IN_GAME, 'You are not a player in this game');
     }
-
-    // Check if there's a tank at source and destination is empty
-    if (player.board[fromY][fromX] !== CellState.TANK || player.board[toY][toX] !== CellState.EMPTY) {
-      return false;
+    if (player.tanks.length > 0) {
+      throw new GameError(ErrorCode.CELL_OCCUPIED, 'A layout can only be loaded onto an empty board');
     }
 
-    // Move tank
-    player.board[fromY][fromX] = CellState.EMPTY;
-    player.board[toY][toX] = CellState.TANK;
-
-    // Update tank position in tanks array
-    const tankIndex = player.tanks.findIndex(t => t.x === fromX && t.y === fromY);
-    if (tankIndex !== -1) {
-      player.tanks[tankIndex] = { x: toX, y: toY };
+    const { boardSize, tanksPerPlayer } = game.config;
+    if (game.config.tankLengths.some(length => length > 1)) {
+      throw new GameError(ErrorCode.VALIDATION_FAILED, 'Invalid layout', undefined, [
+        { field: 'layout', reason: 'layouts can only describe single-cell tanks; place longer tanks one at a time' }
+      ]);
     }
-    // After moving the tank, check if destination is in opponent's revealed area
-    const opponent = game.players[1 - playerId];
-    if (opponent.visibleEnemyBoard[toY][toX] === CellState.REVEALED) {
-      opponent.visibleEnemyBoard[toY][toX] = CellState.TANK;
+    const tanks = Rules.parseLayout(layout, boardSize);
+    if (tanks.length !== tanksPerPlayer) {
+      throw new GameError(ErrorCode.VALIDATION_FAILED, 'Invalid layout', { tanksPerPlayer }, [
+        { field: 'layout', reason: `must contain exactly ${tanksPerPlayer} tanks, found ${tanks.length}` }
+      ]);
     }
-    // Also clear the old position if it was visible
-    if (opponent.visibleEnemyBoard[fromY][fromX] === CellState.TANK) {
-      opponent.visibleEnemyBoard[fromY][fromX] = CellState.REVEALED;
+
+    tanks.forEach(({ x, y }) => this.placeTank(gameId, playerId, x, y));
+  }
+
+  moveTank(gameId: string, playerId: number, fromX: number, fromY: number, toX: number, toY: number): void {
+    const game = this.requireGame(gameId);
+    if (!game.features.tankMovement) {
+      throw new GameError(ErrorCode.FEATURE_DISABLED, 'Tank movement is disabled for this game');
     }
+    this.requireTurn(game, playerId);
+
+    const player = game.players[playerId];
+    const thinkMs = this.thinkTime(game);
+    Rules.moveTank(game.config, player, game.players[1 - playerId], fromX, fromY, toX, toY);
+
+    this.logMove(game, { action: 'move', playerId, x: fromX, y: fromY, toX, toY, thinkMs });
+    this.emitGameEvent(game, 'tankMoved', { playerId }, { playerId, data: { fromX, fromY, toX, toY } });
     game.actionTaken = true;
     this.switchTurn(game);
 
     console.log(`${player.name} moved tank from (${fromX}, ${fromY}) to (${toX}, ${toY})`);
-    return true;
   }
-  // Add this helper method to the GameManager class
-  private switchTurn(game: GameState): void {
-    game.currentTurn = 1 - game.currentTurn;
-    game.moveCount++;
-    game.actionTaken = false; // Reset for the next player's turn
+  // Counter-propose settings during setup; the other player must then accept
+  proposeSettings(gameId: string, playerId: number, proposed: any): void {
+    const game = this.requireGame(gameId);
+    if (game.phase !== GamePhase.SETUP) {
+      throw new GameError(ErrorCode.WRONG_PHASE, 'Settings can only be changed before placement begins', { phase: game.phase });
+    }
+    if (!game.players[playerId]) {
+      throw new GameError(ErrorCode.NOT_IN_GAME, 'You are not a player in this game');
+    }
+
+    const config = Rules.resolveConfig(proposed, game.proposal?.config || game.config);
+    game.players.forEach((player, index) => {
+      requireVariants(this.capabilitiesFor(player.ws), config, game.features, index === playerId ? 'your client' : "your opponent's client");
+    });
+    game.proposal = { config, proposedBy: playerId };
+    console.log(`${game.players[playerId].name} proposed settings for ${gameId}: ${JSON.stringify(config)}`);
+    this.broadcastGameState(game);
   }
 
-  bomb(gameId: string, playerId: number, x: number, y: number): { success: boolean; result: string; gameOver: boolean } {
-    const game = this.games.get(gameId);
-    if (!game || game.phase !== GamePhase.BATTLE || game.currentTurn !== playerId || game.actionTaken) {
-      return { result: 'Not your turn', gameOver: false, success: false };
+  acceptSettings(gameId: string, playerId: number): void {
+    const game = this.requireGame(gameId);
+    if (game.phase !== GamePhase.SETUP || !game.proposal) {
+      throw new GameError(ErrorCode.WRONG_PHASE, 'There are no settings waiting for approval', { phase: game.phase });
     }
-
-    const attacker = game.players[playerId];
-    const defender = game.players[1 - playerId];
-    if (!attacker || !defender) {
-      return { result: 'Invalid players', gameOver: false, success: false };
+    if (!game.players[playerId]) {
+      throw new GameError(ErrorCode.NOT_IN_GAME, 'You are not a player in this game');
     }
-
-    if (!Utils.isValidPosition(x, y)) {
-      return { result: 'Out of bounds', gameOver: false, success: false };
+    if (game.proposal.proposedBy === playerId) {
+      throw new GameError(ErrorCode.NOT_YOUR_TURN, 'Your opponent has to accept your proposal');
     }
 
-    // Check if already bombed
-    if (attacker.visibleEnemyBoard[y][x] === CellState.HIT || attacker.visibleEnemyBoard[y][x] === CellState.MISS) {
-      return { result: 'Already bombed', gameOver: false, success: false };
-    }
+    this.startPlacement(game, game.proposal.config);
+    this.broadcastGameState(game);
+    this.broadcastGameUpdate(game);
+  }
 
-    let result = '';
-    const targetCell = defender.board[y][x];
+  // Freeze the agreed settings into the game record and start placement on fresh boards
+  private startPlacement(game: GameState, config: GameConfig): void {
+    game.config = config;
+    game.proposal = null;
+    game.configAgreedAt = Date.now();
+    game.players.forEach(p => {
+      p.board = Rules.createEmptyBoard(game.config.boardSize);
+      p.visibleEnemyBoard = Rules.createEmptyBoard(game.config.boardSize);
+      p.tanks = [];
+      p.tanksAlive = 0;
+      p.abilitiesUsed = { airstrike: 0, cluster: 0, scan: 0 };
+      p.ready = false;
+      p.placedTanks = [];
+    });
+    game.moveLog = [];
+    game.cellHistory = [];
+    game.boardsLogged = null;
+    game.winProbabilityHistory = [];
+    game.clock = null;
+    game.stall = null;
+    this.setPhase(game, GamePhase.PLACEMENT);
+    game.startTime = Date.now();
+    console.log(`Game ${game.id} entering placement phase with settings ${JSON.stringify(game.config)}`);
+  }
 
-    if (targetCell === CellState.TANK) {
-      // HIT!
-      defender.board[y][x] = CellState.HIT;
-      defender.tanksAlive--;
-      result = `DIRECT HIT at (${String.fromCharCode(65 + x)}${y + 1})!`;
+  getPhase(gameId: string): GamePhase {
+    return this.requireGame(gameId).phase;
+  }
 
-      // Remove tank from defender's tanks array
-      defender.tanks = defender.tanks.filter(t => !(t.x === x && t.y === y));
+  hasGame(gameId: string): boolean {
+    return this.games.has(gameId);
+  }
 
-      // IMPORTANT: Update attacker's visible board to show HIT instead of TANK
-      attacker.visibleEnemyBoard[y][x] = CellState.HIT;
+  // The rules a game is played under, or a new game would start with when no game is given.
+  // A settings proposal still being negotiated is not in force yet, so it is not described.
+  getRules(gameId?: string): RulesDescription & { gameId: string | null; tankMovement: boolean; features: Record<FeatureFlag, boolean> } {
+    const game = gameId ? this.requireGame(gameId.toUpperCase()) : undefined;
+    const features = game ? game.features : this.flags.snapshot();
+    return { gameId: game?.id ?? null, ...Rules.describe(game ? game.config : this.defaultConfig), tankMovement: features.tankMovement, features };
+  }
 
-      console.log(`${attacker.name} hit ${defender.name}'s tank at (${x}, ${y})`);
+  // Every game waiting on the account's move, soonest deadline first. One account may sit in
+  // several games at once, on any connection, so this looks at seats rather than sockets.
+  getInbox(userId: string): InboxEntry[] {
+    const entries: InboxEntry[] = [];
+    this.games.forEach(game => {
+      game.players.forEach((player, index) => {
+        if (player.userId !== userId) return;
+        let action: InboxEntry['action'] | null = null;
+        if (game.phase === GamePhase.SETUP && game.proposal && game.proposal.proposedBy !== index) {
+          action = 'acceptSettings';
+        } else if (game.phase === GamePhase.PLACEMENT && !player.ready) {
+          action = 'place';
+        } else if (game.phase === GamePhase.BATTLE && game.currentTurn === index) {
+          action = 'turn';
+        }
+        if (!action) return;
+        entries.push({
+          gameId: game.id,
+          playerId: index,
+          phase: game.phase,
+          action,
+          opponent: game.players[1 - index]?.name ?? null,
+          moveCount: game.moveCount,
+          turnDeadline: this.turnDeadline(game)
+        });
+      });
+    });
+    return entries.sort((a, b) => (a.turnDeadline ?? Infinity) - (b.turnDeadline ?? Infinity) || a.gameId.localeCompare(b.gameId));
+  }
 
-      // Check win condition
-      if (defender.tanksAlive === 0) {
-        game.phase = GamePhase.GAME_OVER;
-        game.winner = playerId;
-        result += ` VICTORY! All enemy tanks destroyed!`;
-        console.log(`${attacker.name} wins game ${gameId}!`);
-        this.broadcastGameUpdate(game);
-        return { result, gameOver: true, success: true };
-      }
-    } else {
-      // MISS
-      if (targetCell === CellState.EMPTY) {
-        defender.board[y][x] = CellState.MISS;
-      }
-      // Update attacker's visible board to show MISS
-      attacker.visibleEnemyBoard[y][x] = CellState.MISS;
-      result = `Miss at (${String.fromCharCode(65 + x)}${y + 1})`;
-      console.log(`${attacker.name} missed at (${x}, ${y})`);
-    }
+  // Retire saves older than `policy` allows, except those of games loaded right now
+  runRetention(policy: RetentionPolicy): RetentionReport {
+    const report = applyRetention(this.store, policy, gameId => this.games.has(gameId.toUpperCase()));
+    console.log(describeReport(report));
+    return report;
+  }
 
-    // Reveal area around explosion for attacker
-    this.revealArea(attacker, defender, x, y);
+  // Write the game to the store so it can be resumed after it is gone from memory
+  saveGame(gameId: string): GameSnapshot {
+    const game = this.requireGame(gameId);
+    if (game.phase === GamePhase.GAME_OVER || game.phase === GamePhase.ABORTED) {
+      throw new GameError(ErrorCode.WRONG_PHASE, 'Only games in progress can be saved', { phase: game.phase });
+    }
 
-    // NEW: Update defender's board to show revealed areas
-    this.updateDefenderVisibility(defender, attacker, x, y);
+    const snapshot: GameSnapshot = { version: SNAPSHOT_VERSION, savedAt: new Date().toISOString(), game: Utils.serializeGame(game) };
+    this.writeSnapshot(game.id, snapshot);
+    console.log(`Saved game ${game.id} at move ${game.moveCount}`);
+    return snapshot;
+  }
 
-    // IMPORTANT: Ensure the bombed position shows correct state (this must be AFTER revealArea)
-    if (targetCell === CellState.TANK) {
-      attacker.visibleEnemyBoard[y][x] = CellState.HIT;
-    } else {
-      attacker.visibleEnemyBoard[y][x] = CellState.MISS;
+  // Take back a seat with its resume token, loading the game from the archive (a finished
+  // game) or from the store if it is no longer in memory
+  resumeGame(ws: WebSocket, gameId: string, resumeToken: string): Player {
+    gameId = String(gameId || '').toUpperCase();
+    let game = this.games.get(gameId) ?? this.rehydrate(gameId);
+    if (!game) {
+      const snapshot = this.readSnapshot(gameId);
+      game = Utils.restoreGame(snapshot.game);
+      this.games.set(game.id, game);
+      console.log(`Loaded saved game ${game.id} from ${snapshot.savedAt}`);
     }
 
-    // Switch turns and increment move count
-    game.actionTaken = true;
-    this.switchTurn(game);
+    const player = game.players.find(p => p.resumeToken === resumeToken);
+    if (!player) {
+      throw new GameError(ErrorCode.NOT_IN_GAME, 'That resume token does not match a seat in this game', { gameId });
+    }
+    if (player.ws !== ws && player.ws.readyState === WebSocket.OPEN && player.disconnectedAt === null) {
+      throw new GameError(ErrorCode.GAME_FULL, 'That seat is already connected', { gameId });
+    }
+    requireVariants(this.capabilitiesFor(ws), game.config, game.features);
 
+    if (this.playerConnections.has(ws)) {
+      this.leaveGame(ws);
+    }
+    const reconnected = player.disconnectedAt !== null;
+    player.ws = ws;
+    player.disconnectedAt = null;
+    this.playerConnections.set(ws, { gameId: game.id, playerId: player.id });
+    console.log(`${player.name} ${reconnected ? 'reconnected to' : 'resumed'} game ${game.id} as Player ${player.id + 1}`);
+
+    if (reconnected) {
+      game.players.forEach((other, index) => {
+        if (index !== player.id && other.ws.readyState === WebSocket.OPEN) {
+          this.send(other.ws, { type: 'playerReconnected', playerName: player.name, playerId: player.id });
+        }
+      });
+    }
+    this.sendJoined(ws, game, player);
     this.broadcastGameState(game);
-
-    return { result, gameOver: false, success: true };
+    this.broadcastGameUpdate(game);
+    return player;
   }
 
-  private updateDefenderVisibility(defender: Player, attacker: Player, centerX: number, centerY: number): void {
-    for (let dy = -EXPLOSION_RADIUS; dy <= EXPLOSION_RADIUS; dy++) {
-      for (let dx = -EXPLOSION_RADIUS; dx <= EXPLOSION_RADIUS; dx++) {
-        const x = centerX + dx;
-        const y = centerY + dy;
+  // Operator access to the full saved form of a game, hidden boards included
+  getSnapshot(gameId: string): GameSnapshot {
+    gameId = gameId.toUpperCase();
+    const game = this.games.get(gameId);
+    if (game) {
+      return { version: SNAPSHOT_VERSION, savedAt: new Date().toISOString(), game: Utils.serializeGame(game) };
+    }
+    try {
+      return this.readSnapshot(gameId);
+    } catch (error) {
+      const archived = toGameError(error).code === ErrorCode.GAME_NOT_FOUND ? this.readArchived(gameId) : null;
+      if (!archived) throw error;
+      return archived;
+    }
+  }
 
-        if (Utils.isValidPosition(x, y)) {
-          const defenderCell = defender.board[y][x];
+  // Store a snapshot so its players can resume it; a game still running is never overwritten
+  putSnapshot(gameId: string, snapshot: any): void {
+    gameId = gameId.toUpperCase();
+    if (this.games.has(gameId)) {
+      throw new GameError(ErrorCode.ROOM_EXISTS, 'That game is still running', { gameId });
+    }
+    if (snapshot?.version !== SNAPSHOT_VERSION) {
+      throw new GameError(ErrorCode.VALIDATION_FAILED, 'Invalid game snapshot', undefined, [{ field: 'version', reason: `must be ${SNAPSHOT_VERSION}` }]);
+    }
+    const game = Utils.restoreGame(snapshot.game);
+    if (game.id !== gameId) {
+      throw new GameError(ErrorCode.VALIDATION_FAILED, 'Invalid game snapshot', undefined, [{ field: 'game.id', reason: `must be ${gameId}` }]);
+    }
+    this.writeSnapshot(gameId, { version: SNAPSHOT_VERSION, savedAt: snapshot.savedAt || new Date().toISOString(), game: Utils.serializeGame(game) });
+  }
 
-          // If this cell is empty and the attacker can now see it, mark as REVEALED on defender's board
-          if (defenderCell === CellState.EMPTY && attacker.visibleEnemyBoard[y][x] !== CellState.EMPTY) {
-            defender.board[y][x] = CellState.REVEALED;
-          }
-        }
-      }
+  private readSnapshot(gameId: string): GameSnapshot {
+    let snapshot: GameSnapshot | null;
+    try {
+      snapshot = Utils.validateRoomId(gameId) ? this.store.load(gameId) : null;
+    } catch (error) {
+      console.error(`Failed to load game ${gameId}:`, error);
+      throw new GameError(ErrorCode.STORAGE_ERROR, 'The saved game could not be read', { gameId });
+    }
+    if (!snapshot) {
+      throw new GameError(ErrorCode.GAME_NOT_FOUND, 'Game not found', { gameId });
     }
+    return snapshot;
   }
 
-  private revealArea(attacker: Player, defender: Player, centerX: number, centerY: number): void {
-    for (let dy = -EXPLOSION_RADIUS; dy <= EXPLOSION_RADIUS; dy++) {
-      for (let dx = -EXPLOSION_RADIUS; dx <= EXPLOSION_RADIUS; dx++) {
-        const x = centerX + dx;
-        const y = centerY + dy;
+  // A failing disk is reported to the player but is no reason to abort their game
+  private writeSnapshot(gameId: string, snapshot: GameSnapshot): void {
+    try {
+      this.store.save(gameId, snapshot);
+    } catch (error) {
+      console.error(`Failed to save game ${gameId}:`, error);
+      throw new GameError(ErrorCode.STORAGE_ERROR, 'The game could not be saved', { gameId });
+    }
+  }
 
-        if (Utils.isValidPosition(x, y)) {
-          const defenderCell = defender.board[y][x];
-          const currentVisibleState = attacker.visibleEnemyBoard[y][x];
+  // Both boards as one player may see them: the player's own in full, the opponent's
+  // through the fog. Everything sent to a player about the boards comes from here.
+  boardView(gameId: string, playerId: number): BoardView {
+    const game = this.requireGame(gameId);
+    const player = game.players[playerId];
+    if (!player) {
+      throw new GameError(ErrorCode.NOT_IN_GAME, 'No such player in this game', { playerId });
+    }
+    return Rules.boardView(player);
+  }
 
-          // Don't overwrite already known HIT/MISS states
-          if (currentVisibleState === CellState.HIT || currentVisibleState === CellState.MISS) {
-            continue;
-          }
+  // Everything the player may do right now, as the messages that would do it, so clients
+  // can grey out the rest and bots and fuzzers can pick among them. Proposing settings
+  // takes any settings and is not listed; there is no resigning, only leaving, but for
+  // conceding a loss that is already forced.
+  legalActions(gameId: string, playerId: number): LegalAction[] {
+    const game = this.requireGame(gameId);
+    const player = game.players[playerId];
+    if (!player) {
+      throw new GameError(ErrorCode.NOT_IN_GAME, 'No such player in this game', { playerId });
+    }
 
-          // Only update if not already revealed/visible
-          if (currentVisibleState === CellState.EMPTY) {
-            if (defenderCell === CellState.TANK) {
-              attacker.visibleEnemyBoard[y][x] = CellState.TANK;
-            } else if (defenderCell === CellState.HIT) {
-              attacker.visibleEnemyBoard[y][x] = CellState.HIT;
-            } else if (defenderCell === CellState.MISS) {
-              attacker.visibleEnemyBoard[y][x] = CellState.MISS;
-            } else if (defenderCell === CellState.REVEALED) {
-              attacker.visibleEnemyBoard[y][x] = CellState.REVEALED;
-            } else {
-              attacker.visibleEnemyBoard[y][x] = CellState.REVEALED;
-            }
-          }
-        }
-      }
+    const actions: LegalAction[] = [];
+    if (game.phase === GamePhase.SETUP && game.proposal && game.proposal.proposedBy !== playerId) {
+      actions.push({ type: 'acceptSettings' });
+    } else if (game.phase === GamePhase.PLACEMENT && !player.ready) {
+      actions.push(...Rules.placementActions(game.config, player));
+    } else if (game.phase === GamePhase.BATTLE && game.currentTurn === playerId && !game.actionTaken && game.players[1 - playerId]) {
+      actions.push(...Rules.battleActions(game.config, player, game.features.tankMovement));
     }
+    if (this.forcedLoss(game, playerId) !== null) actions.push({ type: 'concede' });
+    if (game.phase !== GamePhase.GAME_OVER) actions.push({ type: 'leaveGame' });
+    return actions;
   }
 
-  private broadcastGameState(game: GameState): void {
-    const gameData = {
-      type: 'gameState',
-      gameId: game.id,
-      phase: game.phase,
-      currentTurn: game.currentTurn,
+  // The move log as one player may see it: until the game is over, where the
+  // opponent placed and moved tanks stays hidden
+  getMoveLog(gameId: string, viewer: number): MoveLogEntry[] {
+    const game = this.requireKeptGame(gameId);
+    if (game.phase === GamePhase.GAME_OVER) return game.moveLog;
+
+    return game.moveLog.map(entry => {
+      if ((entry.action !== 'place' && entry.action !== 'remove' && entry.action !== 'move') || entry.playerId === viewer) return entry;
+      const { seq, action, playerId, moveCount, timestamp } = entry;
+      return { seq, action, playerId, moveCount, timestamp } as MoveLogEntry;
+    });
+  }
+
+  // When and by whom each cell changed. Until the game is over a player sees only the
+  // boards of their own side: their fleet, and what they have uncovered of the enemy's.
+  getCellHistory(gameId: string, viewer: number): CellChange[] {
+    const game = this.requireKeptGame(gameId);
+    if (game.phase === GamePhase.GAME_OVER) return game.cellHistory;
+    return game.cellHistory.filter(change => change.owner === viewer);
+  }
+
+  // A player's boards as they stood after move log entry `seq`
+  getBoardsAt(gameId: string, viewer: number, seq: unknown): BoardView & { seq: number } {
+    const game = this.requireKeptGame(gameId);
+    if (!Number.isInteger(seq) || (seq as number) < 0 || (seq as number) > game.moveLog.length) {
+      throw new GameError(ErrorCode.VALIDATION_FAILED, 'Invalid move log entry', undefined, [
+        { field: 'seq', reason: `must be a move log entry from 0 to ${game.moveLog.length}` }
+      ]);
+    }
+    const mine = game.cellHistory.filter(change => change.owner === viewer);
+    const board = (view: CellChange['view']) => Rules.boardAt(game.config.boardSize, mine.filter(change => change.view === view), seq as number);
+    return { seq: seq as number, myBoard: board('own'), enemyBoard: board('enemy') };
+  }
+
+  // Announce maintenance in `inSeconds`. New games and matchmaking stop at once, and
+  // everyone connected is warned now and again as the countdown passes each mark.
+  scheduleMaintenance(inSeconds: number, message?: string, pauseClocks: boolean = false): Record<string, any> {
+    if (!Number.isInteger(inSeconds) || inSeconds < 0 || inSeconds > MAX_MAINTENANCE_NOTICE_S) {
+      throw new GameError(ErrorCode.VALIDATION_FAILED, 'Invalid maintenance notice', undefined, [
+        { field: 'inSeconds', reason: `must be an integer from 0 to ${MAX_MAINTENANCE_NOTICE_S}` }
+      ]);
+    }
+
+    this.maintenance = { startsAt: Date.now() + inSeconds * 1000, message: message || null, pauseClocks, announcedAt: inSeconds, begun: false };
+    console.log(`Maintenance scheduled in ${inSeconds}s${message ? `: ${message}` : ''}`);
+
+    // Nobody still waiting for an opponent will get one now
+    this.matchQueue.forEach(entry => {
+      if (entry.ws.readyState === WebSocket.OPEN) {
+        this.send(entry.ws, { type: 'quickMatchCancelled', success: true, reason: 'maintenance' });
+      }
+    });
+    this.matchQueue = [];
+
+    this.broadcastMaintenance();
+    this.checkMaintenance();
+    return this.getMaintenance()!;
+  }
+
+  cancelMaintenance(): boolean {
+    if (!this.maintenance) return false;
+    this.maintenance = null;
+    console.log('Maintenance cancelled');
+    this.broadcastMaintenance();
+    return true;
+  }
+
+  getMaintenance(): Record<string, any> | null {
+    if (!this.maintenance) return null;
+    const { startsAt, message, pauseClocks, begun } = this.maintenance;
+    return { startsAt, secondsLeft: Math.max(Math.ceil((startsAt - Date.now()) / 1000), 0), message, pauseClocks, begun };
+  }
+
+  private requireNoMaintenance(): void {
+    if (this.maintenance) {
+      throw new GameError(ErrorCode.MAINTENANCE, 'The server is going down for maintenance, so no new games can start', { startsAt: this.maintenance.startsAt });
+    }
+  }
+
+  // Runs on the clock timer: repeats the warning at each countdown mark, and when
+  // maintenance begins saves every game in progress so nothing is lost to the restart
+  private checkMaintenance(): void {
+    const maintenance = this.maintenance;
+    if (!maintenance || maintenance.begun) return;
+
+    const secondsLeft = Math.ceil((maintenance.startsAt - Date.now()) / 1000);
+    if (secondsLeft > 0) {
+      if (MAINTENANCE_WARNINGS_S.some(mark => secondsLeft <= mark && mark < maintenance.announcedAt)) {
+        maintenance.announcedAt = secondsLeft;
+        this.broadcastMaintenance();
+      }
+      return;
+    }
+
+    maintenance.begun = true;
+    let saved = 0;
+    this.games.forEach(game => {
+      if (game.phase === GamePhase.WAITING || game.phase === GamePhase.GAME_OVER || game.phase === GamePhase.ABORTED) return;
+      try {
+        this.saveGame(game.id);
+        saved++;
+      } catch (error) {
+        console.error(`Game ${game.id} could not be saved for maintenance:`, error);
+      }
+    });
+    console.log(`Maintenance begun; ${saved} game(s) saved`);
+    this.broadcastMaintenance();
+  }
+
+  // Everyone connected hears about maintenance, including players on HTTP sessions
+  private broadcastMaintenance(): void {
+    const message = { type: 'maintenance', maintenance: this.getMaintenance() };
+    const targets = new Set(this.allConnections);
+    this.games.forEach(game => game.players.forEach(p => targets.add(p.ws)));
+    targets.forEach(ws => {
+      if (ws.readyState === WebSocket.OPEN) this.send(ws, message);
+    });
+  }
+
+  // Post-game recap, including the win-probability series for frontends to chart. The
+  // times and figures are also written out for people to read, in `format`'s locale.
+  getGameSummary(gameId: string, format: string = DEFAULT_LOCALE): any {
+    const game = this.requireKeptGame(gameId);
+    if (game.phase !== GamePhase.GAME_OVER) {
+      throw new GameError(ErrorCode.WRONG_PHASE, 'The summary is available once the game is over', { phase: game.phase });
+    }
+
+    const history = game.winProbabilityHistory;
+    const stats = game.players.map((p, index) => moveStats(game.moveLog, index));
+    const finishedAt = this.finishedAt(game);
+    const durationMs = finishedAt - game.startTime;
+    const seconds = (ms: number | null) => ms === null ? null
+      : formatNumber(ms / 1000, format, { style: 'unit', unit: 'second', unitDisplay: 'short', maximumFractionDigits: 1 });
+    return {
+      gameId: game.id,
+      winner: game.winner,
+      winnerName: game.winner !== null ? game.players[game.winner]?.name : null,
+      players: game.players.map(p => ({ id: p.id, name: p.name, userId: p.userId, tanksAlive: p.tanksAlive })),
+      config: game.config,
+      firstTurn: game.firstTurn,
+      moveCount: game.moveCount,
+      durationMs,
+      winProbability: history,
+      moveLog: game.moveLog,
+      fleets: this.revealFleets(game),
+      boardImage: this.finalBoardsImage(game),
+      sparklines: game.players.map((p, index) => sparkline(history.map(h => h.players[index]))),
+      moveStats: stats,
+      signedResult: game.result,
+      formatted: {
+        locale: format,
+        startedAt: formatDate(game.startTime, format),
+        finishedAt: formatDate(finishedAt, format),
+        duration: formatDuration(durationMs, format),
+        moveCount: formatNumber(game.moveCount, format),
+        players: stats.map(stat => ({
+          averageThinkTime: seconds(stat.averageThinkMs),
+          medianThinkTime: seconds(stat.medianThinkMs),
+          averageShotQuality: stat.averageShotQuality === null ? null : formatNumber(stat.averageShotQuality, format)
+        }))
+      }
+    };
+  }
+
+  // Watch a game without playing. Spectators get the public event stream and a
+  // results-only view of both boards; nothing either player has kept hidden.
+  spectate(ws: WebSocket, gameId: string): void {
+    const game = this.requireGame(String(gameId || '').toUpperCase());
+    if (game.features.spectators === false) {  // Games saved before the flag existed allow spectators
+      throw new GameError(ErrorCode.FEATURE_DISABLED, 'Spectators are not allowed in this game');
+    }
+    requireVariants(this.capabilitiesFor(ws), game.config, game.features);
+    if (!this.mayWatch(game, this.connectionUsers.get(ws)?.id ?? null)) {
+      throw new GameError(ErrorCode.FORBIDDEN, 'The players keep this game private', { gameId: game.id });
+    }
+    if (this.playerConnections.has(ws)) {
+      this.leaveGame(ws);
+    }
+    this.stopSpectating(ws);
+
+    const watchers = this.spectators.get(game.id) ?? new Set<WebSocket>();
+    watchers.add(ws);
+    this.spectators.set(game.id, watchers);
+    this.spectating.set(ws, game.id);
+    console.log(`Spectator joined game ${game.id} (${watchers.size} watching)`);
+
+    this.send(ws, { type: 'spectating', success: true, gameId: game.id });
+    this.broadcastGameState(game);
+  }
+
+  stopSpectating(ws: WebSocket): boolean {
+    const gameId = this.spectating.get(ws);
+    if (!gameId) return false;
+    this.spectating.delete(ws);
+    const watchers = this.spectators.get(gameId);
+    watchers?.delete(ws);
+    if (watchers?.size === 0) this.spectators.delete(gameId);
+
+    const game = this.games.get(gameId);
+    if (game) this.broadcastGameState(game);
+    return true;
+  }
+
+  // Whether the viewer (an account id, or null for a guest) may see the game in the lobby
+  // and watch it: every signed-in player must share their live games with them, unless
+  // they play in it themselves
+  private mayWatch(game: GameState, viewerId: string | null): boolean {
+    if (viewerId !== null && game.players.some(p => p.userId === viewerId)) return true;
+    return game.players.every(p => !p.userId || this.accounts.canSee(p.userId, 'liveGames', viewerId));
+  }
+
+  // Send away the spectators of the account's games who may no longer watch them, after
+  // it sat down in one or changed its privacy settings
+  enforcePrivacy(userId: string): void {
+    this.games.forEach(game => {
+      if (!game.players.some(p => p.userId === userId)) return;
+      this.openSpectators(game)
+        .filter(ws => !this.mayWatch(game, this.connectionUsers.get(ws)?.id ?? null))
+        .forEach(ws => {
+          this.stopSpectating(ws);
+          this.send(ws, { type: 'error', error: new GameError(ErrorCode.FORBIDDEN, 'The players keep this game private', { gameId: game.id }).toEnvelope(this.localeFor(ws)) });
+        });
+    });
+  }
+
+  getSpectating(ws: WebSocket): string | undefined {
+    return this.spectating.get(ws);
+  }
+
+  private spectatorCount(game: GameState): number {
+    return this.spectators.get(game.id)?.size ?? 0;
+  }
+
+  private openSpectators(game: GameState): WebSocket[] {
+    return [...(this.spectators.get(game.id) ?? [])].filter(ws => ws.readyState === WebSocket.OPEN);
+  }
+
+  // Every phase change goes through here so an impossible transition is caught
+  // where it happens instead of leaving the game in a state no handler expects
+  private setPhase(game: GameState, next: GamePhase): void {
+    if (game.phase === next) return;
+    if (!PHASE_TRANSITIONS[game.phase].includes(next)) {
+      throw new Error(`Illegal phase transition for game ${game.id}: ${game.phase} -> ${next}`);
+    }
+    const previous = game.phase;
+    game.phase = next;
+    this.emitGameEvent(game, 'phaseChanged', { from: previous, to: next });
+  }
+
+  private requireGame(gameId: string): GameState {
+    const game = this.games.get(gameId);
+    if (!game) {
+      throw new GameError(ErrorCode.GAME_NOT_FOUND, 'Game not found', { gameId });
+    }
+    return game;
+  }
+
+  // A game to read the record of: in memory, or a finished one loaded back from the archive
+  private requireKeptGame(gameId: string): GameState {
+    const game = this.games.get(gameId) ?? this.rehydrate(gameId);
+    if (!game) {
+      throw new GameError(ErrorCode.GAME_NOT_FOUND, 'Game not found', { gameId });
+    }
+    return game;
+  }
+
+  // When a finished game ended: its last logged entry
+  private finishedAt(game: GameState): number {
+    return game.moveLog[game.moveLog.length - 1]?.timestamp ?? game.startTime;
+  }
+
+  // Where a game is in its life: being played, finished but still in memory, or archived
+  getLifecycle(gameId: string): { gameId: string; lifecycle: GameLifecycle; phase: GamePhase; finishedAt: string | null } {
+    gameId = String(gameId || '').toUpperCase();
+    const live = this.games.get(gameId);
+    const archived = live ? null : this.readArchived(gameId);
+    const game = live ?? (archived && Utils.restoreGame(archived.game));
+    if (!game) {
+      throw new GameError(ErrorCode.GAME_NOT_FOUND, 'Game not found', { gameId });
+    }
+    const finished = game.phase === GamePhase.GAME_OVER;
+    return {
+      gameId,
+      lifecycle: archived ? 'archived' : finished ? 'finished' : 'active',
+      phase: game.phase,
+      finishedAt: finished ? new Date(this.finishedAt(game)).toISOString() : null
+    };
+  }
+
+  // One of a moderation flag's games as the moderator reviewing it sees it: who played,
+  // the chat still in memory and, once it is over, every action. A game still being played
+  // keeps its boards hidden, and one no longer kept anywhere comes back as gone.
+  getEvidence(gameId: string): any {
+    gameId = String(gameId || '').toUpperCase();
+    const live = this.games.get(gameId);
+    const archived = live ? null : this.readArchived(gameId);
+    const game = live ?? (archived && Utils.restoreGame(archived.game));
+    if (!game) return { gameId, lifecycle: 'gone' };
+
+    const finished = game.phase === GamePhase.GAME_OVER;
+    return {
+      gameId,
+      lifecycle: archived ? 'archived' : finished ? 'finished' : 'active',
+      phase: game.phase,
+      players: game.players.map(p => ({ id: p.id, name: p.name, userId: p.userId })),
+      winner: game.winner,
+      moveCount: game.moveCount,
+      moveLog: finished ? game.moveLog : null,
+      chat: game.chat
+    };
+  }
+
+  // The archived snapshot of a finished game, if finished games are archived and it is there
+  private readArchived(gameId: string): GameSnapshot | null {
+    if (!this.archive || !Utils.validateRoomId(gameId)) return null;
+    let snapshot: GameSnapshot | null;
+    try {
+      snapshot = this.archive.load(gameId);
+    } catch (error) {
+      console.error(`Failed to read archived game ${gameId}:`, error);
+      throw new GameError(ErrorCode.STORAGE_ERROR, 'The archived game could not be read', { gameId });
+    }
+    // Saves retired by the retention policy are archived too, but are not finished games
+    return snapshot?.version === SNAPSHOT_VERSION && snapshot.game?.phase === GamePhase.GAME_OVER ? snapshot : null;
+  }
+
+  // Load an archived game back into memory for its record to be read; it leaves again
+  // like any other finished game
+  private rehydrate(gameId: string): GameState | undefined {
+    const snapshot = this.readArchived(gameId);
+    if (!snapshot) return undefined;
+    const game = Utils.restoreGame(snapshot.game);
+    this.games.set(game.id, game);
+    this.fromArchive.add(game.id);
+    console.log(`Loaded archived game ${game.id} from ${snapshot.savedAt}`);
+    return game;
+  }
+
+  // Take a game out of memory. A finished game is archived first, if finished games are
+  // archived and it has not been already.
+  private retireGame(game: GameState): void {
+    if (this.archive && game.phase === GamePhase.GAME_OVER && !this.fromArchive.has(game.id)) {
+      try {
+        const { file } = this.archive.put(game.id, { version: SNAPSHOT_VERSION, savedAt: new Date().toISOString(), game: Utils.serializeGame(game) });
+        console.log(`Archived finished game ${game.id} to ${file}`);
+      } catch (error) {
+        console.error(`Failed to archive game ${game.id}:`, error);
+      }
+    }
+    this.fromArchive.delete(game.id);
+    this.games.delete(game.id);
+    this.broadcastGameRemoved(game.id);
+  }
+
+  // Battle actions are only allowed for the player whose turn it is
+  private requireTurn(game: GameState, playerId: number): void {
+    if (game.phase === GamePhase.GAME_OVER) {
+      throw new GameError(ErrorCode.GAME_OVER, 'The game is over');
+    }
+    if (game.phase === GamePhase.PLACEMENT) {
+      throw new GameError(ErrorCode.WRONG_PHASE, 'Both players must finish placing their tanks first', {
+        phase: game.phase,
+        ready: game.players.map(p => p.ready)
+      });
+    }
+    if (game.phase !== GamePhase.BATTLE) {
+      throw new GameError(ErrorCode.WRONG_PHASE, 'The battle has not started yet', { phase: game.phase });
+    }
+    if (!game.players[playerId] || !game.players[1 - playerId]) {
+      throw new GameError(ErrorCode.NOT_IN_GAME, 'Invalid players');
+    }
+    if (game.currentTurn !== playerId || game.actionTaken) {
+      throw new GameError(ErrorCode.NOT_YOUR_TURN, 'Not your turn', { currentTurn: game.currentTurn });
+    }
+  }
+
+  private chooseFirstTurn(game: GameState): void {
+    const policy = game.config.firstMove;
+    const playerId = policy === 'joiner' ? 1 : policy === 'random' ? crypto.randomInt(2) : 0;
+    game.firstTurn = { policy, playerId };
+    game.currentTurn = playerId;
+  }
+
+  // Add this helper method to the GameManager class
+  private switchTurn(game: GameState): void {
+    // Charge the finished turn to the mover's game time before the clock restarts
+    if (game.clock) {
+      const now = Date.now();
+      if (game.clock.banks) {
+        game.clock.banks[game.currentTurn] = Math.max(game.clock.banks[game.currentTurn] - (now - game.clock.turnStartedAt), 0);
+      }
+      game.clock.turnStartedAt = now;
+      game.clock.warned = false;
+    }
+    if (game.stall) {
+      game.stall.turnStartedAt = Date.now();
+      game.stall.nudges = 0;
+    }
+
+    game.currentTurn = 1 - game.currentTurn;
+    game.moveCount++;
+    game.actionTaken = false; // Reset for the next player's turn
+    if (Rules.limitReached(game.config, game.moveCount, game.moveLog)) {
+      this.endAtLimit(game);
+      return;
+    }
+    // Out of shots while the opponent still has some: there is nothing to do but pass
+    if (Rules.shotsLeft(game.config, game.moveLog, game.currentTurn) === 0) {
+      console.log(`${game.players[game.currentTurn].name} has no shots left in game ${game.id}, turn passes`);
+      this.emitGameEvent(game, 'turnPassed', { playerId: game.currentTurn, reason: 'outOfShots' });
+      this.switchTurn(game);
+      return;
+    }
+    this.recordWinProbability(game);
+    this.emitGameEvent(game, 'turnChanged', { currentTurn: game.currentTurn, turnDeadline: this.turnDeadline(game) });
+    this.settlePremoves(game);
+  }
+
+  private startClock(game: GameState): void {
+    const { turnTimeSeconds, gameTimeSeconds } = game.config;
+    if (turnTimeSeconds === 0 && gameTimeSeconds === 0) {
+      game.stall = { turnStartedAt: Date.now(), nudges: 0, stalledTurns: [0, 0] };
+      return;
+    }
+    game.clock = {
+      turnStartedAt: Date.now(),
+      banks: gameTimeSeconds > 0 ? [gameTimeSeconds * 1000, gameTimeSeconds * 1000] : null,
+      warned: false
+    };
+  }
+
+  // When the current turn runs out: the turn limit or the mover's remaining game time, whichever is sooner
+  private turnDeadline(game: GameState): number | null {
+    if (!game.clock || game.phase !== GamePhase.BATTLE) return null;
+    const limits: number[] = [];
+    if (game.config.turnTimeSeconds > 0) limits.push(game.config.turnTimeSeconds * 1000);
+    if (game.clock.banks) limits.push(game.clock.banks[game.currentTurn]);
+    return game.clock.turnStartedAt + Math.min(...limits);
+  }
+
+  // Runs on a timer: warns players who are low on time and ends turns that have run out
+  private checkClocks(): void {
+    const now = Date.now();
+    const elapsed = now - this.lastClockCheck;
+    this.lastClockCheck = now;
+
+    this.games.forEach(game => {
+      if (game.phase !== GamePhase.BATTLE) return;
+      if (game.stall) {
+        this.checkStall(game, game.stall, now, elapsed);
+        return;
+      }
+      if (!game.clock) return;
+
+      if (this.clockPaused(game)) {
+        game.clock.turnStartedAt += elapsed;
+        return;
+      }
+
+      const deadline = this.turnDeadline(game)!;
+      if (now >= deadline) {
+        const outOfGameTime = !!game.clock.banks && game.clock.banks[game.currentTurn] <= now - game.clock.turnStartedAt;
+        this.expireTurn(game.id, outOfGameTime ? 'forfeit' : game.config.timeoutAction);
+      } else if (!game.clock.warned && deadline - now <= TURN_WARNING_MS) {
+        game.clock.warned = true;
+        this.emitGameEvent(game, 'turnTimeWarning', { playerId: game.currentTurn, remainingMs: deadline - now, turnDeadline: deadline });
+      }
+    });
+  }
+
+  // Clocks stop while a seat is empty, e.g. a loaded game waiting to be resumed, and
+  // during maintenance if staff asked for it
+  private clockPaused(game: GameState): boolean {
+    const paused = this.maintenance?.begun && this.maintenance.pauseClocks;
+    return !!paused || game.players.some(p => p.ws.readyState !== WebSocket.OPEN);
+  }
+
+  // Nudge the player to move in an untimed battle who has gone quiet, and time their
+  // turn out once they have stalled for too long
+  private checkStall(game: GameState, stall: StallWatch, now: number, elapsed: number): void {
+    if (this.clockPaused(game)) {
+      stall.turnStartedAt += elapsed;
+      return;
+    }
+
+    const { nudgeMs, timeoutMs, action, forfeitAfter } = STALL_POLICY;
+    const playerId = game.currentTurn;
+    const idleMs = now - stall.turnStartedAt;
+    if (timeoutMs > 0 && idleMs >= timeoutMs) {
+      stall.stalledTurns[playerId]++;
+      const forfeit = action === 'forfeit' || (forfeitAfter > 0 && stall.stalledTurns[playerId] >= forfeitAfter);
+      this.expireTurn(game.id, forfeit ? 'forfeit' : action, true);
+    } else if (nudgeMs > 0 && idleMs >= nudgeMs * (stall.nudges + 1)) {
+      stall.nudges++;
+      this.emitGameEvent(game, 'stallNudge', {
+        playerId,
+        idleMs,
+        timesOutAt: timeoutMs > 0 ? stall.turnStartedAt + timeoutMs : null,
+        stalledTurns: stall.stalledTurns[playerId]
+      });
+    }
+  }
+
+  // The player to move has run out of time, or in an untimed game stalled for too long:
+  // either the turn passes to the opponent or the opponent wins. Replays call this
+  // directly with the logged action.
+  expireTurn(gameId: string, action: TimeoutAction, stalled: boolean = false): void {
+    const game = this.requireGame(gameId);
+    if (game.phase !== GamePhase.BATTLE) {
+      throw new GameError(ErrorCode.WRONG_PHASE, 'Only a turn in battle can run out of time', { phase: game.phase });
+    }
+
+    const playerId = game.currentTurn;
+    const player = game.players[playerId];
+    this.logMove(game, { action: 'timeout', playerId, timeoutAction: action });
+    this.emitGameEvent(game, 'turnTimedOut', { playerId, action, ...(stalled && { stalled }) });
+
+    if (action === 'forfeit') {
+      const winner = 1 - playerId;
+      this.setPhase(game, GamePhase.GAME_OVER);
+      game.winner = winner;
+      game.result = this.signResult(game, 'timeout');
+      this.recordResult(game);
+      console.log(`${player.name} ${stalled ? 'stalled' : 'ran out of time'} and forfeits game ${gameId}`);
+      this.emitGameEvent(game, 'gameOver', { winner, winnerName: game.players[winner].name, reason: 'timeout' });
+      this.broadcastGameState(game);
+      this.broadcastGameUpdate(game);
+      return;
+    }
+
+    console.log(`${player.name} ${stalled ? 'stalled' : 'ran out of time'} in game ${gameId}, turn passes`);
+    this.switchTurn(game);
+    this.broadcastGameState(game);
+  }
+
+  // Log an action once it has been applied, with every cell it changed
+  private logMove(game: GameState, entry: Omit<MoveLogEntry, 'seq' | 'moveCount' | 'timestamp'>): void {
+    const logged: MoveLogEntry = { seq: game.moveLog.length + 1, moveCount: game.moveCount, timestamp: Date.now(), ...entry };
+    game.moveLog.push(logged);
+
+    const boards = game.players.flatMap(p => [p.board, p.visibleEnemyBoard]);
+    const defender = 1 - logged.playerId;
+    const destroyed = game.players[defender]
+      ? tanksDestroyedSince(game.players[defender].tanks, game.boardsLogged?.[defender * 2] ?? Rules.createEmptyBoard(game.config.boardSize))
+      : 0;
+    boards.forEach((board, index) => {
+      const before = game.boardsLogged?.[index] ?? Rules.createEmptyBoard(game.config.boardSize);
+      Rules.diffBoard(before, board).forEach(cell => game.cellHistory.push({
+        seq: logged.seq,
+        moveCount: logged.moveCount,
+        playerId: logged.playerId,
+        owner: Math.floor(index / 2),
+        view: index % 2 === 0 ? 'own' : 'enemy',
+        ...cell
+      }));
+    });
+    game.boardsLogged = boards.map(board => board.map(row => [...row]));
+    this.broadcastCommentary(game, logged, destroyed);
+  }
+
+  // Spectators hear each logged entry described, naming cells in their own coordinate
+  // system; the commentary event carries it to anything else listening
+  private broadcastCommentary(game: GameState, entry: MoveLogEntry, destroyed: number): void {
+    const describe = (coordinates: CoordinateSystem) => commentate(entry, {
+      gameId: game.id,
+      names: game.players.map(p => p.name),
+      config: { ...game.config, coordinates },
+      moveLog: game.moveLog,
+      destroyed,
+      remaining: game.players[1 - entry.playerId]?.tanksAlive ?? 0
+    });
+    const message = { type: 'commentary', gameId: game.id, seq: entry.seq, moveCount: entry.moveCount, playerId: entry.playerId };
+    this.openSpectators(game).forEach(ws => this.send(ws, { ...message, text: describe(this.coordinatesFor(ws, game.config)) }));
+    this.events.emit({ type: 'commentary', gameId: game.id, seq: entry.seq, playerId: entry.playerId, text: describe(game.config.coordinates) });
+  }
+
+  // How long the player to move has taken: since the last logged action, which ended
+  // the previous turn or, for the first, placement
+  private thinkTime(game: GameState): number {
+    const previous = game.moveLog[game.moveLog.length - 1];
+    return Date.now() - (previous?.timestamp ?? game.startTime);
+  }
+
+  private recordWinProbability(game: GameState): void {
+    const probabilities = this.getWinProbability(game);
+    if (probabilities) {
+      game.winProbabilityHistory.push({ moveCount: game.moveCount, players: probabilities });
+    }
+  }
+
+  // Push a typed event to both players. Fields in ownerOnly go to that player alone,
+  // so the opponent learns that something happened without learning where.
+  private emitGameEvent(
+    game: GameState,
+    event: string,
+    data: Record<string, any>,
+    ownerOnly?: { playerId: number; data: Record<string, any> }
+  ): void {
+    game.eventSeq++;
+    const base = { type: 'gameEvent', event, gameId: game.id, seq: game.eventSeq, moveCount: game.moveCount, ...data };
+    // Cell names are written in whichever coordinate system each recipient reads
+    const named = (ws: WebSocket, message: Record<string, any>) =>
+      message.cell === undefined ? message : { ...message, cell: formatCell(this.coordinatesFor(ws, game.config), message.x, message.y) };
+    game.players.forEach((player, index) => {
+      if (player.ws.readyState !== WebSocket.OPEN) return;
+      this.send(player.ws, named(player.ws, ownerOnly && ownerOnly.playerId === index ? { ...base, ...ownerOnly.data } : base));
+    });
+    this.openSpectators(game).forEach(ws => this.send(ws, named(ws, base)));
+  }
+
+  bomb(
+    gameId: string,
+    playerId: number,
+    x: number,
+    y: number,
+    premove?: Premove['condition']  // Set when the server plays the bomb from a premove
+  ): { outcome: 'hit' | 'miss' | 'victory'; cell: string; destroyed: boolean; gameOver: boolean } {
+    const game = this.requireGame(gameId);
+    this.requireTurn(game, playerId);
+
+    const attacker = game.players[playerId];
+    const defender = game.players[1 - playerId];
+
+    const cell = formatCell(game.config.coordinates, x, y);
+    const thinkMs = this.thinkTime(game);
+    // Graded against the attacker's view before the shot, once the shot is known to be legal
+    const scores = game.features.moveAnalysis
+      ? scoreTargets({ enemyBoard: Rules.boardView(attacker).enemyBoard, explosionRadius: game.config.explosionRadius })
+      : null;
+    const { hit, destroyed } = Rules.bomb(game.config, attacker, defender, x, y);
+    const quality = scores ? gradeShot(scores, x, y) : undefined;
+    let outcome: 'hit' | 'miss' | 'victory' = hit ? 'hit' : 'miss';
+    this.emitGameEvent(game, 'bombResult', { playerId, x, y, cell, outcome, destroyed, tanksRemaining: defender.tanksAlive, ...(premove && { premove }) });
+    this.events.emit({ type: 'bombResolved', gameId, playerId, x, y, cell, hit, destroyed, tanksRemaining: defender.tanksAlive, thinkMs, quality });
+
+    if (hit) {
+      console.log(`${attacker.name} hit ${defender.name}'s tank at (${x}, ${y})`);
+
+      // Check win condition
+      if (defender.tanksAlive === 0) {
+        outcome = 'victory';
+        this.declareVictory(game, playerId, { action: 'bomb', playerId, x, y, outcome, thinkMs, quality, premove });
+        return { outcome, cell, destroyed, gameOver: true };
+      }
+    } else {
+      console.log(`${attacker.name} missed at (${x}, ${y})`);
+    }
+    this.logMove(game, { action: 'bomb', playerId, x, y, outcome, thinkMs, quality, premove });
+
+    // Switch turns and increment move count
+    game.actionTaken = true;
+    this.switchTurn(game);
+
+    this.broadcastGameState(game);
+
+    return { outcome, cell, destroyed, gameOver: game.phase === GamePhase.GAME_OVER };
+  }
+
+  // Queue a bomb for a later turn, to be played only if the shot at the condition's cell
+  // comes out as given. The condition names the player's last bomb, while the opponent is
+  // still to reply, or a cell they have yet to bomb. Returns the player's queue.
+  queuePremove(gameId: string, playerId: number, condition: Premove['condition'], x: number, y: number): Premove[] {
+    const game = this.requireGame(gameId);
+    if (game.phase !== GamePhase.BATTLE) {
+      throw new GameError(ErrorCode.WRONG_PHASE, 'Premoves can only be queued during the battle', { phase: game.phase });
+    }
+    const player = game.players[playerId];
+    const invalid = (field: string, reason: string) => new GameError(ErrorCode.VALIDATION_FAILED, 'Invalid premove', undefined, [{ field, reason }]);
+    if (condition.outcome !== 'hit' && condition.outcome !== 'miss') {
+      throw invalid('if.outcome', "must be 'hit' or 'miss'");
+    }
+    [condition, { x, y }].forEach(cell => {
+      if (!Rules.isValidPosition(cell.x, cell.y, game.config.boardSize)) {
+        throw new GameError(ErrorCode.OUT_OF_BOUNDS, 'Out of bounds', { x: cell.x, y: cell.y, boardSize: game.config.boardSize });
+      }
+    });
+    if (this.bombedBy(player, x, y)) {
+      throw new GameError(ErrorCode.ALREADY_BOMBED, 'Already bombed', { x, y });
+    }
+    if (condition.x === x && condition.y === y) {
+      throw invalid('cell', 'must be a different cell from the one in the condition');
+    }
+    const last = game.moveLog.findLast(entry => entry.action === 'bomb' && entry.playerId === playerId);
+    const awaitingReply = game.currentTurn !== playerId && last?.x === condition.x && last?.y === condition.y;
+    if (this.bombedBy(player, condition.x, condition.y) && !awaitingReply) {
+      throw invalid('if', 'must be your last bomb, before your opponent replies, or a cell you have not bombed yet');
+    }
+    if (player.premoves.length >= MAX_PREMOVES) {
+      throw invalid('premoves', `at most ${MAX_PREMOVES} may be queued at once`);
+    }
+
+    player.premoves.push({ condition: { x: condition.x, y: condition.y, outcome: condition.outcome }, x, y });
+    console.log(`${player.name} queued a premove in game ${gameId}: if (${condition.x}, ${condition.y}) is a ${condition.outcome}, bomb (${x}, ${y})`);
+    return player.premoves;
+  }
+
+  // Drop every premove the player has queued; returns how many there were
+  cancelPremoves(gameId: string, playerId: number): number {
+    const player = this.requireGame(gameId).players[playerId];
+    const cancelled = player.premoves.length;
+    player.premoves = [];
+    return cancelled;
+  }
+
+  private bombedBy(player: Player, x: number, y: number): boolean {
+    const cell = player.visibleEnemyBoard[y][x];
+    return cell === CellState.HIT || cell === CellState.MISS;
+  }
+
+  // At the start of a turn, check the mover's premoves against the bomb they dropped on
+  // their turn before. A match is played once the turn change has gone out, so players
+  // see the turn pass before the bomb lands; it waits on nobody, a vacant seat included.
+  private settlePremoves(game: GameState): void {
+    const player = game.players[game.currentTurn];
+    if (game.phase !== GamePhase.BATTLE || player.premoves.length === 0) return;
+    const last = game.moveLog.findLast(entry => entry.action === 'bomb' && entry.playerId === player.id);
+    if (!last || last.moveCount !== game.moveCount - 2) return;
+
+    const settled = (premove: Premove) => premove.condition.x === last.x && premove.condition.y === last.y;
+    const chosen = player.premoves.find(premove => settled(premove) && premove.condition.outcome === last.outcome && !this.bombedBy(player, premove.x, premove.y));
+    player.premoves = player.premoves.filter(premove => !settled(premove) && !this.bombedBy(player, premove.x, premove.y));
+    if (!chosen) return;
+
+    const moveCount = game.moveCount;
+    setTimeout(() => {
+      if (this.games.get(game.id) !== game || game.phase !== GamePhase.BATTLE || game.moveCount !== moveCount) return;
+      try {
+        console.log(`Playing ${player.name}'s premove in game ${game.id}`);
+        this.bomb(game.id, player.id, chosen.x, chosen.y, chosen.condition);
+      } catch (error) {
+        console.error(`Premove in game ${game.id} failed: ${(error as Error).message}`);
+      }
+    }, 0);
+  }
+
+  // Use a special shot in place of this turn's bomb. Airstrikes and cluster bombs
+  // report every cell they struck; a scan only whether it found a tank.
+  useAbility(gameId: string, playerId: number, ability: Ability, x: number, y: number, direction?: StrikeDirection): {
+    ability: Ability; cell: string; outcome?: 'hit' | 'miss' | 'victory'; cells: StrikeCell[]; found?: boolean; gameOver: boolean
+  } {
+    const game = this.requireGame(gameId);
+    this.requireTurn(game, playerId);
+    if (!ABILITIES.includes(ability)) {
+      throw new GameError(ErrorCode.VALIDATION_FAILED, 'Invalid special shot', undefined, [
+        { field: 'ability', reason: `must be one of ${ABILITIES.join(', ')}` }
+      ]);
+    }
+
+    const attacker = game.players[playerId];
+    const defender = game.players[1 - playerId];
+    const cell = formatCell(game.config.coordinates, x, y);
+    const thinkMs = this.thinkTime(game);
+
+    if (ability === 'scan') {
+      const found = Rules.scan(game.config, attacker, defender, x, y);
+      console.log(`${attacker.name} scanned around (${x}, ${y}): ${found ? 'tanks found' : 'nothing'}`);
+      this.emitGameEvent(game, 'abilityUsed', { playerId, ability, x, y, cell, found, abilitiesLeft: Rules.abilitiesLeft(game.config, attacker) });
+      this.logMove(game, { action: 'ability', playerId, ability, x, y, found, thinkMs });
+      game.actionTaken = true;
+      this.switchTurn(game);
+      this.broadcastGameState(game);
+      return { ability, cell, cells: [], found, gameOver: game.phase === GamePhase.GAME_OVER };
+    }
+
+    const cells = ability === 'airstrike'
+      ? Rules.airstrike(game.config, attacker, defender, x, y, direction!)
+      : Rules.clusterBomb(game.config, attacker, defender, x, y);
+    const hits = cells.filter(c => c.hit).length;
+    let outcome: 'hit' | 'miss' | 'victory' = hits > 0 ? 'hit' : 'miss';
+    console.log(`${attacker.name} used ${ability === 'airstrike' ? `an airstrike along ${direction}` : 'a cluster bomb'} at (${x}, ${y}): ${hits} of ${cells.length} cells hit`);
+    this.emitGameEvent(game, 'abilityUsed', {
+      playerId, ability, x, y, cell, direction, outcome,
+      cells: cells.map(c => ({ x: c.x, y: c.y, outcome: c.hit ? 'hit' : 'miss', destroyed: c.destroyed })),
+      tanksRemaining: defender.tanksAlive,
+      abilitiesLeft: Rules.abilitiesLeft(game.config, attacker)
+    });
+
+    if (defender.tanksAlive === 0) {
+      outcome = 'victory';
+      this.declareVictory(game, playerId, { action: 'ability', playerId, ability, x, y, direction, outcome, thinkMs });
+      return { ability, cell, outcome, cells, gameOver: true };
+    }
+    this.logMove(game, { action: 'ability', playerId, ability, x, y, direction, outcome, thinkMs });
+
+    game.actionTaken = true;
+    this.switchTurn(game);
+    this.broadcastGameState(game);
+    return { ability, cell, outcome, cells, gameOver: game.phase === GamePhase.GAME_OVER };
+  }
+
+  // The shot in `entry` destroyed the defender's last tank
+  private declareVictory(game: GameState, playerId: number, entry: Omit<MoveLogEntry, 'seq' | 'moveCount' | 'timestamp'>): void {
+    const winner = game.players[playerId];
+    this.setPhase(game, GamePhase.GAME_OVER);
+    game.winner = playerId;
+    this.logMove(game, entry);
+    this.recordWinProbability(game);
+    game.result = this.signResult(game, 'destroyed');
+    this.recordResult(game);
+    console.log(`${winner.name} wins game ${game.id}!`);
+    console.log(`  ${game.players[0].name} win probability: ${sparkline(game.winProbabilityHistory.map(h => h.players[0]))}`);
+    this.emitGameEvent(game, 'gameOver', { winner: playerId, winnerName: winner.name });
+    this.broadcastGameState(game);
+    this.broadcastGameUpdate(game);
+  }
+
+  // In games that offer it (concedeWithinShots), the shots left before `playerId` is sure
+  // to lose, once the opponent is sure to win within that many (see forcedFinish); null
+  // while the game is still open. A turn limit or shot budget the opponent would run out
+  // of first leaves it open.
+  private forcedLoss(game: GameState, playerId: number): number | null {
+    const within = game.config.concedeWithinShots;
+    if (within === 0 || game.phase !== GamePhase.BATTLE || game.players.length < 2) return null;
+    const loser = game.players[playerId];
+    const winnerId = 1 - playerId;
+    const winnerToMove = game.currentTurn === winnerId;
+
+    const left = Rules.abilitiesLeft(game.config, loser);
+    const movable = game.features.tankMovement && loser.tanks.some(tank => !tank.destroyed && tank.cells.every(c => loser.board[c.y][c.x] === CellState.TANK));
+    const found = game.players[winnerId].visibleEnemyBoard.flat().filter(cell => cell === CellState.TANK).length;
+    const shots = forcedFinish(this.sideStats(game, winnerId), this.sideStats(game, playerId), found, winnerToMove,
+      movable || left.airstrike > 0 || left.cluster > 0);
+    if (shots === null || shots > within) return null;
+
+    const shotsLeft = Rules.shotsLeft(game.config, game.moveLog, winnerId);
+    const turnsLeft = Rules.turnsLeft(game.config, game.moveCount);
+    if ((shotsLeft !== null && shotsLeft < shots) || (turnsLeft !== null && turnsLeft < (winnerToMove ? 2 * shots - 1 : 2 * shots))) return null;
+    return shots;
+  }
+
+  // Give up a game while its loss is forced (see forcedLoss); it is recorded as a
+  // resignation
+  concede(gameId: string, playerId: number): void {
+    const game = this.requireGame(gameId);
+    if (game.phase !== GamePhase.BATTLE) {
+      throw new GameError(ErrorCode.WRONG_PHASE, 'Only a game in battle can be conceded', { phase: game.phase });
+    }
+    if (this.forcedLoss(game, playerId) === null) {
+      throw new GameError(ErrorCode.INVALID_MOVE, 'A game can only be conceded once its loss is forced', { playerId });
+    }
+
+    const winner = 1 - playerId;
+    this.setPhase(game, GamePhase.GAME_OVER);
+    game.winner = winner;
+    this.recordWinProbability(game);
+    game.result = this.signResult(game, 'resigned');
+    this.recordResult(game);
+    console.log(`${game.players[playerId].name} concedes game ${gameId}`);
+    this.emitGameEvent(game, 'gameOver', { winner, winnerName: game.players[winner].name, reason: 'resigned' });
+    this.broadcastGameState(game);
+    this.broadcastGameUpdate(game);
+  }
+
+  // The turn limit or the shot budget stopped the battle with both fleets standing; it is
+  // decided on the boards (see Rules.limitWinner). The caller broadcasts the state.
+  private endAtLimit(game: GameState): void {
+    const winner = Rules.limitWinner(game.players, game.firstTurn!.playerId);
+    this.setPhase(game, GamePhase.GAME_OVER);
+    game.winner = winner;
+    this.recordWinProbability(game);
+    game.result = this.signResult(game, 'limit');
+    this.recordResult(game);
+    console.log(`Game ${game.id} reached its limit at move ${game.moveCount}; ${game.players[winner].name} wins on the boards`);
+    this.emitGameEvent(game, 'gameOver', { winner, winnerName: game.players[winner].name, reason: 'limit' });
+    this.broadcastGameUpdate(game);
+  }
+
+  // Sign the outcome of a game that has just been won; the state hash covers both
+  // boards and the move log, so the whole game can be checked against it later
+  private signResult(game: GameState, reason: GameResult['reason']): SignedResult {
+    const stateHash = stateHashOf(game.players.map(p => p.board), game.moveLog);
+    return this.signer.sign({
+      gameId: game.id,
+      players: game.players.map(p => ({ id: p.id, name: p.name, userId: p.userId })),
+      winner: game.winner!,
+      reason,
+      moveCount: game.moveCount,
+      finishedAt: new Date().toISOString(),
+      stateHash
+    });
+  }
+
+  // A free-for-all for three or more players sharing one client (see freeforall.cts)
+  startFreeForAll(players: unknown, config?: unknown): FreeForAllView {
+    this.requireNoMaintenance();
+    const match = FreeForAll.create(players, config, this.defaultConfig);
+    this.freeForAlls.set(match.id, match);
+    console.log(`Free-for-all ${match.id}: ${match.view().players.map(p => p.name).join(' vs ')}`);
+    return match.view();
+  }
+
+  getFreeForAll(matchId: string, seat?: number): FreeForAllView {
+    return this.requireFreeForAll(matchId).view(seat);
+  }
+
+  // The player to move bombs an opponent, aiming with x and y or a cell name
+  freeForAllBomb(matchId: string, message: GameMessage): { shot: FreeForAllShot } & FreeForAllView {
+    const match = this.requireFreeForAll(matchId);
+    if (message.cell === undefined) requireIntegers(message, ['x', 'y']);
+    const { x, y } = message.cell !== undefined ? parseCell(match.config.coordinates, message.cell, match.config.boardSize) : message;
+    // Hot seat: every shot is the player to move's, and one after the match is won is refused as over
+    const shot = match.bomb(match.view().turn ?? -1, message.target, x, y);
+    return { shot, ...match.view() };
+  }
+
+  private requireFreeForAll(matchId: string): FreeForAll {
+    const match = this.freeForAlls.get(matchId);
+    if (!match) {
+      throw new GameError(ErrorCode.NOT_FOUND, 'Free-for-all not found', { matchId });
+    }
+    return match;
+  }
+
+  // The key results are signed with, for anyone checking them
+  getResultKey(): { keyId: string; algorithm: string; publicKey: string } {
+    return { keyId: this.signer.keyId, algorithm: RESULT_ALGORITHM, publicKey: this.signer.publicKeyPem() };
+  }
+
+  // Count a finished game towards the stats of each player who was signed in, and
+  // rate it if both were
+  // Accounts and ratings are updated from the gameOver event as it goes out (see
+  // stats.cts); players whose rating moved are then told by how much
+  private recordResult(game: GameState): void {
+    this.checkAccuracy(game);
+    const ratingsBefore = game.players.map(p => p.userId ? this.accounts.ratingOf(p.userId) : null);
+    const rated = game.players.every(p => p.userId) && game.players[0].userId !== game.players[1].userId;
+    this.events.emit({
+      type: 'gameOver',
+      gameId: game.id,
+      result: game.result!,
+      moveStats: game.players.map((p, index) => moveStats(game.moveLog, index)),
+      shooting: game.players.map((p, index) => {
+        const { shots, hits } = this.sideStats(game, index);
+        return { shots, hits };
+      }),
+      placement: game.players.map(p => rated && this.accounts.placementMatchesLeft(p.userId!) > 0),
+      boardImage: this.finalBoardsImage(game)
+    });
+
+    game.players.forEach((player, index) => {
+      const previous = ratingsBefore[index];
+      if (!player.userId || previous === null) return;
+      const rating = this.accounts.ratingOf(player.userId);
+      if (rating === previous) return;
+      console.log(`Rating for ${player.name} after game ${game.id}: ${previous} -> ${rating}`);
+      // Until its placement matches are played, the rating is provisional and off the leaderboard
+      const placementMatchesLeft = this.accounts.placementMatchesLeft(player.userId);
+      if (player.ws.readyState === WebSocket.OPEN) this.send(player.ws, { type: 'ratingUpdated', rating, change: rating - previous, placementMatchesLeft });
+    });
+  }
+
+  // Flag a signed-in player whose cold shots hit far more often than chance allows, as
+  // seeing the opponent's board would make them (see coldShooting in analysis.cts)
+  private checkAccuracy(game: GameState): void {
+    game.players.forEach((player, index) => {
+      if (!player.userId) return;
+      const shooting = coldShooting(game.moveLog, index, game.config.boardSize, Rules.fleetCells(game.config));
+      if (shooting.shots < ACCURACY_MIN_SHOTS || shooting.pValue >= ACCURACY_P_VALUE) return;
+      this.moderation.raise({
+        kind: 'accuracy',
+        key: `${game.id} ${player.userId}`,
+        accounts: [{ userId: player.userId, name: player.name }],
+        gameIds: [game.id],
+        reason: `${player.name} hit with ${shooting.hits} of ${shooting.shots} cold shots where chance gives ${shooting.expectedHits} ` +
+          `(p = ${shooting.pValue.toExponential(1)})`
+      });
+    });
+  }
+
+  // Build the state payload for one player, tagged with a hash of its contents
+  // so clients can skip re-downloading an unchanged state.
+  private buildPlayerState(game: GameState, index: number): any {
+    const player = game.players[index];
+    const { myBoard, enemyBoard } = Rules.boardView(player);
+    const playerData = {
+      type: 'gameState',
+      gameId: game.id,
+      phase: game.phase,
+      currentTurn: game.currentTurn,
+      firstTurn: game.firstTurn,
       winner: game.winner,
       moveCount: game.moveCount,
+      config: game.config,
+      proposal: game.proposal,
+      features: game.features,
       players: game.players.map(p => ({
         id: p.id,
         name: p.name,
+        userId: p.userId,
         tanksAlive: p.tanksAlive,
-        ready: p.ready
-      }))
+        tanksRemaining: Math.max(game.config.tanksPerPlayer - p.tanks.length, 0),  // Still to place
+        ready: p.ready,  // Placement confirmed
+        reconnectBy: p.disconnectedAt !== null ? p.disconnectedAt + RECONNECT_GRACE_MS : null  // Dropped, seat held until then
+      })),
+      playerId: index,
+      nextTankLength: game.phase === GamePhase.PLACEMENT && player.tanks.length < game.config.tanksPerPlayer
+        ? Rules.nextTankLength(game.config, player)
+        : null,
+      myBoard,
+      enemyBoard,
+      myTanks: player.tanksAlive,
+      enemyTanks: game.players[1 - index]?.tanksAlive || 0,
+      spectators: this.spectatorCount(game),
+      myAbilities: Rules.abilitiesLeft(game.config, player),
+      enemyAbilities: game.players[1 - index] ? Rules.abilitiesLeft(game.config, game.players[1 - index]) : null,
+      turnsLeft: Rules.turnsLeft(game.config, game.moveCount),  // null: no turn limit
+      myShotsLeft: Rules.shotsLeft(game.config, game.moveLog, index),  // null: no shot budget
+      enemyShotsLeft: Rules.shotsLeft(game.config, game.moveLog, 1 - index),
+      concedeOffer: this.forcedLoss(game, index),  // The opponent's shots left to win, while this player may concede
+      enemyName: game.players[1 - index]?.name || 'Unknown',
+      winProbability: this.getWinProbability(game, index),  // [mine, enemy], once the battle has begun
+      clock: game.clock && { turnDeadline: this.turnDeadline(game), banks: game.clock.banks },
+      myPremoves: player.premoves,
+      fleets: this.revealFleets(game)
+    };
+
+    const stateHash = crypto.createHash('sha1').update(JSON.stringify(playerData)).digest('hex');
+    return { ...playerData, stateHash };
+  }
+
+  // The game as a spectator sees it: both boards in the results-only view, tagged
+  // with a hash like a player's state
+  private buildSpectatorState(game: GameState): any {
+    const state = {
+      type: 'spectatorState',
+      gameId: game.id,
+      phase: game.phase,
+      currentTurn: game.currentTurn,
+      firstTurn: game.firstTurn,
+      winner: game.winner,
+      moveCount: game.moveCount,
+      config: game.config,
+      players: game.players.map((p, index) => ({
+        id: p.id,
+        name: p.name,
+        userId: p.userId,
+        tanksAlive: p.tanksAlive,
+        ready: p.ready,
+        abilities: Rules.abilitiesLeft(game.config, p),
+        shotsLeft: Rules.shotsLeft(game.config, game.moveLog, index),
+        board: game.players[1 - index] ? Rules.resultsView(game.players[1 - index]) : Rules.createEmptyBoard(game.config.boardSize)
+      })),
+      spectators: this.spectatorCount(game),
+      turnsLeft: Rules.turnsLeft(game.config, game.moveCount),
+      winProbability: this.getWinProbability(game),  // [player 0, player 1]
+      clock: game.clock && { turnDeadline: this.turnDeadline(game), banks: game.clock.banks },
+      fleets: this.revealFleets(game)
     };
+    const stateHash = crypto.createHash('sha1').update(JSON.stringify(state)).digest('hex');
+    return { ...state, stateHash };
+  }
+
+  // Both fleets as they were placed, marked with the tanks that were destroyed. Only a
+  // finished game shows them; null in every other phase, aborted games included.
+  private revealFleets(game: GameState): { playerId: number; tanks: Tank[] }[] | null {
+    if (game.phase !== GamePhase.GAME_OVER) return null;
+    return game.players.map(p => ({
+      playerId: p.id,
+      tanks: p.placedTanks.map((tank, index) => ({ ...tank, destroyed: p.tanks[index]?.destroyed ?? false }))
+    }));
+  }
+
+  // Each player's own board as the game ended, under their name. Only for finished games,
+  // when nothing on them is hidden any more
+  private finalBoardsImage(game: GameState): string {
+    return boardsSvg(game.players.map(p => ({ title: p.name, board: p.board })), { coordinates: game.config.coordinates });
+  }
+
+  // Win probability for both players, ordered from `perspective`'s point of view
+  private getWinProbability(game: GameState, perspective: number = 0): [number, number] | null {
+    if (game.phase !== GamePhase.BATTLE && game.phase !== GamePhase.GAME_OVER) return null;
+    if (game.players.length < 2) return null;
+
+    const me = this.sideStats(game, perspective);
+    const enemy = this.sideStats(game, 1 - perspective);
+    return estimateWinProbability(me, enemy, game.currentTurn === perspective ? 0 : 1);
+  }
+
+  // Public shooting record for one player: only its bombs and their outcomes count
+  private sideStats(game: GameState, index: number): SideStats {
+    const player = game.players[index];
+    let shots = 0;
+    let hits = 0;
+    player.visibleEnemyBoard.forEach(row => row.forEach(cell => {
+      if (cell === CellState.HIT) hits++;
+      if (cell === CellState.HIT || cell === CellState.MISS) shots++;
+    }));
+
+    return {
+      shots,
+      hits,
+      tanksRemaining: player.tanksAlive,
+      // Known to both sides: the settings fix the fleet's size and every hit on it is announced
+      cellsRemaining: Rules.fleetCells(game.config) - game.players[1 - index].visibleEnemyBoard.flat().filter(cell => cell === CellState.HIT).length,
+      unshotCells: game.config.boardSize * game.config.boardSize - shots
+    };
+  }
 
+  private broadcastToGame(game: GameState, message: any): void {
+    game.players.forEach(player => {
+      if (player.ws.readyState === WebSocket.OPEN) {
+        this.send(player.ws, message);
+      }
+    });
+  }
+
+  private broadcastGameState(game: GameState): void {
     game.players.forEach((player, index) => {
       if (player.ws.readyState === WebSocket.OPEN) {
-        const playerData = {
-          ...gameData,
-          playerId: index,
-          myBoard: player.board,
-          enemyBoard: player.visibleEnemyBoard,
-          myTanks: player.tanksAlive,
-          enemyTanks: game.players[1 - index]?.tanksAlive || 0,
-          enemyName: game.players[1 - index]?.name || 'Unknown'
-        };
-        player.ws.send(JSON.stringify(playerData));
+        this.send(player.ws, this.buildPlayerState(game, index));
       }
     });
+    const watchers = this.openSpectators(game);
+    if (watchers.length > 0) {
+      const spectatorState = this.buildSpectatorState(game);
+      watchers.forEach(ws => this.send(ws, spectatorState));
+    }
+  }
+
+  // The player's own state, or the spectator view when `playerId` is null
+  private sendGameState(ws: WebSocket, game: GameState, playerId: number | null, ifNoneMatch?: string): void {
+    const playerState = playerId === null ? this.buildSpectatorState(game) : this.buildPlayerState(game, playerId);
+    if (ifNoneMatch && ifNoneMatch === playerState.stateHash) {
+      this.send(ws, { type: 'gameStateNotModified', stateHash: playerState.stateHash });
+      return;
+    }
+    this.send(ws, playerState);
   }
 
   // New method to broadcast game updates to all connections
@@ -513,11 +2362,15 @@ class GameManager {
       playerCount: game.players.length,
       maxPlayers: 2,
       players: game.players.map(p => ({ name: p.name, ready: p.ready })),
+      spectators: this.spectatorCount(game),
       createdAt: game.createdAt,
       canJoin: game.players.length < 2
     };
 
-    this.broadcastToAll(gameUpdate);
+    const watches = (ws: WebSocket) => this.mayWatch(game, this.connectionUsers.get(ws)?.id ?? null);
+    this.broadcastToAll(gameUpdate, watches);
+    // Those its players keep it from see it leave the lobby instead
+    this.broadcastToAll({ type: 'gameRemoved', gameId: game.id }, ws => !watches(ws));
   }
 
   // New method to broadcast new game creation
@@ -543,52 +2396,145 @@ class GameManager {
     };
 
     this.broadcastToAll(removeMessage);
+    // Everyone connected has just been told; spectators simply stop watching
+    this.spectators.get(gameId)?.forEach(ws => this.spectating.delete(ws));
+    this.spectators.delete(gameId);
+  }
+
+  // New method to broadcast to all connections, or those of them `to` picks
+  private broadcastToAll(message: any, to: (ws: WebSocket) => boolean = () => true): void {
+    const encoded: Map<Codec, string | Buffer> = new Map();
+    this.allConnections.forEach(ws => {
+      if (ws.readyState === WebSocket.OPEN && understands(this.capabilitiesFor(ws), message) && to(ws)) {
+        const codec = this.codecFor(ws);
+        if (!encoded.has(codec)) encoded.set(codec, codec.encode(message));
+        this.shaper.deliver(ws, this.roleOf(ws), message, encoded.get(codec)!);
+      }
+    });
+  }
+
+  localeFor(ws: WebSocket): string {
+    return this.connectionLocales.get(ws) || DEFAULT_LOCALE;
+  }
+
+  formatFor(ws: WebSocket): string {
+    return this.connectionFormats.get(ws) || this.localeFor(ws);
+  }
+
+  // The connection's own coordinate system if it picked one, else the game's
+  coordinatesFor(ws: WebSocket, config: GameConfig): CoordinateSystem {
+    return this.connectionCoordinates.get(ws) ?? config.coordinates;
+  }
+
+  // Where an action is aimed: its x and y, or a cell name in the connection's coordinate system
+  private targetOf(ws: WebSocket, message: GameMessage, config: GameConfig): Position {
+    if (message.cell !== undefined) {
+      return parseCell(this.coordinatesFor(ws, config), message.cell, config.boardSize);
+    }
+    requireIntegers(message, ['x', 'y']);
+    return { x: message.x, y: message.y };
+  }
+
+  codecFor(ws: WebSocket): Codec {
+    return this.connectionCodecs.get(ws) || JsonCodec;
+  }
+
+  // REST and gRPC sessions and the AI never say hello; they get the whole current protocol
+  capabilitiesFor(ws: WebSocket): Capabilities {
+    return this.connectionCapabilities.get(ws) ?? { protocolVersion: PROTOCOL_VERSION, codec: this.codecFor(ws), variants: new Set(VARIANTS) };
+  }
+
+  // Encode a message with the connection's negotiated codec, unless its protocol version predates it
+  send(ws: WebSocket, message: any): void {
+    if (!understands(this.capabilitiesFor(ws), message)) return;
+    this.shaper.deliver(ws, this.roleOf(ws), message, this.codecFor(ws).encode(message));
   }
 
-  // New method to broadcast to all connections
-  private broadcastToAll(message: any): void {
-    const messageString = JSON.stringify(message);
-    this.allConnections.forEach(ws => {
-      if (ws.readyState === WebSocket.OPEN) {
-        ws.send(messageString);
-      }
-    });
+  // Which delivery interval applies to the connection (see delivery.cts)
+  private roleOf(ws: WebSocket): DeliveryRole {
+    if (this.playerConnections.has(ws)) return 'player';
+    return this.spectating.has(ws) ? 'spectator' : 'lobby';
   }
 
-  // New method to get list of available games
-  getGamesList(): any[] {
-    const gamesList: any[] = [];
+  // List games with optional filtering, sorting and cursor-based pagination.
+  // The cursor is the id of the last game on the previous page; one that is no longer listed
+  // is refused, so the client starts again from the top. Games whose players keep them from
+  // the viewer are left out.
+  getGamesList(query: GamesListQuery = {}, viewerId: string | null = null): GamesListPage {
+    let gamesList: any[] = [];
     this.games.forEach(game => {
+      if (!this.mayWatch(game, viewerId)) return;
       gamesList.push({
         id: game.id,
         phase: game.phase,
         playerCount: game.players.length,
         maxPlayers: 2,
         players: game.players.map(p => ({ name: p.name, ready: p.ready })),
+        spectators: this.spectatorCount(game),
         createdAt: game.createdAt,
-        canJoin: game.players.length < 2
+        canJoin: game.players.length < 2,
+        variants: gameVariants(game.config, game.features)
       });
     });
-    return gamesList.sort((a, b) => b.createdAt - a.createdAt);
+
+    if (query.phase) {
+      gamesList = gamesList.filter(g => g.phase === query.phase);
+    }
+    if (typeof query.canJoin === 'boolean') {
+      gamesList = gamesList.filter(g => g.canJoin === query.canJoin);
+    }
+
+    const sortKey = query.sort === 'playerCount' ? 'playerCount' : 'createdAt';
+    const direction = query.order === 'asc' ? 1 : -1;
+    gamesList.sort((a, b) => (a[sortKey] - b[sortKey]) * direction || a.id.localeCompare(b.id));
+
+    const total = gamesList.length;
+    if (query.cursor) {
+      const cursorIndex = gamesList.findIndex(g => g.id === query.cursor);
+      if (cursorIndex === -1) {
+        throw new GameError(ErrorCode.VALIDATION_FAILED, 'Invalid games list query', { cursor: query.cursor }, [
+          { field: 'cursor', reason: 'is not a game on the list; start again without one' }
+        ]);
+      }
+      gamesList = gamesList.slice(cursorIndex + 1);
+    }
+
+    const limit = Math.min(Math.max(Math.floor(query.limit || MAX_GAMES_PAGE_SIZE), 1), MAX_GAMES_PAGE_SIZE);
+    const page = gamesList.slice(0, limit);
+    const nextCursor = gamesList.length > limit ? page[page.length - 1].id : null;
+
+    return { games: page, nextCursor, total };
   }
 
   // New method to send server stats
   private sendServerStats(ws: WebSocket): void {
     const stats = this.getGameStats();
-    const gamesList = this.getGamesList();
+    // The first page of the lobby; getGamesList with nextCursor fetches the rest
+    const { games: gamesList, nextCursor, total } = this.getGamesList({}, this.connectionUsers.get(ws)?.id ?? null);
 
     if (ws.readyState === WebSocket.OPEN) {
-      ws.send(JSON.stringify({
+      this.send(ws, {
         type: 'serverStats',
         stats,
-        gamesList
-      }));
+        gamesList,
+        nextCursor,
+        total,
+        maintenance: this.getMaintenance()
+      });
     }
   }
 
   handleMessage(ws: WebSocket, message: GameMessage): void {
+    if (this.isReplayedFrame(ws, message.nonce)) {
+      console.log(`Ignoring replayed ${message.type} frame with nonce ${message.nonce}`);
+      return;
+    }
+
     const connection = this.playerConnections.get(ws);
     try {
+      const mismatch = this.rulesMismatches.get(ws);
+      if (mismatch && !RULES_FREE_MESSAGES.has(message.type)) throw mismatch;
+
       switch (message.type) {
         case 'join':
           const gameId = message.gameId;
@@ -597,59 +2543,81 @@ class GameManager {
             console.log("DEBUG: Creating room '1234' for single-player testing.");
             this.createGame(gameId);
           }
-          if (gameId && !this.games.has(gameId.toUpperCase())) {
-            // Try to create game with custom room ID
-            try {
-              this.createGame(gameId);
-            } catch (error: any) {
-              ws.send(JSON.stringify({
-                type: 'joined',
-                success: false,
-                error: error.message
-              }));
-              return;
+          try {
+            if (gameId && !this.games.has(gameId.toUpperCase())) {
+              // Try to create game with custom room ID
+              this.createGame(gameId, message.config);
             }
-          }
 
-          const targetGameId = gameId ? gameId.toUpperCase() : this.createGame();
-          const joinResult = this.joinGame(targetGameId, ws, message.playerName);
-
-          ws.send(JSON.stringify({
-            type: 'joined',
-            success: joinResult.success,
-            gameId: joinResult.success ? targetGameId : undefined,
-            playerId: joinResult.player?.id,
-            playerName: joinResult.player?.name,
-            boardSize: BOARD_SIZE,
-            tanksPerPlayer: TANKS_PER_PLAYER,
-            error: joinResult.error
-          }));
+            const targetGameId = gameId ? gameId.toUpperCase() : this.createGame(undefined, message.config);
+            const player = this.joinGame(targetGameId, ws, message.playerName);
+            this.sendJoined(ws, this.requireGame(targetGameId), player);
+          } catch (error) {
+            this.send(ws, { type: 'joined', success: false, error: toGameError(error).toEnvelope(this.localeFor(ws)) });
+          }
           break;
 
         case 'createRoom':
           try {
-            const newGameId = this.createGame(message.customRoomId);
+            const newGameId = this.createGameFor(ws, message.customRoomId, message.config).id;
             console.log("Room creation")
-            ws.send(JSON.stringify({
+            this.send(ws, {
               type: 'roomCreated',
               success: true,
               gameId: newGameId
-            }));
-          } catch (error: any) {
-            ws.send(JSON.stringify({
+            });
+          } catch (error) {
+            this.send(ws, {
               type: 'roomCreated',
               success: false,
-              error: error.message
-            }));
+              error: toGameError(error).toEnvelope(this.localeFor(ws))
+            });
+          }
+          break;
+
+        case 'quickMatch':
+          const position = this.quickMatch(ws, message.playerName, message.maxRatingGap);
+          if (position > 0) this.send(ws, { type: 'quickMatchQueued', position });
+          break;
+
+        case 'playAi':
+          try {
+            this.playAi(ws, message.playerName, message.difficulty, message.config);
+          } catch (error) {
+            this.send(ws, { type: 'joined', success: false, error: toGameError(error).toEnvelope(this.localeFor(ws)) });
+          }
+          break;
+
+        case 'playBot':
+          try {
+            this.playBot(ws, message.playerName, message.bot, message.config);
+          } catch (error) {
+            this.send(ws, { type: 'joined', success: false, error: toGameError(error).toEnvelope(this.localeFor(ws)) });
           }
           break;
 
+        case 'cancelQuickMatch':
+          this.send(ws, { type: 'quickMatchCancelled', success: this.cancelQuickMatch(ws) });
+          break;
+
         case 'getGamesList':
-          const gamesList = this.getGamesList();
-          ws.send(JSON.stringify({
-            type: 'gamesList',
-            games: gamesList
-          }));
+          try {
+            const gamesPage = this.getGamesList({
+              cursor: message.cursor,
+              limit: message.limit,
+              phase: message.phase,
+              canJoin: message.canJoin,
+              sort: message.sort,
+              order: message.order
+            }, this.connectionUsers.get(ws)?.id ?? null);
+            this.send(ws, {
+              type: 'gamesList',
+              success: true,
+              ...gamesPage
+            });
+          } catch (error) {
+            this.send(ws, { type: 'gamesList', success: false, error: toGameError(error).toEnvelope(this.localeFor(ws)) });
+          }
           break;
 
         case 'getServerStats':
@@ -657,46 +2625,350 @@ class GameManager {
           break;
 
         case 'placeTank':
-          if (!connection) return;
-          const placed = this.placeTank(connection.gameId, connection.playerId, message.x, message.y);
-          ws.send(JSON.stringify({ type: 'placeTankResult', success: placed, x: message.x, y: message.y }));
-          if (placed) {
-            const game = this.games.get(connection.gameId);
-            if (game) this.broadcastGameState(game);
+          this.runAction(ws, connection, message, 'placeTankResult', false, conn => {
+            const { x, y } = this.targetOf(ws, message, this.requireGame(conn.gameId).config);
+            this.placeTank(conn.gameId, conn.playerId, x, y, message.orientation);
+            this.broadcastGameState(this.requireGame(conn.gameId));
+            return { x, y, orientation: message.orientation ?? 'horizontal' };
+          });
+          break;
+
+        case 'placeLayout':
+          this.runAction(ws, connection, message, 'placeLayoutResult', false, conn => {
+            this.placeLayout(conn.gameId, conn.playerId, message.layout);
+            this.broadcastGameState(this.requireGame(conn.gameId));
+            return {};
+          });
+          break;
+
+        case 'removeTank':
+          this.runAction(ws, connection, message, 'removeTankResult', false, conn => {
+            requireIntegers(message, ['x', 'y']);
+            this.removeTank(conn.gameId, conn.playerId, message.x, message.y);
+            this.broadcastGameState(this.requireGame(conn.gameId));
+            return { x: message.x, y: message.y };
+          });
+          break;
+
+        case 'confirmPlacement':
+          this.runAction(ws, connection, message, 'confirmPlacementResult', false, conn => {
+            this.confirmPlacement(conn.gameId, conn.playerId);
+            this.broadcastGameState(this.requireGame(conn.gameId));
+            return {};
+          });
+          break;
+
+        case 'saveGame':
+          this.runAction(ws, connection, message, 'gameSaved', false, conn => {
+            const snapshot = this.saveGame(conn.gameId);
+            return { gameId: conn.gameId, savedAt: snapshot.savedAt, moveCount: snapshot.game.moveCount };
+          });
+          break;
+
+        case 'resumeGame':
+          try {
+            this.resumeGame(ws, message.gameId, message.resumeToken);
+          } catch (error) {
+            this.send(ws, { type: 'joined', success: false, error: toGameError(error).toEnvelope(this.localeFor(ws)) });
           }
           break;
 
-        case 'moveTank':
+        case 'getMoveLog':
           if (!connection) return;
-          const moved = this.moveTank(connection.gameId, connection.playerId, message.fromX, message.fromY, message.toX, message.toY);
-          ws.send(JSON.stringify({ type: 'moveTankResult', success: moved, error: moved ? undefined : 'Move Failed' }));
-          if (moved) {
-            const game = this.games.get(connection.gameId);
-            if (game) this.broadcastGameState(game);
+          this.send(ws, { type: 'moveLog', gameId: connection.gameId, entries: this.getMoveLog(connection.gameId, connection.playerId) });
+          break;
+
+        case 'getLegalActions':
+          if (!connection) return;
+          this.send(ws, { type: 'legalActions', gameId: connection.gameId, actions: this.legalActions(connection.gameId, connection.playerId) });
+          break;
+
+        case 'getCellHistory':
+          if (!connection) return;
+          this.send(ws, {
+            type: 'cellHistory',
+            gameId: connection.gameId,
+            changes: this.getCellHistory(connection.gameId, connection.playerId),
+            ...(message.seq !== undefined && { boards: this.getBoardsAt(connection.gameId, connection.playerId, message.seq) })
+          });
+          break;
+
+        case 'getInbox':
+          const inboxUser = this.connectionUsers.get(ws);
+          if (!inboxUser) {
+            throw new GameError(ErrorCode.UNAUTHORIZED, 'Sign in to see your inbox');
           }
+          this.send(ws, { type: 'inbox', success: true, games: this.getInbox(inboxUser.id) });
           break;
 
-        case 'bomb':
+        case 'getGameSummary':
           if (!connection) return;
-          const bombResult = this.bomb(connection.gameId, connection.playerId, message.x, message.y);
-          ws.send(JSON.stringify({ type: 'bombResult', x: message.x, y: message.y, ...bombResult }));
+          this.send(ws, { type: 'gameSummary', ...this.getGameSummary(connection.gameId, this.formatFor(ws)) });
           break;
 
-        case 'getGameState':
+        case 'exportBoards':
           if (!connection) return;
-          const game = this.games.get(connection.gameId);
-          if (game) this.broadcastGameState(game);
+          const exportView = this.boardView(connection.gameId, connection.playerId);
+          const exportGame = this.requireGame(connection.gameId);
+          this.send(ws, {
+            type: 'boardsExport',
+            gameId: connection.gameId,
+            moveCount: exportGame.moveCount,
+            myBoard: Rules.boardToText(exportView.myBoard),
+            enemyBoard: Rules.boardToText(exportView.enemyBoard),
+            svg: boardsSvg([
+              { title: 'Your Board', board: exportView.myBoard },
+              { title: 'Enemy Board', board: exportView.enemyBoard, enemy: true }
+            ], { coordinates: this.coordinatesFor(ws, exportGame.config) })
+          });
+          break;
+
+        case 'moveTank':
+          this.runAction(ws, connection, message, 'moveTankResult', true, conn => {
+            requireIntegers(message, ['fromX', 'fromY', 'toX', 'toY']);
+            const emote = this.requireEmote(message);
+            const moveCount = this.requireGame(conn.gameId).moveCount;
+            this.moveTank(conn.gameId, conn.playerId, message.fromX, message.fromY, message.toX, message.toY);
+            this.broadcastGameState(this.requireGame(conn.gameId));
+            this.recordEmote(conn.gameId, conn.playerId, moveCount, emote);
+            return {};
+          });
+          break;
+
+        case 'bomb':
+          this.runAction(ws, connection, message, 'bombResult', true, conn => {
+            const game = this.requireGame(conn.gameId);
+            const { x, y } = this.targetOf(ws, message, game.config);
+            const emote = this.requireEmote(message);
+            const moveCount = game.moveCount;
+            const bombed = this.bomb(conn.gameId, conn.playerId, x, y);
+            this.recordEmote(conn.gameId, conn.playerId, moveCount, emote);
+            const cell = formatCell(this.coordinatesFor(ws, game.config), x, y);
+            const result = translate(`result.${bombed.outcome}`, this.localeFor(ws), { cell });
+            return { x, y, ...bombed, cell, result };
+          });
+          break;
+
+        case 'useAbility':
+          this.runAction(ws, connection, message, 'useAbilityResult', true, conn => {
+            const game = this.requireGame(conn.gameId);
+            const { x, y } = this.targetOf(ws, message, game.config);
+            const emote = this.requireEmote(message);
+            const moveCount = game.moveCount;
+            const used = this.useAbility(conn.gameId, conn.playerId, message.ability, x, y, message.direction);
+            this.recordEmote(conn.gameId, conn.playerId, moveCount, emote);
+            const locale = this.localeFor(ws);
+            const cell = formatCell(this.coordinatesFor(ws, game.config), x, y);
+            const hits = used.cells.filter(c => c.hit).length;
+            const result = used.ability === 'scan'
+              ? translate(used.found ? 'result.scanFound' : 'result.scanEmpty', locale, { cell })
+              : translate(used.outcome === 'victory' ? 'result.strikeVictory' : 'result.strike', locale, { cell, hits, misses: used.cells.length - hits });
+            return { x, y, ...used, cell, result };
+          });
+          break;
+
+        case 'queuePremove':
+          this.runAction(ws, connection, message, 'queuePremoveResult', false, conn => {
+            const game = this.requireGame(conn.gameId);
+            if (!message.if || typeof message.if !== 'object') {
+              throw new GameError(ErrorCode.VALIDATION_FAILED, 'Invalid premove', undefined, [
+                { field: 'if', reason: 'must name the shot to wait on, as { x, y, outcome } or { cell, outcome }' }
+              ]);
+            }
+            const condition = { ...this.targetOf(ws, message.if, game.config), outcome: message.if.outcome };
+            const { x, y } = this.targetOf(ws, message, game.config);
+            return { premoves: this.queuePremove(conn.gameId, conn.playerId, condition, x, y) };
+          });
+          break;
+
+        case 'cancelPremoves':
+          this.runAction(ws, connection, message, 'cancelPremovesResult', false, conn => {
+            return { cancelled: this.cancelPremoves(conn.gameId, conn.playerId) };
+          });
+          break;
+
+        case 'proposeSettings':
+          this.runAction(ws, connection, message, 'proposeSettingsResult', false, conn => {
+            this.proposeSettings(conn.gameId, conn.playerId, message.config);
+            return {};
+          });
+          break;
+
+        case 'acceptSettings':
+          this.runAction(ws, connection, message, 'acceptSettingsResult', false, conn => {
+            this.acceptSettings(conn.gameId, conn.playerId);
+            return {};
+          });
+          break;
+
+        case 'concede':
+          this.runAction(ws, connection, message, 'concedeResult', false, conn => {
+            this.concede(conn.gameId, conn.playerId);
+            return {};
+          });
+          break;
+
+        case 'getRules':
+          try {
+            this.send(ws, { type: 'rules', success: true, ...this.getRules(message.gameId ?? connection?.gameId) });
+          } catch (error) {
+            this.send(ws, { type: 'rules', success: false, error: toGameError(error).toEnvelope(this.localeFor(ws)) });
+          }
+          break;
+
+        case 'hello':
+          try {
+            const capabilities = negotiate(message, this.capabilitiesFor(ws));
+            this.connectionCapabilities.set(ws, capabilities);
+            this.rulesMismatches.delete(ws);
+            this.send(ws, {
+              type: 'welcome',
+              success: true,
+              protocolVersion: capabilities.protocolVersion,
+              rulesVersion: RULES_VERSION,
+              codec: capabilities.codec.name,
+              variants: VARIANTS.filter(variant => capabilities.variants.has(variant))
+            });
+            // Sent in the old codec; everything after it, both ways, uses the new one
+            this.connectionCodecs.set(ws, capabilities.codec);
+          } catch (error) {
+            const refused = toGameError(error);
+            if (refused.code === ErrorCode.INCOMPATIBLE_RULES) this.rulesMismatches.set(ws, refused);
+            this.send(ws, { type: 'welcome', success: false, error: refused.toEnvelope(this.localeFor(ws)) });
+          }
+          break;
+
+        case 'getCapabilities':
+          const capabilityGame = connection ? this.games.get(connection.gameId) : undefined;
+          this.send(ws, {
+            type: 'capabilities',
+            features: capabilityGame ? capabilityGame.features : this.flags.snapshot(),
+            defaultConfig: this.defaultConfig,
+            configLimits: CONFIG_LIMITS,
+            firstMovePolicies: FIRST_MOVE_POLICIES,
+            timeoutActions: TIMEOUT_ACTIONS,
+            coordinateSystems: COORDINATE_SYSTEMS,
+            tankLengthLimits: TANK_LENGTH_LIMITS,
+            orientations: ORIENTATIONS,
+            abilities: ABILITIES,
+            strikeDirections: STRIKE_DIRECTIONS,
+            emotes: EMOTES,
+            quickChat: this.quickChatPhrases(this.localeFor(ws)),
+            aiDifficulties: AI_DIFFICULTIES,
+            bots: Object.keys(this.bots),
+            protocol: {
+              versions: { min: MIN_PROTOCOL_VERSION, max: PROTOCOL_VERSION },
+              codecs: CODECS.map(codec => codec.name),
+              variants: VARIANTS
+            }
+          });
+          break;
+
+        case 'getGameState':
+          const stateGameId = connection?.gameId ?? this.spectating.get(ws);
+          const game = stateGameId ? this.games.get(stateGameId) : undefined;
+          if (game) this.sendGameState(ws, game, connection ? connection.playerId : null, message.ifNoneMatch);
+          break;
+
+        case 'spectate':
+          try {
+            this.spectate(ws, message.gameId);
+          } catch (error) {
+            this.send(ws, { type: 'spectating', success: false, error: toGameError(error).toEnvelope(this.localeFor(ws)) });
+          }
+          break;
+
+        case 'startDrill':
+          // Practice on a generated position; nothing to do with any game the player is in
+          try {
+            const drill = Drill.generate(message.kind as DrillKind);
+            this.drills.set(ws, drill);
+            this.send(ws, { type: 'drill', success: true, ...drill.view() });
+          } catch (error) {
+            this.send(ws, { type: 'drill', success: false, error: toGameError(error).toEnvelope(this.localeFor(ws)) });
+          }
+          break;
+
+        case 'drillShot':
+          try {
+            const drill = this.drills.get(ws);
+            if (!drill) {
+              throw new GameError(ErrorCode.NOT_FOUND, 'Start a drill first');
+            }
+            const { x, y } = this.targetOf(ws, message, drill.config);
+            const shot = drill.shoot(x, y);
+            this.send(ws, { type: 'drillShotResult', success: true, shot, ...drill.view() });
+          } catch (error) {
+            this.send(ws, { type: 'drillShotResult', success: false, error: toGameError(error).toEnvelope(this.localeFor(ws)) });
+          }
+          break;
+
+        case 'stopSpectating':
+          this.send(ws, { type: 'spectatingStopped', success: this.stopSpectating(ws) });
           break;
 
         case 'chat':
           if (!connection) return;
           const chatGame = this.games.get(connection.gameId);
-          if (chatGame) this.handleChat(chatGame, connection.playerId, message.text);
+          if (chatGame) this.handleChat(chatGame, connection.playerId, message.text, message.phrase);
+          break;
+
+        case 'reportPlayer':
+          if (!connection) return;
+          this.reportPlayer(connection.gameId, connection.playerId, message.category, message.comment);
+          this.send(ws, { type: 'playerReported', gameId: connection.gameId });
+          break;
+
+        case 'reportChat':
+          if (!connection) return;
+          requireIntegers(message, ['messageId']);
+          this.reportChat(connection.gameId, connection.playerId, message.messageId, message.reason);
+          this.send(ws, { type: 'chatReported', gameId: connection.gameId, messageId: message.messageId });
+          break;
+
+        case 'register':
+        case 'signIn':
+          // Sign in with an account token from earlier, or with a name and password
+          try {
+            const signedIn = message.type === 'register'
+              ? this.accounts.register(message.name, message.password)
+              : message.token !== undefined
+                ? { user: this.accounts.verify(message.token), token: message.token }
+                : this.accounts.signIn(message.name, message.password);
+            if (!signedIn.user) {
+              throw new GameError(ErrorCode.UNAUTHORIZED, 'That account token is invalid or has expired');
+            }
+            this.connectionUsers.set(ws, signedIn.user);
+            this.send(ws, { type: 'signedIn', success: true, user: signedIn.user, token: signedIn.token });
+          } catch (error) {
+            this.send(ws, { type: 'signedIn', success: false, error: toGameError(error).toEnvelope(this.localeFor(ws)) });
+          }
+          break;
+
+        case 'setLocale':
+          this.connectionLocales.set(ws, negotiateLocale(message.locale));
+          this.connectionFormats.set(ws, negotiateFormat(message.locale));
+          this.send(ws, { type: 'localeSet', locale: this.localeFor(ws), format: this.formatFor(ws) });
+          break;
+
+        // null goes back to each game's own coordinate system
+        case 'setCoordinates':
+          try {
+            if (message.coordinates === null) {
+              this.connectionCoordinates.delete(ws);
+            } else {
+              this.connectionCoordinates.set(ws, requireCoordinateSystem(message.coordinates));
+            }
+            this.send(ws, { type: 'coordinatesSet', success: true, coordinates: this.connectionCoordinates.get(ws) ?? null });
+          } catch (error) {
+            this.send(ws, { type: 'coordinatesSet', success: false, error: toGameError(error).toEnvelope(this.localeFor(ws)) });
+          }
           break;
 
         case 'leaveGame':
           this.leaveGame(ws);
-          ws.send(JSON.stringify({ type: 'leftGame', success: true }));
+          this.stopSpectating(ws);
+          this.send(ws, { type: 'leftGame', success: true });
           break;
 
         default:
@@ -704,50 +2976,424 @@ class GameManager {
       }
     } catch (error) {
       console.error(`Error handling message:`, error);
-      ws.send(JSON.stringify({ type: 'error', message: 'Server error occurred' }));
+      let gameError = toGameError(error);
+      if (!(error instanceof GameError)) {
+        const dumpId = this.writeCrashDump(error, ws, message);
+        if (dumpId) gameError = new GameError(ErrorCode.SERVER_ERROR, gameError.message, { dumpId });
+      }
+      // Only a failed game action (see runAction) can leave a game half-updated and aborts it;
+      // any other frame, however malformed, costs the sender just this error
+      this.send(ws, { type: 'error', error: gameError.toEnvelope(this.localeFor(ws)) });
+    }
+  }
+
+  // A game whose processing failed unexpectedly may be left half-updated, so
+  // end it rather than let play continue; other games are not touched
+  private abortGame(gameId: string, dumpId: string | null): void {
+    if (!this.games.has(gameId)) return;
+    console.error(`Game ${gameId} aborted after a server error${dumpId ? ` (crash dump ${dumpId})` : ''}`);
+    this.closeGame(gameId, new GameError(ErrorCode.SERVER_ERROR, 'The game was aborted after a server error', dumpId ? { dumpId } : undefined));
+  }
+
+  // Take a game out of play for good, telling its players why
+  private closeGame(gameId: string, reason: GameError): void {
+    const game = this.requireGame(gameId);
+    this.setPhase(game, GamePhase.ABORTED);
+
+    game.players.forEach(player => {
+      this.playerConnections.delete(player.ws);
+      if (player.ws.readyState === WebSocket.OPEN) {
+        this.send(player.ws, { type: 'gameAborted', gameId, error: reason.toEnvelope(this.localeFor(player.ws)) });
+      }
+    });
+
+    this.games.delete(gameId);
+    this.broadcastGameRemoved(gameId);
+  }
+
+  // Moderator action: end a game without a result, e.g. after abuse or a dispute
+  voidGame(gameId: string, reason?: string): void {
+    const game = this.requireGame(gameId);
+    if (game.phase === GamePhase.ABORTED) {
+      throw new GameError(ErrorCode.WRONG_PHASE, 'The game has already ended', { phase: game.phase });
+    }
+    console.log(`Game ${gameId} voided${reason ? `: ${reason}` : ''}`);
+    this.closeGame(gameId, new GameError(ErrorCode.GAME_VOIDED, 'A moderator voided this game', reason ? { reason } : undefined));
+  }
+
+  // Moderator action: stop (or allow again) one player's chat messages
+  setChatMuted(gameId: string, playerId: number, muted: boolean): void {
+    const game = this.requireGame(gameId);
+    const player = game.players[playerId];
+    if (!player) {
+      throw new GameError(ErrorCode.NOT_IN_GAME, 'No such player in this game', { playerId });
+    }
+    player.chatMuted = muted;
+    console.log(`${player.name} ${muted ? 'muted' : 'unmuted'} in game ${gameId}`);
+    if (player.ws.readyState === WebSocket.OPEN) {
+      this.send(player.ws, { type: 'chatMuted', gameId, muted });
+    }
+  }
+
+  // Write the failing message and the affected game's state to disk so the
+  // failure can be reconstructed later. Returns the dump id, or null if writing failed.
+  private writeCrashDump(error: unknown, ws: WebSocket | null, message?: GameMessage): string | null {
+    const connection = ws ? this.playerConnections.get(ws) : undefined;
+    const game = connection ? this.games.get(connection.gameId) : undefined;
+    const dumpId = `${Date.now()}-${crypto.randomBytes(4).toString('hex')}`;
+    const written = this.writeDumpFile(dumpId, error, {
+      message,
+      gameId: connection?.gameId,
+      playerId: connection?.playerId,
+      game: game ? Utils.serializeGame(game) : undefined
+    });
+    return written ? dumpId : null;
+  }
+
+  // Last resort: dump every active game before the process goes down
+  dumpAllGames(error: unknown): void {
+    this.writeDumpFile(`${Date.now()}-fatal`, error, {
+      games: Array.from(this.games.values()).map(game => Utils.serializeGame(game))
+    });
+  }
+
+  private writeDumpFile(dumpId: string, error: unknown, contents: Record<string, any>): boolean {
+    try {
+      fs.mkdirSync(CRASH_DUMP_DIR, { recursive: true });
+      const file = path.join(CRASH_DUMP_DIR, `crash-${dumpId}.json`);
+      fs.writeFileSync(file, JSON.stringify({
+        dumpId,
+        writtenAt: new Date().toISOString(),
+        error: error instanceof Error ? { message: error.message, stack: error.stack } : { message: String(error) },
+        ...contents
+      }, null, 2));
+      console.error(`Crash dump ${dumpId} written to ${file}${contents.gameId ? ` (game ${contents.gameId}, player ${contents.playerId})` : ''}`);
+      return true;
+    } catch (writeError) {
+      console.error('Failed to write crash dump:', writeError);
+      return false;
+    }
+  }
+
+  // Shared pipeline for player actions: idempotent replay, move sequencing,
+  // then the action itself. Failures are reported with a structured error.
+  private runAction(
+    ws: WebSocket,
+    connection: { gameId: string; playerId: number } | undefined,
+    message: GameMessage,
+    resultType: string,
+    sequenced: boolean,
+    action: (connection: { gameId: string; playerId: number }) => Record<string, any>
+  ): void {
+    if (!connection) {
+      this.send(ws, { type: resultType, success: false, error: new GameError(ErrorCode.NOT_IN_GAME, 'You are not in a game').toEnvelope(this.localeFor(ws)) });
+      return;
+    }
+    if (this.replayActionResult(ws, connection, message.moveId)) return;
+
+    if (this.isRepeatedAction(ws, message, this.games.get(connection.gameId))) {
+      this.send(ws, {
+        type: resultType,
+        success: false,
+        error: new GameError(ErrorCode.ACTION_TOO_SOON, 'Action repeated too quickly', { windowMs: ACTION_DEBOUNCE_MS })
+          .toEnvelope(this.localeFor(ws))
+      });
+      return;
+    }
+
+    let result: Record<string, any>;
+    let staleMove = false;
+    let crashed: { dumpId: string | null } | null = null;
+    try {
+      if (sequenced) this.checkMoveSequence(connection, message.expectedMove);
+      result = { type: resultType, success: true, ...action(connection) };
+    } catch (error) {
+      let gameError = toGameError(error);
+      if (gameError.code === ErrorCode.SERVER_ERROR) {
+        console.error(`Error handling ${message.type}:`, error);
+        crashed = { dumpId: this.writeCrashDump(error, ws, message) };
+        if (crashed.dumpId) gameError = new GameError(ErrorCode.SERVER_ERROR, gameError.message, { dumpId: crashed.dumpId });
+      }
+      staleMove = gameError.code === ErrorCode.STALE_MOVE;
+      result = { type: resultType, success: false, error: gameError.toEnvelope(this.localeFor(ws)) };
+    }
+
+    this.rememberAction(ws, message, this.games.get(connection.gameId));
+    this.sendActionResult(ws, connection, message.moveId, result);
+    if (crashed) {
+      this.abortGame(connection.gameId, crashed.dumpId);
+      return;
+    }
+
+    // Resync clients that acted on an outdated state
+    const game = this.games.get(connection.gameId);
+    if (staleMove && game) this.sendGameState(ws, game, connection.playerId);
+  }
+
+  // Frames carrying a nonce this connection already used are dropped silently, so
+  // retransmitted or replayed frames never reach the game. Frames without a nonce pass.
+  private isReplayedFrame(ws: WebSocket, nonce: any): boolean {
+    if (typeof nonce !== 'string' || !nonce) return false;
+
+    const seen = this.seenNonces.get(ws) ?? new Set<string>();
+    this.seenNonces.set(ws, seen);
+    if (seen.has(nonce)) return true;
+
+    seen.add(nonce);
+    if (seen.size > NONCE_WINDOW) {
+      seen.delete(seen.values().next().value as string);
+    }
+    return false;
+  }
+
+  // Double clicks and button mashing are turned away before they reach the game: the same
+  // payload again within the debounce window, with nothing logged in the game since it ran,
+  // counts as a repeat. One on another cell, say after the first was refused, is a fresh
+  // attempt, and so is a tank put back where it was just taken from. Move ids and nonces
+  // are fresh on every frame, so they are left out.
+  private actionKey(message: GameMessage): string {
+    const { moveId, nonce, ...payload } = message;
+    return JSON.stringify(payload);
+  }
+
+  private isRepeatedAction(ws: WebSocket, message: GameMessage, game: GameState | undefined): boolean {
+    const now = Date.now();
+    const recent = this.lastActionAt.get(ws) ?? new Map<string, { at: number; moves: number }>();
+    recent.forEach(({ at }, recentKey) => {
+      if (now - at >= ACTION_DEBOUNCE_MS) recent.delete(recentKey);
+    });
+    this.lastActionAt.set(ws, recent);
+    return recent.get(this.actionKey(message))?.moves === (game?.moveLog.length ?? 0);
+  }
+
+  private rememberAction(ws: WebSocket, message: GameMessage, game: GameState | undefined): void {
+    this.lastActionAt.get(ws)?.set(this.actionKey(message), { at: Date.now(), moves: game?.moveLog.length ?? 0 });
+  }
+
+  // If this moveId was already processed for the player, resend the stored result
+  // instead of applying the action a second time. Returns true when replayed.
+  private replayActionResult(ws: WebSocket, connection: { gameId: string; playerId: number }, moveId: any): boolean {
+    if (typeof moveId !== 'string' || !moveId) return false;
+
+    const player = this.games.get(connection.gameId)?.players[connection.playerId];
+    const previous = player?.recentActions.get(moveId);
+    if (!previous) return false;
+
+    console.log(`Replaying result for duplicate move ${moveId} from ${player!.name}`);
+    this.send(ws, { ...previous, replayed: true });
+    return true;
+  }
+
+  // Battle actions must name the move number they were made against, so
+  // submissions made against an outdated state are rejected.
+  private checkMoveSequence(connection: { gameId: string; playerId: number }, expectedMove: any): void {
+    const game = this.requireGame(connection.gameId);
+
+    if (typeof expectedMove !== 'number') {
+      throw new GameError(ErrorCode.MISSING_SEQUENCE, 'Missing move sequence number', undefined,
+        [{ field: 'expectedMove', reason: 'required' }]);
+    }
+
+    if (expectedMove !== game.moveCount) {
+      throw new GameError(ErrorCode.STALE_MOVE, 'Stale move: the game has moved on', { currentMove: game.moveCount });
+    }
+  }
+
+  private sendActionResult(ws: WebSocket, connection: { gameId: string; playerId: number }, moveId: any, result: any): void {
+    const player = this.games.get(connection.gameId)?.players[connection.playerId];
+    if (player && typeof moveId === 'string' && moveId) {
+      player.recentActions.set(moveId, { ...result, moveId });
+      // Maps iterate in insertion order, so the first key is the oldest
+      if (player.recentActions.size > IDEMPOTENCY_WINDOW) {
+        player.recentActions.delete(player.recentActions.keys().next().value!);
+      }
+      result = { ...result, moveId };
+    }
+    this.send(ws, result);
+  }
+
+  // Emotes are optional, but anything outside the allow-list rejects the whole move
+  private requireEmote(message: GameMessage): string | undefined {
+    if (message.emote === undefined || message.emote === null || message.emote === '') return undefined;
+    if (typeof message.emote !== 'string' || !EMOTES.includes(message.emote)) {
+      throw new GameError(ErrorCode.VALIDATION_FAILED, 'Invalid action payload', undefined, [
+        { field: 'emote', reason: `must be one of ${EMOTES.join(', ')}` }
+      ]);
     }
+    return message.emote;
   }
 
-  private handleChat(game: GameState, playerId: number, text: string): void {
+  // Keep the emote with the move it was sent on and pass it to both players
+  private recordEmote(gameId: string, playerId: number, moveCount: number, emote: string | undefined): void {
+    const game = this.games.get(gameId);
+    if (!emote || !game) return;
+
+    const entry = { moveCount, playerId, emote, timestamp: Date.now() };
+    game.emotes.push(entry);
+    this.broadcastToGame(game, { type: 'emote', playerName: game.players[playerId].name, ...entry });
+  }
+
+  // Freeform text where the game has chat, or a quick-chat phrase by its number, which
+  // every game allows; each player reads a phrase in their own language
+  private handleChat(game: GameState, playerId: number, text: unknown, phrase?: unknown): void {
+    if (phrase !== undefined && (!Number.isInteger(phrase) || (phrase as number) < 1 || (phrase as number) > QUICK_CHAT.length)) {
+      throw new GameError(ErrorCode.VALIDATION_FAILED, 'Invalid quick-chat phrase', undefined, [
+        { field: 'phrase', reason: `must be a number from 1 to ${QUICK_CHAT.length}` }
+      ]);
+    }
+    const key = phrase === undefined ? undefined : QUICK_CHAT[(phrase as number) - 1];
+    if (key === undefined && typeof text !== 'string') {
+      throw new GameError(ErrorCode.VALIDATION_FAILED, 'Invalid chat message', undefined, [{ field: 'text', reason: 'must be a string' }]);
+    }
+    if (key === undefined && !game.features.chat) return;
+
     const player = game.players[playerId];
-    if (!player || !text || text.length > 200) return;
+    if (!player || player.chatMuted || (key === undefined && (!text || (text as string).length > 200))) return;
 
-    const chatMessage = {
-      type: 'chat',
+    const line: ChatLine = {
+      id: (game.chat[game.chat.length - 1]?.id ?? 0) + 1,
       playerId,
       playerName: player.name,
-      text: text.trim(),
+      text: key ? translate(`quickChat.${key}`, DEFAULT_LOCALE) : (text as string).trim(),
+      ...(key && { phrase: key }),
       timestamp: Date.now()
     };
+    game.chat.push(line);
+    if (game.chat.length > MAX_CHAT_KEPT) game.chat.shift();
+    const { id: messageId, ...chatMessage } = line;
 
     game.players.forEach(p => {
       if (p.ws.readyState === WebSocket.OPEN) {
-        p.ws.send(JSON.stringify(chatMessage));
+        const localized = key ? translate(`quickChat.${key}`, this.localeFor(p.ws)) : chatMessage.text;
+        this.send(p.ws, { type: 'chat', messageId, ...chatMessage, text: localized });
       }
     });
 
-    console.log(`${player.name}: ${text}`);
+    console.log(`${player.name}: ${line.text}`);
+  }
+
+  // The quick-chat phrases, numbered as they are sent, in the connection's language
+  private quickChatPhrases(locale: string): { phrase: number; key: string; text: string }[] {
+    return QUICK_CHAT.map((key, index) => ({ phrase: index + 1, key, text: translate(`quickChat.${key}`, locale) }));
+  }
+
+  // A player reports an opponent's chat message to the moderators, with what was said before it
+  reportChat(gameId: string, playerId: number, messageId: number, reason?: string): void {
+    const game = this.requireGame(gameId);
+    const reporter = game.players[playerId];
+    if (!reporter) {
+      throw new GameError(ErrorCode.NOT_IN_GAME, 'You are not a player in this game');
+    }
+    const index = game.chat.findIndex(line => line.id === messageId);
+    if (index === -1 || game.chat[index].playerId === playerId) {
+      throw new GameError(ErrorCode.NOT_FOUND, "No such message from your opponent; only the last few can be reported", { messageId });
+    }
+    const line = game.chat[index];
+    const sender = game.players[line.playerId];
+    const note = typeof reason === 'string' && reason.trim() ? `: ${reason.trim().slice(0, 200)}` : '';
+    // Raised once per message, however many times it is reported
+    this.moderation.raise({
+      kind: 'chatReport',
+      key: `${game.id} ${messageId}`,
+      accounts: sender?.userId ? [{ userId: sender.userId, name: sender.name }] : [],
+      gameIds: [game.id],
+      reason: `${reporter.name} reported a message from ${line.playerName}${note}`,
+      reportedBy: reporter.name,
+      chat: game.chat.slice(Math.max(index - REPORT_CONTEXT, 0), index + 1)
+    });
+  }
+
+  // A player reports their opponent, during the game or after it. Where the game stands
+  // and its chat go with the report; one report per player per game reaches the queue.
+  reportPlayer(gameId: string, playerId: number, category: unknown, comment?: unknown): void {
+    this.fileReport(this.requireKeptGame(String(gameId || '').toUpperCase()), playerId, category, comment);
+  }
+
+  // The same for whoever holds a seat's resume token, so a player who has left, or whose
+  // game has been archived, can still report without taking their seat back
+  reportPlayerByToken(gameId: string, resumeToken: unknown, category: unknown, comment?: unknown): void {
+    const game = this.requireKeptGame(String(gameId || '').toUpperCase());
+    const player = game.players.find(p => typeof resumeToken === 'string' && p.resumeToken === resumeToken);
+    if (!player) {
+      throw new GameError(ErrorCode.NOT_IN_GAME, 'That resume token does not match a seat in this game', { gameId: game.id });
+    }
+    this.fileReport(game, player.id, category, comment);
+  }
+
+  private fileReport(game: GameState, playerId: number, category: unknown, comment?: unknown): void {
+    const fields: { field: string; reason: string }[] = [];
+    if (!REPORT_CATEGORIES.includes(category as ReportCategory)) {
+      fields.push({ field: 'category', reason: `must be one of ${REPORT_CATEGORIES.join(', ')}` });
+    }
+    if (comment !== undefined && (typeof comment !== 'string' || comment.length > 500)) {
+      fields.push({ field: 'comment', reason: 'must be text of at most 500 characters' });
+    }
+    if (fields.length > 0) {
+      throw new GameError(ErrorCode.VALIDATION_FAILED, 'Invalid report', undefined, fields);
+    }
+    const reporter = game.players[playerId];
+    const reported = game.players[1 - playerId];
+    if (!reporter) {
+      throw new GameError(ErrorCode.NOT_IN_GAME, 'You are not a player in this game');
+    }
+    if (!reported) {
+      throw new GameError(ErrorCode.NOT_IN_GAME, 'You have no opponent to report');
+    }
+
+    const text = typeof comment === 'string' && comment.trim() ? comment.trim() : undefined;
+    this.moderation.raise({
+      kind: 'playerReport',
+      key: `${game.id} ${playerId}`,
+      accounts: reported.userId ? [{ userId: reported.userId, name: reported.name }] : [],
+      gameIds: [game.id],
+      reason: `${reporter.name} reported ${reported.name} for ${category}${text ? `: ${text.slice(0, 200)}` : ''}`,
+      reportedBy: reporter.name,
+      category: category as ReportCategory,
+      comment: text,
+      context: {
+        phase: game.phase,
+        moveCount: game.moveCount,
+        players: game.players.map(p => ({ id: p.id, name: p.name, userId: p.userId }))
+      },
+      chat: [...game.chat]
+    });
   }
 
   removePlayer(ws: WebSocket): void {
-    this.leaveGame(ws);
+    this.cancelQuickMatch(ws);
+    this.stopSpectating(ws);
+    this.drills.delete(ws);
+    if (!this.holdSeat(ws)) this.leaveGame(ws);
     this.removeConnection(ws);
   }
 
-  private cleanupOldGames(): void {
+  // Drop games that are too old or that nobody is connected to any more, and finished
+  // games kept in memory as long as the archive policy allows
+  cleanupOldGames(): string {
     const now = Date.now();
     const maxAge = 2 * 60 * 60 * 1000; // 2 hours
+    let removed = 0;
 
     this.games.forEach((game, gameId) => {
       const gameAge = now - game.createdAt;
-      const hasActivePlayers = game.players.some(p => p.ws.readyState === WebSocket.OPEN);
+      const hasActivePlayers = game.players.some(p => p.ws.readyState === WebSocket.OPEN || p.disconnectedAt !== null);
+      const expired = this.finishedTtlMs > 0 && game.phase === GamePhase.GAME_OVER && now - this.finishedAt(game) >= this.finishedTtlMs;
 
-      if (gameAge > maxAge || !hasActivePlayers) {
+      if (gameAge > maxAge || !hasActivePlayers || expired) {
         console.log(`Cleaning up old/inactive game: ${gameId}`);
-        this.games.delete(gameId);
-        this.broadcastGameRemoved(gameId);
+        this.retireGame(game);
+        removed++;
       }
     });
+    this.freeForAlls.forEach((match, matchId) => {
+      if (now - match.createdAt > maxAge) this.freeForAlls.delete(matchId);
+    });
+    return `${removed} game(s) removed`;
+  }
+
+  // Games not yet won or aborted, waiting ones included
+  countGamesInProgress(): number {
+    return [...this.games.values()].filter(game => game.phase !== GamePhase.GAME_OVER && game.phase !== GamePhase.ABORTED).length;
   }
 
   getGameStats(): { totalGames: number; activePlayers: number; totalConnections: number } {
@@ -765,8 +3411,18 @@ class GameManager {
 }
 
 // HTTP Server for static files
-function createHttpServer(): http.Server {
+function createHttpServer(api: HttpApi, metrics: Metrics): http.Server {
   return http.createServer((req, res) => {
+    if (req.url && req.url.startsWith('/api/')) {
+      api.handle(req, res);
+      return;
+    }
+    if (req.url === '/metrics' && req.method === 'GET') {
+      res.writeHead(200, { 'Content-Type': 'text/plain; version=0.0.4' });
+      res.end(metrics.render());
+      return;
+    }
+
     let filePath = '.' + req.url;
     if (filePath === './') {
       filePath = './index.html';
@@ -812,8 +3468,21 @@ function createHttpServer(): http.Server {
           res.end(`Server Error: ${error.code}\n`);
         }
       } else {
-        res.writeHead(200, { 'Content-Type': contentType });
-        res.end(content, 'utf-8');
+        const encoding = Utils.negotiateEncoding(req.headers['accept-encoding']);
+        if (!encoding || !COMPRESSIBLE_TYPES.has(contentType)) {
+          // A type that could have been compressed varies with the header, so caches keep them apart
+          res.writeHead(200, { 'Content-Type': contentType, ...(COMPRESSIBLE_TYPES.has(contentType) && { 'Vary': 'Accept-Encoding' }) });
+          res.end(content, 'utf-8');
+          return;
+        }
+
+        const compressed = encoding === 'gzip' ? zlib.gzipSync(content) : zlib.deflateSync(content);
+        res.writeHead(200, {
+          'Content-Type': contentType,
+          'Content-Encoding': encoding,
+          'Vary': 'Accept-Encoding'
+        });
+        res.end(compressed);
       }
     });
   });
@@ -821,20 +3490,125 @@ function createHttpServer(): http.Server {
 
 // Main Server Setup
 function startServer(): void {
-  const server = createHttpServer();
-  const wss = new WebSocketServer({ server });
-  const gameManager = new GameManager();
+  let port = PORT;
+  let grpcPort: number | undefined;
+  let defaultConfig = DEFAULT_CONFIG;
+  let retention: RetentionPolicy | null = null;
+  let archivePolicy: ArchivePolicy | null = null;
+  let intervals: DeliveryIntervals;
+  let signer: ResultSigner;
+  let storage: Storage;
+  let hooks: string[];
+  let bots: Record<string, BotDefinition>;
+  const events = new EventBus();
+  try {
+    const options = Utils.parseServerArgs(process.argv.slice(2));
+    port = options.port ?? PORT;
+    grpcPort = options.grpcPort;
+    defaultConfig = Rules.resolveConfig(options.config);
+    retention = loadRetentionPolicy();
+    archivePolicy = loadArchivePolicy();
+    intervals = loadDeliveryIntervals();
+    signer = new ResultSigner(process.env.TANKS_RESULT_KEY_FILE);
+    storage = openStorage(options.storage);
+    hooks = attachHooks(events);
+    bots = loadBots();
+  } catch (error) {
+    const reasons = error instanceof GameError ? error.fields?.map(f => `${f.field} ${f.reason}`).join('; ') : (error as Error).message;
+    console.error(`Invalid server options: ${reasons}`);
+    process.exit(2);
+  }
+
+  const flags = new FeatureFlags();
+  flags.load();
+  const accounts = new Accounts(storage.accounts, process.env.TANKS_ACCOUNT_SECRET);
+  const chaos = new FaultInjector();
+  if (chaos.enabled) console.log('Fault injection available (TANKS_CHAOS); every fault is off until set through /api/chaos');
+  const shaper = new DeliveryShaper(intervals);
+  const moderation = new ModerationQueue(process.env.TANKS_MODERATION_QUEUE);
+  const gameManager = new GameManager(flags, defaultConfig, chaos.wrapStore(storage.store), accounts, signer, events, bots, archivePolicy, shaper, moderation);
+  const metrics = new Metrics(() => gameManager.countGamesInProgress());
+  events.subscribe('metrics', metrics.subscriber);
+  if (hooks.length > 0) console.log(`Event hooks: ${hooks.join('; ')}`);
+  if (Object.keys(bots).length > 0) console.log(`Bots: ${Object.keys(bots).join(', ')}`);
+  if (archivePolicy) {
+    console.log(`Finished games archived to ${archivePolicy.archiveDir}` +
+      (archivePolicy.finishedMinutes > 0 ? ` ${archivePolicy.finishedMinutes} minute(s) after they end` : ' as they leave memory'));
+  }
+  console.log(`Delivery intervals: ${Object.entries(intervals).map(([role, ms]) => `${role} ${ms} ms`).join(', ')}`);
+  const staff = new StaffDirectory();
+  staff.load();
+  const scheduler = new Scheduler();
+  const api = new HttpApi(gameManager, staff, new AuditLog(process.env.TANKS_AUDIT_LOG), accounts, scheduler, chaos, moderation);
+  const server = createHttpServer(api, metrics);
+
+  // Every recurring task, so staff can see when each last ran (GET /api/jobs)
+  scheduler.add('staleGameCleanup', { everyMs: 30 * 60 * 1000 }, 'Remove games older than two hours or with nobody connected, archiving finished ones if set',
+    () => gameManager.cleanupOldGames());
+  scheduler.add('apiSessionExpiry', { everyMs: 10 * 60 * 1000 }, 'Drop REST and gRPC sessions whose players stopped polling',
+    () => api.expireSessions());
+  scheduler.add('serverStats', { everyMs: 60 * 1000 }, 'Log game, player and connection counts', () => {
+    const stats = gameManager.getGameStats();
+    const { delayed, superseded } = shaper.status().counts;
+    const line = `Games: ${stats.totalGames}, Players: ${stats.activePlayers}, Connections: ${stats.totalConnections}, ` +
+      `Held back: ${delayed} (${superseded} superseded)`;
+    console.log(`Server Stats - ${line}`);
+    return line;
+  });
+  if (retention) {
+    const policy = retention;
+    scheduler.add('retention', { dailyAt: RETENTION_RUN_AT }, `Archive or purge saves older than ${policy.maxAgeDays} days`,
+      () => describeReport(gameManager.runRetention(policy)));
+    scheduler.run('retention');
+  }
+  const eventLog = process.env.TANKS_EVENT_LOG;
+  if (eventLog && eventLog !== '-') {
+    scheduler.add('collusionCheck', { dailyAt: COLLUSION_RUN_AT }, 'Flag account pairs whose rated games look arranged for moderators to review',
+      () => describeCollusion(detectCollusion(fs.existsSync(eventLog) ? fs.readFileSync(eventLog, 'utf-8') : '', moderation)).split('\n')[0]);
+  }
+
+  const wss = new WebSocketServer({
+    server,
+    perMessageDeflate: { threshold: COMPRESSION_THRESHOLD },
+    // Clients may request a binary codec via subprotocol; plain connections use JSON
+    handleProtocols: (protocols: Set<string>) => {
+      const codec = selectCodec(protocols);
+      return protocols.has(codec.subprotocol) ? codec.subprotocol : false;
+    }
+  });
+
+  // Errors inside message handling are dumped and recovered per game; anything
+  // that escapes to here leaves the process in an unknown state, so dump and exit
+  process.on('uncaughtException', (error) => {
+    console.error('Uncaught exception:', error);
+    gameManager.dumpAllGames(error);
+    process.exit(1);
+  });
+
+  // Re-read feature flags and staff tokens without a restart; running games keep their flag snapshot
+  process.on('SIGHUP', () => {
+    flags.load();
+    staff.load();
+    console.log('Feature flags reloaded:', flags.snapshot());
+  });
 
-  wss.on('connection', (ws: WebSocket) => {
-    gameManager.addConnection(ws);
+  wss.on('connection', (ws: WebSocket, req: http.IncomingMessage) => {
+    const acceptLanguage = req.headers['accept-language'];
+    chaos.attach(ws);
+    shaper.attach(ws);
+    gameManager.addConnection(ws, selectCodec([ws.protocol]), negotiateLocale(acceptLanguage), negotiateFormat(acceptLanguage));
 
-    ws.on('message', (data: string) => {
+    ws.on('message', (data: Buffer) => {
+      if (chaos.dropConnection()) {
+        ws.terminate();
+        return;
+      }
       try {
-        const message: GameMessage = JSON.parse(data);
+        const message: GameMessage = gameManager.codecFor(ws).decode(data);
         gameManager.handleMessage(ws, message);
       } catch (error) {
         console.error('Error parsing message:', error);
-        ws.send(JSON.stringify({ type: 'error', message: 'Invalid message format' }));
+        gameManager.send(ws, { type: 'error', error: new GameError(ErrorCode.INVALID_MESSAGE, 'Invalid message format').toEnvelope(gameManager.localeFor(ws)) });
       }
     });
 
@@ -847,18 +3621,20 @@ function startServer(): void {
     });
   });
 
-  // Periodic stats logging
-  setInterval(() => {
-    const stats = gameManager.getGameStats();
-    console.log(`Server Stats - Games: ${stats.totalGames}, Players: ${stats.activePlayers}, Connections: ${stats.totalConnections}`);
-  }, 60000); // Every minute
-
-  server.listen(PORT, () => {
-    console.log(`Fog of Tank server running on port ${PORT}`);
-    console.log(`Game available at http://localhost:${PORT}`);
+  server.listen(port, () => {
+    console.log(`Fog of Tank server running on port ${port}`);
+    console.log(`Game available at http://localhost:${port}`);
+    console.log(`Default settings: ${JSON.stringify(defaultConfig)}`);
+    console.log(`Storage: ${storage.description}`);
     console.log(`Ready for tank battles!`);
     console.log(`Features: Custom room IDs, real-time broadcasting, auto-matchmaking`);
   });
+  if (grpcPort !== undefined) {
+    // Bot clients; shares the REST API's sessions (see grpc.cts and tanks.proto)
+    new GrpcServer(gameManager, api).createServer().listen(grpcPort, () => {
+      console.log(`gRPC service tanks.v1.Tanks on port ${grpcPort}`);
+    });
+  }
 }
 
 // Start the server
@@ -866,5 +3642,5 @@ if (require.main === module) {
   startServer();
 }
 
-export { GameManager, Utils, CellState, GamePhase };
+export { GameManager, Utils, GamePhase };
 
@@ -0,0 +1,258 @@
+// Headless matches between two AI strategies, for comparing them at scale. Games are
+// played straight through Rules with no server, sockets or clocks, and every random
+// choice comes from a generator seeded per game, so a run can be repeated exactly: the
+// same seed gives the same results however many workers share the games.
+//
+//   node simulate.cjs <strategy> <strategy> [--games N] [--seed S] [--workers W] [--config JSON] [--mistakes] [--json]
+//
+// Strategies are named as in ai.cts (random, hunt, density) or by difficulty (easy,
+// medium, hard). The two take turns moving first. --config takes the same settings a
+// game does, e.g. '{"boardSize":10,"tankLengths":[2,3]}'. With --mistakes, a strategy named
+// by difficulty also makes that difficulty's mistakes, as set by TANKS_AI_MISTAKES, so the
+// mistake rates can be tuned against the win rates they produce.
+
+import * as os from 'os';
+import { Worker, isMainThread, parentPort, workerData } from 'worker_threads';
+import type { GameError } from './errors.cjs';
+import { Rules, type GameConfig } from './game.cjs';
+import {
+  AI_STRATEGIES, generatePlacements, withMistake, loadMistakeModels, type AiDifficulty, type AiStrategy, type MistakeModel, type RandomInt
+} from './ai.cjs';
+
+const DEFAULT_GAMES = 1000;
+const MAX_GAMES = 10_000_000;
+
+interface SimulationOptions {
+  strategies: [string, string];
+  games: number;
+  seed: number;
+  workers: number;
+  config: GameConfig;
+  mistakes: [MistakeModel | null, MistakeModel | null];  // Per strategy, with --mistakes
+}
+
+interface GameOutcome {
+  winner: number;    // Index into the strategies
+  turns: number;     // Bombs dropped by both sides
+  durationMs: number;
+}
+
+interface SimulationReport {
+  strategies: [string, string];
+  games: number;
+  seed: number;
+  workers: number;
+  mistakes: [MistakeModel | null, MistakeModel | null];
+  wins: [number, number];
+  winsMovingFirst: [number, number];
+  turns: { mean: number; p50: number; p99: number };
+  durationMs: { mean: number; p50: number; p99: number; total: number };
+}
+
+// mulberry32: small, fast and plenty for picking cells; not for anything secret
+function seededRandom(seed: number): RandomInt {
+  let state = seed >>> 0;
+  return max => {
+    state = (state + 0x6D2B79F5) >>> 0;
+    let t = state;
+    t = Math.imul(t ^ (t >>> 15), t | 1);
+    t ^= t + Math.imul(t ^ (t >>> 7), t | 61);
+    return Math.floor((((t ^ (t >>> 14)) >>> 0) / 4294967296) * max);
+  };
+}
+
+// Each game's seed depends only on the run's seed and the game's number
+function gameSeed(seed: number, game: number): number {
+  return Math.imul(seed ^ 0x9E3779B9, 0x85EBCA6B) ^ Math.imul(game + 1, 0xC2B2AE35);
+}
+
+function findStrategy(name: string): AiStrategy | undefined {
+  return Object.values(AI_STRATEGIES).find(strategy => strategy.name === name) ?? AI_STRATEGIES[name as keyof typeof AI_STRATEGIES];
+}
+
+// One game between the two strategies; `first` says which of them opens the battle
+function playGame(
+  config: GameConfig,
+  strategies: [AiStrategy, AiStrategy],
+  first: number,
+  random: RandomInt,
+  mistakes: [MistakeModel | null, MistakeModel | null] = [null, null]
+): { winner: number; turns: number } {
+  const sides = [Rules.createSide(config), Rules.createSide(config)];
+  const lengths = Array.from({ length: config.tanksPerPlayer }, (_, i) => Rules.tankLength(config, i));
+  sides.forEach((side, index) => {
+    generatePlacements(config.boardSize, lengths, strategies[index].spreadTanks, random)
+      .forEach(({ x, y, orientation }) => Rules.placeTank(config, side, x, y, orientation));
+  });
+
+  let turn = first;
+  let turns = 0;
+  // Every bomb lands on a cell not bombed before, so the game always ends
+  for (;;) {
+    const attacker = sides[turn];
+    const defender = sides[1 - turn];
+    const view = { enemyBoard: Rules.boardView(attacker).enemyBoard, explosionRadius: config.explosionRadius, random };
+    const choice = strategies[turn].chooseTarget(view);
+    const target = mistakes[turn] ? withMistake(choice, view, mistakes[turn]!) : choice;
+    Rules.bomb(config, attacker, defender, target.x, target.y);
+    turns++;
+    if (defender.tanksAlive === 0) return { winner: turn, turns };
+    turn = 1 - turn;
+  }
+}
+
+// Play games [from, to) of a run
+function playRange(options: SimulationOptions, from: number, to: number): GameOutcome[] {
+  const strategies = options.strategies.map(name => findStrategy(name)!) as [AiStrategy, AiStrategy];
+  const outcomes: GameOutcome[] = [];
+  for (let game = from; game < to; game++) {
+    const startedAt = performance.now();
+    const { winner, turns } = playGame(options.config, strategies, game % 2, seededRandom(gameSeed(options.seed, game)), options.mistakes);
+    outcomes.push({ winner, turns, durationMs: performance.now() - startedAt });
+  }
+  return outcomes;
+}
+
+// Split the games into one contiguous range per worker thread
+async function simulate(options: SimulationOptions): Promise<SimulationReport> {
+  const startedAt = performance.now();
+  const workers = Math.min(options.workers, options.games);
+  const perWorker = Math.ceil(options.games / workers);
+  const ranges = Array.from({ length: workers }, (_, i) => [i * perWorker, Math.min((i + 1) * perWorker, options.games)]);
+
+  const outcomes = workers === 1
+    ? playRange(options, 0, options.games)
+    : (await Promise.all(ranges.map(([from, to]) => new Promise<GameOutcome[]>((resolve, reject) => {
+      const worker = new Worker(__filename, { workerData: { options, from, to } });
+      worker.once('message', resolve);
+      worker.once('error', reject);
+    })))).flat();
+
+  return summarize(options, outcomes, performance.now() - startedAt);
+}
+
+// Nearest-rank percentile of already sorted values
+function percentile(sorted: number[], p: number): number {
+  return sorted[Math.max(Math.ceil((p / 100) * sorted.length) - 1, 0)];
+}
+
+function summarize(options: SimulationOptions, outcomes: GameOutcome[], totalMs: number): SimulationReport {
+  const wins: [number, number] = [0, 0];
+  const winsMovingFirst: [number, number] = [0, 0];
+  outcomes.forEach((outcome, game) => {
+    wins[outcome.winner]++;
+    if (outcome.winner === game % 2) winsMovingFirst[outcome.winner]++;
+  });
+  const turns = outcomes.map(o => o.turns).sort((a, b) => a - b);
+  const durations = outcomes.map(o => o.durationMs).sort((a, b) => a - b);
+  const mean = (values: number[]) => values.reduce((sum, v) => sum + v, 0) / values.length;
+
+  return {
+    strategies: options.strategies,
+    games: outcomes.length,
+    seed: options.seed,
+    workers: Math.min(options.workers, options.games),
+    mistakes: options.mistakes,
+    wins,
+    winsMovingFirst,
+    turns: { mean: mean(turns), p50: percentile(turns, 50), p99: percentile(turns, 99) },
+    durationMs: { mean: mean(durations), p50: percentile(durations, 50), p99: percentile(durations, 99), total: totalMs }
+  };
+}
+
+function describeSimulation(report: SimulationReport): string {
+  const { games, wins, winsMovingFirst, turns, durationMs } = report;
+  const strategies = report.strategies.map((name, i) => {
+    const mistakes = report.mistakes[i];
+    return mistakes ? `${name} (${Math.round(mistakes.rate * 100)}% mistakes)` : name;
+  });
+  const width = Math.max(...strategies.map(name => name.length));
+  const percent = (count: number, of: number) => `${of > 0 ? ((100 * count) / of).toFixed(1) : '0.0'}%`;
+  return [
+    `${games} games, ${strategies[0]} vs ${strategies[1]}, seed ${report.seed}, ${report.workers} worker(s)`,
+    ...strategies.map((name, i) =>
+      `  ${name.padEnd(width)}  won ${wins[i]} (${percent(wins[i], games)}), ${winsMovingFirst[i]} of them moving first`),
+    `  turns   mean ${turns.mean.toFixed(1)}, p50 ${turns.p50}, p99 ${turns.p99}`,
+    `  game    mean ${durationMs.mean.toFixed(3)} ms, p50 ${durationMs.p50.toFixed(3)} ms, p99 ${durationMs.p99.toFixed(3)} ms`,
+    `  total   ${(durationMs.total / 1000).toFixed(2)} s`
+  ].join('\n');
+}
+
+// The value following `flag`, if it was given
+function optionValue(args: string[], flag: string): string | undefined {
+  const index = args.indexOf(flag);
+  return index === -1 ? undefined : args[index + 1];
+}
+
+function parseSimulationArgs(args: string[]): SimulationOptions {
+  const valued = ['--games', '--seed', '--workers', '--config'];
+  const names = args.filter((arg, i) => !arg.startsWith('--') && !valued.includes(args[i - 1]));
+  if (names.length !== 2) {
+    throw new Error('Name two strategies to play against each other');
+  }
+  const unknown = names.filter(name => !findStrategy(name));
+  if (unknown.length > 0) {
+    const known = Object.entries(AI_STRATEGIES).map(([difficulty, strategy]) => `${strategy.name} (${difficulty})`);
+    throw new Error(`Unknown strategy ${unknown.join(', ')}; choose from ${known.join(', ')}`);
+  }
+
+  const integer = (flag: string, fallback: number, min: number, max: number): number => {
+    const raw = optionValue(args, flag);
+    if (raw === undefined) return fallback;
+    const value = Number(raw);
+    if (!Number.isInteger(value) || value < min || value > max) {
+      throw new Error(`${flag} must be a whole number from ${min} to ${max}`);
+    }
+    return value;
+  };
+
+  const mistakeModels = args.includes('--mistakes') ? loadMistakeModels() : null;
+  const rawConfig = optionValue(args, '--config');
+  let proposed: unknown = {};
+  if (rawConfig !== undefined) {
+    try {
+      proposed = JSON.parse(rawConfig);
+    } catch {
+      throw new Error('--config must be JSON');
+    }
+  }
+
+  return {
+    // Reported under their strategy names, whichever way they were asked for
+    strategies: names.map(name => findStrategy(name)!.name) as [string, string],
+    games: integer('--games', DEFAULT_GAMES, 1, MAX_GAMES),
+    seed: integer('--seed', 1, 0, 0xFFFFFFFF),
+    workers: integer('--workers', Math.max(os.availableParallelism() - 1, 1), 1, 256),
+    config: Rules.resolveConfig(proposed),
+    mistakes: names.map(name => {
+      const model = mistakeModels?.[name as AiDifficulty];
+      return model && model.rate > 0 ? model : null;
+    }) as [MistakeModel | null, MistakeModel | null]
+  };
+}
+
+async function main(args: string[]): Promise<void> {
+  let options: SimulationOptions;
+  try {
+    options = parseSimulationArgs(args);
+  } catch (error) {
+    const fields: { field: string; reason: string }[] = (error as GameError).fields ?? [];
+    console.error([(error as Error).message, ...fields.map(f => `  ${f.field} ${f.reason}`)].join('\n'));
+    console.error('Usage: node simulate.cjs <strategy> <strategy> [--games N] [--seed S] [--workers W] [--config JSON] [--mistakes] [--json]');
+    process.exit(2);
+  }
+
+  const report = await simulate(options);
+  console.log(args.includes('--json') ? JSON.stringify(report, null, 2) : describeSimulation(report));
+  process.exit(0);
+}
+
+if (!isMainThread && workerData?.options) {
+  const { options, from, to } = workerData;
+  parentPort!.postMessage(playRange(options, from, to));
+} else if (require.main === module) {
+  main(process.argv.slice(2));
+}
+
+export { simulate, playGame, seededRandom, describeSimulation, parseSimulationArgs };
+export type { SimulationOptions, SimulationReport, GameOutcome };
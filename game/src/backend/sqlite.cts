@@ -0,0 +1,197 @@
+// SQLite storage for saved games and accounts, on Node's built-in node:sqlite, so games
+// and players survive restarts without a database server. Saved games are split into the
+// game itself and one row per logged move; accounts keep their rating and stats in columns
+// so the leaderboard can be read straight from the table. It is the only SQL backend; why
+// there is no Postgres one is in store.cts.
+//
+// The schema is versioned with PRAGMA user_version. Opening a database applies whichever
+// MIGRATIONS it has not seen yet, in order, each in its own transaction.
+
+import type { DatabaseSync } from 'node:sqlite';
+import type { Store, GameSnapshot } from './store.cjs';
+import type { AccountRepository, UserAccount } from './accounts.cjs';
+
+// Append only: a migration that has shipped is never edited, a new one is added instead
+const MIGRATIONS: string[] = [
+  `CREATE TABLE games (
+     id TEXT PRIMARY KEY,
+     version INTEGER NOT NULL,
+     saved_at TEXT NOT NULL,
+     phase TEXT NOT NULL,
+     move_count INTEGER NOT NULL,
+     game TEXT NOT NULL              -- Utils.serializeGame output without its move log
+   );
+   CREATE TABLE moves (
+     game_id TEXT NOT NULL REFERENCES games(id) ON DELETE CASCADE,
+     seq INTEGER NOT NULL,
+     entry TEXT NOT NULL,            -- One MoveLogEntry as JSON
+     PRIMARY KEY (game_id, seq)
+   );
+   CREATE TABLE users (
+     id TEXT PRIMARY KEY,
+     name TEXT NOT NULL UNIQUE COLLATE NOCASE,
+     password_hash TEXT NOT NULL,
+     created_at TEXT NOT NULL,
+     rating INTEGER NOT NULL,
+     games_played INTEGER NOT NULL DEFAULT 0,
+     wins INTEGER NOT NULL DEFAULT 0,
+     losses INTEGER NOT NULL DEFAULT 0,
+     shots INTEGER NOT NULL DEFAULT 0,
+     hits INTEGER NOT NULL DEFAULT 0,
+     rated_games INTEGER NOT NULL DEFAULT 0
+   );
+   CREATE INDEX users_by_rating ON users (rating DESC);`,
+  `ALTER TABLE users ADD COLUMN timed_moves INTEGER NOT NULL DEFAULT 0;
+   ALTER TABLE users ADD COLUMN think_ms INTEGER NOT NULL DEFAULT 0;
+   ALTER TABLE users ADD COLUMN graded_shots INTEGER NOT NULL DEFAULT 0;
+   ALTER TABLE users ADD COLUMN shot_quality INTEGER NOT NULL DEFAULT 0;`,
+  `ALTER TABLE users ADD COLUMN profile_visibility TEXT NOT NULL DEFAULT 'public';
+   ALTER TABLE users ADD COLUMN history_visibility TEXT NOT NULL DEFAULT 'public';
+   ALTER TABLE users ADD COLUMN live_games_visibility TEXT NOT NULL DEFAULT 'public';
+   ALTER TABLE users ADD COLUMN friends TEXT NOT NULL DEFAULT '[]';  -- User ids as a JSON array`
+];
+
+class SqliteDatabase {
+  readonly db: DatabaseSync;
+  readonly path: string;
+
+  constructor(path: string) {
+    // Loaded here rather than imported so file storage never touches the experimental module
+    const { DatabaseSync } = require('node:sqlite') as typeof import('node:sqlite');
+    this.path = path;
+    this.db = new DatabaseSync(path);
+    this.db.exec('PRAGMA foreign_keys = ON; PRAGMA journal_mode = WAL;');
+    this.migrate();
+  }
+
+  // Run `work` in a transaction, rolling it back if it throws
+  transaction<T>(work: () => T): T {
+    this.db.exec('BEGIN');
+    try {
+      const result = work();
+      this.db.exec('COMMIT');
+      return result;
+    } catch (error) {
+      this.db.exec('ROLLBACK');
+      throw error;
+    }
+  }
+
+  private migrate(): void {
+    const { user_version: current } = this.db.prepare('PRAGMA user_version').get() as { user_version: number };
+    if (current > MIGRATIONS.length) {
+      throw new Error(`${this.path} has schema version ${current}, newer than this server knows (${MIGRATIONS.length})`);
+    }
+    MIGRATIONS.slice(current).forEach((migration, index) => {
+      const version = current + index + 1;
+      this.transaction(() => {
+        this.db.exec(migration);
+        this.db.exec(`PRAGMA user_version = ${version}`);
+      });
+      console.log(`Migrated ${this.path} to schema version ${version}`);
+    });
+  }
+}
+
+class SqliteStore implements Store {
+  private database: SqliteDatabase;
+
+  constructor(database: SqliteDatabase) {
+    this.database = database;
+  }
+
+  save(gameId: string, snapshot: GameSnapshot): void {
+    const id = gameId.toUpperCase();
+    const { moveLog = [], ...game } = snapshot.game;
+    const { db } = this.database;
+    this.database.transaction(() => {
+      db.prepare(`INSERT INTO games (id, version, saved_at, phase, move_count, game) VALUES (?, ?, ?, ?, ?, ?)
+                  ON CONFLICT (id) DO UPDATE SET version = excluded.version, saved_at = excluded.saved_at,
+                  phase = excluded.phase, move_count = excluded.move_count, game = excluded.game`)
+        .run(id, snapshot.version, snapshot.savedAt, String(game.phase), Number(game.moveCount) || 0, JSON.stringify(game));
+      db.prepare('DELETE FROM moves WHERE game_id = ?').run(id);
+      const insertMove = db.prepare('INSERT INTO moves (game_id, seq, entry) VALUES (?, ?, ?)');
+      (moveLog as any[]).forEach((entry, index) => insertMove.run(id, entry.seq ?? index + 1, JSON.stringify(entry)));
+    });
+  }
+
+  load(gameId: string): GameSnapshot | null {
+    const id = gameId.toUpperCase();
+    const row = this.database.db.prepare('SELECT version, saved_at, game FROM games WHERE id = ?').get(id) as
+      { version: number; saved_at: string; game: string } | undefined;
+    if (!row) return null;
+
+    const moves = this.database.db.prepare('SELECT entry FROM moves WHERE game_id = ? ORDER BY seq').all(id) as { entry: string }[];
+    return {
+      version: row.version,
+      savedAt: row.saved_at,
+      game: { ...JSON.parse(row.game), moveLog: moves.map(move => JSON.parse(move.entry)) }
+    };
+  }
+
+  remove(gameId: string): void {
+    this.database.db.prepare('DELETE FROM games WHERE id = ?').run(gameId.toUpperCase());
+  }
+
+  list(): string[] {
+    return (this.database.db.prepare('SELECT id FROM games ORDER BY id').all() as { id: string }[]).map(row => row.id);
+  }
+}
+
+class SqliteAccountRepository implements AccountRepository {
+  private database: SqliteDatabase;
+
+  constructor(database: SqliteDatabase) {
+    this.database = database;
+  }
+
+  loadAll(): UserAccount[] {
+    const rows = this.database.db.prepare('SELECT * FROM users').all() as any[];
+    return rows.map(row => ({
+      id: row.id,
+      name: row.name,
+      passwordHash: row.password_hash,
+      createdAt: row.created_at,
+      rating: row.rating,
+      stats: {
+        gamesPlayed: row.games_played,
+        wins: row.wins,
+        losses: row.losses,
+        shots: row.shots,
+        hits: row.hits,
+        ratedGames: row.rated_games,
+        timedMoves: row.timed_moves,
+        thinkMs: row.think_ms,
+        gradedShots: row.graded_shots,
+        shotQuality: row.shot_quality
+      },
+      privacy: {
+        profile: row.profile_visibility,
+        history: row.history_visibility,
+        liveGames: row.live_games_visibility,
+        friends: JSON.parse(row.friends)
+      }
+    }));
+  }
+
+  save(user: UserAccount): void {
+    const { stats, privacy } = user;
+    this.database.db.prepare(`INSERT INTO users (id, name, password_hash, created_at, rating, games_played, wins, losses, shots, hits, rated_games,
+                                                 timed_moves, think_ms, graded_shots, shot_quality,
+                                                 profile_visibility, history_visibility, live_games_visibility, friends)
+                              VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+                              ON CONFLICT (id) DO UPDATE SET name = excluded.name, password_hash = excluded.password_hash,
+                              rating = excluded.rating, games_played = excluded.games_played, wins = excluded.wins,
+                              losses = excluded.losses, shots = excluded.shots, hits = excluded.hits, rated_games = excluded.rated_games,
+                              timed_moves = excluded.timed_moves, think_ms = excluded.think_ms, graded_shots = excluded.graded_shots,
+                              shot_quality = excluded.shot_quality, profile_visibility = excluded.profile_visibility,
+                              history_visibility = excluded.history_visibility, live_games_visibility = excluded.live_games_visibility,
+                              friends = excluded.friends`)
+      .run(user.id, user.name, user.passwordHash, user.createdAt, user.rating,
+        stats.gamesPlayed, stats.wins, stats.losses, stats.shots, stats.hits, stats.ratedGames,
+        stats.timedMoves, stats.thinkMs, stats.gradedShots, stats.shotQuality,
+        privacy.profile, privacy.history, privacy.liveGames, JSON.stringify(privacy.friends));
+  }
+}
+
+export { SqliteDatabase, SqliteStore, SqliteAccountRepository, MIGRATIONS };
@@ -0,0 +1,139 @@
+// SQLite storage: migrating a database from any earlier schema version, and saved games
+// and accounts coming back exactly as they were saved. Run with `npm test`.
+
+import { describe, it, beforeEach } from 'node:test';
+import * as assert from 'assert';
+import * as fs from 'fs';
+import * as os from 'os';
+import * as path from 'path';
+import { DatabaseSync } from 'node:sqlite';
+import { SqliteDatabase, SqliteStore, SqliteAccountRepository, MIGRATIONS } from './sqlite.cjs';
+import type { GameSnapshot } from './store.cjs';
+import type { UserAccount } from './accounts.cjs';
+
+const SNAPSHOT: GameSnapshot = {
+  version: 1,
+  savedAt: '2026-05-01T12:00:00.000Z',
+  game: {
+    id: 'ABCD',
+    phase: 'battle',
+    moveCount: 2,
+    config: { boardSize: 8, tanksPerPlayer: 1 },
+    moveLog: [
+      { seq: 1, action: 'place', playerId: 0, moveCount: 0, timestamp: 1, x: 0, y: 0, orientation: 'horizontal' },
+      { seq: 2, action: 'bomb', playerId: 0, moveCount: 1, timestamp: 2, x: 3, y: 4, outcome: 'miss', thinkMs: 850 }
+    ]
+  }
+};
+
+const ACCOUNT: UserAccount = {
+  id: 'u1',
+  name: 'Commander_1',
+  passwordHash: 'aa:bb',
+  createdAt: '2026-01-01T00:00:00.000Z',
+  rating: 1234,
+  stats: { gamesPlayed: 3, wins: 2, losses: 1, shots: 40, hits: 12, ratedGames: 3, timedMoves: 40, thinkMs: 52000, gradedShots: 10, shotQuality: 640 },
+  privacy: { profile: 'public', history: 'friends', liveGames: 'private', friends: ['u2', 'u3'] }
+};
+
+let file: string;
+
+beforeEach(() => {
+  file = path.join(fs.mkdtempSync(path.join(os.tmpdir(), 'tanks-sqlite-')), 'tanks.db');
+});
+
+function schemaVersion(database: SqliteDatabase): number {
+  return (database.db.prepare('PRAGMA user_version').get() as { user_version: number }).user_version;
+}
+
+describe('migrations', () => {
+  it('brings a new database to the latest schema', () => {
+    assert.strictEqual(schemaVersion(new SqliteDatabase(file)), MIGRATIONS.length);
+  });
+
+  it('applies only the migrations a database has not seen, keeping its rows', () => {
+    const old = new DatabaseSync(file);
+    old.exec(MIGRATIONS[0]);
+    old.exec('PRAGMA user_version = 1');
+    old.prepare(`INSERT INTO users (id, name, password_hash, created_at, rating, games_played, wins) VALUES ('u1', 'old', 'aa:bb', '2025-01-01', 1100, 4, 3)`).run();
+    old.close();
+
+    const database = new SqliteDatabase(file);
+    assert.strictEqual(schemaVersion(database), MIGRATIONS.length);
+    const [user] = new SqliteAccountRepository(database).loadAll();
+    assert.strictEqual(user.rating, 1100);
+    assert.strictEqual(user.stats.wins, 3);
+    assert.strictEqual(user.stats.thinkMs, 0, 'columns added later take their defaults');
+    assert.deepStrictEqual(user.privacy, { profile: 'public', history: 'public', liveGames: 'public', friends: [] });
+  });
+
+  it('is a no-op on a database already up to date', () => {
+    new SqliteStore(new SqliteDatabase(file)).save('ABCD', SNAPSHOT);
+    const reopened = new SqliteDatabase(file);
+    assert.strictEqual(schemaVersion(reopened), MIGRATIONS.length);
+    assert.deepStrictEqual(new SqliteStore(reopened).list(), ['ABCD']);
+  });
+
+  it('refuses a database from a newer server', () => {
+    const newer = new DatabaseSync(file);
+    newer.exec(`PRAGMA user_version = ${MIGRATIONS.length + 1}`);
+    newer.close();
+    assert.throws(() => new SqliteDatabase(file), /newer than this server knows/);
+  });
+});
+
+describe('SqliteStore', () => {
+  it('round-trips a saved game and its move log', () => {
+    const store = new SqliteStore(new SqliteDatabase(file));
+    store.save('abcd', SNAPSHOT);
+    assert.deepStrictEqual(store.load('ABCD'), SNAPSHOT);
+    assert.deepStrictEqual(new SqliteStore(new SqliteDatabase(file)).load('abcd'), SNAPSHOT, 'after reopening');
+  });
+
+  it('replaces the move log when a game is saved again', () => {
+    const store = new SqliteStore(new SqliteDatabase(file));
+    store.save('ABCD', SNAPSHOT);
+    const shorter = { ...SNAPSHOT, game: { ...SNAPSHOT.game, moveLog: SNAPSHOT.game.moveLog.slice(0, 1) } };
+    store.save('ABCD', shorter);
+    assert.deepStrictEqual(store.load('ABCD'), shorter);
+  });
+
+  it('removes a game with its moves', () => {
+    const database = new SqliteDatabase(file);
+    const store = new SqliteStore(database);
+    store.save('ABCD', SNAPSHOT);
+    store.save('EFGH', SNAPSHOT);
+    store.remove('abcd');
+    assert.strictEqual(store.load('ABCD'), null);
+    assert.deepStrictEqual(store.list(), ['EFGH']);
+    assert.strictEqual((database.db.prepare(`SELECT COUNT(*) AS n FROM moves WHERE game_id = 'ABCD'`).get() as { n: number }).n, 0);
+  });
+
+  it('leaves nothing behind when a save fails part way', () => {
+    const database = new SqliteDatabase(file);
+    const broken = { ...SNAPSHOT, game: { ...SNAPSHOT.game, moveLog: [SNAPSHOT.game.moveLog[0], SNAPSHOT.game.moveLog[0]] } };
+    assert.throws(() => new SqliteStore(database).save('ABCD', broken));
+    assert.deepStrictEqual(new SqliteStore(database).list(), []);
+  });
+});
+
+describe('SqliteAccountRepository', () => {
+  it('round-trips an account with its rating, stats and privacy', () => {
+    new SqliteAccountRepository(new SqliteDatabase(file)).save(ACCOUNT);
+    assert.deepStrictEqual(new SqliteAccountRepository(new SqliteDatabase(file)).loadAll(), [ACCOUNT]);
+  });
+
+  it('updates an account saved again', () => {
+    const accounts = new SqliteAccountRepository(new SqliteDatabase(file));
+    accounts.save(ACCOUNT);
+    const changed = { ...ACCOUNT, rating: 1250, stats: { ...ACCOUNT.stats, wins: 3 } };
+    accounts.save(changed);
+    assert.deepStrictEqual(accounts.loadAll(), [changed]);
+  });
+
+  it('keeps names unique regardless of case', () => {
+    const accounts = new SqliteAccountRepository(new SqliteDatabase(file));
+    accounts.save(ACCOUNT);
+    assert.throws(() => accounts.save({ ...ACCOUNT, id: 'u2', name: ACCOUNT.name.toUpperCase() }));
+  });
+});
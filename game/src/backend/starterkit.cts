@@ -0,0 +1,214 @@
+// Starter bots for the bot protocol (see bot.cts) in Python and JavaScript, so a bot can
+// be written without working the protocol out first. Each kit is a complete bot that
+// plays legal, if random, games: it reads the server's messages, answers each request,
+// and leaves placing tanks and choosing targets to two functions meant to be rewritten.
+// The protocol version, cell values and orientations are taken from this server's own
+// definitions, so a kit always speaks the protocol of the server that made it.
+//
+//   node starterkit.cjs python|javascript [file]
+//
+// Without a file the kit is written to stdout. Try it against the built-in AI with
+//   node botmatch.cjs -- python3 mybot.py
+
+import * as fs from 'fs';
+import { BOT_PROTOCOL_VERSION } from './bot.cjs';
+import { CellState, ORIENTATIONS } from './game.cjs';
+
+type KitLanguage = 'python' | 'javascript';
+
+const KIT_LANGUAGES: KitLanguage[] = ['python', 'javascript'];
+const RUN_WITH: Record<KitLanguage, string> = { python: 'python3', javascript: 'node' };
+
+// CellState's members as NAME = value pairs
+function cellConstants(): [string, number][] {
+  return Object.entries(CellState).filter((entry): entry is [string, number] => typeof entry[1] === 'number');
+}
+
+function pythonKit(file: string): string {
+  return `#!/usr/bin/env python3
+# A Tanks bot, from the starter kit for bot protocol ${BOT_PROTOCOL_VERSION}. The server runs this program and
+# talks to it over stdin and stdout, one JSON object per line. Rewrite place_tanks and
+# choose_target; the rest answers the server. Anything printed to stderr shows up in the
+# server log.
+#
+#   node botmatch.cjs -- ${RUN_WITH.python} ${file}
+#   TANKS_BOTS='{"mybot": ["${RUN_WITH.python}", "${file}"]}' node server.cjs
+
+import json
+import random
+import sys
+
+PROTOCOL = ${BOT_PROTOCOL_VERSION}
+${cellConstants().map(([name, value]) => `${name} = ${value}`).join('\n')}
+ORIENTATIONS = ${JSON.stringify(ORIENTATIONS)}
+
+
+def place_tanks(config, lengths):
+    """One {x, y, orientation} per tank, in the order of lengths. A tank covers its
+    length in cells from (x, y), rightwards or downwards; tanks may not overlap."""
+    size = config["boardSize"]
+    taken = set()
+    tanks = []
+    for length in lengths:
+        while True:
+            orientation = random.choice(ORIENTATIONS)
+            dx, dy = (1, 0) if orientation == "horizontal" else (0, 1)
+            x = random.randrange(size - dx * (length - 1))
+            y = random.randrange(size - dy * (length - 1))
+            cells = {(x + dx * i, y + dy * i) for i in range(length)}
+            if not cells & taken:
+                taken |= cells
+                tanks.append({"x": x, "y": y, "orientation": orientation})
+                break
+    return tanks
+
+
+def choose_target(config, my_board, enemy_board):
+    """The (x, y) to bomb: a tank a blast has uncovered if there is one, otherwise any
+    cell not bombed yet. Boards are rows of cells, enemy_board[y][x]."""
+    open_cells = [(x, y) for y, row in enumerate(enemy_board) for x, cell in enumerate(row) if cell not in (HIT, MISS)]
+    tanks = [(x, y) for x, y in open_cells if enemy_board[y][x] == TANK]
+    return random.choice(tanks or open_cells)
+
+
+def send(message):
+    print(json.dumps(message), flush=True)
+
+
+def log(text):
+    print(text, file=sys.stderr, flush=True)
+
+
+def main():
+    config = None
+    for line in sys.stdin:
+        message = json.loads(line)
+        kind = message["type"]
+        if kind == "start":
+            if message["protocol"] != PROTOCOL:
+                log("written for bot protocol %d, but the server speaks %d" % (PROTOCOL, message["protocol"]))
+            config = message["config"]
+        elif kind == "place":
+            send({"tanks": place_tanks(config, message["lengths"])})
+        elif kind == "bomb":
+            x, y = choose_target(config, message["myBoard"], message["enemyBoard"])
+            send({"x": x, "y": y})
+        elif kind in ("illegal", "timeout"):
+            log("%s: %s; the server played %s instead" % (kind, message["reason"], message["played"]))
+        elif kind == "gameOver":
+            log("won" if message["won"] else "lost")
+
+
+if __name__ == "__main__":
+    main()
+`;
+}
+
+function javascriptKit(file: string): string {
+  return `#!/usr/bin/env node
+// A Tanks bot, from the starter kit for bot protocol ${BOT_PROTOCOL_VERSION}. The server runs this program and
+// talks to it over stdin and stdout, one JSON object per line. Rewrite placeTanks and
+// chooseTarget; the rest answers the server. Anything written to stderr shows up in the
+// server log.
+//
+//   node botmatch.cjs -- ${RUN_WITH.javascript} ${file}
+//   TANKS_BOTS='{"mybot": ["${RUN_WITH.javascript}", "${file}"]}' node server.cjs
+
+'use strict';
+const readline = require('readline');
+
+const PROTOCOL = ${BOT_PROTOCOL_VERSION};
+${cellConstants().map(([name, value]) => `const ${name} = ${value};`).join('\n')}
+const ORIENTATIONS = ${JSON.stringify(ORIENTATIONS)};
+
+const randomInt = n => Math.floor(Math.random() * n);
+const pick = items => items[randomInt(items.length)];
+
+// One { x, y, orientation } per tank, in the order of lengths. A tank covers its length
+// in cells from (x, y), rightwards or downwards; tanks may not overlap.
+function placeTanks(config, lengths) {
+  const size = config.boardSize;
+  const taken = new Set();
+  return lengths.map(length => {
+    for (;;) {
+      const orientation = pick(ORIENTATIONS);
+      const [dx, dy] = orientation === 'horizontal' ? [1, 0] : [0, 1];
+      const x = randomInt(size - dx * (length - 1));
+      const y = randomInt(size - dy * (length - 1));
+      const cells = Array.from({ length }, (_, i) => \`\${x + dx * i},\${y + dy * i}\`);
+      if (cells.every(cell => !taken.has(cell))) {
+        cells.forEach(cell => taken.add(cell));
+        return { x, y, orientation };
+      }
+    }
+  });
+}
+
+// The { x, y } to bomb: a tank a blast has uncovered if there is one, otherwise any cell
+// not bombed yet. Boards are rows of cells, enemyBoard[y][x].
+function chooseTarget(config, myBoard, enemyBoard) {
+  const open = enemyBoard.flatMap((row, y) => row.map((cell, x) => ({ x, y, cell }))).filter(({ cell }) => cell !== HIT && cell !== MISS);
+  const tanks = open.filter(({ cell }) => cell === TANK);
+  const { x, y } = pick(tanks.length > 0 ? tanks : open);
+  return { x, y };
+}
+
+const send = message => process.stdout.write(\`\${JSON.stringify(message)}\\n\`);
+const log = text => process.stderr.write(\`\${text}\\n\`);
+
+let config = null;
+readline.createInterface({ input: process.stdin }).on('line', line => {
+  const message = JSON.parse(line);
+  switch (message.type) {
+    case 'start':
+      if (message.protocol !== PROTOCOL) log(\`written for bot protocol \${PROTOCOL}, but the server speaks \${message.protocol}\`);
+      config = message.config;
+      break;
+    case 'place':
+      send({ tanks: placeTanks(config, message.lengths) });
+      break;
+    case 'bomb':
+      send(chooseTarget(config, message.myBoard, message.enemyBoard));
+      break;
+    case 'illegal':
+    case 'timeout':
+      log(\`\${message.type}: \${message.reason}; the server played \${message.played} instead\`);
+      break;
+    case 'gameOver':
+      log(message.won ? 'won' : 'lost');
+      break;
+  }
+});
+`;
+}
+
+function starterKit(language: KitLanguage, file: string): string {
+  return language === 'python' ? pythonKit(file) : javascriptKit(file);
+}
+
+function main(args: string[]): void {
+  const [language, file] = args as [KitLanguage, string | undefined];
+  if (!KIT_LANGUAGES.includes(language)) {
+    console.error(`Usage: node starterkit.cjs ${KIT_LANGUAGES.join('|')} [file]`);
+    process.exit(2);
+  }
+  const kit = starterKit(language, file ?? (language === 'python' ? 'mybot.py' : 'mybot.js'));
+  if (!file) {
+    process.stdout.write(kit);
+    process.exit(0);
+  }
+  if (fs.existsSync(file)) {
+    console.error(`${file} already exists; pick another name or remove it first`);
+    process.exit(2);
+  }
+  fs.writeFileSync(file, kit, { mode: 0o755 });
+  console.log(`Wrote a ${language} starter bot to ${file}; try it with: node botmatch.cjs -- ${RUN_WITH[language]} ${file}`);
+  process.exit(0);
+}
+
+if (require.main === module) {
+  main(process.argv.slice(2));
+}
+
+export { starterKit, KIT_LANGUAGES };
+export type { KitLanguage };
@@ -0,0 +1,96 @@
+// Player stats and ratings, kept up to date from the gameOver events (see events.cts) as
+// each game finishes instead of being worked out again from past games. A game counts
+// towards the account of everyone who played it signed in, and one between two signed-in
+// players moves both their ratings; the leaderboard is kept in order as ratings change.
+//
+// If the stats are lost or go wrong they can be rebuilt from a JSON event log
+// (TANKS_EVENT_LOG): every account is reset and the games in the log counted again, in
+// the order they finished. Run it against the storage the server uses (TANKS_STORAGE,
+// see store.cts), with the server stopped:
+//
+//   node stats.cjs rebuild <event-log>
+
+import * as fs from 'fs';
+import { Accounts } from './accounts.cjs';
+import { openStorage, type Storage } from './store.cjs';
+import type { GameOver, Subscriber } from './events.cjs';
+
+interface RebuildReport {
+  accounts: number;  // Reset
+  games: number;     // Finished games read from the log
+  counted: number;   // Those with at least one signed-in player
+  rated: number;     // Those between two signed-in players
+  skipped: number;   // Lines that were not JSON
+}
+
+// Count one finished game; returns whether it was rated
+function countGame(accounts: Accounts, event: GameOver): boolean {
+  const { players, winner } = event.result.result;
+  players.forEach((player, seat) => {
+    if (!player.userId) return;
+    // Logs written before shots were reported count none
+    const { shots, hits } = event.shooting?.[seat] ?? { shots: 0, hits: 0 };
+    const { timedMoves, thinkMs, gradedShots, shotQuality } = event.moveStats[seat];
+    accounts.recordGame(player.userId, { won: winner === seat, shots, hits, timedMoves, thinkMs, gradedShots, shotQuality });
+  });
+
+  const winnerId = players[winner]?.userId;
+  const loserId = players[1 - winner]?.userId;
+  return !!winnerId && !!loserId && accounts.recordRatedGame(winnerId, loserId) !== null;
+}
+
+function statsAggregator(accounts: Accounts): Subscriber {
+  return event => {
+    if (event.type === 'gameOver') countGame(accounts, event);
+  };
+}
+
+// Reset every account and count the logged games again
+function rebuildStats(accounts: Accounts, log: string): RebuildReport {
+  const report: RebuildReport = { accounts: accounts.resetStats(), games: 0, counted: 0, rated: 0, skipped: 0 };
+  log.split('\n').forEach(line => {
+    if (!line.trim()) return;
+    let event: any;
+    try {
+      event = JSON.parse(line);
+    } catch {
+      report.skipped++;
+      return;
+    }
+    if (event?.type !== 'gameOver') return;
+    report.games++;
+    if (event.result.result.players.some((player: { userId: string | null }) => player.userId)) report.counted++;
+    if (countGame(accounts, event)) report.rated++;
+  });
+  return report;
+}
+
+function main(args: string[]): void {
+  const [command, file] = args;
+  if (command !== 'rebuild' || !file) {
+    console.error('Usage: node stats.cjs rebuild <event-log>');
+    process.exit(2);
+  }
+
+  let storage: Storage;
+  let log: string;
+  try {
+    storage = openStorage();
+    log = fs.readFileSync(file, 'utf-8');
+  } catch (error) {
+    console.error((error as Error).message);
+    process.exit(2);
+  }
+
+  const report = rebuildStats(new Accounts(storage.accounts), log);
+  console.log(`Reset ${report.accounts} account(s) and counted ${report.counted} of ${report.games} game(s) from ${file}, ${report.rated} rated`);
+  if (report.skipped > 0) console.log(`Skipped ${report.skipped} line(s) that were not JSON`);
+  process.exit(0);
+}
+
+if (require.main === module) {
+  main(process.argv.slice(2));
+}
+
+export { statsAggregator, rebuildStats };
+export type { RebuildReport };
@@ -0,0 +1,133 @@
+// Storage for saved games. GameManager only talks to the Store interface, so a
+// database or other backend can replace the file store without touching game code.
+//
+// The backend is chosen with --storage or TANKS_STORAGE, for the server and the admin tools alike:
+//
+//   file                 saved games in TANKS_SAVE_DIR, accounts in TANKS_ACCOUNTS_FILE (default)
+//   sqlite[:<path>]      both in one SQLite database, ./tanks.db unless a path is given
+//   memory               both kept in the process only, for tests, demos and one-off runs
+//
+// There are two repositories, Store for games and AccountRepository (accounts.cts) for
+// accounts. A game's moves are saved with it, and a player's rating with their account;
+// SQLite puts each in its own rows and columns, but neither has a repository of its own.
+//
+// There is no Postgres backend. Both interfaces are synchronous, called in the middle of
+// handling a message, and Postgres drivers are asynchronous and not bundled; a postgres://
+// storage is refused at startup rather than half supported.
+
+import * as fs from 'fs';
+import * as path from 'path';
+import { FileAccountRepository, type AccountRepository } from './accounts.cjs';
+import { SqliteDatabase, SqliteStore, SqliteAccountRepository } from './sqlite.cjs';
+
+const SNAPSHOT_VERSION = 1;
+const SAVE_DIR = process.env.TANKS_SAVE_DIR || './saves';  // Where file storage keeps saved games
+const DEFAULT_SQLITE_PATH = './tanks.db';
+
+// A saved game as written by Utils.serializeGame, tagged with when and how it was saved
+interface GameSnapshot {
+  version: number;
+  savedAt: string;
+  game: Record<string, any>;
+}
+
+interface Store {
+  save(gameId: string, snapshot: GameSnapshot): void;
+  load(gameId: string): GameSnapshot | null;
+  remove(gameId: string): void;
+  list(): string[];
+}
+
+// One JSON file per game in a directory, written via a temporary file so a crash
+// mid-save never leaves a truncated snapshot behind
+class FileStore implements Store {
+  private directory: string;
+
+  constructor(directory: string) {
+    this.directory = directory;
+  }
+
+  save(gameId: string, snapshot: GameSnapshot): void {
+    fs.mkdirSync(this.directory, { recursive: true });
+    const file = this.fileFor(gameId);
+    fs.writeFileSync(`${file}.tmp`, JSON.stringify(snapshot, null, 2));
+    fs.renameSync(`${file}.tmp`, file);
+  }
+
+  load(gameId: string): GameSnapshot | null {
+    try {
+      return JSON.parse(fs.readFileSync(this.fileFor(gameId), 'utf-8'));
+    } catch (error) {
+      if ((error as NodeJS.ErrnoException).code === 'ENOENT') return null;
+      throw error;
+    }
+  }
+
+  remove(gameId: string): void {
+    fs.rmSync(this.fileFor(gameId), { force: true });
+  }
+
+  list(): string[] {
+    if (!fs.existsSync(this.directory)) return [];
+    return fs.readdirSync(this.directory)
+      .filter(name => name.endsWith('.json'))
+      .map(name => name.slice(0, -'.json'.length));
+  }
+
+  // Game ids are alphanumeric, which also keeps them from escaping the directory
+  private fileFor(gameId: string): string {
+    if (!/^[A-Za-z0-9]+$/.test(gameId)) {
+      throw new Error(`Invalid game id for storage: ${gameId}`);
+    }
+    return path.join(this.directory, `${gameId.toUpperCase()}.json`);
+  }
+}
+
+// Saved games held in the process. Snapshots are copied in and out, so later changes to
+// a game never reach its save, exactly as with the other stores.
+class MemoryStore implements Store {
+  private snapshots: Map<string, GameSnapshot> = new Map();
+
+  save(gameId: string, snapshot: GameSnapshot): void {
+    this.snapshots.set(gameId.toUpperCase(), structuredClone(snapshot));
+  }
+
+  load(gameId: string): GameSnapshot | null {
+    const snapshot = this.snapshots.get(gameId.toUpperCase());
+    return snapshot ? structuredClone(snapshot) : null;
+  }
+
+  remove(gameId: string): void {
+    this.snapshots.delete(gameId.toUpperCase());
+  }
+
+  list(): string[] {
+    return [...this.snapshots.keys()];
+  }
+}
+
+interface Storage {
+  store: Store;
+  accounts: AccountRepository;
+  description: string;  // Where things are kept, for log lines
+}
+
+function openStorage(spec: string = process.env.TANKS_STORAGE || 'file'): Storage {
+  if (spec === 'file') {
+    return { store: new FileStore(SAVE_DIR), accounts: new FileAccountRepository(process.env.TANKS_ACCOUNTS_FILE), description: SAVE_DIR };
+  }
+  if (spec === 'memory') {
+    return { store: new MemoryStore(), accounts: new FileAccountRepository(), description: 'memory (lost when the process exits)' };
+  }
+  if (spec === 'sqlite' || spec.startsWith('sqlite:')) {
+    const database = new SqliteDatabase(spec.slice('sqlite:'.length) || DEFAULT_SQLITE_PATH);
+    return { store: new SqliteStore(database), accounts: new SqliteAccountRepository(database), description: `SQLite ${database.path}` };
+  }
+  if (/^postgres(ql)?:\/\//.test(spec)) {
+    throw new Error('Postgres storage is not available: this server does not bundle a Postgres driver; use sqlite');
+  }
+  throw new Error(`Unknown storage ${spec}; use file, sqlite, sqlite:<path> or memory`);
+}
+
+export { FileStore, MemoryStore, SNAPSHOT_VERSION, SAVE_DIR, openStorage };
+export type { Store, GameSnapshot, Storage };
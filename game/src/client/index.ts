@@ -6,15 +6,57 @@ interface GameState {
   enemyBoard: number[][];
   players: Player[];
   phase: GamePhase;
-  currentTurn: string;
+  currentTurn: number;
   myTanks: number;
   enemyTanks: number;
+  moveCount: number;
+  stateHash: string;
+  config: GameConfig;
+  proposal: SettingsProposal | null;
+  features?: Record<string, boolean>;
+  winProbability?: [number, number] | null;
+  myAbilities?: Record<string, number>;  // Special shots left
+  turnsLeft?: number | null;  // null: no turn limit
+  myShotsLeft?: number | null;  // null: no shot budget
+  concedeOffer?: number | null;  // The opponent's shots left to a win that is already forced, while conceding is offered
+  nextTankLength?: number | null;  // During placement, until every tank is down
+  fleets?: RevealedFleet[] | null;  // Both fleets as placed, once the game is over
+}
+
+interface RevealedFleet {
+  playerId: number;
+  tanks: { cells: SelectedCell[]; destroyed: boolean }[];
+}
+
+interface GameConfig {
+  boardSize: number;
+  tanksPerPlayer: number;
+  explosionRadius: number;
+  firstMove: 'creator' | 'joiner' | 'random';
+  tankLengths?: number[];
+  turnTimeSeconds?: number;
+  gameTimeSeconds?: number;
+  timeoutAction?: 'skip' | 'forfeit';
+  airstrikes?: number;
+  clusterBombs?: number;
+  scans?: number;
+  maxTurns?: number;
+  shotBudget?: number;
+  concedeWithinShots?: number;
+  coordinates?: 'letterNumber' | 'oneBased' | 'zeroBased';
+}
+
+interface SettingsProposal {
+  config: GameConfig;
+  proposedBy: number;
 }
 
 interface Player {
-  id: string;
+  id: number;
   name: string;
   tanksAlive: number;
+  tanksRemaining?: number;
+  ready?: boolean;
 }
 
 interface GameInfo {
@@ -31,6 +73,16 @@ interface ServerMessage {
   [key: string]: any;
 }
 
+// The game rules this client was built for (RULES_VERSION on the server)
+const RULES_VERSION = 1;
+
+interface ServerError {
+  code: string;
+  message: string;
+  status: number;
+  details?: Record<string, any>;
+}
+
 interface ChatMessage {
   playerName: string;
   text: string;
@@ -41,7 +93,7 @@ interface SelectedCell {
   y: number;
 }
 
-type GamePhase = 'waiting' | 'placement' | 'battle' | 'gameover';
+type GamePhase = 'waiting' | 'setup' | 'placement' | 'battle' | 'gameover';
 type ActionState = 'attack' | 'move';
 
 enum CellState {
@@ -62,6 +114,16 @@ interface ImageAsset {
   path: string;
 }
 
+// A random v4 UUID for move ids and nonces. crypto.randomUUID only exists in secure
+// contexts, so a page served over plain http from a LAN address builds its own.
+function randomId(): string {
+  if (typeof crypto.randomUUID === 'function') return crypto.randomUUID();
+  const bytes = crypto.getRandomValues(new Uint8Array(16));
+  bytes[6] = (bytes[6] & 0x0f) | 0x40;
+  bytes[8] = (bytes[8] & 0x3f) | 0x80;
+  const hex = Array.from(bytes, b => b.toString(16).padStart(2, '0')).join('');
+  return `${hex.slice(0, 8)}-${hex.slice(8, 12)}-${hex.slice(12, 16)}-${hex.slice(16, 20)}-${hex.slice(20)}`;
+}
 
 class AssetsManager {
   private images: Image[] = [];
@@ -108,6 +170,49 @@ class AssetsManager {
   }
 }
 
+type DiagnosticKind = 'input' | 'sent' | 'received' | 'error';
+
+interface DiagnosticEntry {
+  at: number;        // ms since recording started
+  kind: DiagnosticKind;
+  data: any;
+}
+
+// Opt-in session recorder for bug reports, enabled with ?diagnostics=1 in the URL.
+// Keeps the most recent entries so a long session does not grow without bound.
+class DiagnosticsRecorder {
+  private static readonly MAX_ENTRIES = 5000;
+  private entries: DiagnosticEntry[] = [];
+  private startedAt: number = Date.now();
+
+  static isRequested(): boolean {
+    return new URLSearchParams(window.location.search).get('diagnostics') === '1';
+  }
+
+  record(kind: DiagnosticKind, data: any): void {
+    this.entries.push({ at: Date.now() - this.startedAt, kind, data });
+    if (this.entries.length > DiagnosticsRecorder.MAX_ENTRIES) {
+      this.entries.shift();
+    }
+  }
+
+  download(gameId: string | null): void {
+    const bundle = {
+      version: 1,
+      startedAt: new Date(this.startedAt).toISOString(),
+      savedAt: new Date().toISOString(),
+      userAgent: navigator.userAgent,
+      gameId,
+      entries: this.entries
+    };
+
+    const link = document.createElement('a');
+    link.download = `fog-of-tank-diagnostics-${gameId || 'session'}-${this.startedAt}.json`;
+    link.href = URL.createObjectURL(new Blob([JSON.stringify(bundle, null, 2)], { type: 'application/json' }));
+    link.click();
+    URL.revokeObjectURL(link.href);
+  }
+}
 
 class FogOfTankClient {
   private ws: WebSocket | null = null;
@@ -115,14 +220,19 @@ class FogOfTankClient {
   private boardSize: number = 8;
   private cellSize: number = 50;
   private tanksPerPlayer: number = 3;
+  private tankLengths: number[] = [];
+  private coordinates: GameConfig['coordinates'] = 'letterNumber';
+  private placementOrientation: 'horizontal' | 'vertical' = 'horizontal';
   private selectedCell: SelectedCell | null = null;
   private selectedTankCell: SelectedCell | null = null;
   private gamePhase: GamePhase = 'waiting';
   private isMyTurn: boolean = false;
-  private playerId: string | null = null;
+  private playerId: number | null = null;
   private actionState: ActionState = 'attack';
   private assetManager: AssetsManager;
   private gameId: string | null = null;
+  private lastAnsweredProposal: string | null = null;
+  private diagnostics: DiagnosticsRecorder | null = DiagnosticsRecorder.isRequested() ? new DiagnosticsRecorder() : null;
 
   private gameCanvas!: HTMLCanvasElement;
   private enemyCanvas!: HTMLCanvasElement;
@@ -141,6 +251,7 @@ class FogOfTankClient {
       { id: "non-damaged", path: "../../assets/non-damaged.png" }
     ]
     this.initializeCanvases();
+    this.initializeDiagnostics();
     this.connectWebSocket();
     this.assetManager = new AssetsManager();
     this.assetManager.preloadAssets(images);
@@ -172,6 +283,42 @@ class FogOfTankClient {
     });
   }
 
+  private initializeDiagnostics(): void {
+    if (!this.diagnostics) return;
+
+    const recorder = this.diagnostics;
+    window.addEventListener('error', (e: ErrorEvent) => {
+      recorder.record('error', { message: e.message, source: `${e.filename}:${e.lineno}:${e.colno}`, stack: e.error?.stack });
+    });
+    window.addEventListener('unhandledrejection', (e: PromiseRejectionEvent) => {
+      recorder.record('error', { message: String(e.reason), stack: e.reason?.stack });
+    });
+
+    this.setElementDisplay('diagnosticsButton', 'inline-block');
+    console.log('Diagnostics recording enabled');
+  }
+
+  // Raw click plus the cell it resolved to, so coordinate bugs show up in the trace
+  private recordInput(board: 'mine' | 'enemy', event: MouseEvent, x: number, y: number): void {
+    this.diagnostics?.record('input', {
+      board,
+      clientX: event.clientX,
+      clientY: event.clientY,
+      cell: { x, y },
+      phase: this.gamePhase,
+      actionState: this.actionState,
+      isMyTurn: this.isMyTurn
+    });
+  }
+
+  public downloadDiagnostics(): void {
+    if (!this.diagnostics) {
+      this.showMessage('Diagnostics are off. Reload with ?diagnostics=1 to record a session.');
+      return;
+    }
+    this.diagnostics.download(this.gameId);
+  }
+
   private connectWebSocket(): void {
     const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
     const wsUrl = "ws://localhost:3000";
@@ -180,11 +327,25 @@ class FogOfTankClient {
 
     this.ws.onopen = () => {
       console.log('Connected to game server');
+      // Say what this client understands so the server never sends it anything it doesn't
+      this.sendMessage({
+        type: 'hello',
+        protocolVersions: [1, 2],
+        rulesVersion: RULES_VERSION,
+        codecs: ['json'],
+        variants: ['multiCellTanks', 'abilities', 'timers', 'tankMovement', 'settingsNegotiation', 'limits']
+      });
       this.requestServerStats();
+      // Back after a dropped connection: take the seat back while the server still holds it
+      const resumeToken = this.gameId && localStorage.getItem(`tanks.resume.${this.gameId}`);
+      if (resumeToken) {
+        this.sendMessage({ type: 'resumeGame', gameId: this.gameId, resumeToken });
+      }
     };
 
     this.ws.onmessage = (event: MessageEvent) => {
       const message: ServerMessage = JSON.parse(event.data);
+      this.diagnostics?.record('received', message);
       this.handleMessage(message);
     };
 
@@ -201,11 +362,28 @@ class FogOfTankClient {
 
   private handleMessage(message: ServerMessage): void {
     switch (message.type) {
+      case 'welcome':
+        if (!message.success) {
+          const error = message.error as ServerError;
+          console.warn('Server refused our capabilities:', error);
+          if (error.details?.hint) this.showError(`${error.message}. ${error.details.hint}.`);
+        }
+        break;
+      case 'error':
+        // Refused outright, as everything but the lobby is when our rules are out of date
+        const refusal = message.error as ServerError;
+        this.showError(refusal.details?.hint ? `${refusal.message}. ${refusal.details.hint}.` : refusal.message);
+        break;
       case 'serverStats':
         this.handleServerStats(message);
         break;
       case 'gamesList':
-        this.displayGamesList(message.games as GameInfo[]);
+        // A cursor the server no longer lists: start again from the top
+        if (message.success === false) {
+          this.requestGamesList();
+          break;
+        }
+        this.displayGamesList(message.games as GameInfo[], message.total);
         break;
       case 'roomCreated':
         this.handleRoomCreated(message);
@@ -216,10 +394,23 @@ class FogOfTankClient {
       case 'gameState':
         this.handleGameState(message as GameState & { type: string });
         break;
+      case 'gameStateNotModified':
+        // Current state is already up to date
+        break;
+      case 'proposeSettingsResult':
+      case 'acceptSettingsResult':
+        this.handleSettingsResult(message);
+        break;
       case 'placeTankResult':
+      case 'removeTankResult':
+      case 'confirmPlacementResult':
         this.handlePlaceTankResult(message);
         break;
+      case 'concedeResult':
+        if (!message.success) this.showError((message.error as ServerError).message);
+        break;
       case 'bombResult':
+      case 'useAbilityResult':
         this.handleBombResult(message);
         break;
       case 'moveTankResult':
@@ -231,12 +422,49 @@ class FogOfTankClient {
       case 'chat':
         this.handleChat(message as ChatMessage & { type: string });
         break;
+      case 'chatMuted':
+        this.showMessage(message.muted ? 'A moderator has muted your chat' : 'A moderator has unmuted your chat');
+        break;
       case 'playerDisconnected':
         this.handlePlayerDisconnected(message);
         break;
+      case 'playerReconnected':
+        this.showMessage(`${message.playerName} reconnected`);
+        break;
       case 'leftGame':
         this.handleLeftGame(message);
         break;
+      case 'gameSaved':
+        if (message.success) {
+          this.showMessage(`Game saved at move ${message.moveCount}. Use "Resume Game" with ID ${message.gameId} to continue later.`);
+        } else {
+          this.showError((message.error as ServerError).message);
+        }
+        break;
+      case 'quickMatchQueued':
+        this.showMessage(`Looking for an opponent... (position ${message.position} in queue)`);
+        break;
+      case 'maintenance':
+        this.handleMaintenance(message.maintenance);
+        break;
+      case 'gameEvent':
+        this.handleGameEvent(message);
+        break;
+      case 'boardsExport':
+        this.saveSnapshot(message);
+        break;
+      case 'emote':
+        this.handleEmote(message);
+        break;
+      case 'playerReady':
+        if (message.playerId !== this.playerId) {
+          this.showMessage(message.bothReady ? 'Both fleets deployed - battle begins!' : `${message.playerName} has finished placing tanks`);
+        }
+        break;
+      case 'gameAborted':
+        this.showMessage((message.error as ServerError).message);
+        this.handleLeftGame({ type: 'leftGame', success: true });
+        break;
       case 'newGame':
       case 'gameUpdate':
       case 'gameRemoved':
@@ -251,8 +479,29 @@ class FogOfTankClient {
 
   private handleServerStats(message: ServerMessage): void {
     if (message.gamesList) {
-      this.displayGamesList(message.gamesList as GameInfo[]);
+      this.displayGamesList(message.gamesList as GameInfo[], message.total);
+    }
+    if (message.maintenance) {
+      this.handleMaintenance(message.maintenance);
+    }
+  }
+
+  // Staff announced maintenance (null once it is called off)
+  private handleMaintenance(maintenance: any): void {
+    if (!maintenance) {
+      this.showMessage('Scheduled maintenance has been called off');
+      return;
+    }
+    if (maintenance.begun) {
+      this.showMessage(this.gameId
+        ? `Maintenance has begun. Your game was saved - use "Resume Game" with ID ${this.gameId} once the server is back.`
+        : 'Maintenance has begun');
+      return;
     }
+
+    const seconds = maintenance.secondsLeft;
+    const countdown = seconds >= 60 ? `${Math.ceil(seconds / 60)} minute${seconds > 60 ? 's' : ''}` : `${seconds} seconds`;
+    this.showMessage(`Server maintenance in ${countdown}${maintenance.message ? ` - ${maintenance.message}` : ''}. New games cannot start until it is over.`);
   }
 
   private handleRoomCreated(message: ServerMessage): void {
@@ -265,7 +514,9 @@ class FogOfTankClient {
         </div>
       `;
     } else {
-      messagesDiv.innerHTML = `<div class="error-message">${message.error}</div>`;
+      const error = message.error as ServerError & { fields?: { field: string; reason: string }[] };
+      const reasons = error.fields?.map(f => `${f.field} ${f.reason}`).join(', ');
+      messagesDiv.innerHTML = `<div class="error-message">${error.message}${reasons ? `: ${reasons}` : ''}</div>`;
     }
   }
 
@@ -273,8 +524,11 @@ class FogOfTankClient {
     if (message.success) {
       this.gameId = message.gameId;
       this.playerId = message.playerId;
-      this.boardSize = message.boardSize;
-      this.tanksPerPlayer = message.tanksPerPlayer;
+      this.applyConfig(message.config);
+      // Remembered so this seat can be taken back if the game is saved and loaded later
+      if (message.resumeToken) {
+        localStorage.setItem(`tanks.resume.${message.gameId}`, message.resumeToken);
+      }
 
       let idInfo = document.getElementById("game-id-info") as HTMLElement;
       idInfo.innerHTML = `(id: ${this.gameId})`;
@@ -284,7 +538,7 @@ class FogOfTankClient {
       this.showGameArea();
       this.clearMessages();
     } else {
-      this.showError(message.error);
+      this.showError((message.error as ServerError).message);
     }
   }
 
@@ -292,19 +546,112 @@ class FogOfTankClient {
     this.gameState = message;
     this.gamePhase = message.phase;
     this.isMyTurn = message.currentTurn === this.playerId;
+    this.applyConfig(message.config);
 
     this.updateUI();
     this.drawBoards();
+
+    if (message.phase === 'setup' && message.proposal) {
+      this.reviewProposal(message.proposal);
+    }
+  }
+
+  private applyConfig(config: GameConfig): void {
+    this.boardSize = config.boardSize;
+    this.tanksPerPlayer = config.tanksPerPlayer;
+    this.tankLengths = config.tankLengths || [];
+    this.coordinates = config.coordinates || 'letterNumber';
+    this.cellSize = this.gameCanvas.width / this.boardSize;
+  }
+
+  // Board labels in the game's coordinate system; x and y themselves always count from 0
+  private columnLabel(x: number): string {
+    if (this.coordinates === 'letterNumber') return String.fromCharCode(65 + x);
+    return String(this.coordinates === 'zeroBased' ? x : x + 1);
+  }
+
+  private rowLabel(y: number): string {
+    return String(this.coordinates === 'zeroBased' ? y : y + 1);
+  }
+
+  private describeConfig(config: GameConfig): string {
+    const lengths = config.tankLengths?.length ? ` (lengths ${config.tankLengths.join(', ')})` : '';
+    const clocks = [
+      config.turnTimeSeconds ? `${config.turnTimeSeconds}s per turn (${config.timeoutAction === 'forfeit' ? 'forfeit' : 'skip'} on timeout)` : '',
+      config.gameTimeSeconds ? `${config.gameTimeSeconds}s per player` : ''
+    ].filter(Boolean).join(', ');
+    const abilities = [
+      config.airstrikes ? `${config.airstrikes} airstrike${config.airstrikes === 1 ? '' : 's'}` : '',
+      config.clusterBombs ? `${config.clusterBombs} cluster bomb${config.clusterBombs === 1 ? '' : 's'}` : '',
+      config.scans ? `${config.scans} scan${config.scans === 1 ? '' : 's'}` : ''
+    ].filter(Boolean).join(', ');
+    const limits = [
+      config.maxTurns ? `${config.maxTurns} turns max` : '',
+      config.shotBudget ? `${config.shotBudget} shots each` : ''
+    ].filter(Boolean).join(', ');
+    return `${config.boardSize}x${config.boardSize} board, ${config.tanksPerPlayer} tanks${lengths}, blast radius ${config.explosionRadius}, first move: ${config.firstMove}${clocks ? `, ${clocks}` : ''}${abilities ? `, ${abilities}` : ''}${limits ? `, ${limits}` : ''}`;
+  }
+
+  // Longer tanks extend right or down from the clicked cell; R switches between the two
+  public togglePlacementOrientation(): void {
+    this.placementOrientation = this.placementOrientation === 'horizontal' ? 'vertical' : 'horizontal';
+    this.updateUI();
+  }
+
+  // Ask the player to accept the opponent's settings or send a counter-proposal
+  private reviewProposal(proposal: SettingsProposal): void {
+    if (proposal.proposedBy === this.playerId) return;
+
+    const key = JSON.stringify(proposal);
+    if (key === this.lastAnsweredProposal) return;
+    this.lastAnsweredProposal = key;
+
+    // Let the board redraw before the blocking dialog opens
+    setTimeout(() => {
+      if (confirm(`Opponent proposes: ${this.describeConfig(proposal.config)}. Accept?`)) {
+        this.sendMessage({ type: 'acceptSettings' });
+        return;
+      }
+
+      const { boardSize, tanksPerPlayer, explosionRadius, firstMove } = proposal.config;
+      const counter = prompt(
+        'Counter-propose as "board size, tanks, blast radius, first move (creator/joiner/random)":',
+        `${boardSize}, ${tanksPerPlayer}, ${explosionRadius}, ${firstMove}`
+      );
+      if (!counter) {
+        this.lastAnsweredProposal = null;
+        return;
+      }
+
+      const [size, tanks, radius, first] = counter.split(',').map(v => v.trim());
+      this.sendMessage({
+        type: 'proposeSettings',
+        config: { boardSize: parseInt(size, 10), tanksPerPlayer: parseInt(tanks, 10), explosionRadius: parseInt(radius, 10), firstMove: first || firstMove }
+      });
+    }, 0);
+  }
+
+  private handleSettingsResult(message: ServerMessage): void {
+    if (!message.success) {
+      this.lastAnsweredProposal = null;
+      this.showMessage((message.error as ServerError).message);
+    }
   }
 
   private handlePlaceTankResult(message: ServerMessage): void {
     if (!message.success) {
-      this.showError('Cannot place tank there!');
+      this.showError((message.error as ServerError)?.message || 'Cannot place tank there!');
     }
   }
 
 
   private handleBombResult(message: ServerMessage): void {
+    if (!message.success) {
+      this.showMessage((message.error as ServerError).message);
+      this.resetSelection();
+      return;
+    }
+
     this.showMessage(message.result);
     if (message.gameOver) {
       this.showMessage('🎉 Game Over! ' + message.result);
@@ -319,7 +666,7 @@ class FogOfTankClient {
     if (message.success) {
       this.showMessage('Tank moved successfully!');
     } else {
-      this.showError(message.error || 'Cannot move tank there!');
+      this.showError((message.error as ServerError)?.message || 'Cannot move tank there!');
     }
     // Reset selection after action
     this.resetSelection();
@@ -334,8 +681,57 @@ class FogOfTankClient {
     chatMessages.scrollTop = chatMessages.scrollHeight;
   }
 
+  // Board changes arrive with the next gameState; events only drive notifications
+  private handleGameEvent(message: ServerMessage): void {
+    const byOpponent = message.playerId !== undefined && message.playerId !== this.playerId;
+    if (message.event === 'bombResult' && byOpponent) {
+      this.showMessage(message.outcome === 'hit' ? `Enemy hit your tank at ${message.cell}!` : `Enemy missed at ${message.cell}`);
+    } else if (message.event === 'abilityUsed' && byOpponent) {
+      const hits = (message.cells || []).filter((c: any) => c.outcome === 'hit').length;
+      this.showMessage(message.ability === 'scan'
+        ? `Enemy scanned around ${message.cell}`
+        : `Enemy ${message.ability === 'airstrike' ? 'airstrike' : 'cluster bomb'} at ${message.cell}: ${hits} of your cells hit`);
+    } else if (message.event === 'tankMoved' && byOpponent) {
+      this.showMessage('Enemy repositioned a tank');
+    } else if (message.event === 'turnTimeWarning' && message.playerId === this.playerId) {
+      this.showMessage(`${Math.ceil(message.remainingMs / 1000)} seconds left for your turn!`);
+    } else if (message.event === 'stallNudge' && message.playerId === this.playerId) {
+      this.showMessage(message.timesOutAt
+        ? `Still your move - it times out in ${Math.ceil((message.timesOutAt - Date.now()) / 60000)} minute(s)`
+        : 'Still your move - your opponent is waiting');
+    } else if (message.event === 'turnTimedOut') {
+      const who = message.playerId === this.playerId ? 'You' : 'Enemy';
+      const what = message.stalled ? 'took too long to move' : 'ran out of time';
+      this.showMessage(message.action === 'forfeit' ? `${who} ${what}` : `${who} ${what} - turn skipped`);
+    } else if (message.event === 'turnPassed') {
+      this.showMessage(message.playerId === this.playerId ? 'You have no shots left - turn passes' : 'Enemy has no shots left - turn passes');
+    } else if (message.event === 'gameOver' && message.reason === 'limit') {
+      this.showMessage(`${message.winner === this.playerId ? 'Victory' : 'Defeat'} - the game hit its limit and was decided on tanks left, then accuracy`);
+    } else if (message.event === 'gameOver' && message.reason === 'resigned') {
+      this.showMessage(message.winner === this.playerId ? 'Victory - your opponent conceded' : 'You conceded the game');
+    } else if (message.event === 'gameOver' && message.reason === 'abandoned' && message.winner === this.playerId) {
+      this.showMessage('Victory - your opponent did not come back');
+    } else if (message.event === 'gameOver' && message.winner !== this.playerId) {
+      this.showMessage(message.reason === 'timeout' ? 'Defeat - you ran out of time' : `Defeat - ${message.winnerName} destroyed all your tanks`);
+    }
+  }
+
+  private handleEmote(message: ServerMessage): void {
+    const chatMessages = document.getElementById('chatMessages') as HTMLElement;
+    const messageDiv = document.createElement('div');
+    messageDiv.className = 'chat-message';
+    messageDiv.innerHTML = `<em>${message.playerName} (move ${message.moveCount + 1}): ${message.emote}</em>`;
+    chatMessages.appendChild(messageDiv);
+    chatMessages.scrollTop = chatMessages.scrollHeight;
+  }
+
   private handlePlayerDisconnected(message: ServerMessage): void {
-    this.showMessage(`${message.playerName} disconnected`);
+    if (message.reconnectBy) {
+      const seconds = Math.max(Math.ceil((message.reconnectBy - Date.now()) / 1000), 0);
+      this.showMessage(`${message.playerName} lost their connection - waiting up to ${seconds} seconds for them to return`);
+    } else {
+      this.showMessage(`${message.playerName} disconnected`);
+    }
   }
 
   private handleLeftGame(message: ServerMessage): void {
@@ -383,7 +779,7 @@ class FogOfTankClient {
     // Column labels (A-F)
     for (let x = 0; x < this.boardSize; x++) {
       ctx.fillText(
-        String.fromCharCode(65 + x),
+        this.columnLabel(x),
         x * this.cellSize + this.cellSize / 2,
         -5
       );
@@ -393,7 +789,7 @@ class FogOfTankClient {
     ctx.textAlign = 'right';
     for (let y = 0; y < this.boardSize; y++) {
       ctx.fillText(
-        (y + 1).toString(),
+        this.rowLabel(y),
         -5,
         y * this.cellSize + this.cellSize / 2 + 5
       );
@@ -423,6 +819,57 @@ class FogOfTankClient {
     if (this.actionState === 'move' && this.selectedTankCell && isMyBoard) {
       this.highlightValidMoves(ctx, this.selectedTankCell.x, this.selectedTankCell.y, board);
     }
+
+    // Once the game is over, outline where the enemy placed every tank
+    const enemyFleet = this.gameState?.fleets?.find(fleet => fleet.playerId !== this.playerId);
+    if (!isMyBoard && enemyFleet) {
+      this.outlineFleet(ctx, enemyFleet);
+    }
+  }
+
+  // Destroyed tanks in grey, the ones that survived in yellow
+  private outlineFleet(ctx: CanvasRenderingContext2D, fleet: RevealedFleet): void {
+    ctx.lineWidth = 3;
+    ctx.setLineDash([6, 4]);
+    fleet.tanks.forEach(tank => {
+      const xs = tank.cells.map(cell => cell.x);
+      const ys = tank.cells.map(cell => cell.y);
+      const left = Math.min(...xs) * this.cellSize;
+      const top = Math.min(...ys) * this.cellSize;
+      ctx.strokeStyle = tank.destroyed ? '#9ca3af' : '#facc15';
+      ctx.strokeRect(
+        left + 3,
+        top + 3,
+        (Math.max(...xs) + 1) * this.cellSize - left - 6,
+        (Math.max(...ys) + 1) * this.cellSize - top - 6
+      );
+    });
+    ctx.setLineDash([]);
+  }
+
+  // The server draws both boards with coordinate labels and a legend (image.cts); the
+  // boardsExport reply is saved as a PNG
+  public exportSnapshot(): void {
+    if (!this.gameState) return;
+    this.sendMessage({ type: 'exportBoards' });
+  }
+
+  private saveSnapshot(message: ServerMessage): void {
+    const image = new Image();
+    image.onload = () => {
+      const snapshot = document.createElement('canvas');
+      snapshot.width = image.width;
+      snapshot.height = image.height;
+      const ctx = snapshot.getContext('2d');
+      if (!ctx) return;
+      ctx.drawImage(image, 0, 0);
+
+      const link = document.createElement('a');
+      link.download = `fog-of-tank-${message.gameId}-move-${message.moveCount}.png`;
+      link.href = snapshot.toDataURL('image/png');
+      link.click();
+    };
+    image.src = `data:image/svg+xml;charset=utf-8,${encodeURIComponent(message.svg)}`;
   }
 
   private highlightValidMoves(ctx: CanvasRenderingContext2D, tankX: number, tankY: number, board: number[][]): void {
@@ -541,17 +988,25 @@ class FogOfTankClient {
     const rect = this.gameCanvas.getBoundingClientRect();
     const x = Math.floor((event.clientX - rect.left) / this.cellSize);
     const y = Math.floor((event.clientY - rect.top) / this.cellSize);
+    this.recordInput('mine', event, x, y);
 
     if (this.gamePhase === 'placement') {
-      // Check if player has already placed all tanks
       const myPlayer = this.gameState?.players?.find(p => p.id === this.playerId);
-      if (myPlayer && myPlayer.tanksAlive >= this.tanksPerPlayer) {
-        this.showMessage('You have already placed all your tanks!');
+      if (myPlayer?.ready) {
+        this.showMessage('Your placement is confirmed');
         return;
       }
-      if (x >= 0 && x < this.boardSize && y >= 0 && y < this.boardSize) {
-        this.placeTank(x, y);
+      if (x < 0 || x >= this.boardSize || y < 0 || y >= this.boardSize) return;
+      // Clicking one of your tanks takes it back so it can be placed again
+      if (this.gameState?.myBoard[y]?.[x] === CellState.TANK) {
+        this.sendMessage({ type: 'removeTank', moveId: randomId(), x, y });
+        return;
       }
+      if (myPlayer && myPlayer.tanksRemaining === 0) {
+        this.showMessage('All tanks placed - confirm your placement, or click a tank to take it back');
+        return;
+      }
+      this.placeTank(x, y);
     } else if (this.gamePhase === 'battle' && this.isMyTurn) {
       if (x >= 0 && x < this.boardSize && y >= 0 && y < this.boardSize) {
         this.handleBattlePhaseClick(x, y);
@@ -565,7 +1020,7 @@ class FogOfTankClient {
     const cellState = this.gameState.myBoard[y][x];
 
     if (this.actionState === 'attack') {
-      if (cellState === CellState.TANK) {
+      if (cellState === CellState.TANK && this.gameState.features?.tankMovement !== false) {
         this.selectedTankCell = { x, y };
         this.toggleActionMode()
         this.drawBoards();
@@ -616,7 +1071,10 @@ class FogOfTankClient {
   }
 
   private handleEnemyBoardClick(event: MouseEvent): void {
-    if (this.gamePhase !== 'battle' || !this.isMyTurn) return;
+    if (this.gamePhase !== 'battle' || !this.isMyTurn) {
+      this.diagnostics?.record('input', { board: 'enemy', clientX: event.clientX, clientY: event.clientY, ignored: true, phase: this.gamePhase, isMyTurn: this.isMyTurn });
+      return;
+    }
 
     const rect = this.enemyCanvas.getBoundingClientRect();
 
@@ -639,12 +1097,18 @@ class FogOfTankClient {
     // Calculate the grid coordinates
     const x = Math.floor((relativeX * scaleX) / actualCellWidth);
     const y = Math.floor((relativeY * scaleY) / actualCellHeight);
+    this.recordInput('enemy', event, x, y);
 
     // Validate coordinates
     if (x >= 0 && x < this.boardSize && y >= 0 && y < this.boardSize) {
       if (this.actionState === 'attack') {
-        console.log(`Bombing at (${x}, ${y})`); // Debug log
-        this.bomb(x, y);
+        const ability = this.takeAbility();
+        if (ability) {
+          this.useAbility(ability, x, y);
+        } else {
+          console.log(`Bombing at (${x}, ${y})`); // Debug log
+          this.bomb(x, y);
+        }
       } else {
         this.showMessage('Switch to Attack mode to bomb enemy positions!');
       }
@@ -657,6 +1121,38 @@ class FogOfTankClient {
   private placeTank(x: number, y: number): void {
     this.sendMessage({
       type: 'placeTank',
+      moveId: randomId(),
+      x: x,
+      y: y,
+      orientation: this.placementOrientation
+    });
+  }
+
+  // Emote picked in the controls, sent with the next move and then cleared
+  private takeEmote(): string | undefined {
+    const select = document.getElementById('emoteSelect') as HTMLSelectElement | null;
+    const emote = select?.value || undefined;
+    if (select) select.value = '';
+    return emote;
+  }
+
+  // Special shot picked in the controls, used for one attack and then cleared
+  private takeAbility(): string | undefined {
+    const select = document.getElementById('abilitySelect') as HTMLSelectElement | null;
+    const ability = select?.value || undefined;
+    if (select) select.value = '';
+    return ability;
+  }
+
+  private useAbility(choice: string, x: number, y: number): void {
+    const [ability, direction] = choice.split(':');
+    this.sendMessage({
+      type: 'useAbility',
+      moveId: randomId(),
+      expectedMove: this.gameState?.moveCount,
+      emote: this.takeEmote(),
+      ability,
+      direction,
       x: x,
       y: y
     });
@@ -665,6 +1161,9 @@ class FogOfTankClient {
   private bomb(x: number, y: number): void {
     this.sendMessage({
       type: 'bomb',
+      moveId: randomId(),
+      expectedMove: this.gameState?.moveCount,
+      emote: this.takeEmote(),
       x: x,
       y: y
     });
@@ -673,6 +1172,9 @@ class FogOfTankClient {
   private moveTank(fromX: number, fromY: number, toX: number, toY: number): void {
     this.sendMessage({
       type: 'moveTank',
+      moveId: randomId(),
+      expectedMove: this.gameState?.moveCount,
+      emote: this.takeEmote(),
       fromX: fromX,
       fromY: fromY,
       toX: toX,
@@ -719,6 +1221,9 @@ class FogOfTankClient {
       case 'waiting':
         phaseIndicator.textContent = 'Waiting for players...';
         break;
+      case 'setup':
+        phaseIndicator.textContent = 'Agreeing on settings...';
+        break;
       case 'placement':
         phaseIndicator.textContent = 'Place your tanks!';
         break;
@@ -753,22 +1258,71 @@ class FogOfTankClient {
         turnIndicator.textContent = `${enemyPlayer?.name || 'Enemy'}'s Turn`;
         turnIndicator.className = 'turn-indicator enemy-turn';
       }
+      // What is left before a turn limit or the shot budget decides the game
+      const { turnsLeft, myShotsLeft } = this.gameState;
+      const left = [
+        typeof turnsLeft === 'number' ? `${turnsLeft} turn${turnsLeft === 1 ? '' : 's'} left` : '',
+        typeof myShotsLeft === 'number' ? `${myShotsLeft} shot${myShotsLeft === 1 ? '' : 's'} left` : ''
+      ].filter(Boolean).join(', ');
+      if (left) turnIndicator.textContent += ` (${left})`;
     } else if (this.gamePhase === 'placement') {
       const myPlayer = this.gameState.players.find(p => p.id === this.playerId);
-      const tanksPlaced = myPlayer ? myPlayer.tanksAlive : 0;
-      turnIndicator.textContent = `Place tanks: ${tanksPlaced}/${this.tanksPerPlayer}`;
+      const tanksRemaining = myPlayer?.tanksRemaining ?? this.tanksPerPlayer;
+      turnIndicator.textContent = `Place tanks: ${this.tanksPerPlayer - tanksRemaining}/${this.tanksPerPlayer} (${tanksRemaining} left)`;
+      const nextLength = this.gameState.nextTankLength ?? this.tankLengths[this.tanksPerPlayer - tanksRemaining] ?? 1;
+      if (tanksRemaining > 0 && this.tankLengths.some(length => length > 1)) {
+        turnIndicator.textContent += ` - next tank: ${nextLength} cell${nextLength === 1 ? '' : 's'}, ${this.placementOrientation} (R to rotate)`;
+      }
 
-      if (tanksPlaced >= this.tanksPerPlayer) {
+      if (tanksRemaining === 0 && !myPlayer?.ready) {
+        turnIndicator.textContent = 'All tanks placed - Confirm Placement to lock them in, or click a tank to move it';
+      }
+      if (myPlayer?.ready) {
         turnIndicator.textContent = 'Waiting for opponent to finish placing tanks...';
       }
 
       turnIndicator.className = 'turn-indicator waiting-turn';
+    } else if (this.gamePhase === 'setup') {
+      const proposal = this.gameState.proposal;
+      turnIndicator.textContent = proposal && proposal.proposedBy === this.playerId
+        ? `Waiting for opponent to accept: ${this.describeConfig(proposal.config)}`
+        : 'Review the proposed settings';
+      turnIndicator.className = 'turn-indicator waiting-turn';
     } else if (this.gamePhase === 'gameover') {
     } else {
       turnIndicator.textContent = 'Waiting...';
       turnIndicator.className = 'turn-indicator waiting-turn';
     }
 
+    // Offer to lock in the fleet once every tank is down
+    const confirmButton = document.getElementById('confirmPlacementButton') as HTMLButtonElement | null;
+    if (confirmButton) {
+      const me = this.gameState.players.find(p => p.id === this.playerId);
+      confirmButton.style.display = this.gamePhase === 'placement' && me?.tanksRemaining === 0 && !me.ready ? 'inline-block' : 'none';
+    }
+
+    // Offer to concede once the opponent is sure to win within the game's concedeWithinShots
+    const concedeButton = document.getElementById('concedeButton') as HTMLButtonElement | null;
+    if (concedeButton) {
+      const offer = this.gameState.concedeOffer;
+      concedeButton.style.display = this.gamePhase === 'battle' && typeof offer === 'number' ? 'inline-block' : 'none';
+      concedeButton.textContent = `Concede (lost in ${offer} shot${offer === 1 ? '' : 's'})`;
+    }
+
+    // Offer special shots only in games that have them, with how many are left
+    const abilitySelect = document.getElementById('abilitySelect') as HTMLSelectElement | null;
+    const abilities = this.gameState.myAbilities;
+    if (abilitySelect) {
+      const anyConfigured = abilities && Object.values(abilities).some(count => count > 0);
+      abilitySelect.style.display = this.gamePhase === 'battle' && this.isMyTurn && anyConfigured ? 'inline-block' : 'none';
+      Array.from(abilitySelect.options).forEach(option => {
+        if (!option.value) return;
+        const left = abilities?.[option.value.split(':')[0]] ?? 0;
+        option.disabled = left === 0;
+        option.textContent = `${option.textContent!.replace(/ \(\d+ left\)$/, '')} (${left} left)`;
+      });
+    }
+
     // Update action mode button
     const actionButton = document.getElementById('actionModeButton') as HTMLButtonElement;
     if (actionButton) {
@@ -804,6 +1358,7 @@ class FogOfTankClient {
   }
 
   showError(message: string): void {
+    this.diagnostics?.record('error', { message });
     const activeMenus = ['createRoomMessages', 'joinRoomMessages', 'browseGamesMessages'];
     for (const menuId of activeMenus) {
       const element = document.getElementById(menuId) as HTMLElement;
@@ -855,7 +1410,7 @@ class FogOfTankClient {
     });
   }
 
-  private displayGamesList(games: GameInfo[]): void {
+  private displayGamesList(games: GameInfo[], total?: number): void {
     const gamesList = document.getElementById('gamesList') as HTMLElement;
     if (!games || games.length === 0) {
       gamesList.innerHTML = '<div style="padding: 20px; text-align: center; color: #ccc;">No games available</div>';
@@ -871,22 +1426,32 @@ class FogOfTankClient {
         </div>
         <div style="margin-top: 5px; color: #ccc; font-size: 0.9em;">
           Status: ${game.phase === 'waiting' ? 'Waiting for players' :
+        game.phase === 'setup' ? 'Agreeing on settings' :
         game.phase === 'placement' ? 'Placing tanks' :
           game.phase === 'battle' ? 'In battle' : 'Game over'}
         </div>
       </div>
-    `).join('');
+    `).join('') + (total !== undefined && total > games.length
+      ? `<div style="padding: 10px; text-align: center; color: #ccc;">Showing ${games.length} of ${total} games</div>`
+      : '');
   }
 
   // WebSocket communication
   sendMessage(message: Record<string, any>): void {
     if (this.ws && this.ws.readyState === WebSocket.OPEN) {
-      this.ws.send(JSON.stringify(message));
+      // Every frame gets a fresh nonce; the server drops any frame it has seen before
+      const frame = { ...message, nonce: randomId() };
+      this.diagnostics?.record('sent', frame);
+      this.ws.send(JSON.stringify(frame));
     } else {
       this.showError('Connection lost. Please refresh the page.');
     }
   }
 
+  public requestGameState(): void {
+    this.sendMessage({ type: 'getGameState', ifNoneMatch: this.gameState?.stateHash });
+  }
+
   private requestServerStats(): void {
     this.sendMessage({ type: 'getServerStats' });
   }
@@ -973,6 +1538,8 @@ window.addEventListener('load', () => {
   (window as any).createRoom = () => {
     const playerNameElement = document.getElementById('playerNameCreate') as HTMLInputElement;
     const customRoomIdElement = document.getElementById('customRoomId') as HTMLInputElement;
+    const boardSizeElement = document.getElementById('boardSizeCreate') as HTMLInputElement;
+    const tanksElement = document.getElementById('tanksCreate') as HTMLInputElement;
     const playerName = playerNameElement.value.trim();
     const customRoomId = customRoomIdElement.value.trim();
 
@@ -981,9 +1548,15 @@ window.addEventListener('load', () => {
       return;
     }
 
+    // Blank fields keep the server's defaults
+    const config: Partial<GameConfig> = {};
+    if (boardSizeElement.value) config.boardSize = parseInt(boardSizeElement.value);
+    if (tanksElement.value) config.tanksPerPlayer = parseInt(tanksElement.value);
+
     game.sendMessage({
       type: 'createRoom',
-      customRoomId: customRoomId || undefined
+      customRoomId: customRoomId || undefined,
+      config
     });
   };
 
@@ -1014,11 +1587,53 @@ window.addEventListener('load', () => {
     if (!playerName) return;
 
     game.sendMessage({
-      type: 'join',
+      type: 'quickMatch',
       playerName: playerName
     });
   };
 
+  (window as any).playAi = () => {
+    const playerName = prompt('Enter your name:');
+    if (!playerName) return;
+    const choice = prompt('Difficulty (easy, medium, hard), or the name of a bot on this server:', 'medium')?.trim();
+    if (!choice) return;
+
+    // Anything but a difficulty names a bot (see bot.cts on the server)
+    if (!['easy', 'medium', 'hard'].includes(choice.toLowerCase())) {
+      game.sendMessage({ type: 'playBot', playerName: playerName, bot: choice });
+      return;
+    }
+    game.sendMessage({
+      type: 'playAi',
+      playerName: playerName,
+      difficulty: choice.toLowerCase()
+    });
+  };
+
+  (window as any).confirmPlacement = () => {
+    game.sendMessage({ type: 'confirmPlacement', moveId: randomId() });
+  };
+
+  (window as any).concede = () => {
+    game.sendMessage({ type: 'concede', moveId: randomId() });
+  };
+
+  (window as any).saveGame = () => {
+    game.sendMessage({ type: 'saveGame' });
+  };
+
+  (window as any).resumeGame = () => {
+    const gameId = prompt('Enter the ID of the saved game:')?.trim().toUpperCase();
+    if (!gameId) return;
+
+    const resumeToken = localStorage.getItem(`tanks.resume.${gameId}`);
+    if (!resumeToken) {
+      game.showError('This browser did not play that game');
+      return;
+    }
+    game.sendMessage({ type: 'resumeGame', gameId, resumeToken });
+  };
+
   (window as any).leaveGame = () => {
     if (confirm('Are you sure you want to leave the game?')) {
       game.sendMessage({ type: 'leaveGame' });
@@ -1029,7 +1644,19 @@ window.addEventListener('load', () => {
     game.sendChat();
   };
 
+  (window as any).exportSnapshot = () => {
+    game.exportSnapshot();
+  };
+
+  (window as any).downloadDiagnostics = () => {
+    game.downloadDiagnostics();
+  };
+
   document.addEventListener('keydown', (e: KeyboardEvent) => {
+    if ((e.key === 'r' || e.key === 'R') && !(e.target instanceof HTMLInputElement)) {
+      game.togglePlacementOrientation();
+      return;
+    }
     if (e.key === 'Escape') {
       if (game.getActionState() === 'move') {
         game.resetSelection();
@@ -1049,7 +1676,7 @@ window.addEventListener('load', () => {
 // Handle page visibility change
 document.addEventListener('visibilitychange', () => {
   if (!document.hidden && game && game.getGameID()) {
-    game.sendMessage({ type: 'getGameState' });
+    game.requestGameState();
   }
 });
 